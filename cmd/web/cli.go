@@ -0,0 +1,222 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/GitEagleY/BookingsWebApp/internal/config"
+	"github.com/GitEagleY/BookingsWebApp/internal/driver"
+	"github.com/GitEagleY/BookingsWebApp/internal/forms"
+	"github.com/GitEagleY/BookingsWebApp/internal/logging"
+	"github.com/GitEagleY/BookingsWebApp/internal/metrics"
+	"github.com/GitEagleY/BookingsWebApp/internal/models"
+	"github.com/GitEagleY/BookingsWebApp/internal/repository"
+	"github.com/GitEagleY/BookingsWebApp/internal/repository/dbrepo"
+)
+
+// commands are the subcommands of the binary, e.g. ./bookings user create -h. They take the same settings as
+// the server, from flags, BOOKINGS_* variables and the config file. Without a command the server is started.
+var commands = map[string]func(args []string) error{
+	"serve":   runServe,
+	"migrate": runMigrate,
+	"user": subcommands("user", map[string]func(args []string) error{
+		"create":  runUserCreate,
+		"passwd":  runUserPasswd,
+		"disable": runUserDisable,
+	}),
+	"room": subcommands("room", map[string]func(args []string) error{
+		"list":   runRoomList,
+		"create": runRoomCreate,
+	}),
+	"reservation": subcommands("reservation", map[string]func(args []string) error{
+		"list":   runReservationList,
+		"show":   runReservationShow,
+		"cancel": runReservationCancel,
+	}),
+	"block": subcommands("block", map[string]func(args []string) error{
+		"add":    runBlockAdd,
+		"remove": runBlockRemove,
+	}),
+	"mail": subcommands("mail", map[string]func(args []string) error{
+		"test": runMailTest,
+	}),
+	"export": runExport,
+	"import": runImport,
+}
+
+// commandNames returns the names of the commands, sorted.
+func commandNames(cmds map[string]func(args []string) error) string {
+	names := make([]string, 0, len(cmds))
+	for name := range cmds {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// subcommands returns a command running one of subs, chosen by its first argument, e.g. create in user create.
+func subcommands(name string, subs map[string]func(args []string) error) func(args []string) error {
+	return func(args []string) error {
+		if len(args) == 0 {
+			return fmt.Errorf("usage: bookings %s <command>, one of %s", name, commandNames(subs))
+		}
+		sub, ok := subs[args[0]]
+		if !ok {
+			return fmt.Errorf("unknown command %s %s, use one of %s", name, args[0], commandNames(subs))
+		}
+		return sub(args[1:])
+	}
+}
+
+// commandFlags returns the flag set of a command, e.g. user create, to which the settings are added.
+func commandFlags(name, usage string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: bookings %s\n", usage)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// loadCommand reads the settings and the flags of a command from args, and sets up the application the way the
+// server does, logging to stderr.
+func loadCommand(fs *flag.FlagSet, args []string) (config.Settings, error) {
+	settings, err := config.Parse(fs, args, os.LookupEnv)
+	if err != nil {
+		return settings, err
+	}
+
+	// the level was checked with the settings
+	level, _ := logging.ParseLevel(settings.Log.Level)
+	app.Logger = logging.New(os.Stderr, settings.Log.Format, level)
+	app.QueryTimeout = settings.DB.QueryTimeout
+	app.Currency = strings.ToLower(settings.Currency)
+	app.SiteURL = strings.TrimSuffix(settings.SiteURL, "/")
+	app.Payments = newPayments(settings.Payments)
+	app.SMTP = settings.SMTP
+	app.Features = settings.Features
+	app.Metrics = metrics.NewRegistry()
+	return settings, nil
+}
+
+// connect is loadCommand, then opens the database of the settings and returns the repository over it. The
+// database is closed with db.SQL.Close.
+func connect(fs *flag.FlagSet, args []string) (repository.DatabaseRepo, *driver.DB, error) {
+	settings, err := loadCommand(fs, args)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	db, err := driver.ConnectSQL(settings.DB.DSN())
+	if err != nil {
+		return nil, nil, fmt.Errorf("cannot connect to database: %w", err)
+	}
+	return dbrepo.NewPostgresRepo(db.SQL, &app), db, nil
+}
+
+// checkWaitlistLinks fails a command that frees nights when it couldn't email the waitlist their booking links,
+// before anything is changed.
+func checkWaitlistLinks() error {
+	if app.Features.Waitlist && app.SiteURL == "" {
+		return errors.New("site_url is needed for the booking links emailed to the waitlist, or turn the waitlist off with -waitlist=false")
+	}
+	return nil
+}
+
+// startMail sends the emails queued by a command in the background. The returned func waits for them to be
+// sent.
+func startMail() func() error {
+	app.MailChan = make(chan models.MailData, mailQueueSize)
+	m := newMailer()
+	_ = m.Start()
+
+	return func() error {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+		return m.Stop(ctx)
+	}
+}
+
+// commandContext returns the context of a command's queries, cancelled by Ctrl-C.
+func commandContext() (context.Context, context.CancelFunc) {
+	return signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+}
+
+// oneArg returns the only argument left after the flags of fs, e.g. the email of user passwd.
+func oneArg(fs *flag.FlagSet, what string) (string, error) {
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return "", fmt.Errorf("expected the %s after the flags", what)
+	}
+	return fs.Arg(0), nil
+}
+
+// idArg returns the only argument left after the flags of fs as an id, e.g. of the reservation to show.
+func idArg(fs *flag.FlagSet, what string) (int, error) {
+	arg, err := oneArg(fs, what+" id")
+	if err != nil {
+		return 0, err
+	}
+	id, err := strconv.Atoi(arg)
+	if err != nil || id <= 0 {
+		return 0, fmt.Errorf("invalid %s id %q", what, arg)
+	}
+	return id, nil
+}
+
+// parseDate parses a date given on the command line, naming the flag in the error.
+func parseDate(name, value string) (time.Time, error) {
+	t, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return t, fmt.Errorf("invalid -%s date %q, use yyyy-mm-dd", name, value)
+	}
+	return t, nil
+}
+
+// table returns a writer of aligned columns on stdout, starting with the tab separated header.
+func table(header string) *tabwriter.Writer {
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, header)
+	return tw
+}
+
+// readPassword asks for a new password twice on out and reads the answers from in, one a line. The password is
+// checked with forms.CheckPassword.
+func readPassword(in *bufio.Reader, out io.Writer) (string, error) {
+	read := func(prompt string) (string, error) {
+		fmt.Fprint(out, prompt)
+		line, err := in.ReadString('\n')
+		if err != nil && !(errors.Is(err, io.EOF) && line != "") {
+			return "", fmt.Errorf("can't read the password: %w", err)
+		}
+		return strings.TrimRight(line, "\r\n"), nil
+	}
+
+	password, err := read("Password: ")
+	if err != nil {
+		return "", err
+	}
+	if err := forms.CheckPassword(password); err != nil {
+		return "", err
+	}
+	again, err := read("Repeat password: ")
+	if err != nil {
+		return "", err
+	}
+	if again != password {
+		return "", errors.New("the passwords don't match")
+	}
+	return password, nil
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestSubcommands(t *testing.T) {
+	var got []string
+	run := subcommands("user", map[string]func(args []string) error{
+		"create": func(args []string) error {
+			got = args
+			return nil
+		},
+	})
+
+	if err := run([]string{"create", "-email=a@b.com"}); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0] != "-email=a@b.com" {
+		t.Errorf("expected the arguments after the subcommand, got %v", got)
+	}
+
+	if err := run(nil); err == nil || !strings.Contains(err.Error(), "create") {
+		t.Errorf("expected the subcommands listed without one, got %v", err)
+	}
+	if err := run([]string{"delete"}); err == nil {
+		t.Error("expected an error for an unknown subcommand")
+	}
+}
+
+func TestIDArg(t *testing.T) {
+	tests := []struct {
+		args  []string
+		valid bool
+	}{
+		{[]string{"12"}, true},
+		{[]string{}, false},
+		{[]string{"12", "13"}, false},
+		{[]string{"twelve"}, false},
+		{[]string{"-1"}, false},
+	}
+
+	for _, e := range tests {
+		fs := flag.NewFlagSet("test", flag.ContinueOnError)
+		fs.SetOutput(io.Discard)
+		fs.Parse(append([]string{"--"}, e.args...))
+
+		id, err := idArg(fs, "reservation")
+		if e.valid && (err != nil || id != 12) {
+			t.Errorf("%v: expected id 12, got %d, %v", e.args, id, err)
+		}
+		if !e.valid && err == nil {
+			t.Errorf("%v: expected an error", e.args)
+		}
+	}
+}
+
+func TestReadPassword(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		valid bool
+	}{
+		{"match", "Lower4ndUpper\nLower4ndUpper\n", true},
+		{"no final newline", "Lower4ndUpper\nLower4ndUpper", true},
+		{"windows line ends", "Lower4ndUpper\r\nLower4ndUpper\r\n", true},
+		{"mismatch", "Lower4ndUpper\nLower4ndUpper!\n", false},
+		{"weak", "password\npassword\n", false},
+		{"no input", "", false},
+	}
+
+	for _, e := range tests {
+		var prompts strings.Builder
+		password, err := readPassword(bufio.NewReader(strings.NewReader(e.input)), &prompts)
+		if e.valid && (err != nil || password != "Lower4ndUpper") {
+			t.Errorf("%s: expected the password, got %q, %v", e.name, password, err)
+		}
+		if !e.valid && err == nil {
+			t.Errorf("%s: expected an error", e.name)
+		}
+		if !strings.HasPrefix(prompts.String(), "Password: ") {
+			t.Errorf("%s: expected a prompt, got %q", e.name, prompts.String())
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"io"
+	"os"
+
+	"github.com/GitEagleY/BookingsWebApp/internal/export"
+	"github.com/GitEagleY/BookingsWebApp/internal/models"
+)
+
+// runExport writes the same reservations export as /admin/reservations/export to a file or stdout,
+// so it can be run from cron, e.g.
+//
+//	./bookings export -config=bookings.yaml -format=xlsx -from=2050-01-01 -to=2050-01-31 -out=jan.xlsx
+func runExport(args []string) error {
+	fs := commandFlags("export", "export [flags]")
+	format := fs.String("format", "csv", "Export format (csv, xlsx)")
+	out := fs.String("out", "", "Output file, defaults to stdout")
+	query := fs.String("q", "", "Search name, email and phone")
+	roomID := fs.Int("room", 0, "Only this room id")
+	from := fs.String("from", "", "Stays ending on or after this date (yyyy-mm-dd)")
+	to := fs.String("to", "", "Stays starting on or before this date (yyyy-mm-dd)")
+	status := fs.String("status", "", "Reservation status (new, processed)")
+	sortBy := fs.String("sort", "start_date", "Sort column")
+	desc := fs.Bool("desc", false, "Sort descending")
+
+	repo, db, err := connect(fs, args)
+	if err != nil {
+		return err
+	}
+	defer db.SQL.Close()
+
+	f := models.ReservationFilter{
+		Query:    *query,
+		RoomID:   *roomID,
+		Status:   *status,
+		SortBy:   *sortBy,
+		SortDesc: *desc,
+	}
+
+	if *from != "" {
+		f.From, err = parseDate("from", *from)
+		if err != nil {
+			return err
+		}
+	}
+	if *to != "" {
+		f.To, err = parseDate("to", *to)
+		if err != nil {
+			return err
+		}
+	}
+
+	var w io.Writer = os.Stdout
+	if *out != "" {
+		file, err := os.Create(*out)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		w = file
+	}
+
+	ew, err := export.NewWriter(*format, w)
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := commandContext()
+	defer stop()
+
+	err = repo.StreamReservations(ctx, f, ew.Write)
+	if err != nil {
+		return err
+	}
+	return ew.Close()
+}
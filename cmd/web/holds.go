@@ -0,0 +1,26 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/GitEagleY/BookingsWebApp/internal/repository"
+)
+
+// holdSweepInterval is how often expired room holds are removed.
+const holdSweepInterval = time.Minute
+
+// newHoldSweeper returns the sweeper deleting room holds that were never turned into reservations.
+func newHoldSweeper(db repository.DatabaseRepo) *sweeper {
+	return newSweeper("expired hold sweeper", holdSweepInterval, func(ctx context.Context) error {
+		removed, err := db.DeleteExpiredHolds(ctx)
+		if err != nil {
+			return err
+		}
+		app.Metrics.Counter("bookings_holds_expired_total", "Room holds removed after expiring.").Add(float64(removed))
+		if removed > 0 {
+			app.Logger.Info("removed expired room holds", "count", removed)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/GitEagleY/BookingsWebApp/internal/importer"
+)
+
+// runImport imports reservations from a CSV file, the command line version of /admin/import, e.g.
+//
+//	./bookings import -config=bookings.yaml -file=old-bookings.csv -map="first_name=Guest,room=Unit" -dry-run
+//
+// Every row with an error is listed; the valid rows are inserted in one transaction unless -dry-run is set.
+func runImport(args []string) error {
+	fs := commandFlags("import", "import [flags]")
+	file := fs.String("file", "", "CSV file to import")
+	mapFlag := fs.String("map", "", "Column mapping as field=Header pairs, fields: "+strings.Join(importer.Fields, ", "))
+	dryRun := fs.Bool("dry-run", false, "Only validate the file")
+
+	repo, db, err := connect(fs, args)
+	if err != nil {
+		return err
+	}
+	defer db.SQL.Close()
+
+	if *file == "" {
+		return errors.New("missing required flag file")
+	}
+
+	mapping, err := importer.ParseMapping(*mapFlag)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Open(*file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	ctx, stop := commandContext()
+	defer stop()
+
+	report, err := importer.Validate(ctx, f, mapping, repo)
+	if err != nil {
+		return err
+	}
+
+	for _, row := range report.Rows {
+		if !row.Valid() {
+			fmt.Printf("line %d: %s\n", row.Line, strings.Join(row.Errors, "; "))
+		}
+	}
+	fmt.Printf("%d valid rows, %d rows with errors\n", report.Valid, report.Invalid)
+
+	if *dryRun || report.Valid == 0 {
+		return nil
+	}
+
+	reservations := report.Reservations()
+	for i := range reservations {
+		reservations[i].Currency = app.Currency
+	}
+
+	n, err := repo.ImportReservations(ctx, reservations)
+	if err != nil {
+		return fmt.Errorf("nothing was imported: %w", err)
+	}
+	fmt.Printf("imported %d reservations\n", n)
+	return nil
+}
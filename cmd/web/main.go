@@ -1,135 +1,289 @@
 package main
 
 import (
+	"context"
+	"database/sql"
 	"encoding/gob"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
+	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 	"time"
 
 	render "github.com/GitEagleY/BookingsWebApp/internal/Render"
 	"github.com/GitEagleY/BookingsWebApp/internal/config"
 	"github.com/GitEagleY/BookingsWebApp/internal/driver"
+	"github.com/GitEagleY/BookingsWebApp/internal/health"
 	"github.com/GitEagleY/BookingsWebApp/internal/helpers"
+	"github.com/GitEagleY/BookingsWebApp/internal/lifecycle"
+	"github.com/GitEagleY/BookingsWebApp/internal/logging"
+	"github.com/GitEagleY/BookingsWebApp/internal/metrics"
+	"github.com/GitEagleY/BookingsWebApp/internal/migrate"
 	"github.com/GitEagleY/BookingsWebApp/internal/models"
+	"github.com/GitEagleY/BookingsWebApp/internal/payments"
+	"github.com/GitEagleY/BookingsWebApp/internal/sessionstore"
+	"github.com/GitEagleY/BookingsWebApp/migrations"
 	"github.com/alexedwards/scs/v2"
 
 	handlers "github.com/GitEagleY/BookingsWebApp/internal/Handlers"
 )
 
-const portNumber = ":8080"
-
 var app config.AppConfig
 var session *scs.SessionManager
-var infoLog *log.Logger
-var errorLog *log.Logger
 
 // main is the main function
 func main() {
 
-	db, err := run()
+	command, args := runServe, os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		c, ok := commands[args[0]]
+		if !ok {
+			log.Fatalf("unknown command %s, use one of %s", args[0], commandNames(commands))
+		}
+		command, args = c, args[1:]
+	}
+
+	err := command(args)
 	if err != nil {
 		log.Fatal(err)
 	}
-	defer db.SQL.Close()
+}
+
+// runServe starts the web server, the command run when none is given, e.g.
+//
+//	./bookings serve -config=bookings.yaml
+func runServe(args []string) error {
+	settings, err := config.Load(args, os.LookupEnv)
+	if errors.Is(err, flag.ErrHelp) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
 
-	defer close(app.MailChan)
-	fmt.Println("Starting mail listener")
-	listenForMail()
+	return serve(settings)
+}
 
-	fmt.Println(fmt.Sprintf("Staring application on port %s", portNumber))
+// serve runs the application until it is interrupted or sent SIGTERM, then stops taking requests, finishes
+// the ones in progress, sends the queued emails and closes the database, within the shutdown timeout.
+func serve(settings config.Settings) error {
+	db, err := run(settings)
+	if err != nil {
+		return err
+	}
 
-	fmt.Println("admin user: email=admin@email.com password=admin")
+	mailer := newMailer()
+	app.ReadyChecks = []health.Check{
+		{Name: "database", Run: db.SQL.PingContext},
+		{Name: "templates", Run: func(ctx context.Context) error {
+			if len(app.TemplateCache) == 0 {
+				return errors.New("no templates loaded")
+			}
+			return nil
+		}},
+		{Name: "mail", Run: mailer.alive},
+	}
+	registerGauges(db)
+
+	g := &lifecycle.Group{Logger: app.Logger}
+	g.Add(lifecycle.Func("database", nil, func(ctx context.Context) error {
+		return db.SQL.Close()
+	}))
+	g.Add(mailer)
+	g.Add(newHoldSweeper(handlers.Repo.DB))
+	if store, ok := session.Store.(sessionstore.Sweeper); ok {
+		g.Add(newSessionSweeper(store))
+	}
 	srv := &http.Server{
-		Addr:    portNumber,
+		Addr:    settings.Addr,
 		Handler: routes(&app),
 	}
+	if settings.TLS.Enabled() {
+		cfg, redirect, err := newTLSConfig(settings.TLS, settings.Addr)
+		if err != nil {
+			return errors.Join(err, db.SQL.Close())
+		}
+		srv.TLSConfig = cfg
+		if settings.TLS.HTTPAddr != "" {
+			g.Add(&webServer{
+				name: "http redirect server",
+				srv: &http.Server{
+					Addr:              settings.TLS.HTTPAddr,
+					Handler:           redirect,
+					ReadHeaderTimeout: 10 * time.Second,
+				},
+				group: g,
+			})
+		}
+	}
+	g.Add(&webServer{srv: srv, group: g})
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-	err = srv.ListenAndServe()
+	startCtx, cancel := context.WithTimeout(context.Background(), settings.ShutdownTimeout)
+	err = g.Start(startCtx)
+	cancel()
 	if err != nil {
-		log.Fatal(err)
+		return err
+	}
+
+	app.Logger.Info("application started", "addr", settings.Addr, "tls", settings.TLS.Enabled())
+
+	err = g.Wait(ctx)
+	// a second signal kills the application without waiting
+	stop()
+	app.Logger.Info("shutting down")
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), settings.ShutdownTimeout)
+	defer cancel()
+	return errors.Join(err, g.Stop(shutdownCtx))
+}
+
+// newPayments returns the payment provider of the settings, which were checked when they were loaded.
+func newPayments(settings config.PaymentSettings) payments.PaymentProvider {
+	if settings.Provider == "stripe" {
+		return payments.NewStripe(settings.Key, settings.WebhookSecret)
 	}
+	return payments.NewFake(settings.WebhookSecret)
 }
 
-func run() (*driver.DB, error) {
+// registerGauges adds the gauges read when the metrics are scraped.
+func registerGauges(db *driver.DB) {
+	stats := func(f func(s sql.DBStats) float64) func() float64 {
+		return func() float64 { return f(db.SQL.Stats()) }
+	}
+	app.Metrics.GaugeFunc("bookings_db_open_connections", "Open database connections.",
+		stats(func(s sql.DBStats) float64 { return float64(s.OpenConnections) }))
+	app.Metrics.GaugeFunc("bookings_db_in_use_connections", "Database connections in use.",
+		stats(func(s sql.DBStats) float64 { return float64(s.InUse) }))
+	app.Metrics.GaugeFunc("bookings_db_idle_connections", "Idle database connections.",
+		stats(func(s sql.DBStats) float64 { return float64(s.Idle) }))
+	app.Metrics.GaugeFunc("bookings_db_max_open_connections", "Most database connections allowed.",
+		stats(func(s sql.DBStats) float64 { return float64(s.MaxOpenConnections) }))
+	app.Metrics.GaugeFunc("bookings_db_wait_count", "Times a query waited for a database connection.",
+		stats(func(s sql.DBStats) float64 { return float64(s.WaitCount) }))
+	app.Metrics.GaugeFunc("bookings_db_wait_duration_seconds", "Time spent waiting for database connections.",
+		stats(func(s sql.DBStats) float64 { return s.WaitDuration.Seconds() }))
+	app.Metrics.GaugeFunc("bookings_mail_queue_length", "Emails waiting to be sent.",
+		func() float64 { return float64(len(app.MailChan)) })
+}
+
+// run sets up the application from the settings and connects to the database.
+func run(settings config.Settings) (*driver.DB, error) {
 	gob.Register(models.Reservation{})
 	gob.Register(models.User{})
 	gob.Register(models.User{})
 	gob.Register(models.Restriction{})
 	gob.Register(map[string]int{})
-	mailChan := make(chan models.MailData)
-	app.MailChan = mailChan
-
-	inProduction := flag.Bool("production", true, "Application is in production")
-	useCache := *flag.Bool("cache", true, "Use template cache")
-	dbHost := flag.String("dbhost", "localhost", "Database host")
-	dbName := flag.String("dbname", "", "Database name")
-	dbUser := flag.String("dbuser", "", "Database user")
-	dbPass := flag.String("dbpass", "", "Database password")
-	dbPort := flag.String("dbport", "", "Database port")
-	dbSSL := flag.String("dbssl", "disable", "Database ssl settings( disable, prefer, require)")
-
-	flag.Parse()
-
-	// Check if any flags are provided
-	if flag.NFlag() == 0 {
-		fmt.Println("\nNo flags provided. Example usage:")
-		fmt.Printf("./webappname -production=false -cache=false -dbname=mydb -dbuser=user -dbpass=pass -dbport=8080 -dbssl=require\n")
-		os.Exit(1)
-	}
-	if *dbName == "" || *dbUser == "" {
-		fmt.Println("Missing required flags dbName and dbUser")
-		os.Exit(1)
-	} else {
-		fmt.Println("Application Configuration:")
-		fmt.Printf("Production Mode: %v\n", *inProduction)
-		fmt.Printf("Use Cache: %t\n", useCache)
-		fmt.Printf("Database Host: %s\n", *dbHost)
-		fmt.Printf("Database Name: %s\n", *dbName)
-		fmt.Printf("Database User: %s\n", *dbUser)
-		fmt.Printf("Database Port: %s\n", *dbPort)
-		fmt.Printf("Database SSL Settings: %s\n", *dbSSL)
-	}
-
-	// change this to true when in production
-	app.InProduction = *inProduction
-
-	infoLog = log.New(os.Stdout, "INFO:\t", log.Ldate|log.Ltime)
-	app.InfoLog = infoLog
-
-	errorLog = log.New(os.Stdout, "-----------------ERROR:---------------------\t", log.Ldate|log.Ltime|log.Lshortfile)
-	app.ErrorLog = errorLog
+	app.MailChan = make(chan models.MailData, mailQueueSize)
+
+	err := settings.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	loc, err := time.LoadLocation(settings.Timezone)
+	if err != nil {
+		return nil, err
+	}
+	time.Local = loc
+
+	app.InProduction = settings.Production
+	app.QueryTimeout = settings.DB.QueryTimeout
+	app.AdminIdleTimeout = settings.Session.AdminIdleTimeout
+	app.TrustedProxies = settings.TrustedProxies
+	app.RedirectHTTPS = settings.RedirectHTTPS
+
+	// the level was checked with the settings
+	level, _ := logging.ParseLevel(settings.Log.Level)
+	app.Logger = logging.New(os.Stdout, settings.Log.Format, level)
+	// the standard logger, used by some libraries, writes through it too
+	slog.SetDefault(app.Logger)
+	app.Logger.Info("configuration", "settings", settings)
+
+	// set up payments
+	app.Payments = newPayments(settings.Payments)
+	if settings.Payments.Provider == "fake" && app.InProduction && settings.Payments.DepositPercent > 0 {
+		app.Logger.Warn("deposits are taken with the fake payment provider, no money is charged")
+	}
+	app.PaymentsPublicKey = settings.Payments.PublicKey
+	app.DepositPercent = settings.Payments.DepositPercent
+	app.Currency = strings.ToLower(settings.Currency)
+	app.SiteURL = strings.TrimSuffix(settings.SiteURL, "/")
+
+	app.SMTP = settings.SMTP
+	app.Features = settings.Features
+	app.Metrics = metrics.NewRegistry()
+	app.MetricsAccess = settings.Metrics
+
+	// connect to database
+	app.Logger.Info("connecting to database", "host", settings.DB.Host, "name", settings.DB.Name)
+	db, err := driver.ConnectSQL(settings.DB.DSN())
+	if err != nil {
+		return nil, fmt.Errorf("cannot connect to database: %w", err)
+	}
+	app.Logger.Info("connected to database")
+
+	if settings.DB.Migrate {
+		m, err := migrate.New(db.SQL, migrations.FS, app.Logger)
+		if err == nil {
+			_, err = m.Up(context.Background())
+		}
+		if err != nil {
+			db.SQL.Close()
+			return nil, fmt.Errorf("cannot migrate the database: %w", err)
+		}
+	}
 
 	// set up the session
+	store, err := newSessionStore(settings.Session, db.SQL)
+	if err != nil {
+		db.SQL.Close()
+		return nil, err
+	}
 	session = scs.New()
-	session.Lifetime = 24 * time.Hour
+	session.Store = store
+	session.Lifetime = settings.Session.Lifetime
+	session.IdleTimeout = settings.Session.IdleTimeout
+	session.Cookie.Name = settings.Session.CookieName
 	session.Cookie.Persist = true
 	session.Cookie.SameSite = http.SameSiteLaxMode
-	session.Cookie.Secure = app.InProduction
+	session.Cookie.Secure = app.InProduction || settings.TLS.Enabled()
 	app.Session = session
 
-	// connect to database
-	log.Println("connection to database...")
-	connectString := fmt.Sprintf("host=%s port=%s dbname=%s user=%s password=%s sslmode=%s", *dbHost, *dbPort, *dbName, *dbUser, *dbPass, *dbSSL)
-	db, err := driver.ConnectSQL(connectString)
-	if err != nil {
-		log.Fatal("Cannot connect to database!")
-	}
-	log.Println("connected")
-	//defer db.SQL.Close()
-
 	//create template cache
 	tc, err := render.CreateTemplateCache()
 	if err != nil {
-		log.Fatal("cannot create template cache")
-		return nil, err
+		db.SQL.Close()
+		return nil, fmt.Errorf("cannot create template cache: %w", err)
 	}
 	app.TemplateCache = tc
-	app.UseCache = *&useCache
+	app.UseCache = settings.UseCache
 
 	repo := handlers.NewRepo(&app, db)
+
+	// the time zone entered on the setup page is the property's and takes over from the setting
+	property, err := repo.DB.GetProperty(context.Background())
+	switch {
+	case err == nil:
+		loc, err := time.LoadLocation(property.Timezone)
+		if err != nil {
+			db.SQL.Close()
+			return nil, fmt.Errorf("cannot load the time zone of the property: %w", err)
+		}
+		time.Local = loc
+		app.Logger.Info("serving property", "name", property.Name, "timezone", property.Timezone)
+	case !errors.Is(err, sql.ErrNoRows):
+		db.SQL.Close()
+		return nil, fmt.Errorf("cannot load the property: %w", err)
+	}
 	handlers.NewHandlers(repo)
 	render.NewRenderer(&app)
 	helpers.NewHelpers(&app)
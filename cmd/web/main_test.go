@@ -1,10 +1,15 @@
 package main
 
-import "testing"
+import (
+	"testing"
+
+	"github.com/GitEagleY/BookingsWebApp/internal/config"
+)
 
 func TestRun(t *testing.T) {
-	_, err := run()
-	if err != nil {
-		t.Error("failed run")
+	// without a database name and user the settings are refused before connecting
+	_, err := run(config.Defaults())
+	if err == nil {
+		t.Error("expected run to fail without a database")
 	}
 }
@@ -1,9 +1,24 @@
 package main
 
 import (
+	"context"
+	"crypto/subtle"
+	"log/slog"
+	"net"
 	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
 
+	handlers "github.com/GitEagleY/BookingsWebApp/internal/Handlers"
+	"github.com/GitEagleY/BookingsWebApp/internal/config"
+	"github.com/GitEagleY/BookingsWebApp/internal/csp"
 	"github.com/GitEagleY/BookingsWebApp/internal/helpers"
+	"github.com/GitEagleY/BookingsWebApp/internal/logging"
+	"github.com/GitEagleY/BookingsWebApp/internal/metrics"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
 	"github.com/justinas/nosurf"
 )
 
@@ -20,6 +35,9 @@ func NoSurf(next http.Handler) http.Handler {
 		SameSite: http.SameSiteLaxMode, // Set the SameSite attribute to Lax mode for better cross-site request protection.
 	})
 
+	// The payment provider signs its webhooks instead.
+	csrfHandler.ExemptPath("/payments/webhook")
+
 	return csrfHandler
 }
 
@@ -28,6 +46,27 @@ func SessionLoad(next http.Handler) http.Handler {
 	return session.LoadAndSave(next)
 }
 
+// StaffIdle signs staff out after app.AdminIdleTimeout without a request, sooner than sessions expire for
+// guests. The rest of the session, such as a reservation being made, is kept.
+func StaffIdle(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		if session.Exists(ctx, "user_id") {
+			last := session.GetInt64(ctx, "last_active")
+			now := time.Now()
+			if last != 0 && now.Sub(time.Unix(last, 0)) > app.AdminIdleTimeout {
+				_ = session.RenewToken(ctx)
+				session.Remove(ctx, "user_id")
+				session.Remove(ctx, "last_active")
+				session.Put(ctx, "warning", "You were signed out after a while without activity")
+			} else {
+				session.Put(ctx, "last_active", now.Unix())
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
 func Auth(next http.Handler) http.Handler {
 
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -40,3 +79,282 @@ func Auth(next http.Handler) http.Handler {
 		next.ServeHTTP(w, r)
 	})
 }
+
+// setupDone is set once the setup is done, which can't be undone, so the database isn't asked again.
+var setupDone atomic.Bool
+
+// RequireSetup sends every page to /setup until the owner account is created there. The probes, the metrics
+// and the static files are served regardless.
+func RequireSetup(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if setupDone.Load() || setupExempt(r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		done, err := handlers.Repo.DB.SetupDone(r.Context())
+		if err != nil {
+			helpers.ServerError(w, r, err)
+			return
+		}
+		if !done {
+			http.Redirect(w, r, "/setup", http.StatusSeeOther)
+			return
+		}
+		setupDone.Store(true)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// setupExempt reports whether path is served before the setup.
+func setupExempt(path string) bool {
+	return path == "/setup" || probeRoutes[path] || strings.HasPrefix(path, "/static/")
+}
+
+// httpsKey is the context key marking the requests a trusted proxy got over HTTPS.
+type httpsKey struct{}
+
+// proxiedKey is the context key marking the requests that came from a trusted proxy.
+type proxiedKey struct{}
+
+// ProxyHeaders takes the address of the client and whether it used HTTPS from the X-Forwarded-For and
+// X-Forwarded-Proto headers of the requests coming from a trusted proxy. Anyone else's are ignored, as anyone
+// can send them.
+func ProxyHeaders(next http.Handler) http.Handler {
+	// the networks were checked when the settings were loaded
+	nets, _ := config.ParseNetworks(app.TrustedProxies)
+	trusted := func(ip net.IP) bool {
+		for _, n := range nets {
+			if n.Contains(ip) {
+				return true
+			}
+		}
+		return false
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host, _, err := net.SplitHostPort(r.RemoteAddr)
+		if ip := net.ParseIP(host); err != nil || ip == nil || !trusted(ip) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// each proxy appends the address it got the request from; the client is the last one that isn't a
+		// trusted proxy, the ones before it could be made up by the client
+		forwarded := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+		for i := len(forwarded) - 1; i >= 0; i-- {
+			ip := net.ParseIP(strings.TrimSpace(forwarded[i]))
+			if ip == nil {
+				break
+			}
+			// the port of the client isn't forwarded
+			r.RemoteAddr = net.JoinHostPort(ip.String(), "0")
+			if !trusted(ip) {
+				break
+			}
+		}
+
+		// the scheme set by the nearest proxy
+		ctx := context.WithValue(r.Context(), proxiedKey{}, true)
+		protos := strings.Split(r.Header.Get("X-Forwarded-Proto"), ",")
+		if strings.EqualFold(strings.TrimSpace(protos[len(protos)-1]), "https") {
+			ctx = context.WithValue(ctx, httpsKey{}, true)
+		}
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// isHTTPS reports whether the client sent r over HTTPS, to the application or to a trusted proxy.
+func isHTTPS(r *http.Request) bool {
+	https, _ := r.Context().Value(httpsKey{}).(bool)
+	return r.TLS != nil || https
+}
+
+// RedirectHTTPS sends the requests that came over plain HTTP through a trusted proxy to HTTPS, when
+// app.RedirectHTTPS is set. The probes and the metrics, read from inside the network, are served either way.
+func RedirectHTTPS(next http.Handler) http.Handler {
+	redirect := httpsRedirect("")
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !app.RedirectHTTPS || isHTTPS(r) || probeRoutes[r.URL.Path] {
+			next.ServeHTTP(w, r)
+			return
+		}
+		redirect.ServeHTTP(w, r)
+	})
+}
+
+// SecureHeaders sets the security headers of every response. The content security policy allows the inline
+// scripts carrying the nonce of the request, which render.Template gives the templates.
+func SecureHeaders(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		nonce, err := csp.NewNonce()
+		if err != nil {
+			helpers.ServerError(w, r, err)
+			return
+		}
+
+		h := w.Header()
+		h.Set("Content-Security-Policy", csp.Policy(nonce))
+		h.Set("X-Frame-Options", "DENY") // frame-ancestors of browsers without CSP
+		h.Set("X-Content-Type-Options", "nosniff")
+		h.Set("Referrer-Policy", "strict-origin-when-cross-origin")
+		h.Set("Permissions-Policy", "camera=(), microphone=(), geolocation=(), usb=()")
+		// browsers ignore it over plain HTTP
+		if app.InProduction && isHTTPS(r) {
+			h.Set("Strict-Transport-Security", "max-age=31536000")
+		}
+
+		next.ServeHTTP(w, r.WithContext(csp.WithNonce(r.Context(), nonce)))
+	})
+}
+
+// RequestMetrics counts the requests and their durations by route pattern, e.g. /admin/guests/{id}, so the
+// ids in URLs don't make a series each.
+func RequestMetrics(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+
+		next.ServeHTTP(ww, r)
+
+		route, status := routePattern(r), responseStatus(ww)
+		app.Metrics.Counter("bookings_http_requests_total", "HTTP requests served, by route and status.", "method", "route", "status").
+			Inc(r.Method, route, strconv.Itoa(status))
+		app.Metrics.Histogram("bookings_http_request_duration_seconds", "Time taken to serve HTTP requests, by route.", metrics.DefaultBuckets, "route").
+			Observe(time.Since(start).Seconds(), route)
+	})
+}
+
+// forwardedByUnknownProxy reports whether r was forwarded by a proxy that isn't in app.TrustedProxies, so its
+// address is the proxy's and not the client's, e.g. a reverse proxy on the same host.
+func forwardedByUnknownProxy(r *http.Request) bool {
+	if proxied, _ := r.Context().Value(proxiedKey{}).(bool); proxied {
+		return false
+	}
+	for _, h := range []string{"X-Forwarded-For", "X-Real-Ip", "Forwarded"} {
+		if r.Header.Get(h) != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// MetricsAuth lets requests with the metrics token, or from the allowed networks, through. The networks are
+// ignored for requests forwarded by a proxy that isn't trusted, as they'd all come from the proxy's address.
+func MetricsAuth(next http.Handler) http.Handler {
+	// the networks were checked when the settings were loaded
+	nets, _ := app.MetricsAccess.Networks()
+	token := app.MetricsAccess.Token
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if token != "" {
+			given, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if ok && subtle.ConstantTimeCompare([]byte(given), []byte(token)) == 1 {
+				next.ServeHTTP(w, r)
+				return
+			}
+		}
+
+		host, _, err := net.SplitHostPort(r.RemoteAddr)
+		if ip := net.ParseIP(host); err == nil && ip != nil && !forwardedByUnknownProxy(r) {
+			for _, n := range nets {
+				if n.Contains(ip) {
+					next.ServeHTTP(w, r)
+					return
+				}
+			}
+		}
+
+		http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+	})
+}
+
+// routePattern returns the pattern of the route that served r, once served, or "unmatched".
+func routePattern(r *http.Request) string {
+	if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+		return rctx.RoutePattern()
+	}
+	return "unmatched"
+}
+
+// responseStatus returns the status written to ww, a handler writing nothing answers 200.
+func responseStatus(ww middleware.WrapResponseWriter) int {
+	if ww.Status() == 0 {
+		return http.StatusOK
+	}
+	return ww.Status()
+}
+
+// probeRoutes are polled by load balancers and monitoring, their requests are only logged at debug level.
+var probeRoutes = map[string]bool{"/healthz": true, "/readyz": true, "/metrics": true}
+
+type requestUserKey struct{}
+
+// RequestLogger gives each request an id, sent back in the X-Request-ID header, and a logger carrying it for the
+// handlers, then logs the request with its route, user, status and duration.
+func RequestLogger(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		id := requestID(r)
+		w.Header().Set("X-Request-ID", id)
+
+		logger := logging.FromContext(r.Context(), app.Logger).With("request_id", id)
+		userID := new(int) // set by LogUser once the session is loaded
+		ctx := logging.WithLogger(r.Context(), logger)
+		ctx = context.WithValue(ctx, requestUserKey{}, userID)
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+
+		next.ServeHTTP(ww, r.WithContext(ctx))
+
+		route, status := routePattern(r), responseStatus(ww)
+		level := slog.LevelInfo
+		switch {
+		case status >= 500:
+			level = slog.LevelWarn
+		case probeRoutes[route]:
+			level = slog.LevelDebug
+		}
+		attrs := []slog.Attr{
+			slog.String("method", r.Method),
+			slog.String("path", r.URL.Path),
+			slog.String("route", route),
+			slog.Int("status", status),
+			slog.Duration("duration", time.Since(start)),
+		}
+		if *userID != 0 {
+			attrs = append(attrs, slog.Int("user_id", *userID))
+		}
+		logger.LogAttrs(ctx, level, "request", attrs...)
+	})
+}
+
+// requestID returns the id given by a proxy in the X-Request-ID header, when it looks like one, or a new id.
+func requestID(r *http.Request) string {
+	id := r.Header.Get("X-Request-ID")
+	if id != "" && len(id) <= 64 && strings.Trim(id, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-_.") == "" {
+		return id
+	}
+	id, err := helpers.RandomToken(8)
+	if err != nil {
+		return "unknown"
+	}
+	return id
+}
+
+// LogUser adds the signed in user to the logs of the request, it runs once the session is loaded.
+func LogUser(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if id := session.GetInt(r.Context(), "user_id"); id != 0 {
+			logger := logging.FromContext(r.Context(), app.Logger).With("user_id", id)
+			r = r.WithContext(logging.WithLogger(r.Context(), logger))
+		}
+
+		next.ServeHTTP(w, r)
+
+		// read after the handler, which may have signed the user in or out
+		if userID, ok := r.Context().Value(requestUserKey{}).(*int); ok {
+			*userID = session.GetInt(r.Context(), "user_id")
+		}
+	})
+}
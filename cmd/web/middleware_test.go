@@ -1,9 +1,25 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
 	"fmt"
+	"log/slog"
 	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
+
+	handlers "github.com/GitEagleY/BookingsWebApp/internal/Handlers"
+	"github.com/GitEagleY/BookingsWebApp/internal/config"
+	"github.com/GitEagleY/BookingsWebApp/internal/csp"
+	"github.com/GitEagleY/BookingsWebApp/internal/logging"
+	"github.com/GitEagleY/BookingsWebApp/internal/metrics"
+	"github.com/GitEagleY/BookingsWebApp/internal/repository"
+	"github.com/alexedwards/scs/v2"
+	"github.com/go-chi/chi/v5"
 )
 
 func TestNosurf(t *testing.T) {
@@ -17,3 +33,411 @@ func TestNosurf(t *testing.T) {
 		t.Error(fmt.Sprintf("type is not http.Handler it = %T", v))
 	}
 }
+
+func TestMetricsAuth(t *testing.T) {
+	app.MetricsAccess = config.MetricsSettings{Token: "s3cret", Allow: "127.0.0.1,10.0.0.0/8"}
+	defer func() { app.MetricsAccess = config.MetricsSettings{} }()
+
+	h := MetricsAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		auth       string
+		forwarded  string
+		expected   int
+	}{
+		{"loopback", "127.0.0.1:5000", "", "", http.StatusOK},
+		{"allowed-network", "10.1.2.3:5000", "", "", http.StatusOK},
+		{"token", "203.0.113.9:5000", "Bearer s3cret", "", http.StatusOK},
+		{"wrong-token", "203.0.113.9:5000", "Bearer guess", "", http.StatusForbidden},
+		{"denied", "203.0.113.9:5000", "", "", http.StatusForbidden},
+		{"untrusted-proxy", "127.0.0.1:5000", "", "203.0.113.9", http.StatusForbidden},
+		{"untrusted-proxy-token", "127.0.0.1:5000", "Bearer s3cret", "203.0.113.9", http.StatusOK},
+	}
+
+	for _, e := range tests {
+		req := httptest.NewRequest("GET", "/metrics", nil)
+		req.RemoteAddr = e.remoteAddr
+		if e.auth != "" {
+			req.Header.Set("Authorization", e.auth)
+		}
+		if e.forwarded != "" {
+			req.Header.Set("X-Forwarded-For", e.forwarded)
+		}
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+
+		if rr.Code != e.expected {
+			t.Errorf("%s: expected %d, got %d", e.name, e.expected, rr.Code)
+		}
+	}
+}
+
+func TestMetricsAuthBehindProxy(t *testing.T) {
+	app.MetricsAccess = config.MetricsSettings{Allow: "10.0.0.0/8"}
+	app.TrustedProxies = "127.0.0.1"
+	defer func() {
+		app.MetricsAccess = config.MetricsSettings{}
+		app.TrustedProxies = ""
+	}()
+
+	h := ProxyHeaders(MetricsAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})))
+
+	tests := []struct {
+		name      string
+		forwarded string
+		expected  int
+	}{
+		{"allowed-client", "10.1.2.3", http.StatusOK},
+		{"public-client", "203.0.113.9", http.StatusForbidden},
+	}
+
+	for _, e := range tests {
+		req := httptest.NewRequest("GET", "/metrics", nil)
+		req.RemoteAddr = "127.0.0.1:5000"
+		req.Header.Set("X-Forwarded-For", e.forwarded)
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+
+		if rr.Code != e.expected {
+			t.Errorf("%s: expected %d, got %d", e.name, e.expected, rr.Code)
+		}
+	}
+}
+
+func TestRequestMetrics(t *testing.T) {
+	app.Metrics = metrics.NewRegistry()
+	defer func() { app.Metrics = nil }()
+
+	mux := chi.NewRouter()
+	mux.Use(RequestMetrics)
+	mux.Get("/rooms/{id}", func(w http.ResponseWriter, r *http.Request) {})
+
+	for _, url := range []string{"/rooms/1", "/rooms/2", "/missing"} {
+		mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", url, nil))
+	}
+
+	requests := app.Metrics.Counter("bookings_http_requests_total", "", "method", "route", "status")
+	if got := requests.Value("GET", "/rooms/{id}", "200"); got != 2 {
+		t.Errorf("expected 2 requests to /rooms/{id}, got %v", got)
+	}
+	if got := requests.Value("GET", "unmatched", "404"); got != 1 {
+		t.Errorf("expected 1 unmatched request, got %v", got)
+	}
+
+	var buf strings.Builder
+	app.Metrics.Write(&buf)
+	if !strings.Contains(buf.String(), `bookings_http_request_duration_seconds_count{route="/rooms/{id}"} 2`) {
+		t.Errorf("request durations not recorded:\n%s", buf.String())
+	}
+}
+
+func TestRequestLogger(t *testing.T) {
+	var logs bytes.Buffer
+	app.Logger = logging.New(&logs, "json", slog.LevelDebug)
+	session = scs.New()
+	defer func() { app.Logger, session = nil, nil }()
+
+	mux := chi.NewRouter()
+	mux.Use(RequestLogger, SessionLoad, LogUser)
+	mux.Post("/rooms/{id}", func(w http.ResponseWriter, r *http.Request) {
+		// signs in, like the login handler
+		session.Put(r.Context(), "user_id", 7)
+		logging.FromContext(r.Context(), nil).Info("booking")
+		w.WriteHeader(http.StatusCreated)
+	})
+	mux.Get("/healthz", func(w http.ResponseWriter, r *http.Request) {})
+
+	req := httptest.NewRequest("POST", "/rooms/1", nil)
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+
+	id := rr.Header().Get("X-Request-ID")
+	if id == "" {
+		t.Fatal("no X-Request-ID header")
+	}
+
+	records := decodeLogs(t, &logs)
+	if len(records) != 2 {
+		t.Fatalf("expected 2 records, got %v", records)
+	}
+	if records[0]["msg"] != "booking" || records[0]["request_id"] != id {
+		t.Errorf("handler record without the request id: %v", records[0])
+	}
+	request := records[1]
+	expected := map[string]interface{}{
+		"msg":        "request",
+		"level":      "INFO",
+		"request_id": id,
+		"method":     "POST",
+		"route":      "/rooms/{id}",
+		"status":     float64(http.StatusCreated),
+		"user_id":    float64(7),
+	}
+	for k, v := range expected {
+		if request[k] != v {
+			t.Errorf("request record: expected %s=%v, got %v", k, v, request[k])
+		}
+	}
+	if _, ok := request["duration"]; !ok {
+		t.Errorf("request record without a duration: %v", request)
+	}
+
+	// an id given by a proxy is kept, a strange one is replaced, probes are logged at debug level
+	tests := []struct {
+		header string
+		keep   bool
+	}{
+		{"abc-123", true},
+		{"<script>", false},
+	}
+	for _, e := range tests {
+		req = httptest.NewRequest("GET", "/healthz", nil)
+		req.Header.Set("X-Request-ID", e.header)
+		rr = httptest.NewRecorder()
+		mux.ServeHTTP(rr, req)
+
+		if got := rr.Header().Get("X-Request-ID"); (got == e.header) != e.keep || got == "" {
+			t.Errorf("X-Request-ID %q: got %q", e.header, got)
+		}
+		records = decodeLogs(t, &logs)
+		if len(records) != 1 || records[0]["level"] != "DEBUG" || records[0]["user_id"] != nil {
+			t.Errorf("unexpected probe records %v", records)
+		}
+	}
+}
+
+func TestStaffIdle(t *testing.T) {
+	session = scs.New()
+	app.AdminIdleTimeout = 30 * time.Minute
+	defer func() { session, app.AdminIdleTimeout = nil, 0 }()
+
+	mux := chi.NewRouter()
+	mux.Use(SessionLoad, StaffIdle)
+	mux.Get("/login", func(w http.ResponseWriter, r *http.Request) {
+		session.Put(r.Context(), "user_id", 7)
+		session.Put(r.Context(), "reservation", "in progress")
+	})
+	mux.Get("/away", func(w http.ResponseWriter, r *http.Request) {
+		session.Put(r.Context(), "last_active", time.Now().Add(-time.Hour).Unix())
+	})
+	mux.Get("/whoami", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "%d %s", session.GetInt(r.Context(), "user_id"), session.GetString(r.Context(), "reservation"))
+	})
+
+	var cookie *http.Cookie
+	get := func(path string) string {
+		req := httptest.NewRequest("GET", path, nil)
+		if cookie != nil {
+			req.AddCookie(cookie)
+		}
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, req)
+		for _, c := range rr.Result().Cookies() {
+			cookie = c
+		}
+		return rr.Body.String()
+	}
+
+	get("/login")
+	if got := get("/whoami"); got != "7 in progress" {
+		t.Errorf("expected the staff member signed in, got %q", got)
+	}
+
+	get("/away")
+	if got := get("/whoami"); got != "0 in progress" {
+		t.Errorf("expected the staff member signed out with the rest of the session kept, got %q", got)
+	}
+}
+
+// setupRepo is a test repository answering whether the setup is done.
+type setupRepo struct {
+	repository.DatabaseRepo
+	done *bool
+}
+
+func (r setupRepo) SetupDone(ctx context.Context) (bool, error) {
+	return *r.done, nil
+}
+
+func TestRequireSetup(t *testing.T) {
+	done := false
+	repo := handlers.NewTestRepo(&app)
+	repo.DB = setupRepo{repo.DB, &done}
+	handlers.NewHandlers(repo)
+	defer func() {
+		handlers.NewHandlers(nil)
+		setupDone.Store(false)
+	}()
+
+	h := RequireSetup(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	serve := func(path string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, httptest.NewRequest("GET", path, nil))
+		return rr
+	}
+
+	for _, path := range []string{"/", "/admin/dashboard", "/user/login"} {
+		rr := serve(path)
+		if rr.Code != http.StatusSeeOther || rr.Header().Get("Location") != "/setup" {
+			t.Errorf("%s before the setup: expected a redirect to /setup, got %d %s", path, rr.Code, rr.Header().Get("Location"))
+		}
+	}
+	for _, path := range []string{"/setup", "/healthz", "/readyz", "/metrics", "/static/css/styles.css"} {
+		if rr := serve(path); rr.Code != http.StatusOK {
+			t.Errorf("%s before the setup: expected it served, got %d", path, rr.Code)
+		}
+	}
+
+	done = true
+	if rr := serve("/"); rr.Code != http.StatusOK {
+		t.Errorf("after the setup: expected the page served, got %d", rr.Code)
+	}
+
+	// the setup can't be undone, the database isn't asked again
+	done = false
+	if rr := serve("/"); rr.Code != http.StatusOK {
+		t.Errorf("after the setup: expected the page still served, got %d", rr.Code)
+	}
+}
+
+// decodeLogs returns the JSON records written to buf and empties it.
+func decodeLogs(t *testing.T, buf *bytes.Buffer) []map[string]interface{} {
+	t.Helper()
+	var records []map[string]interface{}
+	dec := json.NewDecoder(buf)
+	for dec.More() {
+		var record map[string]interface{}
+		if err := dec.Decode(&record); err != nil {
+			t.Fatal(err)
+		}
+		records = append(records, record)
+	}
+	buf.Reset()
+	return records
+}
+
+func TestProxyHeaders(t *testing.T) {
+	app.TrustedProxies = "10.0.0.0/8"
+	defer func() { app.TrustedProxies = "" }()
+
+	var gotAddr string
+	var gotHTTPS bool
+	h := ProxyHeaders(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotAddr, gotHTTPS = r.RemoteAddr, isHTTPS(r)
+	}))
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		forwarded  string
+		proto      string
+		addr       string
+		https      bool
+	}{
+		{"untrusted", "203.0.113.9:5000", "198.51.100.1", "https", "203.0.113.9:5000", false},
+		{"trusted", "10.0.0.1:5000", "198.51.100.1", "https", "198.51.100.1:0", true},
+		{"trusted-http", "10.0.0.1:5000", "198.51.100.1", "http", "198.51.100.1:0", false},
+		{"proxy-chain", "10.0.0.1:5000", "198.51.100.1, 10.0.0.2", "", "198.51.100.1:0", false},
+		{"spoofed", "10.0.0.1:5000", "192.0.2.7, 198.51.100.1", "", "198.51.100.1:0", false},
+		{"garbage", "10.0.0.1:5000", "nonsense, 198.51.100.1", "", "198.51.100.1:0", false},
+		{"nearest-proto", "10.0.0.1:5000", "198.51.100.1", "http, https", "198.51.100.1:0", true},
+		{"no-headers", "10.0.0.1:5000", "", "", "10.0.0.1:5000", false},
+	}
+
+	for _, e := range tests {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = e.remoteAddr
+		if e.forwarded != "" {
+			req.Header.Set("X-Forwarded-For", e.forwarded)
+		}
+		if e.proto != "" {
+			req.Header.Set("X-Forwarded-Proto", e.proto)
+		}
+		h.ServeHTTP(httptest.NewRecorder(), req)
+
+		if gotAddr != e.addr {
+			t.Errorf("%s: expected remote address %s, got %s", e.name, e.addr, gotAddr)
+		}
+		if gotHTTPS != e.https {
+			t.Errorf("%s: expected https %v, got %v", e.name, e.https, gotHTTPS)
+		}
+	}
+}
+
+func TestRedirectHTTPS(t *testing.T) {
+	app.RedirectHTTPS = true
+	defer func() { app.RedirectHTTPS = false }()
+
+	h := RedirectHTTPS(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	req := httptest.NewRequest("POST", "http://example.com:8080/book?room=1", nil)
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	if rr.Code != http.StatusPermanentRedirect {
+		t.Errorf("expected %d, got %d", http.StatusPermanentRedirect, rr.Code)
+	}
+	if loc := rr.Header().Get("Location"); loc != "https://example.com/book?room=1" {
+		t.Errorf("unexpected redirect to %s", loc)
+	}
+
+	req = httptest.NewRequest("GET", "/book", nil)
+	req = req.WithContext(context.WithValue(req.Context(), httpsKey{}, true))
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Errorf("https: expected %d, got %d", http.StatusOK, rr.Code)
+	}
+
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest("GET", "/healthz", nil))
+	if rr.Code != http.StatusOK {
+		t.Errorf("probe: expected %d, got %d", http.StatusOK, rr.Code)
+	}
+}
+
+func TestSecureHeaders(t *testing.T) {
+	defer func() { app.InProduction = false }()
+
+	var nonce string
+	h := SecureHeaders(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		nonce = csp.Nonce(r.Context())
+	}))
+
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest("GET", "/", nil))
+
+	if nonce == "" {
+		t.Fatal("no nonce in the request context")
+	}
+	if policy := rr.Header().Get("Content-Security-Policy"); !strings.Contains(policy, "'nonce-"+nonce+"'") {
+		t.Errorf("policy doesn't allow the nonce of the request: %s", policy)
+	}
+	for _, header := range []string{"X-Content-Type-Options", "Referrer-Policy", "Permissions-Policy", "X-Frame-Options"} {
+		if rr.Header().Get(header) == "" {
+			t.Errorf("%s not set", header)
+		}
+	}
+	if rr.Header().Get("Strict-Transport-Security") != "" {
+		t.Error("HSTS set outside production")
+	}
+
+	app.InProduction = true
+	first := nonce
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest("GET", "/", nil))
+	if nonce == first {
+		t.Error("nonce reused between requests")
+	}
+	if rr.Header().Get("Strict-Transport-Security") != "" {
+		t.Error("HSTS set over plain HTTP")
+	}
+
+	req := httptest.NewRequest("GET", "https://example.com/", nil)
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	if rr.Header().Get("Strict-Transport-Security") == "" {
+		t.Error("HSTS not set in production over HTTPS")
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strconv"
+
+	"github.com/GitEagleY/BookingsWebApp/internal/driver"
+	"github.com/GitEagleY/BookingsWebApp/internal/migrate"
+	"github.com/GitEagleY/BookingsWebApp/migrations"
+)
+
+// runMigrate applies or rolls back the migrations built into the binary, e.g.
+//
+//	./bookings migrate up -dbname=bookings -dbuser=user
+//	./bookings migrate down -config=bookings.yaml 2
+var runMigrate = subcommands("migrate", map[string]func(args []string) error{
+	"up":     runMigrateUp,
+	"down":   runMigrateDown,
+	"redo":   runMigrateRedo,
+	"status": runMigrateStatus,
+})
+
+// migrator loads the settings and the flags of fs from args and returns the migrator of the database. The
+// database is closed with db.SQL.Close.
+func migrator(fs *flag.FlagSet, args []string) (*migrate.Migrator, *driver.DB, error) {
+	settings, err := loadCommand(fs, args)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	db, err := driver.ConnectSQL(settings.DB.DSN())
+	if err != nil {
+		return nil, nil, fmt.Errorf("cannot connect to database: %w", err)
+	}
+
+	m, err := migrate.New(db.SQL, migrations.FS, app.Logger)
+	if err != nil {
+		db.SQL.Close()
+		return nil, nil, err
+	}
+	return m, db, nil
+}
+
+// runMigrateUp applies the pending migrations.
+func runMigrateUp(args []string) error {
+	m, db, err := migrator(commandFlags("migrate up", "migrate up [flags]"), args)
+	if err != nil {
+		return err
+	}
+	defer db.SQL.Close()
+
+	ctx, stop := commandContext()
+	defer stop()
+
+	n, err := m.Up(ctx)
+	fmt.Printf("applied %d migrations\n", n)
+	return err
+}
+
+// runMigrateDown rolls back the last migration, or the number given.
+func runMigrateDown(args []string) error {
+	fs := commandFlags("migrate down", "migrate down [flags] [n]")
+	m, db, err := migrator(fs, args)
+	if err != nil {
+		return err
+	}
+	defer db.SQL.Close()
+
+	steps := 1
+	if fs.NArg() > 0 {
+		steps, err = strconv.Atoi(fs.Arg(0))
+		if err != nil || steps < 1 || fs.NArg() > 1 {
+			fs.Usage()
+			return fmt.Errorf("invalid number of migrations %q", fs.Arg(0))
+		}
+	}
+
+	ctx, stop := commandContext()
+	defer stop()
+
+	n, err := m.Down(ctx, steps)
+	fmt.Printf("rolled back %d migrations\n", n)
+	return err
+}
+
+// runMigrateRedo rolls back the last migration and applies it again.
+func runMigrateRedo(args []string) error {
+	m, db, err := migrator(commandFlags("migrate redo", "migrate redo [flags]"), args)
+	if err != nil {
+		return err
+	}
+	defer db.SQL.Close()
+
+	ctx, stop := commandContext()
+	defer stop()
+
+	return m.Redo(ctx)
+}
+
+// runMigrateStatus lists the migrations and when they were applied.
+func runMigrateStatus(args []string) error {
+	m, db, err := migrator(commandFlags("migrate status", "migrate status [flags]"), args)
+	if err != nil {
+		return err
+	}
+	defer db.SQL.Close()
+
+	ctx, stop := commandContext()
+	defer stop()
+
+	list, err := m.Status(ctx)
+	if err != nil {
+		return err
+	}
+
+	tw := table("VERSION\tNAME\tAPPLIED")
+	for _, s := range list {
+		applied := "pending"
+		if !s.AppliedAt.IsZero() {
+			applied = s.AppliedAt.Format("2006-01-02 15:04:05")
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", s.Version, s.Name, applied)
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	handlers "github.com/GitEagleY/BookingsWebApp/internal/Handlers"
+	render "github.com/GitEagleY/BookingsWebApp/internal/Render"
+	"github.com/GitEagleY/BookingsWebApp/internal/export"
+	"github.com/GitEagleY/BookingsWebApp/internal/models"
+)
+
+// runReservationList lists the reservations matching the flags, a page at a time, e.g.
+//
+//	./bookings reservation list -from=2050-01-01 -status=new
+func runReservationList(args []string) error {
+	fs := commandFlags("reservation list", "reservation list [flags]")
+	query := fs.String("q", "", "Search name, email and phone")
+	roomID := fs.Int("room", 0, "Only this room id")
+	from := fs.String("from", "", "Stays ending on or after this date (yyyy-mm-dd)")
+	to := fs.String("to", "", "Stays starting on or before this date (yyyy-mm-dd)")
+	status := fs.String("status", "", "Reservation status (new, processed)")
+	sortBy := fs.String("sort", "start_date", "Sort column")
+	desc := fs.Bool("desc", false, "Sort descending")
+	limit := fs.Int("limit", 50, "Reservations on a page")
+	after := fs.String("after", "", "Page after this cursor, as printed at the end of the previous page")
+
+	repo, db, err := connect(fs, args)
+	if err != nil {
+		return err
+	}
+	defer db.SQL.Close()
+
+	f := models.ReservationFilter{
+		Query:    *query,
+		RoomID:   *roomID,
+		Status:   *status,
+		SortBy:   *sortBy,
+		SortDesc: *desc,
+		After:    *after,
+		Limit:    *limit,
+	}
+	if *from != "" {
+		f.From, err = parseDate("from", *from)
+		if err != nil {
+			return err
+		}
+	}
+	if *to != "" {
+		f.To, err = parseDate("to", *to)
+		if err != nil {
+			return err
+		}
+	}
+
+	ctx, stop := commandContext()
+	defer stop()
+
+	page, err := repo.SearchReservations(ctx, f)
+	if err != nil {
+		return err
+	}
+
+	tw := table("ID\tGUEST\tEMAIL\tROOM\tARRIVAL\tDEPARTURE\tSTATUS\tTOTAL")
+	for _, res := range page.Reservations {
+		fmt.Fprintf(tw, "%d\t%s %s\t%s\t%s\t%s\t%s\t%s\t%s %s\n", res.ID, res.FirstName, res.LastName, res.Email,
+			res.Room.RoomName, res.StartDate.Format("2006-01-02"), res.EndDate.Format("2006-01-02"),
+			export.Status(res), render.FormatMoney(res.Total()), strings.ToUpper(res.Currency))
+	}
+	err = tw.Flush()
+	if err != nil {
+		return err
+	}
+
+	if page.NextCursor != "" {
+		fmt.Printf("\nmore with -after=%s\n", page.NextCursor)
+	}
+	return nil
+}
+
+// runReservationShow prints a reservation with its payments, e.g.
+//
+//	./bookings reservation show 12
+func runReservationShow(args []string) error {
+	fs := commandFlags("reservation show", "reservation show [flags] id")
+
+	repo, db, err := connect(fs, args)
+	if err != nil {
+		return err
+	}
+	defer db.SQL.Close()
+
+	id, err := idArg(fs, "reservation")
+	if err != nil {
+		return err
+	}
+	err = checkWaitlistLinks()
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := commandContext()
+	defer stop()
+
+	res, err := repo.GetReservationByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	records, err := repo.GetPaymentsForReservation(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	currency := strings.ToUpper(res.Currency)
+	tw := table(fmt.Sprintf("Reservation\t%d", res.ID))
+	fmt.Fprintf(tw, "Guest\t%s %s\n", res.FirstName, res.LastName)
+	fmt.Fprintf(tw, "Email\t%s\n", res.Email)
+	fmt.Fprintf(tw, "Phone\t%s\n", res.Phone)
+	fmt.Fprintf(tw, "Room\t%s\n", res.Room.RoomName)
+	fmt.Fprintf(tw, "Stay\t%s to %s, %d nights, %d guests\n", res.StartDate.Format("2006-01-02"),
+		res.EndDate.Format("2006-01-02"), res.Nights(), res.Guests)
+	fmt.Fprintf(tw, "Status\t%s\n", export.Status(res))
+	fmt.Fprintf(tw, "Source\t%s\n", res.Source)
+	fmt.Fprintf(tw, "Total\t%s %s\n", render.FormatMoney(res.Total()), currency)
+	if res.PromotionCode != "" {
+		fmt.Fprintf(tw, "Promo code\t%s, %s %s off\n", res.PromotionCode, render.FormatMoney(res.Discount), currency)
+	}
+	fmt.Fprintf(tw, "Cancellation\t%s\n", handlers.ReservationPolicy(res).Description())
+	if res.SpecialRequests != "" {
+		fmt.Fprintf(tw, "Special requests\t%s\n", res.SpecialRequests)
+	}
+	if res.Note != "" {
+		fmt.Fprintf(tw, "Note\t%s\n", res.Note)
+	}
+	for _, p := range records {
+		fmt.Fprintf(tw, "Payment\t%s %s %s, %s, %s\n", p.Kind, render.FormatMoney(p.Amount),
+			strings.ToUpper(p.Currency), p.Status, p.CreatedAt.Format("2006-01-02 15:04"))
+	}
+	fmt.Fprintf(tw, "Booked\t%s\n", res.CreatedAt.Format("2006-01-02 15:04"))
+	return tw.Flush()
+}
+
+// runReservationCancel cancels a reservation under its cancellation policy, as staff, the way the admin pages
+// do: the deposit is refunded as far as the policy allows, unless -no-refund is given, e.g. when the guest was
+// refunded some other way, and the waitlist is told about the freed nights, e.g.
+//
+//	./bookings reservation cancel 12
+func runReservationCancel(args []string) error {
+	fs := commandFlags("reservation cancel", "reservation cancel [flags] id")
+	noRefund := fs.Bool("no-refund", false, "Cancel without refunding the deposit")
+
+	repo, db, err := connect(fs, args)
+	if err != nil {
+		return err
+	}
+	defer db.SQL.Close()
+
+	id, err := idArg(fs, "reservation")
+	if err != nil {
+		return err
+	}
+	err = checkWaitlistLinks()
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := commandContext()
+	defer stop()
+
+	res, err := repo.GetReservationByID(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	stopMail := startMail()
+	h := &handlers.Repository{App: &app, DB: repo}
+	result, err := h.ApplyCancellation(ctx, app.SiteURL, res, "staff", !*noRefund)
+	if err != nil {
+		return errors.Join(err, stopMail())
+	}
+
+	fmt.Printf("cancelled reservation %d of %s %s\n", res.ID, res.FirstName, res.LastName)
+	if result.Refund > 0 && !*noRefund {
+		fmt.Printf("refunded %s %s\n", render.FormatMoney(result.Refund), strings.ToUpper(res.Currency))
+	}
+	return stopMail()
+}
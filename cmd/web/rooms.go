@@ -0,0 +1,164 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	handlers "github.com/GitEagleY/BookingsWebApp/internal/Handlers"
+	render "github.com/GitEagleY/BookingsWebApp/internal/Render"
+	"github.com/GitEagleY/BookingsWebApp/internal/cancellation"
+	"github.com/GitEagleY/BookingsWebApp/internal/models"
+	"github.com/GitEagleY/BookingsWebApp/internal/pricing"
+	"github.com/GitEagleY/BookingsWebApp/internal/repository"
+)
+
+// runRoomList lists the rooms with their rates and cancellation policies.
+func runRoomList(args []string) error {
+	fs := commandFlags("room list", "room list [flags]")
+
+	repo, db, err := connect(fs, args)
+	if err != nil {
+		return err
+	}
+	defer db.SQL.Close()
+
+	ctx, stop := commandContext()
+	defer stop()
+
+	rooms, err := repo.AllRooms(ctx)
+	if err != nil {
+		return err
+	}
+
+	tw := table("ID\tNAME\tNIGHTLY RATE\tCANCELLATION POLICY")
+	for _, rm := range rooms {
+		fmt.Fprintf(tw, "%d\t%s\t%s %s\t%s\n", rm.ID, rm.RoomName, render.FormatMoney(rm.NightlyRate),
+			strings.ToUpper(app.Currency), rm.CancellationPolicy)
+	}
+	return tw.Flush()
+}
+
+// runRoomCreate adds a room, e.g.
+//
+//	./bookings room create -name="Colonels Loft" -rate=149.00 -policy=moderate
+func runRoomCreate(args []string) error {
+	fs := commandFlags("room create", "room create [flags]")
+	name := fs.String("name", "", "Name of the room")
+	rate := fs.String("rate", "0", "Nightly rate, e.g. 89.00")
+	policy := fs.String("policy", cancellation.Flexible.Name, "Cancellation policy, a preset (flexible, moderate, strict) or e.g. custom:7=100,2=50")
+
+	repo, db, err := connect(fs, args)
+	if err != nil {
+		return err
+	}
+	defer db.SQL.Close()
+
+	rm := models.Room{RoomName: strings.TrimSpace(*name)}
+	if rm.RoomName == "" {
+		return errors.New("missing required flag name")
+	}
+	rm.NightlyRate, err = pricing.ParseMoney(*rate)
+	if err != nil {
+		return fmt.Errorf("invalid -rate: %w", err)
+	}
+	p, err := cancellation.Parse(*policy)
+	if err != nil {
+		return fmt.Errorf("invalid -policy: %w", err)
+	}
+	rm.CancellationPolicy = p.String()
+
+	ctx, stop := commandContext()
+	defer stop()
+
+	id, err := repo.InsertRoom(ctx, rm)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("created room %d, %s\n", id, rm.RoomName)
+	return nil
+}
+
+// runBlockAdd blocks a room for the owner, e.g. for maintenance. The room is free again on the -to date, the
+// way a guest leaves on the departure date:
+//
+//	./bookings block add -room=1 -from=2050-03-01 -to=2050-03-08
+func runBlockAdd(args []string) error {
+	fs := commandFlags("block add", "block add [flags]")
+	roomID := fs.Int("room", 0, "Room id")
+	from := fs.String("from", "", "First night blocked (yyyy-mm-dd)")
+	to := fs.String("to", "", "Day the room is free again (yyyy-mm-dd)")
+
+	repo, db, err := connect(fs, args)
+	if err != nil {
+		return err
+	}
+	defer db.SQL.Close()
+
+	if *roomID <= 0 {
+		return errors.New("missing required flag room")
+	}
+	start, err := parseDate("from", *from)
+	if err != nil {
+		return err
+	}
+	end, err := parseDate("to", *to)
+	if err != nil {
+		return err
+	}
+	if !end.After(start) {
+		return errors.New("-to must be after -from")
+	}
+
+	ctx, stop := commandContext()
+	defer stop()
+
+	id, err := repo.InsertBlock(ctx, models.RoomRestriction{RoomID: *roomID, StartDate: start, EndDate: end})
+	if errors.Is(err, repository.ErrRoomUnavailable) {
+		return fmt.Errorf("room %d is booked or blocked on some of these nights", *roomID)
+	} else if err != nil {
+		return err
+	}
+	fmt.Printf("added block %d\n", id)
+	return nil
+}
+
+// runBlockRemove removes an owner block by the id printed by block add, and emails the waitlisted guests
+// whose nights it frees, e.g.
+//
+//	./bookings block remove 42
+func runBlockRemove(args []string) error {
+	fs := commandFlags("block remove", "block remove [flags] id")
+
+	repo, db, err := connect(fs, args)
+	if err != nil {
+		return err
+	}
+	defer db.SQL.Close()
+
+	id, err := idArg(fs, "block")
+	if err != nil {
+		return err
+	}
+	err = checkWaitlistLinks()
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := commandContext()
+	defer stop()
+
+	block, err := repo.DeleteBlock(ctx, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("there is no owner block %d", id)
+	} else if err != nil {
+		return err
+	}
+	fmt.Printf("removed block %d\n", id)
+
+	stopMail := startMail()
+	h := &handlers.Repository{App: &app, DB: repo}
+	h.ReleaseDates(ctx, app.SiteURL, block.RoomID, block.StartDate, block.EndDate)
+	return stopMail()
+}
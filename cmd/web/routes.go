@@ -5,6 +5,7 @@ import (
 
 	handlers "github.com/GitEagleY/BookingsWebApp/internal/Handlers"
 	"github.com/GitEagleY/BookingsWebApp/internal/config"
+	"github.com/GitEagleY/BookingsWebApp/internal/health"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
@@ -13,45 +14,100 @@ import (
 func routes(app *config.AppConfig) http.Handler {
 	mux := chi.NewRouter()
 
+	mux.Use(ProxyHeaders)
+	mux.Use(RequestMetrics)
+	mux.Use(RequestLogger)
 	mux.Use(middleware.Recoverer)
-	mux.Use(NoSurf)
-	mux.Use(SessionLoad)
-
-	mux.Get("/", handlers.Repo.Home)
-	mux.Get("/about", handlers.Repo.About)
-	mux.Get("/generals-quarters", handlers.Repo.Generals)
-	mux.Get("/majors-suite", handlers.Repo.Majors)
-	mux.Get("/contact", handlers.Repo.Contact)
-
-	mux.Get("/search-availability", handlers.Repo.Availability)
-	mux.Post("/search-availability", handlers.Repo.PostAvailability)
-	mux.Post("/search-availability-json", handlers.Repo.AvailabilityJSON)
-	mux.Get("/choose-room/{id}", handlers.Repo.ChooseRoom)
-
-	mux.Get("/make-reservation", handlers.Repo.Reservation)
-	mux.Post("/make-reservation", handlers.Repo.PostReservation)
-	mux.Get("/reservation-summary", handlers.Repo.ReservationSummary)
-	mux.Get("/book-room", handlers.Repo.BookRoom)
-
-	mux.Get("/user/login", handlers.Repo.ShowLogin)
-	mux.Post("/user/login", handlers.Repo.PostShowLogin)
-	mux.Get("/user/logout", handlers.Repo.Logout)
-	mux.Route("/admin", func(mux chi.Router) {
-		mux.Use(Auth)
-		mux.Get("/dashboard", handlers.Repo.AdminDashboard)
-
-		mux.Get("/reservations-new", handlers.Repo.AdminNewReservations)
-		mux.Get("/reservations-all", handlers.Repo.AdminAllReservations)
-		mux.Get("/reservations-calendar", handlers.Repo.AdminReservationsCalendar)
-
-		mux.Get("/reservations/{src}/{id}", handlers.Repo.AdminShowReservation)
-		mux.Post("/reservations/{src}/{id}", handlers.Repo.AdminPostShowReservation)
-		mux.Get("/process-reservation/{src}/{id}", handlers.Repo.AdminProcessReservation)
-		mux.Get("/delete-reservation/{src}/{id}", handlers.Repo.AdminDeleteReservation)
+	mux.Use(RedirectHTTPS)
+	mux.Use(SecureHeaders)
 
+	// probes and scrapes need no session or CSRF cookie, and stay up when the session store is down
+	mux.Get("/healthz", health.Live)
+	mux.Get("/readyz", health.Ready(app.ReadyChecks...))
+	mux.With(MetricsAuth).Get("/metrics", app.Metrics.Handler().ServeHTTP)
+
+	mux.Group(func(mux chi.Router) {
+		mux.Use(NoSurf)
+		mux.Use(SessionLoad)
+		mux.Use(StaffIdle)
+		mux.Use(LogUser)
+		mux.Use(RequireSetup)
+
+		mux.Get("/setup", handlers.Repo.Setup)
+		mux.Post("/setup", handlers.Repo.PostSetup)
+
+		mux.Get("/", handlers.Repo.Home)
+		mux.Get("/about", handlers.Repo.About)
+		mux.Get("/generals-quarters", handlers.Repo.Generals)
+		mux.Get("/majors-suite", handlers.Repo.Majors)
+		mux.Get("/contact", handlers.Repo.Contact)
+
+		mux.Get("/search-availability", handlers.Repo.Availability)
+		mux.Post("/search-availability", handlers.Repo.PostAvailability)
+		mux.Post("/search-availability-json", handlers.Repo.AvailabilityJSON)
+		mux.Get("/choose-room/{id}", handlers.Repo.ChooseRoom)
+
+		mux.Get("/make-reservation", handlers.Repo.Reservation)
+		mux.Post("/make-reservation", handlers.Repo.PostReservation)
+		mux.Get("/reservation-deposit", handlers.Repo.Deposit)
+		mux.Post("/reservation-deposit", handlers.Repo.PostDeposit)
+		mux.Get("/reservation-summary", handlers.Repo.ReservationSummary)
+		mux.Get("/book-room", handlers.Repo.BookRoom)
+
+		if app.Features.Waitlist {
+			mux.Get("/waitlist", handlers.Repo.Waitlist)
+			mux.Post("/waitlist", handlers.Repo.PostWaitlist)
+			mux.Get("/waitlist/book/{token}", handlers.Repo.WaitlistBook)
+		}
+
+		mux.Get("/cancel-reservation", handlers.Repo.CancelReservation)
+		mux.Post("/cancel-reservation", handlers.Repo.PostCancelReservation)
+		mux.Post("/reservation-invoice", handlers.Repo.PostReservationInvoice)
+
+		mux.Post("/payments/webhook", handlers.Repo.PaymentWebhook)
+
+		mux.Get("/user/login", handlers.Repo.ShowLogin)
+		mux.Post("/user/login", handlers.Repo.PostShowLogin)
+		mux.Get("/user/logout", handlers.Repo.Logout)
+		mux.Route("/admin", func(mux chi.Router) {
+			mux.Use(Auth)
+			mux.Get("/dashboard", handlers.Repo.AdminDashboard)
+			mux.Get("/dashboard/occupancy", handlers.Repo.AdminDashboardOccupancy)
+			mux.Get("/dashboard/bookings", handlers.Repo.AdminDashboardBookings)
+
+			mux.Get("/reservations-new", handlers.Repo.AdminNewReservations)
+			mux.Get("/reservations-all", handlers.Repo.AdminAllReservations)
+			mux.Get("/reservations-calendar", handlers.Repo.AdminReservationsCalendar)
+			mux.Get("/new-reservation", handlers.Repo.AdminNewReservation)
+			mux.Post("/new-reservation", handlers.Repo.AdminPostNewReservation)
+			mux.Get("/reservations/export", handlers.Repo.AdminExportReservations)
+			mux.Get("/guests", handlers.Repo.AdminGuests)
+			mux.Get("/guests/{id}", handlers.Repo.AdminShowGuest)
+			mux.Post("/guests/{id}", handlers.Repo.AdminPostGuest)
+			mux.Post("/guests/{id}/merge", handlers.Repo.AdminMergeGuest)
+			mux.Get("/import", handlers.Repo.AdminImport)
+			mux.Post("/import", handlers.Repo.AdminPostImport)
+			mux.Get("/taxes", handlers.Repo.AdminTaxes)
+			mux.Post("/taxes", handlers.Repo.AdminPostTax)
+			mux.Post("/taxes/{id}/delete", handlers.Repo.AdminDeleteTax)
+			mux.Get("/promotions", handlers.Repo.AdminPromotions)
+			mux.Post("/promotions", handlers.Repo.AdminPostPromotion)
+			mux.Post("/promotions/{id}/delete", handlers.Repo.AdminDeletePromotion)
+			mux.Get("/promotions/redemptions", handlers.Repo.AdminPromotionRedemptions)
+
+			mux.Get("/reservations/{src}/{id}", handlers.Repo.AdminShowReservation)
+			mux.Post("/reservations/{src}/{id}", handlers.Repo.AdminPostShowReservation)
+			mux.Post("/reservations/{src}/{id}/notes", handlers.Repo.AdminPostReservationNote)
+			mux.Post("/reservations/{src}/{id}/notes/{noteID}/pin", handlers.Repo.AdminPinReservationNote)
+			mux.Get("/reservations/{src}/{id}/invoice", handlers.Repo.AdminReservationInvoice)
+			mux.Post("/reservations/{src}/{id}/invoice/send", handlers.Repo.AdminSendInvoice)
+			mux.Get("/process-reservation/{src}/{id}", handlers.Repo.AdminProcessReservation)
+			mux.Post("/delete-reservation/{src}/{id}", handlers.Repo.AdminDeleteReservation)
+
+		})
+		fileServer := http.FileServer(http.Dir("./static/"))
+		mux.Handle("/static/*", http.StripPrefix("/static", fileServer))
 	})
-	fileServer := http.FileServer(http.Dir("./static/"))
-	mux.Handle("/static/*", http.StripPrefix("/static", fileServer))
 
 	return mux
 }
@@ -2,6 +2,8 @@ package main
 
 import (
 	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 
 	"github.com/GitEagleY/BookingsWebApp/internal/config"
@@ -18,3 +20,18 @@ func TestRoutes(t *testing.T) {
 		t.Error(fmt.Sprintf(" MUX type is not  *chi.Mux - its = %T", v))
 	}
 }
+
+func TestProbesSkipSessions(t *testing.T) {
+	var app config.AppConfig
+	mux := routes(&app)
+
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest("GET", "/healthz", nil))
+
+	if rr.Code != http.StatusOK {
+		t.Errorf("expected 200, got %d", rr.Code)
+	}
+	if cookies := rr.Result().Cookies(); len(cookies) > 0 {
+		t.Errorf("expected no session or CSRF cookie, got %v", cookies)
+	}
+}
@@ -1,52 +1,134 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"io/ioutil"
-	"log"
 	"strings"
+	"sync/atomic"
 	"time"
 
+	"github.com/GitEagleY/BookingsWebApp/internal/metrics"
 	"github.com/GitEagleY/BookingsWebApp/internal/models"
 	mail "github.com/xhit/go-simple-mail/v2"
 )
 
-func listenForMail() {
+// mailQueueSize is how many emails can wait to be sent before the handlers queueing them wait too.
+const mailQueueSize = 100
 
+// mailHeartbeat is how often the mail worker shows it's alive while waiting for emails, and mailStuckAfter how
+// long without a heartbeat before it's reported as stuck, e.g. on an SMTP server that never answers.
+const (
+	mailHeartbeat  = 15 * time.Second
+	mailStuckAfter = time.Minute
+)
+
+// mailer sends the emails queued on app.MailChan in the background.
+type mailer struct {
+	quit chan struct{}
+	done chan struct{}
+	beat atomic.Int64 // unix nanoseconds of the last heartbeat
+}
+
+func newMailer() *mailer {
+	return &mailer{quit: make(chan struct{}), done: make(chan struct{})}
+}
+
+func (m *mailer) Name() string { return "mail worker" }
+
+// Start sends the queued emails until Stop is called, then sends the ones still queued.
+func (m *mailer) Start() error {
+	m.beat.Store(time.Now().UnixNano())
 	go func() {
+		defer close(m.done)
+		ticker := time.NewTicker(mailHeartbeat)
+		defer ticker.Stop()
+
 		for {
-			msg := <-app.MailChan
-			sendMsg(msg)
+			select {
+			case msg := <-app.MailChan:
+				sendMsg(msg)
+				m.beat.Store(time.Now().UnixNano())
+			case <-ticker.C:
+				m.beat.Store(time.Now().UnixNano())
+			case <-m.quit:
+				for {
+					select {
+					case msg := <-app.MailChan:
+						sendMsg(msg)
+					default:
+						return
+					}
+				}
+			}
 		}
 	}()
+	return nil
+}
+
+// Stop waits for the queued emails to be sent. The channel is left open so a late sender doesn't panic.
+func (m *mailer) Stop(ctx context.Context) error {
+	close(m.quit)
+	select {
+	case <-m.done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("%d emails not sent: %w", len(app.MailChan), ctx.Err())
+	}
+}
 
+// alive returns an error when the worker has stopped or hasn't shown it's alive for mailStuckAfter.
+func (m *mailer) alive(ctx context.Context) error {
+	select {
+	case <-m.done:
+		return errors.New("mail worker stopped")
+	default:
+	}
+	if since := time.Since(time.Unix(0, m.beat.Load())); since > mailStuckAfter {
+		return fmt.Errorf("mail worker stuck for %s", since.Round(time.Second))
+	}
+	return nil
 }
 
-// sendMsg sends an email using the provided mail data.
+// sendMsg sends an email, logging whether it went.
 func sendMsg(m models.MailData) {
+	logger := app.Logger.With("to", m.To, "subject", m.Subject)
+
+	err := deliver(m)
+	if err != nil {
+		logger.Error("can't send email", "error", err)
+		mailFailures().Inc()
+		return
+	}
+	logger.Info("email sent")
+	app.Metrics.Counter("bookings_mail_sent_total", "Emails sent.").Inc()
+}
+
+// deliver sends an email through the mail server of app.SMTP.
+func deliver(m models.MailData) error {
 	// Create a new SMTP client.
 	server := mail.NewSMTPClient()
 
 	// Set the SMTP server host and port.
-	server.Host = "localhost"
-	server.Port = 1025
+	server.Host = app.SMTP.Host
+	server.Port = app.SMTP.Port
 
 	// Configure connection settings.
 	server.KeepAlive = false
 	server.ConnectTimeout = 10 * time.Second
 	server.SendTimeout = 10 * time.Second
 
-	// Uncomment and provide credentials if required.
-	// server.Username = "your_username"
-	// server.Password = "your_password"
-
-	// Uncomment and set encryption type if needed.
-	// server.Encryption = mail.EncryptionTLS
-
-	// Connect to the SMTP server.
-	client, err := server.Connect()
-	if err != nil {
-		errorLog.Println(err)
+	// Credentials and encryption, when the server needs them.
+	server.Username = app.SMTP.Username
+	server.Password = app.SMTP.Password
+	switch app.SMTP.Encryption {
+	case "ssl":
+		server.Encryption = mail.EncryptionSSLTLS
+	case "starttls":
+		server.Encryption = mail.EncryptionSTARTTLS
+	default:
+		server.Encryption = mail.EncryptionNone
 	}
 
 	// Create a new email message.
@@ -61,7 +143,7 @@ func sendMsg(m models.MailData) {
 	} else {
 		data, err := ioutil.ReadFile(fmt.Sprintf("./email-templates/%s", m.Template))
 		if err != nil {
-			app.ErrorLog.Println(err)
+			return fmt.Errorf("can't read email template: %w", err)
 		}
 
 		mailTemplate := string(data)
@@ -70,13 +152,50 @@ func sendMsg(m models.MailData) {
 
 	}
 
+	// Attach any files, such as invoices.
+	for _, a := range m.Attachments {
+		email.Attach(&mail.File{Name: a.Name, MimeType: a.ContentType, Data: a.Data})
+	}
+
+	// Connect to the SMTP server.
+	client, err := server.Connect()
+	if err != nil {
+		return fmt.Errorf("can't connect to the mail server: %w", err)
+	}
+
 	// Send the email using the SMTP client.
-	err = email.Send(client)
+	return email.Send(client)
+}
+
+func mailFailures() *metrics.Counter {
+	return app.Metrics.Counter("bookings_mail_send_failures_total", "Emails that couldn't be sent.")
+}
+
+// runMailTest sends an email through the configured mail server, to check the smtp settings, e.g.
+//
+//	./bookings mail test -config=bookings.yaml owner@example.com
+func runMailTest(args []string) error {
+	fs := commandFlags("mail test", "mail test [flags] to")
+
+	_, err := loadCommand(fs, args)
 	if err != nil {
-		// Log any errors that occur during email sending.
-		log.Println(err)
-	} else {
-		// Log a message indicating successful email sending.
-		log.Println("Email sent successfully")
+		return err
+	}
+
+	to, err := oneArg(fs, "address to send to")
+	if err != nil {
+		return err
+	}
+
+	err = deliver(models.MailData{
+		To:      to,
+		From:    app.SMTP.From,
+		Subject: "Test email",
+		Content: fmt.Sprintf("This is a test email, sent from %s:%d by bookings mail test.", app.SMTP.Host, app.SMTP.Port),
+	})
+	if err != nil {
+		return err
 	}
+	fmt.Printf("sent a test email to %s\n", to)
+	return nil
 }
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+
+	"github.com/GitEagleY/BookingsWebApp/internal/lifecycle"
+)
+
+// webServer serves the application, reporting to group when it stops serving on its own. It serves HTTPS
+// when the server has a TLS configuration.
+type webServer struct {
+	name  string // "web server" when empty
+	srv   *http.Server
+	group *lifecycle.Group
+	addr  net.Addr // listened on, once started
+}
+
+func (s *webServer) Name() string {
+	if s.name == "" {
+		return "web server"
+	}
+	return s.name
+}
+
+// Start listens on the address of the server, so a port in use fails here, and serves in the background.
+func (s *webServer) Start() error {
+	ln, err := net.Listen("tcp", s.srv.Addr)
+	if err != nil {
+		return err
+	}
+	s.addr = ln.Addr()
+
+	go func() {
+		var err error
+		if s.srv.TLSConfig != nil {
+			err = s.srv.ServeTLS(ln, "", "")
+		} else {
+			err = s.srv.Serve(ln)
+		}
+		if !errors.Is(err, http.ErrServerClosed) {
+			s.group.Fail(err)
+		}
+	}()
+	return nil
+}
+
+// Stop stops accepting connections and waits for the requests in progress to finish.
+func (s *webServer) Stop(ctx context.Context) error {
+	return s.srv.Shutdown(ctx)
+}
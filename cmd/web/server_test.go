@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/GitEagleY/BookingsWebApp/internal/config"
+	"github.com/GitEagleY/BookingsWebApp/internal/lifecycle"
+)
+
+func TestWebServerDrainsRequests(t *testing.T) {
+	started := make(chan struct{})
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		time.Sleep(100 * time.Millisecond)
+		io.WriteString(w, "done")
+	})
+
+	g := &lifecycle.Group{}
+	s := &webServer{srv: &http.Server{Addr: "127.0.0.1:0", Handler: handler}, group: g}
+	g.Add(s)
+	if err := g.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	body := make(chan string)
+	go func() {
+		resp, err := http.Get("http://" + s.addr.String())
+		if err != nil {
+			body <- err.Error()
+			return
+		}
+		defer resp.Body.Close()
+		b, _ := io.ReadAll(resp.Body)
+		body <- string(b)
+	}()
+
+	<-started
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := g.Stop(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := <-body; got != "done" {
+		t.Errorf("expected the request in progress to finish, got %q", got)
+	}
+	if _, err := http.Get("http://" + s.addr.String()); err == nil {
+		t.Error("expected new connections to be refused once stopped")
+	}
+}
+
+func TestWebServerAddressInUse(t *testing.T) {
+	first := &webServer{srv: &http.Server{Addr: "127.0.0.1:0"}}
+	if err := first.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer first.Stop(context.Background())
+
+	second := &webServer{srv: &http.Server{Addr: first.addr.String()}}
+	if err := second.Start(); err == nil {
+		t.Error("expected an error listening on an address in use")
+	}
+}
+
+func TestHTTPSRedirect(t *testing.T) {
+	tests := []struct {
+		addr     string
+		url      string
+		expected string
+	}{
+		{":443", "http://example.com/rooms?id=1", "https://example.com/rooms?id=1"},
+		{":8443", "http://example.com:8080/rooms", "https://example.com:8443/rooms"},
+		{":443", "http://[::1]:8080/", "https://[::1]/"},
+	}
+
+	for _, e := range tests {
+		rr := httptest.NewRecorder()
+		httpsRedirect(httpsPort(e.addr)).ServeHTTP(rr, httptest.NewRequest("GET", e.url, nil))
+
+		if loc := rr.Header().Get("Location"); loc != e.expected {
+			t.Errorf("%s on %s: expected redirect to %s, got %s", e.url, e.addr, e.expected, loc)
+		}
+	}
+}
+
+func TestNewTLSConfigMissingCertificate(t *testing.T) {
+	settings := config.TLSSettings{CertFile: "missing.crt", KeyFile: "missing.key"}
+	if _, _, err := newTLSConfig(settings, ":443"); err == nil {
+		t.Error("expected an error for missing certificate files")
+	}
+}
+
+func TestNewTLSConfigAutocert(t *testing.T) {
+	settings := config.TLSSettings{Autocert: "bookings.example.com", CacheDir: t.TempDir()}
+	cfg, handler, err := newTLSConfig(settings, ":443")
+	if err != nil {
+		t.Fatalf("expected Let's Encrypt to be set up, got %v", err)
+	}
+	if cfg.GetCertificate == nil {
+		t.Error("expected the certificates to come from Let's Encrypt")
+	}
+
+	// anything but the challenges is sent to HTTPS
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", "http://bookings.example.com/rooms", nil))
+	if loc := rr.Header().Get("Location"); loc != "https://bookings.example.com/rooms" {
+		t.Errorf("expected a redirect to HTTPS, got %d %q", rr.Code, loc)
+	}
+}
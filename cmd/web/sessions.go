@@ -0,0 +1,46 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/GitEagleY/BookingsWebApp/internal/config"
+	"github.com/GitEagleY/BookingsWebApp/internal/sessionstore"
+	"github.com/alexedwards/scs/v2"
+	"github.com/alexedwards/scs/v2/memstore"
+)
+
+// sessionSweepInterval is how often expired sessions are removed from the postgres and file stores.
+const sessionSweepInterval = 5 * time.Minute
+
+// newSessionStore returns the session store chosen by the settings, which were validated.
+func newSessionStore(settings config.SessionSettings, db *sql.DB) (scs.Store, error) {
+	switch settings.Store {
+	case "postgres":
+		return sessionstore.NewPostgres(db), nil
+	case "file":
+		store, err := sessionstore.NewFile(settings.Dir)
+		if err != nil {
+			return nil, fmt.Errorf("cannot open the session directory: %w", err)
+		}
+		return store, nil
+	default:
+		return memstore.New(), nil
+	}
+}
+
+// newSessionSweeper returns the sweeper deleting the expired sessions of store.
+func newSessionSweeper(store sessionstore.Sweeper) *sweeper {
+	return newSweeper("expired session sweeper", sessionSweepInterval, func(ctx context.Context) error {
+		removed, err := store.DeleteExpired(ctx)
+		if err != nil {
+			return err
+		}
+		if removed > 0 {
+			app.Logger.Debug("removed expired sessions", "count", removed)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"time"
+)
+
+// sweeper periodically removes what has expired, such as room holds never turned into reservations.
+type sweeper struct {
+	name     string
+	interval time.Duration
+	sweep    func(ctx context.Context) error
+	quit     chan struct{}
+	done     chan struct{}
+}
+
+func newSweeper(name string, interval time.Duration, sweep func(ctx context.Context) error) *sweeper {
+	return &sweeper{name: name, interval: interval, sweep: sweep, quit: make(chan struct{}), done: make(chan struct{})}
+}
+
+func (s *sweeper) Name() string { return s.name }
+
+// Start sweeps every interval until Stop is called.
+func (s *sweeper) Start() error {
+	go func() {
+		defer close(s.done)
+		ticker := time.NewTicker(s.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+			case <-s.quit:
+				return
+			}
+
+			err := s.sweep(context.Background())
+			if err != nil {
+				app.Logger.Error("sweep failed", "sweeper", s.name, "error", err)
+			}
+		}
+	}()
+	return nil
+}
+
+// Stop waits for a sweep in progress to finish.
+func (s *sweeper) Stop(ctx context.Context) error {
+	close(s.quit)
+	select {
+	case <-s.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
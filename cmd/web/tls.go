@@ -0,0 +1,72 @@
+package main
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+
+	"github.com/GitEagleY/BookingsWebApp/internal/config"
+
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// newTLSConfig returns the TLS configuration of the application serving HTTPS on addr, and the handler of
+// the plain HTTP address, which redirects to it.
+func newTLSConfig(settings config.TLSSettings, addr string) (*tls.Config, http.Handler, error) {
+	redirect := httpsRedirect(httpsPort(addr))
+
+	if settings.Autocert != "" {
+		return autocertConfig(settings, redirect)
+	}
+
+	cert, err := tls.LoadX509KeyPair(settings.CertFile, settings.KeyFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	cfg := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+	return cfg, redirect, nil
+}
+
+// autocertConfig gets the certificates of the hosts from Let's Encrypt, keeping them in the cache directory
+// so a restart doesn't ask again. The handler also answers the HTTP challenges, so HTTPAddr must be :80
+// unless a proxy forwards them.
+func autocertConfig(settings config.TLSSettings, redirect http.Handler) (*tls.Config, http.Handler, error) {
+	m := &autocert.Manager{
+		Prompt:     autocert.AcceptTOS,
+		Cache:      autocert.DirCache(settings.CacheDir),
+		HostPolicy: autocert.HostWhitelist(settings.Hosts()...),
+		Email:      settings.Email,
+	}
+	cfg := m.TLSConfig()
+	cfg.MinVersion = tls.VersionTLS12
+	return cfg, m.HTTPHandler(redirect), nil
+}
+
+// httpsPort returns the port of addr to put in the redirects to it, empty for the default one.
+func httpsPort(addr string) string {
+	_, port, err := net.SplitHostPort(addr)
+	if err != nil || port == "443" {
+		return ""
+	}
+	return port
+}
+
+// httpsRedirect permanently redirects requests to the same URL over HTTPS, on port, or the default one when
+// it is empty. The method and the body are kept.
+func httpsRedirect(port string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if port != "" {
+			host = net.JoinHostPort(host, port)
+		} else if ip := net.ParseIP(host); ip != nil && ip.To4() == nil {
+			host = "[" + host + "]"
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusPermanentRedirect)
+	})
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bufio"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/GitEagleY/BookingsWebApp/internal/models"
+	"github.com/asaskevich/govalidator"
+)
+
+// runUserCreate adds a staff account, asking for its password, e.g.
+//
+//	./bookings user create -email=owner@example.com -first-name=Jane -last-name=Doe
+func runUserCreate(args []string) error {
+	fs := commandFlags("user create", "user create [flags]")
+	email := fs.String("email", "", "Email address the user signs in with")
+	firstName := fs.String("first-name", "", "First name")
+	lastName := fs.String("last-name", "", "Last name")
+
+	repo, db, err := connect(fs, args)
+	if err != nil {
+		return err
+	}
+	defer db.SQL.Close()
+
+	*email = strings.ToLower(strings.TrimSpace(*email))
+	if !govalidator.IsEmail(*email) {
+		return fmt.Errorf("invalid -email %q", *email)
+	}
+
+	password, err := readPassword(bufio.NewReader(os.Stdin), os.Stderr)
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := commandContext()
+	defer stop()
+
+	_, err = repo.GetUserByEmail(ctx, *email)
+	if err == nil {
+		return fmt.Errorf("there is a user with the email %s already", *email)
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+
+	id, err := repo.InsertUser(ctx, models.User{
+		FirstName:  *firstName,
+		LastName:   *lastName,
+		Email:      *email,
+		AcessLevel: models.AccessLevelAdmin,
+	}, password)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("created user %d, %s\n", id, *email)
+	return nil
+}
+
+// runUserPasswd sets the password of a user, asking for it, e.g.
+//
+//	./bookings user passwd owner@example.com
+func runUserPasswd(args []string) error {
+	fs := commandFlags("user passwd", "user passwd [flags] email")
+
+	repo, db, err := connect(fs, args)
+	if err != nil {
+		return err
+	}
+	defer db.SQL.Close()
+
+	email, err := oneArg(fs, "email")
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := commandContext()
+	defer stop()
+
+	u, err := findUser(repo.GetUserByEmail(ctx, strings.ToLower(email)))
+	if err != nil {
+		return err
+	}
+
+	password, err := readPassword(bufio.NewReader(os.Stdin), os.Stderr)
+	if err != nil {
+		return err
+	}
+
+	err = repo.UpdateUserPassword(ctx, u.ID, password)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("password of %s changed\n", u.Email)
+	return nil
+}
+
+// runUserDisable stops a user from signing in, e.g.
+//
+//	./bookings user disable former@example.com
+func runUserDisable(args []string) error {
+	fs := commandFlags("user disable", "user disable [flags] email")
+
+	repo, db, err := connect(fs, args)
+	if err != nil {
+		return err
+	}
+	defer db.SQL.Close()
+
+	email, err := oneArg(fs, "email")
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := commandContext()
+	defer stop()
+
+	u, err := findUser(repo.GetUserByEmail(ctx, strings.ToLower(email)))
+	if err != nil {
+		return err
+	}
+	if !u.DisabledAt.IsZero() {
+		fmt.Printf("%s was disabled on %s\n", u.Email, u.DisabledAt.Format("2006-01-02"))
+		return nil
+	}
+
+	err = repo.DisableUser(ctx, u.ID)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%s disabled\n", u.Email)
+	return nil
+}
+
+// findUser turns the missing user of a lookup into a readable error.
+func findUser(u models.User, err error) (models.User, error) {
+	if errors.Is(err, sql.ErrNoRows) {
+		return u, errors.New("there is no user with this email")
+	}
+	return u, err
+}
@@ -1,17 +1,26 @@
 package handlers
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/GitEagleY/BookingsWebApp/internal/cancellation"
+	"github.com/GitEagleY/BookingsWebApp/internal/logging"
 	"github.com/GitEagleY/BookingsWebApp/internal/models"
+	"github.com/GitEagleY/BookingsWebApp/internal/payments"
+	"github.com/GitEagleY/BookingsWebApp/internal/repository"
+	"github.com/go-chi/chi/v5"
 )
 
 // /////////////////////////////////////////////////////////////
@@ -30,6 +39,27 @@ var theTests = []struct {
 	{"majors-suite", "/majors-suite", "GET", http.StatusOK},
 	{"search-availability", "/search-availability", "GET", http.StatusOK},
 	{"contact", "/contact", "GET", http.StatusOK},
+	{"waitlist", "/waitlist?s=2050-01-01&e=2050-01-02", "GET", http.StatusOK},
+	{"cancel-reservation", "/cancel-reservation", "GET", http.StatusOK},
+	{"admin-new-reservations", "/admin/reservations-new?q=smith&sort=last_name&dir=desc", "GET", http.StatusOK},
+	{"admin-all-reservations", "/admin/reservations-all?room=1&from=2050-01-01&to=2050-02-01&status=new", "GET", http.StatusOK},
+	{"admin-reservations-bad-cursor", "/admin/reservations-all?after=invalid", "GET", http.StatusBadRequest},
+	{"admin-export-csv", "/admin/reservations/export?format=csv&room=1", "GET", http.StatusOK},
+	{"admin-export-xlsx", "/admin/reservations/export?format=xlsx", "GET", http.StatusOK},
+	{"admin-export-unknown-format", "/admin/reservations/export?format=pdf", "GET", http.StatusBadRequest},
+	{"admin-import", "/admin/import", "GET", http.StatusOK},
+	{"admin-taxes", "/admin/taxes", "GET", http.StatusOK},
+	{"admin-promotions", "/admin/promotions", "GET", http.StatusOK},
+	{"admin-redemptions", "/admin/promotions/redemptions", "GET", http.StatusOK},
+	{"admin-redemptions-code", "/admin/promotions/redemptions?code=summer", "GET", http.StatusOK},
+	{"admin-redemptions-error", "/admin/promotions/redemptions?code=fail", "GET", http.StatusInternalServerError},
+	{"admin-dashboard", "/admin/dashboard", "GET", http.StatusOK},
+	{"admin-new-reservation", "/admin/new-reservation", "GET", http.StatusOK},
+	{"admin-dashboard-range", "/admin/dashboard?from=2050-01-01&to=2050-03-31", "GET", http.StatusOK},
+	{"admin-dashboard-occupancy", "/admin/dashboard/occupancy?from=2050-01-01&to=2050-03-31", "GET", http.StatusOK},
+	{"admin-dashboard-bookings", "/admin/dashboard/bookings", "GET", http.StatusOK},
+	{"admin-guests", "/admin/guests?q=smith", "GET", http.StatusOK},
+	{"admin-guests-error", "/admin/guests?q=error", "GET", http.StatusInternalServerError},
 }
 
 func TestHandlers(t *testing.T) {
@@ -250,7 +280,7 @@ func TestRepository_PostReservation(t *testing.T) {
 	if rr.Code != http.StatusSeeOther {
 		t.Errorf("Post reservation handler returned wrong response code for invalid data: got %d, wanted %d", rr.Code, http.StatusSeeOther)
 	}
-	//test for failure for insert reservation into db
+	//test for the room being taken since the guest searched
 	reqBody = "start_date=2050-01-01"
 	reqBody = fmt.Sprintf("%s&%s", reqBody, "end_date=2050-01-02")
 	reqBody = fmt.Sprintf("%s&%s", reqBody, "first_name=John")
@@ -269,9 +299,12 @@ func TestRepository_PostReservation(t *testing.T) {
 
 	handler.ServeHTTP(rr, req)
 	if rr.Code != http.StatusSeeOther {
-		t.Errorf("Post reservation failed when trying to fail inserting reservation: got %d, wanted %d", rr.Code, http.StatusSeeOther)
+		t.Errorf("Post reservation failed when the room was taken: got %d, wanted %d", rr.Code, http.StatusSeeOther)
 	}
-	//test for failure for insert restriction into db
+	if loc, _ := rr.Result().Location(); loc == nil || loc.String() != "/search-availability" {
+		t.Errorf("Post reservation sent the guest to %v when the room was taken, wanted /search-availability", loc)
+	}
+	//test for failure for insert reservation into db
 	reqBody = "start_date=2050-01-01"
 	reqBody = fmt.Sprintf("%s&%s", reqBody, "end_date=2050-01-02")
 	reqBody = fmt.Sprintf("%s&%s", reqBody, "first_name=John")
@@ -292,6 +325,9 @@ func TestRepository_PostReservation(t *testing.T) {
 	if rr.Code != http.StatusSeeOther {
 		t.Errorf("Post reservation failed when trying to fail inserting reservation: got %d, wanted %d", rr.Code, http.StatusSeeOther)
 	}
+	if loc, _ := rr.Result().Location(); loc == nil || loc.String() != "/" {
+		t.Errorf("Post reservation sent the guest to %v when the insert failed, wanted /", loc)
+	}
 }
 
 // /////////////////////////////////////////////////////////////
@@ -811,6 +847,233 @@ func TestChooseRoom(t *testing.T) {
 	}
 }*/
 
+// chooseRoomHoldTests is the data for the hold ChooseRoom places on the selected room
+var chooseRoomHoldTests = []struct {
+	name               string
+	roomID             string
+	expectedLocation   string
+	expectedHoldPlaced bool
+}{
+	{
+		name:               "room-held",
+		roomID:             "1",
+		expectedLocation:   "/make-reservation",
+		expectedHoldPlaced: true,
+	},
+	{
+		name:               "room-already-taken",
+		roomID:             "2",
+		expectedLocation:   "/search-availability",
+		expectedHoldPlaced: false,
+	},
+}
+
+// TestChooseRoomHold tests that ChooseRoom holds the room, or sends the guest back when it is taken
+func TestChooseRoomHold(t *testing.T) {
+	for _, e := range chooseRoomHoldTests {
+		req, _ := http.NewRequest("GET", "/choose-room/"+e.roomID, nil)
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("id", e.roomID)
+		ctx := getCtx(req)
+		ctx = context.WithValue(ctx, chi.RouteCtxKey, rctx)
+		req = req.WithContext(ctx)
+
+		session.Put(ctx, "reservation", models.Reservation{
+			StartDate: time.Date(2050, 1, 1, 0, 0, 0, 0, time.UTC),
+			EndDate:   time.Date(2050, 1, 2, 0, 0, 0, 0, time.UTC),
+		})
+
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(Repo.ChooseRoom)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusSeeOther {
+			t.Errorf("%s returned wrong response code: got %d, wanted %d", e.name, rr.Code, http.StatusSeeOther)
+		}
+
+		actualLoc, _ := rr.Result().Location()
+		if actualLoc.String() != e.expectedLocation {
+			t.Errorf("failed %s: expected location %s, but got location %s", e.name, e.expectedLocation, actualLoc.String())
+		}
+
+		if session.Exists(ctx, "hold_id") != e.expectedHoldPlaced {
+			t.Errorf("failed %s: expected hold placed to be %t", e.name, e.expectedHoldPlaced)
+		}
+	}
+}
+
+// TestPostReservationWithHold tests that PostReservation converts the guest's hold
+func TestPostReservationWithHold(t *testing.T) {
+	postedData := url.Values{}
+	postedData.Add("start_date", "2050-01-01")
+	postedData.Add("end_date", "2050-01-02")
+	postedData.Add("first_name", "John")
+	postedData.Add("last_name", "Smith")
+	postedData.Add("email", "john@smith.com")
+	postedData.Add("room_id", "1")
+	postedData.Add("phone", "1231231234")
+
+	req, _ := http.NewRequest("POST", "/make-reservation", strings.NewReader(postedData.Encode()))
+	ctx := getCtx(req)
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	session.Put(ctx, "hold_id", 1)
+
+	rr := httptest.NewRecorder()
+	handler := http.HandlerFunc(Repo.PostReservation)
+	handler.ServeHTTP(rr, req)
+
+	actualLoc, _ := rr.Result().Location()
+	if rr.Code != http.StatusSeeOther || actualLoc.String() != "/reservation-summary" {
+		t.Errorf("PostReservation with hold: got %d to %s, wanted %d to /reservation-summary", rr.Code, actualLoc.String(), http.StatusSeeOther)
+	}
+	if session.Exists(ctx, "hold_id") {
+		t.Error("hold was not cleared from the session after converting it")
+	}
+
+	// the hold expired and the room was taken in the meantime
+	postedData.Set("room_id", "2")
+	req, _ = http.NewRequest("POST", "/make-reservation", strings.NewReader(postedData.Encode()))
+	ctx = getCtx(req)
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	session.Put(ctx, "hold_id", 1)
+
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	actualLoc, _ = rr.Result().Location()
+	if rr.Code != http.StatusSeeOther || actualLoc.String() != "/search-availability" {
+		t.Errorf("PostReservation with lost hold: got %d to %s, wanted %d to /search-availability", rr.Code, actualLoc.String(), http.StatusSeeOther)
+	}
+}
+
+// postWaitlistTests is the data for the PostWaitlist handler tests
+var postWaitlistTests = []struct {
+	name               string
+	postedData         url.Values
+	expectedStatusCode int
+	expectedLocation   string
+}{
+	{
+		name: "valid-entry",
+		postedData: url.Values{
+			"first_name": {"John"},
+			"email":      {"john@smith.com"},
+			"start_date": {"2050-01-01"},
+			"end_date":   {"2050-01-02"},
+			"room_id":    {"0"},
+		},
+		expectedStatusCode: http.StatusSeeOther,
+		expectedLocation:   "/",
+	},
+	{
+		name: "invalid-email",
+		postedData: url.Values{
+			"first_name": {"John"},
+			"email":      {"john"},
+			"start_date": {"2050-01-01"},
+			"end_date":   {"2050-01-02"},
+		},
+		expectedStatusCode: http.StatusOK,
+	},
+	{
+		name: "departure-before-arrival",
+		postedData: url.Values{
+			"first_name": {"John"},
+			"email":      {"john@smith.com"},
+			"start_date": {"2050-01-02"},
+			"end_date":   {"2050-01-01"},
+		},
+		expectedStatusCode: http.StatusOK,
+	},
+	{
+		name: "database-fails",
+		postedData: url.Values{
+			"first_name": {"John"},
+			"email":      {"john@smith.com"},
+			"start_date": {"2050-01-01"},
+			"end_date":   {"2050-01-02"},
+			"room_id":    {"2"},
+		},
+		expectedStatusCode: http.StatusSeeOther,
+		expectedLocation:   "/",
+	},
+}
+
+// TestPostWaitlist tests the PostWaitlist handler
+func TestPostWaitlist(t *testing.T) {
+	for _, e := range postWaitlistTests {
+		req, _ := http.NewRequest("POST", "/waitlist", strings.NewReader(e.postedData.Encode()))
+		ctx := getCtx(req)
+		req = req.WithContext(ctx)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(Repo.PostWaitlist)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("%s returned wrong response code: got %d, wanted %d", e.name, rr.Code, e.expectedStatusCode)
+		}
+
+		if e.expectedLocation != "" {
+			actualLoc, _ := rr.Result().Location()
+			if actualLoc.String() != e.expectedLocation {
+				t.Errorf("failed %s: expected location %s, but got location %s", e.name, e.expectedLocation, actualLoc.String())
+			}
+		}
+	}
+}
+
+// waitlistBookTests is the data for the WaitlistBook handler tests, /waitlist/book/{token}
+var waitlistBookTests = []struct {
+	name             string
+	token            string
+	expectedLocation string
+}{
+	{
+		name:             "valid-link",
+		token:            "abc",
+		expectedLocation: "/make-reservation",
+	},
+	{
+		name:             "expired-link",
+		token:            "expired",
+		expectedLocation: "/search-availability",
+	},
+	{
+		name:             "any-room-taken-again",
+		token:            "any-room",
+		expectedLocation: "/search-availability",
+	},
+}
+
+// TestWaitlistBook tests the WaitlistBook handler
+func TestWaitlistBook(t *testing.T) {
+	for _, e := range waitlistBookTests {
+		req, _ := http.NewRequest("GET", "/waitlist/book/"+e.token, nil)
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("token", e.token)
+		ctx := getCtx(req)
+		ctx = context.WithValue(ctx, chi.RouteCtxKey, rctx)
+		req = req.WithContext(ctx)
+
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(Repo.WaitlistBook)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusSeeOther {
+			t.Errorf("%s returned wrong response code: got %d, wanted %d", e.name, rr.Code, http.StatusSeeOther)
+		}
+
+		actualLoc, _ := rr.Result().Location()
+		if actualLoc.String() != e.expectedLocation {
+			t.Errorf("failed %s: expected location %s, but got location %s", e.name, e.expectedLocation, actualLoc.String())
+		}
+	}
+}
+
 // bookRoomTests is the data for the BookRoom handler tests
 var bookRoomTests = []struct {
 	name               string
@@ -1088,7 +1351,7 @@ var adminDeleteReservationTests = []struct {
 
 func TestAdminDeleteReservation(t *testing.T) {
 	for _, e := range adminDeleteReservationTests {
-		req, _ := http.NewRequest("GET", fmt.Sprintf("/admin/process-reservation/cal/1/do%s", e.queryParams), nil)
+		req, _ := http.NewRequest("POST", fmt.Sprintf("/admin/delete-reservation/cal/1%s", e.queryParams), nil)
 		ctx := getCtx(req)
 		req = req.WithContext(ctx)
 
@@ -1103,11 +1366,1753 @@ func TestAdminDeleteReservation(t *testing.T) {
 	}
 }
 
-// gets the context
-func getCtx(req *http.Request) context.Context {
-	ctx, err := session.Load(req.Context(), req.Header.Get("X-Session"))
-	if err != nil {
-		log.Println(err)
+// reservationFilterTests is the data for building admin list filters from query parameters
+var reservationFilterTests = []struct {
+	name     string
+	query    string
+	expected models.ReservationFilter
+}{
+	{
+		name:  "defaults",
+		query: "",
+		expected: models.ReservationFilter{
+			SortBy: "start_date",
+			Limit:  reservationsPerPage,
+		},
+	},
+	{
+		name:  "all-parameters",
+		query: "q=+smith+&room=2&from=2050-01-01&to=2050-01-31&status=processed&sort=last_name&dir=desc&after=abc",
+		expected: models.ReservationFilter{
+			Query:    "smith",
+			RoomID:   2,
+			From:     time.Date(2050, 1, 1, 0, 0, 0, 0, time.UTC),
+			To:       time.Date(2050, 1, 31, 0, 0, 0, 0, time.UTC),
+			Status:   "processed",
+			SortBy:   "last_name",
+			SortDesc: true,
+			After:    "abc",
+			Limit:    reservationsPerPage,
+		},
+	},
+	{
+		name:  "unknown-sort-and-status",
+		query: "sort=password&status=deleted&from=yesterday",
+		expected: models.ReservationFilter{
+			SortBy: "start_date",
+			Limit:  reservationsPerPage,
+		},
+	},
+}
+
+// TestReservationFilterFromQuery tests parsing the admin list query parameters
+func TestReservationFilterFromQuery(t *testing.T) {
+	for _, e := range reservationFilterTests {
+		q, _ := url.ParseQuery(e.query)
+		f := reservationFilterFromQuery(q)
+		if f != e.expected {
+			t.Errorf("failed %s: expected %+v, but got %+v", e.name, e.expected, f)
+		}
+	}
+}
+
+// adminMoveReservationTests is the data for changing the room and dates on the admin detail page
+var adminMoveReservationTests = []struct {
+	name             string
+	postedData       url.Values
+	expectedLocation string
+}{
+	{
+		name: "move",
+		postedData: url.Values{
+			"room_id":      {"1"},
+			"start_date":   {"2050-01-01"},
+			"end_date":     {"2050-01-03"},
+			"notify_guest": {"1"},
+		},
+		expectedLocation: "/admin/reservations-all",
+	},
+	{
+		name:             "guest-details-only",
+		postedData:       url.Values{"first_name": {"John"}},
+		expectedLocation: "/admin/reservations-all",
+	},
+	{
+		name: "room-taken",
+		postedData: url.Values{
+			"room_id":    {"2"},
+			"start_date": {"2050-01-01"},
+			"end_date":   {"2050-01-03"},
+		},
+		expectedLocation: "/admin/reservations/all/1",
+	},
+	{
+		name: "departure-before-arrival",
+		postedData: url.Values{
+			"room_id":    {"1"},
+			"start_date": {"2050-01-03"},
+			"end_date":   {"2050-01-01"},
+		},
+		expectedLocation: "/admin/reservations/all/1",
+	},
+	{
+		name: "invalid-date",
+		postedData: url.Values{
+			"room_id":    {"1"},
+			"start_date": {"invalid"},
+			"end_date":   {"2050-01-03"},
+		},
+		expectedLocation: "/admin/reservations/all/1",
+	},
+	{
+		name:             "invalid-room",
+		postedData:       url.Values{"room_id": {"invalid"}},
+		expectedLocation: "/admin/reservations/all/1",
+	},
+	{
+		name:             "more-guests",
+		postedData:       url.Values{"room_id": {"1"}, "guests": {"4"}},
+		expectedLocation: "/admin/reservations-all",
+	},
+	{
+		name:             "invalid-guests",
+		postedData:       url.Values{"guests": {"0"}},
+		expectedLocation: "/admin/reservations/all/1",
+	},
+}
+
+// TestAdminMoveReservation tests changing the room and dates of a reservation
+func TestAdminMoveReservation(t *testing.T) {
+	for _, e := range adminMoveReservationTests {
+		req, _ := http.NewRequest("POST", "/admin/reservations/all/1", strings.NewReader(e.postedData.Encode()))
+		ctx := getCtx(req)
+		req = req.WithContext(ctx)
+		req.RequestURI = "/admin/reservations/all/1"
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(Repo.AdminPostShowReservation)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusSeeOther {
+			t.Errorf("failed %s: expected code %d, but got %d", e.name, http.StatusSeeOther, rr.Code)
+		}
+
+		actualLoc, _ := rr.Result().Location()
+		if actualLoc.String() != e.expectedLocation {
+			t.Errorf("failed %s: expected location %s, but got location %s", e.name, e.expectedLocation, actualLoc.String())
+		}
+	}
+}
+
+// pricedRepo is the test repository of a two night stay in room 1 booked at 125.00 a night with the SUMMER
+// promo code, keeping the reservation saved.
+type pricedRepo struct {
+	repository.DatabaseRepo
+	saved *models.Reservation
+}
+
+func (p pricedRepo) GetReservationByID(ctx context.Context, id int) (models.Reservation, error) {
+	return models.Reservation{
+		ID:            id,
+		RoomID:        1,
+		Email:         "john@smith.com",
+		StartDate:     time.Date(2050, 1, 1, 0, 0, 0, 0, time.UTC),
+		EndDate:       time.Date(2050, 1, 3, 0, 0, 0, 0, time.UTC),
+		Guests:        1,
+		Amount:        25000,
+		PromotionCode: "SUMMER",
+		Discount:      2500,
+	}, nil
+}
+
+func (p pricedRepo) UpdateReservation(ctx context.Context, u models.Reservation) error {
+	*p.saved = u
+	return nil
+}
+
+// TestAdminPostShowReservationPrice tests that the price agreed when booking is kept unless the stay moves
+func TestAdminPostShowReservationPrice(t *testing.T) {
+	db := Repo.DB
+	defer func() { Repo.DB = db }()
+
+	tests := []struct {
+		name             string
+		postedData       url.Values
+		expectedAmount   int
+		expectedDiscount int
+	}{
+		{
+			name:             "contact-details",
+			postedData:       url.Values{"email": {"john@example.com"}, "phone": {"555-555-5555"}},
+			expectedAmount:   25000,
+			expectedDiscount: 2500,
+		},
+		{
+			name:             "more-guests",
+			postedData:       url.Values{"guests": {"2"}},
+			expectedAmount:   25000,
+			expectedDiscount: 2500,
+		},
+		{
+			// room 1 is 100.00 a night now, and SUMMER takes 10% off
+			name:             "longer-stay",
+			postedData:       url.Values{"start_date": {"2050-01-01"}, "end_date": {"2050-01-04"}},
+			expectedAmount:   30000,
+			expectedDiscount: 3000,
+		},
+	}
+
+	for _, e := range tests {
+		var saved models.Reservation
+		Repo.DB = pricedRepo{DatabaseRepo: db, saved: &saved}
+
+		req, _ := http.NewRequest("POST", "/admin/reservations/all/1", strings.NewReader(e.postedData.Encode()))
+		req = req.WithContext(getCtx(req))
+		req.RequestURI = "/admin/reservations/all/1"
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(Repo.AdminPostShowReservation).ServeHTTP(rr, req)
+
+		if saved.Amount != e.expectedAmount || saved.Discount != e.expectedDiscount {
+			t.Errorf("%s: expected amount %d and discount %d, got %d and %d", e.name, e.expectedAmount,
+				e.expectedDiscount, saved.Amount, saved.Discount)
+		}
+	}
+}
+
+// adminNewReservationTests is the data for the AdminPostNewReservation handler tests
+var adminNewReservationTests = []struct {
+	name               string
+	postedData         url.Values
+	expectedStatusCode int
+	expectedLocation   string
+	expectedHTML       string
+}{
+	{
+		name: "valid",
+		postedData: url.Values{
+			"first_name":   {"John"},
+			"last_name":    {"Smith"},
+			"email":        {"john@smith.com"},
+			"room_id":      {"1"},
+			"start_date":   {"2050-01-01"},
+			"end_date":     {"2050-01-03"},
+			"source":       {"phone"},
+			"status":       {"processed"},
+			"note":         {"arrives late"},
+			"notify_guest": {"1"},
+		},
+		expectedStatusCode: http.StatusSeeOther,
+		expectedLocation:   "/admin/reservations/all/1",
+	},
+	{
+		name: "room-taken",
+		postedData: url.Values{
+			"first_name": {"John"},
+			"last_name":  {"Smith"},
+			"email":      {"john@smith.com"},
+			"room_id":    {"2"},
+			"start_date": {"2050-01-01"},
+			"end_date":   {"2050-01-03"},
+			"source":     {"walk-in"},
+			"status":     {"new"},
+		},
+		expectedStatusCode: http.StatusOK,
+		expectedHTML:       "The room is not available for these dates",
+	},
+	{
+		name: "invalid",
+		postedData: url.Values{
+			"first_name": {"John"},
+			"email":      {"john"},
+			"room_id":    {"1"},
+			"start_date": {"2050-01-03"},
+			"end_date":   {"2050-01-01"},
+			"source":     {"website"},
+			"status":     {"new"},
+		},
+		expectedStatusCode: http.StatusOK,
+		expectedHTML:       "Departure must be after arrival",
+	},
+	{
+		name: "unknown-room",
+		postedData: url.Values{
+			"first_name": {"John"},
+			"last_name":  {"Smith"},
+			"email":      {"john@smith.com"},
+			"room_id":    {"3"},
+			"start_date": {"2050-01-01"},
+			"end_date":   {"2050-01-03"},
+			"source":     {"email"},
+			"status":     {"new"},
+		},
+		expectedStatusCode: http.StatusOK,
+		expectedHTML:       "Choose a room",
+	},
+}
+
+// TestAdminPostNewReservation tests the AdminPostNewReservation handler
+func TestAdminPostNewReservation(t *testing.T) {
+	for _, e := range adminNewReservationTests {
+		req, _ := http.NewRequest("POST", "/admin/new-reservation", strings.NewReader(e.postedData.Encode()))
+		ctx := getCtx(req)
+		req = req.WithContext(ctx)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(Repo.AdminPostNewReservation)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("failed %s: expected code %d, but got %d", e.name, e.expectedStatusCode, rr.Code)
+		}
+
+		if e.expectedLocation != "" {
+			actualLoc, _ := rr.Result().Location()
+			if actualLoc.String() != e.expectedLocation {
+				t.Errorf("failed %s: expected location %s, but got location %s", e.name, e.expectedLocation, actualLoc.String())
+			}
+		}
+
+		if e.expectedHTML != "" && !strings.Contains(rr.Body.String(), e.expectedHTML) {
+			t.Errorf("failed %s: expected to find %s but did not", e.name, e.expectedHTML)
+		}
+	}
+}
+
+// dashboardRangeTests is the data for the dashboardRange tests
+var dashboardRangeTests = []struct {
+	name          string
+	query         string
+	expectedStart string
+	expectedEnd   string
+}{
+	{"default", "", "2049-10-01", "2050-04-01"},
+	{"range", "from=2050-01-10&to=2050-01-20", "2050-01-10", "2050-01-21"},
+	{"reversed", "from=2050-01-20&to=2050-01-10", "2049-10-01", "2050-04-01"},
+	{"invalid", "from=yesterday&to=2050-01-10", "2049-10-01", "2050-04-01"},
+}
+
+// TestDashboardRange tests parsing the dashboard date range
+func TestDashboardRange(t *testing.T) {
+	today := time.Date(2050, 3, 15, 0, 0, 0, 0, time.UTC)
+
+	for _, e := range dashboardRangeTests {
+		q, _ := url.ParseQuery(e.query)
+		start, end := dashboardRange(q, today)
+		if start.Format("2006-01-02") != e.expectedStart || end.Format("2006-01-02") != e.expectedEnd {
+			t.Errorf("failed %s: expected %s to %s, but got %s to %s", e.name, e.expectedStart, e.expectedEnd,
+				start.Format("2006-01-02"), end.Format("2006-01-02"))
+		}
+	}
+}
+
+// TestAdminDashboardOccupancy tests the occupancy chart data
+func TestAdminDashboardOccupancy(t *testing.T) {
+	req, _ := http.NewRequest("GET", "/admin/dashboard/occupancy?from=2050-01-01&to=2050-02-28", nil)
+	ctx := getCtx(req)
+	req = req.WithContext(ctx)
+
+	rr := httptest.NewRecorder()
+	handler := http.HandlerFunc(Repo.AdminDashboardOccupancy)
+	handler.ServeHTTP(rr, req)
+
+	var chart chartData
+	err := json.Unmarshal(rr.Body.Bytes(), &chart)
+	if err != nil {
+		t.Fatal("failed to parse json", err)
+	}
+
+	if len(chart.Labels) != 2 || chart.Labels[0] != "Jan 2050" {
+		t.Errorf("expected a label per month, got %v", chart.Labels)
+	}
+	if len(chart.Datasets) != 2 || chart.Datasets[0].Label != "Generals Quarters" {
+		t.Fatalf("expected a dataset per room, got %+v", chart.Datasets)
+	}
+	if chart.Datasets[0].Data[0] != 50 || chart.Datasets[1].Data[0] != 10 {
+		t.Errorf("expected occupancy of 50%% and 10%%, got %v and %v", chart.Datasets[0].Data, chart.Datasets[1].Data)
+	}
+}
+
+// adminImportTests is the data for the AdminPostImport handler tests
+var adminImportTests = []struct {
+	name               string
+	file               string
+	fields             map[string]string
+	expectedStatusCode int
+	expectedLocation   string
+}{
+	{
+		name:               "dry-run",
+		file:               "First Name,Last Name,Email,Phone,Room,Arrival,Departure\nJohn,Smith,john@smith.com,,1,2050-01-01,2050-01-02\n",
+		fields:             map[string]string{"dry_run": "1"},
+		expectedStatusCode: http.StatusOK,
+	},
+	{
+		name:               "import",
+		file:               "First Name,Last Name,Email,Phone,Room,Arrival,Departure\nJohn,Smith,john@smith.com,,1,2050-01-01,2050-01-02\n",
+		expectedStatusCode: http.StatusOK,
+	},
+	{
+		name:               "mapped-columns",
+		file:               "guest,surname,mail,unit,in,out\nJohn,Smith,john@smith.com,1,2050-01-01,2050-01-02\n",
+		fields:             map[string]string{"map_first_name": "guest", "map_last_name": "surname", "map_email": "mail", "map_room": "unit", "map_start_date": "in", "map_end_date": "out"},
+		expectedStatusCode: http.StatusOK,
+	},
+	{
+		name:               "unmapped-columns",
+		file:               "guest,surname\nJohn,Smith\n",
+		expectedStatusCode: http.StatusSeeOther,
+		expectedLocation:   "/admin/import",
+	},
+	{
+		name:               "no-file",
+		expectedStatusCode: http.StatusSeeOther,
+		expectedLocation:   "/admin/import",
+	},
+}
+
+// TestAdminPostImport tests the AdminPostImport handler
+func TestAdminPostImport(t *testing.T) {
+	for _, e := range adminImportTests {
+		var body bytes.Buffer
+		mw := multipart.NewWriter(&body)
+		for k, v := range e.fields {
+			_ = mw.WriteField(k, v)
+		}
+		if e.file != "" {
+			fw, _ := mw.CreateFormFile("file", "reservations.csv")
+			_, _ = fw.Write([]byte(e.file))
+		}
+		mw.Close()
+
+		req, _ := http.NewRequest("POST", "/admin/import", &body)
+		ctx := getCtx(req)
+		req = req.WithContext(ctx)
+		req.Header.Set("Content-Type", mw.FormDataContentType())
+
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(Repo.AdminPostImport)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("%s returned wrong response code: got %d, wanted %d", e.name, rr.Code, e.expectedStatusCode)
+		}
+
+		if e.expectedLocation != "" {
+			actualLoc, _ := rr.Result().Location()
+			if actualLoc.String() != e.expectedLocation {
+				t.Errorf("failed %s: expected location %s, but got location %s", e.name, e.expectedLocation, actualLoc.String())
+			}
+		}
+	}
+}
+
+// adminGuestTests is the data for the AdminPostGuest and AdminMergeGuest handler tests
+var adminGuestTests = []struct {
+	name             string
+	merge            bool
+	guestID          string
+	postedData       url.Values
+	expectedStatus   int
+	expectedLocation string
+}{
+	{
+		name:             "update",
+		guestID:          "1",
+		postedData:       url.Values{"email": {"john@smith.com"}, "tags": {"VIP, vip, , do-not-rebook"}},
+		expectedStatus:   http.StatusSeeOther,
+		expectedLocation: "/admin/guests/1",
+	},
+	{
+		name:             "update-invalid-email",
+		guestID:          "1",
+		postedData:       url.Values{"email": {"john"}},
+		expectedStatus:   http.StatusSeeOther,
+		expectedLocation: "/admin/guests/1",
+	},
+	{
+		name:             "update-email-taken",
+		guestID:          "1",
+		postedData:       url.Values{"email": {"jane@smith.com"}},
+		expectedStatus:   http.StatusSeeOther,
+		expectedLocation: "/admin/guests/1",
+	},
+	{
+		name:           "update-missing-guest",
+		guestID:        "3",
+		postedData:     url.Values{"email": {"john@smith.com"}},
+		expectedStatus: http.StatusInternalServerError,
+	},
+	{
+		name:             "merge",
+		merge:            true,
+		guestID:          "1",
+		postedData:       url.Values{"merge_id": {"2"}},
+		expectedStatus:   http.StatusSeeOther,
+		expectedLocation: "/admin/guests/1",
+	},
+	{
+		name:             "merge-into-itself",
+		merge:            true,
+		guestID:          "1",
+		postedData:       url.Values{"merge_id": {"1"}},
+		expectedStatus:   http.StatusSeeOther,
+		expectedLocation: "/admin/guests/1",
+	},
+	{
+		name:           "merge-error",
+		merge:          true,
+		guestID:        "1",
+		postedData:     url.Values{"merge_id": {"3"}},
+		expectedStatus: http.StatusInternalServerError,
+	},
+}
+
+// TestAdminPostGuest tests saving and merging guest profiles
+func TestAdminPostGuest(t *testing.T) {
+	for _, e := range adminGuestTests {
+		req, _ := http.NewRequest("POST", "/admin/guests/"+e.guestID, strings.NewReader(e.postedData.Encode()))
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("id", e.guestID)
+		ctx := getCtx(req)
+		ctx = context.WithValue(ctx, chi.RouteCtxKey, rctx)
+		req = req.WithContext(ctx)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(Repo.AdminPostGuest)
+		if e.merge {
+			handler = Repo.AdminMergeGuest
+		}
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatus {
+			t.Errorf("failed %s: expected code %d, but got %d", e.name, e.expectedStatus, rr.Code)
+		}
+
+		if e.expectedLocation != "" {
+			actualLoc, _ := rr.Result().Location()
+			if actualLoc.String() != e.expectedLocation {
+				t.Errorf("failed %s: expected location %s, but got location %s", e.name, e.expectedLocation, actualLoc.String())
+			}
+		}
+	}
+}
+
+// adminShowGuestTests is the data for the AdminShowGuest handler tests
+var adminShowGuestTests = []struct {
+	name               string
+	guestID            string
+	expectedStatusCode int
+}{
+	{"found", "1", http.StatusOK},
+	{"missing", "3", http.StatusInternalServerError},
+	{"bad-id", "x", http.StatusBadRequest},
+}
+
+// TestAdminShowGuest tests the guest profile page
+func TestAdminShowGuest(t *testing.T) {
+	for _, e := range adminShowGuestTests {
+		req, _ := http.NewRequest("GET", "/admin/guests/"+e.guestID, nil)
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("id", e.guestID)
+		ctx := getCtx(req)
+		ctx = context.WithValue(ctx, chi.RouteCtxKey, rctx)
+		req = req.WithContext(ctx)
+
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(Repo.AdminShowGuest)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("failed %s: expected code %d, but got %d", e.name, e.expectedStatusCode, rr.Code)
+		}
+	}
+}
+
+// TestParseTags tests that tags are trimmed and de-duplicated
+func TestParseTags(t *testing.T) {
+	tags := parseTags(" VIP, vip,, do-not-rebook ,")
+	if len(tags) != 2 || tags[0] != "VIP" || tags[1] != "do-not-rebook" {
+		t.Errorf("unexpected tags %q", tags)
+	}
+
+	if tags := parseTags(""); len(tags) != 0 {
+		t.Errorf("expected no tags, got %q", tags)
+	}
+}
+
+// TestPostReservationSpecialRequests tests that the special requests of the guest are kept with the reservation
+func TestPostReservationSpecialRequests(t *testing.T) {
+	postedData := url.Values{
+		"start_date":       {"2050-01-01"},
+		"end_date":         {"2050-01-02"},
+		"first_name":       {"John"},
+		"last_name":        {"Smith"},
+		"email":            {"john@smith.com"},
+		"room_id":          {"1"},
+		"special_requests": {"  Late arrival, around midnight  "},
+	}
+
+	req, _ := http.NewRequest("POST", "/make-reservation", strings.NewReader(postedData.Encode()))
+	ctx := getCtx(req)
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	rr := httptest.NewRecorder()
+	handler := http.HandlerFunc(Repo.PostReservation)
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusSeeOther {
+		t.Fatalf("PostReservation returned wrong response code: got %d, wanted %d", rr.Code, http.StatusSeeOther)
+	}
+
+	res, ok := session.Get(ctx, "reservation").(models.Reservation)
+	if !ok {
+		t.Fatal("reservation not stored in the session")
+	}
+	if res.SpecialRequests != "Late arrival, around midnight" {
+		t.Errorf("expected trimmed special requests, got %q", res.SpecialRequests)
+	}
+
+	// too long special requests show the form again
+	postedData.Set("special_requests", strings.Repeat("a", specialRequestsMaxLength+1))
+	req, _ = http.NewRequest("POST", "/make-reservation", strings.NewReader(postedData.Encode()))
+	ctx = getCtx(req)
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	if session.Exists(ctx, "reservation") {
+		t.Error("reservation stored although the special requests are too long")
+	}
+}
+
+// reservationNoteTests is the data for the AdminPostReservationNote and AdminPinReservationNote handler tests
+var reservationNoteTests = []struct {
+	name             string
+	pin              bool
+	noteID           string
+	postedData       url.Values
+	expectedStatus   int
+	expectedLocation string
+	expectedFlash    string
+}{
+	{
+		name:             "note",
+		postedData:       url.Values{"body": {"Arrives late"}, "pinned": {"1"}},
+		expectedStatus:   http.StatusSeeOther,
+		expectedLocation: "/admin/reservations/all/1#notes",
+		expectedFlash:    "Note added",
+	},
+	{
+		name:             "reply",
+		postedData:       url.Values{"body": {"Key left at the bar"}, "parent_id": {"1"}},
+		expectedStatus:   http.StatusSeeOther,
+		expectedLocation: "/admin/reservations/all/1#notes",
+		expectedFlash:    "Note added",
+	},
+	{
+		name:             "empty",
+		postedData:       url.Values{"body": {""}},
+		expectedStatus:   http.StatusSeeOther,
+		expectedLocation: "/admin/reservations/all/1#notes",
+	},
+	{
+		name:             "too-long",
+		postedData:       url.Values{"body": {strings.Repeat("a", noteMaxLength+1)}},
+		expectedStatus:   http.StatusSeeOther,
+		expectedLocation: "/admin/reservations/all/1#notes",
+	},
+	{
+		name:           "reply-to-unknown-note",
+		postedData:     url.Values{"body": {"hello"}, "parent_id": {"3"}},
+		expectedStatus: http.StatusInternalServerError,
+	},
+	{
+		name:             "pin",
+		pin:              true,
+		noteID:           "1",
+		postedData:       url.Values{"pinned": {"1"}},
+		expectedStatus:   http.StatusSeeOther,
+		expectedLocation: "/admin/reservations/all/1#notes",
+	},
+	{
+		name:           "pin-unknown-note",
+		pin:            true,
+		noteID:         "3",
+		postedData:     url.Values{"pinned": {"0"}},
+		expectedStatus: http.StatusInternalServerError,
+	},
+	{
+		name:           "pin-bad-note-id",
+		pin:            true,
+		noteID:         "x",
+		postedData:     url.Values{"pinned": {"1"}},
+		expectedStatus: http.StatusBadRequest,
+	},
+}
+
+// TestAdminReservationNotes tests adding, replying to and pinning reservation notes
+func TestAdminReservationNotes(t *testing.T) {
+	for _, e := range reservationNoteTests {
+		req, _ := http.NewRequest("POST", "/admin/reservations/all/1/notes", strings.NewReader(e.postedData.Encode()))
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("src", "all")
+		rctx.URLParams.Add("id", "1")
+		rctx.URLParams.Add("noteID", e.noteID)
+		ctx := getCtx(req)
+		ctx = context.WithValue(ctx, chi.RouteCtxKey, rctx)
+		req = req.WithContext(ctx)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		session.Put(ctx, "user_id", 1)
+
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(Repo.AdminPostReservationNote)
+		if e.pin {
+			handler = Repo.AdminPinReservationNote
+		}
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatus {
+			t.Errorf("failed %s: expected code %d, but got %d", e.name, e.expectedStatus, rr.Code)
+		}
+
+		if e.expectedLocation != "" {
+			actualLoc, _ := rr.Result().Location()
+			if actualLoc.String() != e.expectedLocation {
+				t.Errorf("failed %s: expected location %s, but got location %s", e.name, e.expectedLocation, actualLoc.String())
+			}
+		}
+
+		if e.expectedFlash != "" && session.GetString(ctx, "flash") != e.expectedFlash {
+			t.Errorf("failed %s: expected flash %q, but got %q", e.name, e.expectedFlash, session.GetString(ctx, "flash"))
+		}
+	}
+}
+
+// depositAmountTests is the data for the depositAmount tests
+var depositAmountTests = []struct {
+	name     string
+	rate     int
+	nights   int
+	percent  int
+	expected int
+}{
+	{"no-deposit", 10000, 2, 0, 0},
+	{"half", 10000, 2, 50, 10000},
+	{"full", 8900, 3, 100, 26700},
+	{"rounded", 8950, 1, 15, 1343},
+	{"no-rate", 0, 2, 50, 0},
+}
+
+// TestDepositAmount tests the deposit asked for a reservation
+func TestDepositAmount(t *testing.T) {
+	for _, e := range depositAmountTests {
+		if got := depositAmount(e.rate*e.nights, e.percent); got != e.expected {
+			t.Errorf("%s: expected %d, got %d", e.name, e.expected, got)
+		}
+	}
+}
+
+// TestPostReservationDeposit tests booking a room with a deposit, paid and declined
+func TestPostReservationDeposit(t *testing.T) {
+	fake := payments.NewFake("test-secret")
+	app.Payments = fake
+	app.DepositPercent = 50
+	defer func() {
+		app.Payments = payments.NewFake("test-secret")
+		app.DepositPercent = 0
+	}()
+
+	postedData := url.Values{
+		"start_date": {"2050-01-01"},
+		"end_date":   {"2050-01-03"},
+		"first_name": {"John"},
+		"last_name":  {"Smith"},
+		"email":      {"john@smith.com"},
+		"room_id":    {"1"},
+	}
+
+	for _, declined := range []bool{false, true} {
+		req, _ := http.NewRequest("POST", "/make-reservation", strings.NewReader(postedData.Encode()))
+		ctx := getCtx(req)
+		req = req.WithContext(ctx)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(Repo.PostReservation)
+		handler.ServeHTTP(rr, req)
+
+		actualLoc, _ := rr.Result().Location()
+		if actualLoc.String() != "/reservation-deposit" {
+			t.Fatalf("expected to be sent to pay the deposit, got %s", actualLoc.String())
+		}
+		// half of 2 nights at 100.00, the 30.00 cleaning fee and 2 x 2.50 tourist tax
+		if amount := session.GetInt(ctx, "deposit_amount"); amount != 11750 {
+			t.Errorf("expected a deposit of 11750, got %d", amount)
+		}
+		if !session.Exists(ctx, "hold_id") {
+			t.Error("room not held while the deposit is paid")
+		}
+
+		// the deposit page renders
+		req, _ = http.NewRequest("GET", "/reservation-deposit", nil)
+		req = req.WithContext(ctx)
+		rr = httptest.NewRecorder()
+		handler = Repo.Deposit
+		handler.ServeHTTP(rr, req)
+		if rr.Code != http.StatusOK {
+			t.Errorf("deposit page returned %d", rr.Code)
+		}
+
+		intentID := session.GetString(ctx, "deposit_intent")
+		if declined {
+			fake.Decline(intentID)
+		}
+
+		req, _ = http.NewRequest("POST", "/reservation-deposit", nil)
+		req = req.WithContext(ctx)
+		rr = httptest.NewRecorder()
+		handler = Repo.PostDeposit
+		handler.ServeHTTP(rr, req)
+
+		actualLoc, _ = rr.Result().Location()
+		if declined {
+			if actualLoc.String() != "/reservation-deposit" || session.GetString(ctx, "deposit_intent") != intentID {
+				t.Errorf("declined deposit: expected to pay again, got %s", actualLoc.String())
+			}
+			continue
+		}
+		if actualLoc.String() != "/reservation-summary" {
+			t.Errorf("paid deposit: expected the summary, got %s", actualLoc.String())
+		}
+		if paid := session.GetInt(ctx, "deposit_paid"); paid != 11750 {
+			t.Errorf("expected 11750 paid, got %d", paid)
+		}
+		if session.Exists(ctx, "deposit_intent") {
+			t.Error("deposit intent left in the session")
+		}
+	}
+
+	// no reservation in the session
+	req, _ := http.NewRequest("POST", "/reservation-deposit", nil)
+	req = req.WithContext(getCtx(req))
+	rr := httptest.NewRecorder()
+	handler := http.HandlerFunc(Repo.PostDeposit)
+	handler.ServeHTTP(rr, req)
+	if actualLoc, _ := rr.Result().Location(); actualLoc.String() != "/" {
+		t.Errorf("missing session: expected /, got %s", actualLoc.String())
+	}
+}
+
+// TestPaymentWebhook tests that webhooks are only accepted with a valid signature
+func TestPaymentWebhook(t *testing.T) {
+	fake := payments.NewFake("test-secret")
+	app.Payments = fake
+	defer func() { app.Payments = payments.NewFake("test-secret") }()
+
+	var tests = []struct {
+		name               string
+		event              payments.Event
+		tamper             bool
+		expectedStatusCode int
+	}{
+		{"payment-succeeded", payments.Event{Type: payments.EventPaymentSucceeded, IntentID: "pi_fake_1"}, false, http.StatusOK},
+		{"refund-failed", payments.Event{Type: payments.EventRefundFailed, RefundID: "re_fake_2"}, false, http.StatusOK},
+		{"ignored", payments.Event{IntentID: "pi_unknown"}, false, http.StatusOK},
+		{"bad-signature", payments.Event{Type: payments.EventPaymentSucceeded, IntentID: "pi_fake_1"}, true, http.StatusBadRequest},
+	}
+
+	for _, e := range tests {
+		payload, header := fake.Webhook(e.event)
+		if e.tamper {
+			payload = append(payload, ' ')
+		}
+
+		req, _ := http.NewRequest("POST", "/payments/webhook", bytes.NewReader(payload))
+		req.Header = header
+		req = req.WithContext(getCtx(req))
+
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(Repo.PaymentWebhook)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("%s: expected %d, got %d", e.name, e.expectedStatusCode, rr.Code)
+		}
+	}
+}
+
+// TestCancelReservationRefund tests that cancelling a reservation refunds its deposit as its policy allows
+func TestCancelReservationRefund(t *testing.T) {
+	now := time.Now()
+
+	var tests = []struct {
+		name           string
+		arrival        time.Time
+		expectedRefund int
+	}{
+		{"full-refund", now.AddDate(0, 0, 30), 5000},
+		{"half-refund", now.AddDate(0, 0, 2), 2500},
+		{"no-refund", now, 0},
+	}
+
+	for _, e := range tests {
+		fake := payments.NewFake("test-secret")
+		app.Payments = fake
+
+		// the test repository has a 5000 deposit paid with pi_fake_1 on reservation 1
+		intent, _ := fake.CreateIntent(context.Background(), 5000, "usd", "hold-1")
+		_, _ = fake.Capture(context.Background(), intent.ID)
+
+		req, _ := http.NewRequest("POST", "/admin/delete-reservation/all/1", nil)
+		req = req.WithContext(getCtx(req))
+
+		res := models.Reservation{ID: 1, StartDate: e.arrival, CancellationPolicy: cancellation.Moderate.String()}
+		result, err := Repo.ApplyCancellation(req.Context(), "http://localhost", res, "staff", true)
+		if err != nil {
+			t.Fatalf("%s: %v", e.name, err)
+		}
+		if result.Refund != e.expectedRefund || result.Fee != 5000-e.expectedRefund {
+			t.Errorf("%s: expected a refund of %d, got %d with a fee of %d", e.name, e.expectedRefund, result.Refund, result.Fee)
+		}
+
+		// the rest of the deposit can still be refunded, and no more
+		rest := 5000 - e.expectedRefund
+		if rest > 0 {
+			_, err = fake.Refund(context.Background(), intent.ID, rest)
+			if err != nil {
+				t.Errorf("%s: expected %d left to refund, got %v", e.name, rest, err)
+			}
+		}
+		_, err = fake.Refund(context.Background(), intent.ID, 1)
+		if !errors.Is(err, payments.ErrRefundTooLarge) {
+			t.Errorf("%s: expected the deposit to be used up, got %v", e.name, err)
+		}
+	}
+
+	// cancelled without refunding, e.g. from the command line, the deposit is left alone
+	fake := payments.NewFake("test-secret")
+	app.Payments = fake
+	intent, _ := fake.CreateIntent(context.Background(), 5000, "usd", "hold-1")
+	_, _ = fake.Capture(context.Background(), intent.ID)
+	res := models.Reservation{ID: 1, StartDate: now.AddDate(0, 0, 30), CancellationPolicy: cancellation.Moderate.String()}
+	result, err := Repo.ApplyCancellation(context.Background(), "http://localhost", res, "staff", false)
+	if err != nil || result.Refund != 5000 {
+		t.Errorf("no-refund: expected a refund of 5000 due, got %d, %v", result.Refund, err)
+	}
+	_, err = fake.Refund(context.Background(), intent.ID, 5000)
+	if err != nil {
+		t.Errorf("no-refund: expected the deposit left to refund, got %v", err)
+	}
+
+	app.Payments = payments.NewFake("test-secret")
+
+	req, _ := http.NewRequest("POST", "/admin/delete-reservation/all/2", nil)
+	req = req.WithContext(getCtx(req))
+
+	// reservations without payments need no refund
+	_, err = Repo.ApplyCancellation(req.Context(), "http://localhost", models.Reservation{ID: 2}, "staff", true)
+	if err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+
+	// the cancellation can't be recorded
+	_, err = Repo.ApplyCancellation(req.Context(), "http://localhost", models.Reservation{ID: 1000}, "staff", true)
+	if err == nil {
+		t.Error("expected an error when the cancellation can't be saved")
+	}
+}
+
+// postCancelReservationTests is the data for the guest cancellation tests, POST /cancel-reservation
+var postCancelReservationTests = []struct {
+	name               string
+	form               url.Values
+	expectedStatusCode int
+	expectedLocation   string
+	expectedHTML       string
+}{
+	{
+		name:               "missing-fields",
+		form:               url.Values{},
+		expectedStatusCode: http.StatusOK,
+		expectedHTML:       "This field cannot be blank",
+	},
+	{
+		name:               "bad-booking-number",
+		form:               url.Values{"reservation_id": {"abc"}, "email": {"john@smith.com"}},
+		expectedStatusCode: http.StatusOK,
+		expectedHTML:       "Invalid booking number",
+	},
+	{
+		name:               "unknown-reservation",
+		form:               url.Values{"reservation_id": {"1000"}, "email": {"john@smith.com"}},
+		expectedStatusCode: http.StatusOK,
+		expectedHTML:       "No reservation matches",
+	},
+	{
+		name:               "wrong-email",
+		form:               url.Values{"reservation_id": {"1"}, "email": {"jane@smith.com"}},
+		expectedStatusCode: http.StatusOK,
+		expectedHTML:       "No reservation matches",
+	},
+	{
+		name:               "quote",
+		form:               url.Values{"reservation_id": {"1"}, "email": {"John@Smith.com"}},
+		expectedStatusCode: http.StatusOK,
+		expectedHTML:       "Cancellation fee",
+	},
+	{
+		name:               "confirmed",
+		form:               url.Values{"reservation_id": {"2"}, "email": {"john@smith.com"}, "confirm": {"1"}},
+		expectedStatusCode: http.StatusSeeOther,
+		expectedLocation:   "/",
+	},
+}
+
+// TestPostCancelReservation tests that guests can only cancel their own reservation
+func TestPostCancelReservation(t *testing.T) {
+	for _, e := range postCancelReservationTests {
+		req, _ := http.NewRequest("POST", "/cancel-reservation", strings.NewReader(e.form.Encode()))
+		req = req.WithContext(getCtx(req))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(Repo.PostCancelReservation)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("%s: expected %d, got %d", e.name, e.expectedStatusCode, rr.Code)
+		}
+		if e.expectedLocation != "" {
+			actualLoc, _ := rr.Result().Location()
+			if actualLoc.String() != e.expectedLocation {
+				t.Errorf("%s: expected location %s, got %s", e.name, e.expectedLocation, actualLoc.String())
+			}
+		}
+		if e.expectedHTML != "" && !strings.Contains(rr.Body.String(), e.expectedHTML) {
+			t.Errorf("%s: expected %q in the page", e.name, e.expectedHTML)
+		}
+	}
+}
+
+// adminInvoiceTests is the data for the admin invoice tests, /admin/reservations/{src}/{id}/invoice
+var adminInvoiceTests = []struct {
+	name                string
+	id                  string
+	query               string
+	send                bool
+	expectedStatusCode  int
+	expectedContentType string
+	expectedLocation    string
+}{
+	{"pdf", "1", "", false, http.StatusOK, "application/pdf", ""},
+	{"html", "1", "?format=html", false, http.StatusOK, "text/html; charset=utf-8", ""},
+	{"bad-id", "x", "", false, http.StatusBadRequest, "", ""},
+	{"unknown-reservation", "1000", "", false, http.StatusInternalServerError, "", ""},
+	{"send", "1", "", true, http.StatusSeeOther, "", "/admin/reservations/all/1"},
+	{"send-unknown-reservation", "1000", "", true, http.StatusInternalServerError, "", ""},
+}
+
+// TestAdminReservationInvoice tests downloading and emailing the invoice of a reservation
+func TestAdminReservationInvoice(t *testing.T) {
+	for _, e := range adminInvoiceTests {
+		method := "GET"
+		if e.send {
+			method = "POST"
+		}
+		req, _ := http.NewRequest(method, "/admin/reservations/all/"+e.id+"/invoice"+e.query, nil)
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("src", "all")
+		rctx.URLParams.Add("id", e.id)
+		ctx := context.WithValue(getCtx(req), chi.RouteCtxKey, rctx)
+		req = req.WithContext(ctx)
+
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(Repo.AdminReservationInvoice)
+		if e.send {
+			handler = Repo.AdminSendInvoice
+		}
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("%s: expected %d, got %d", e.name, e.expectedStatusCode, rr.Code)
+		}
+		if e.expectedContentType != "" && rr.Header().Get("Content-Type") != e.expectedContentType {
+			t.Errorf("%s: expected content type %s, got %s", e.name, e.expectedContentType, rr.Header().Get("Content-Type"))
+		}
+		if e.expectedStatusCode == http.StatusOK && !strings.Contains(rr.Body.String(), "INV-000001") {
+			t.Errorf("%s: invoice number missing", e.name)
+		}
+		if e.expectedLocation != "" {
+			actualLoc, _ := rr.Result().Location()
+			if actualLoc.String() != e.expectedLocation {
+				t.Errorf("%s: expected location %s, got %s", e.name, e.expectedLocation, actualLoc.String())
+			}
+		}
+	}
+}
+
+// TestPostReservationInvoice tests that guests only get the invoice of their own reservation
+func TestPostReservationInvoice(t *testing.T) {
+	var tests = []struct {
+		name                string
+		email               string
+		expectedStatusCode  int
+		expectedContentType string
+	}{
+		{"own-reservation", "John@Smith.com", http.StatusOK, "application/pdf"},
+		{"wrong-email", "jane@smith.com", http.StatusSeeOther, ""},
+	}
+
+	for _, e := range tests {
+		form := url.Values{"reservation_id": {"1"}, "email": {e.email}, "format": {"pdf"}}
+		req, _ := http.NewRequest("POST", "/reservation-invoice", strings.NewReader(form.Encode()))
+		req = req.WithContext(getCtx(req))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(Repo.PostReservationInvoice)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("%s: expected %d, got %d", e.name, e.expectedStatusCode, rr.Code)
+		}
+		if e.expectedContentType != "" {
+			if rr.Header().Get("Content-Type") != e.expectedContentType {
+				t.Errorf("%s: expected content type %s, got %s", e.name, e.expectedContentType, rr.Header().Get("Content-Type"))
+			}
+			if !strings.Contains(rr.Header().Get("Content-Disposition"), "INV-000001.pdf") {
+				t.Errorf("%s: unexpected download name %q", e.name, rr.Header().Get("Content-Disposition"))
+			}
+		}
+	}
+}
+
+// gets the context
+func getCtx(req *http.Request) context.Context {
+	ctx, err := session.Load(req.Context(), req.Header.Get("X-Session"))
+	if err != nil {
+		log.Println(err)
+	}
+	return ctx
+}
+
+// adminTaxTests is the data for the AdminPostTax handler tests
+var adminTaxTests = []struct {
+	name               string
+	postedData         url.Values
+	expectedStatusCode int
+	expectedHTML       string
+}{
+	{
+		name:               "tourist-tax",
+		postedData:         url.Values{"name": {"Tourist tax"}, "kind": {"tax"}, "method": {"fixed"}, "basis": {"guest_night"}, "amount": {"2.50"}},
+		expectedStatusCode: http.StatusSeeOther,
+	},
+	{
+		name:               "vat-from-date",
+		postedData:         url.Values{"name": {"VAT"}, "kind": {"tax"}, "method": {"percent"}, "basis": {"stay"}, "amount": {"7.5"}, "valid_from": {"2050-01-01"}},
+		expectedStatusCode: http.StatusSeeOther,
+	},
+	{
+		name:               "percent-per-night",
+		postedData:         url.Values{"name": {"VAT"}, "kind": {"tax"}, "method": {"percent"}, "basis": {"night"}, "amount": {"20"}},
+		expectedStatusCode: http.StatusOK,
+		expectedHTML:       "percentages are charged on the stay",
+	},
+	{
+		name:               "bad-amount",
+		postedData:         url.Values{"name": {"Cleaning fee"}, "kind": {"fee"}, "method": {"fixed"}, "basis": {"stay"}, "amount": {"30.001"}},
+		expectedStatusCode: http.StatusOK,
+		expectedHTML:       "Enter a number with at most two decimals",
+	},
+	{
+		name:               "bad-date",
+		postedData:         url.Values{"name": {"Cleaning fee"}, "kind": {"fee"}, "method": {"fixed"}, "basis": {"stay"}, "amount": {"30"}, "valid_until": {"soon"}},
+		expectedStatusCode: http.StatusOK,
+		expectedHTML:       "Invalid date",
+	},
+	{
+		name:               "missing-name",
+		postedData:         url.Values{"kind": {"fee"}, "method": {"fixed"}, "basis": {"stay"}, "amount": {"30"}},
+		expectedStatusCode: http.StatusOK,
+		expectedHTML:       "This field cannot be blank",
+	},
+	{
+		name:               "database-error",
+		postedData:         url.Values{"name": {"fail"}, "kind": {"fee"}, "method": {"fixed"}, "basis": {"stay"}, "amount": {"30"}},
+		expectedStatusCode: http.StatusInternalServerError,
+	},
+}
+
+// TestAdminPostTax tests adding tax and fee rules
+func TestAdminPostTax(t *testing.T) {
+	for _, e := range adminTaxTests {
+		req, _ := http.NewRequest("POST", "/admin/taxes", strings.NewReader(e.postedData.Encode()))
+		ctx := getCtx(req)
+		req = req.WithContext(ctx)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(Repo.AdminPostTax)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("failed %s: expected code %d, but got %d", e.name, e.expectedStatusCode, rr.Code)
+		}
+
+		if e.expectedHTML != "" && !strings.Contains(rr.Body.String(), e.expectedHTML) {
+			t.Errorf("failed %s: expected to find %s but did not", e.name, e.expectedHTML)
+		}
+	}
+}
+
+// TestAdminDeleteTax tests deleting tax and fee rules
+func TestAdminDeleteTax(t *testing.T) {
+	tests := []struct {
+		id                 string
+		expectedStatusCode int
+	}{
+		{"1", http.StatusSeeOther},
+		{"3", http.StatusInternalServerError},
+		{"x", http.StatusBadRequest},
+	}
+
+	for _, e := range tests {
+		req, _ := http.NewRequest("POST", "/admin/taxes/"+e.id+"/delete", nil)
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("id", e.id)
+		ctx := getCtx(req)
+		ctx = context.WithValue(ctx, chi.RouteCtxKey, rctx)
+		req = req.WithContext(ctx)
+
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(Repo.AdminDeleteTax)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("delete tax rule %s: expected code %d, but got %d", e.id, e.expectedStatusCode, rr.Code)
+		}
+	}
+}
+
+// TestPostReservationCharges tests that the taxes and fees are charged for the number of guests
+func TestPostReservationCharges(t *testing.T) {
+	postedData := url.Values{
+		"start_date": {"2050-01-01"},
+		"end_date":   {"2050-01-03"},
+		"first_name": {"John"},
+		"last_name":  {"Smith"},
+		"email":      {"john@smith.com"},
+		"room_id":    {"1"},
+		"guests":     {"3"},
+	}
+
+	req, _ := http.NewRequest("POST", "/make-reservation", strings.NewReader(postedData.Encode()))
+	ctx := getCtx(req)
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	rr := httptest.NewRecorder()
+	handler := http.HandlerFunc(Repo.PostReservation)
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusSeeOther {
+		t.Fatalf("expected code %d, but got %d", http.StatusSeeOther, rr.Code)
+	}
+
+	res, ok := session.Get(ctx, "reservation").(models.Reservation)
+	if !ok {
+		t.Fatal("reservation not in the session")
+	}
+	if res.Guests != 3 || res.Currency != app.Currency {
+		t.Errorf("expected 3 guests paying in %s, got %d in %s", app.Currency, res.Guests, res.Currency)
+	}
+	// 2 nights at 100.00, a 30.00 cleaning fee and 3 x 2 x 2.50 tourist tax
+	if res.Amount != 20000 || res.FeeTotal() != 3000 || res.TaxTotal() != 1500 || res.Total() != 24500 {
+		t.Errorf("unexpected price %d + %d fees + %d taxes", res.Amount, res.FeeTotal(), res.TaxTotal())
+	}
+
+	// the summary itemises the charges
+	req, _ = http.NewRequest("GET", "/reservation-summary", nil)
+	req = req.WithContext(ctx)
+	rr = httptest.NewRecorder()
+	handler = Repo.ReservationSummary
+	handler.ServeHTTP(rr, req)
+
+	for _, want := range []string{"Cleaning fee", "Tourist tax", "245.00"} {
+		if !strings.Contains(rr.Body.String(), want) {
+			t.Errorf("expected %s on the summary", want)
+		}
+	}
+
+	// too many guests show the form again
+	postedData.Set("guests", "50")
+	req, _ = http.NewRequest("POST", "/make-reservation", strings.NewReader(postedData.Encode()))
+	ctx = getCtx(req)
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	rr = httptest.NewRecorder()
+	handler = Repo.PostReservation
+	handler.ServeHTTP(rr, req)
+
+	if !strings.Contains(rr.Body.String(), "Enter between 1 and 20 guests") {
+		t.Error("expected an error for too many guests")
+	}
+}
+
+// TestPostReservationPromotion tests promo codes entered when making a reservation
+func TestPostReservationPromotion(t *testing.T) {
+	tests := []struct {
+		name             string
+		code             string
+		expectedStatus   int
+		expectedLocation string
+		expectedDiscount int
+		expectedHTML     string
+	}{
+		// 10% off 2 nights at 100.00
+		{"percent", " summer ", http.StatusSeeOther, "/reservation-summary", 2000, ""},
+		{"unknown", "NOPE", http.StatusOK, "", 0, "Unknown promo code"},
+		{"other-room", "SUITE", http.StatusOK, "", 0, "it isn&#39;t valid for this room"},
+		{"expired", "EXPIRED", http.StatusOK, "", 0, "it has expired"},
+		{"used-up-when-saving", "USEDUP", http.StatusSeeOther, "/make-reservation", 0, ""},
+	}
+
+	for _, e := range tests {
+		postedData := url.Values{
+			"start_date": {"2050-01-01"},
+			"end_date":   {"2050-01-03"},
+			"first_name": {"John"},
+			"last_name":  {"Smith"},
+			"email":      {"john@smith.com"},
+			"room_id":    {"1"},
+			"promo_code": {e.code},
+		}
+
+		req, _ := http.NewRequest("POST", "/make-reservation", strings.NewReader(postedData.Encode()))
+		ctx := getCtx(req)
+		req = req.WithContext(ctx)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(Repo.PostReservation)
+		handler.ServeHTTP(rr, req)
+
+		if e.expectedHTML != "" {
+			if !strings.Contains(rr.Body.String(), e.expectedHTML) {
+				t.Errorf("failed %s: expected to find %s but did not", e.name, e.expectedHTML)
+			}
+			continue
+		}
+
+		if rr.Code != e.expectedStatus {
+			t.Errorf("failed %s: expected code %d, but got %d", e.name, e.expectedStatus, rr.Code)
+			continue
+		}
+		if location := rr.Header().Get("Location"); location != e.expectedLocation {
+			t.Errorf("failed %s: expected location %s, but got %s", e.name, e.expectedLocation, location)
+		}
+
+		res, ok := session.Get(ctx, "reservation").(models.Reservation)
+		if !ok {
+			t.Errorf("failed %s: reservation not in the session", e.name)
+			continue
+		}
+		if res.Discount != e.expectedDiscount {
+			t.Errorf("failed %s: expected a discount of %d, got %d", e.name, e.expectedDiscount, res.Discount)
+		}
+		// 180.00 with the 30.00 cleaning fee and 2 x 2.50 tourist tax
+		if e.expectedDiscount > 0 && (res.PromotionCode != "SUMMER" || res.Total() != 21500) {
+			t.Errorf("failed %s: expected SUMMER with a total of 21500, got %s with %d", e.name, res.PromotionCode, res.Total())
+		}
+	}
+}
+
+var adminPromotionTests = []struct {
+	name               string
+	postedData         url.Values
+	expectedStatusCode int
+	expectedHTML       string
+}{
+	{
+		name:               "percent",
+		postedData:         url.Values{"code": {"summer24"}, "method": {"percent"}, "amount": {"15"}, "valid_until": {"2050-08-31"}, "max_uses": {"100"}},
+		expectedStatusCode: http.StatusSeeOther,
+	},
+	{
+		name:               "fixed-for-rooms",
+		postedData:         url.Values{"code": {"TENOFF"}, "method": {"fixed"}, "amount": {"10.00"}, "room_id": {"1", "2"}, "min_nights": {"2"}, "max_uses_per_guest": {"1"}},
+		expectedStatusCode: http.StatusSeeOther,
+	},
+	{
+		name:               "two-words",
+		postedData:         url.Values{"code": {"big sale"}, "method": {"percent"}, "amount": {"15"}},
+		expectedStatusCode: http.StatusOK,
+		expectedHTML:       "codes are one word in capitals",
+	},
+	{
+		name:               "over-100",
+		postedData:         url.Values{"code": {"FREE"}, "method": {"percent"}, "amount": {"150"}},
+		expectedStatusCode: http.StatusOK,
+		expectedHTML:       "more than 100% off",
+	},
+	{
+		name:               "bad-limit",
+		postedData:         url.Values{"code": {"LIMIT"}, "method": {"percent"}, "amount": {"15"}, "max_uses": {"-1"}},
+		expectedStatusCode: http.StatusOK,
+		expectedHTML:       "Enter a whole number",
+	},
+	{
+		name:               "bad-room",
+		postedData:         url.Values{"code": {"ROOM"}, "method": {"percent"}, "amount": {"15"}, "room_id": {"x"}},
+		expectedStatusCode: http.StatusBadRequest,
+	},
+	{
+		name:               "missing-amount",
+		postedData:         url.Values{"code": {"NOTHING"}, "method": {"percent"}},
+		expectedStatusCode: http.StatusOK,
+		expectedHTML:       "This field cannot be blank",
+	},
+	{
+		name:               "database-error",
+		postedData:         url.Values{"code": {"fail"}, "method": {"percent"}, "amount": {"15"}},
+		expectedStatusCode: http.StatusInternalServerError,
+	},
+}
+
+// TestAdminPostPromotion tests adding promo codes
+func TestAdminPostPromotion(t *testing.T) {
+	for _, e := range adminPromotionTests {
+		req, _ := http.NewRequest("POST", "/admin/promotions", strings.NewReader(e.postedData.Encode()))
+		ctx := getCtx(req)
+		req = req.WithContext(ctx)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(Repo.AdminPostPromotion)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("failed %s: expected code %d, but got %d", e.name, e.expectedStatusCode, rr.Code)
+		}
+
+		if e.expectedHTML != "" && !strings.Contains(rr.Body.String(), e.expectedHTML) {
+			t.Errorf("failed %s: expected to find %s but did not", e.name, e.expectedHTML)
+		}
+	}
+}
+
+// TestAdminDeletePromotion tests deleting promo codes
+func TestAdminDeletePromotion(t *testing.T) {
+	tests := []struct {
+		id                 string
+		expectedStatusCode int
+	}{
+		{"1", http.StatusSeeOther},
+		{"3", http.StatusInternalServerError},
+		{"x", http.StatusBadRequest},
+	}
+
+	for _, e := range tests {
+		req, _ := http.NewRequest("POST", "/admin/promotions/"+e.id+"/delete", nil)
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("id", e.id)
+		ctx := getCtx(req)
+		ctx = context.WithValue(ctx, chi.RouteCtxKey, rctx)
+		req = req.WithContext(ctx)
+
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(Repo.AdminDeletePromotion)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("delete promotion %s: expected code %d, but got %d", e.id, e.expectedStatusCode, rr.Code)
+		}
+	}
+}
+
+// TestServerErrorLogged tests server errors are logged with the request id and a stack trace
+func TestServerErrorLogged(t *testing.T) {
+	req := httptest.NewRequest("GET", "/admin/guests?q=error", nil)
+	ctx := getCtx(req)
+	ctx = logging.WithLogger(ctx, app.Logger.With("request_id", "req-1"))
+	req = req.WithContext(ctx)
+
+	logs.Reset()
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(Repo.AdminGuests).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusInternalServerError {
+		t.Fatalf("expected %d, got %d", http.StatusInternalServerError, rr.Code)
+	}
+	out := logs.String()
+	for _, want := range []string{`level=ERROR msg="server error" request_id=req-1 error=`, "stack="} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected %s in the log, got %q", want, out)
+		}
+	}
+}
+
+// TestCancelledRequest tests the context of the request reaches the repository, cancelling its queries
+func TestCancelledRequest(t *testing.T) {
+	tests := []struct {
+		name             string
+		method           string
+		url              string
+		body             string
+		handler          http.HandlerFunc
+		expectedStatus   int
+		expectedLocation string
+	}{
+		{"guests", "GET", "/admin/guests", "", Repo.AdminGuests, http.StatusInternalServerError, ""},
+		{"show-reservation", "GET", "/admin/reservations/new/1/show", "", Repo.AdminShowReservation, http.StatusInternalServerError, ""},
+		{"availability", "POST", "/search-availability", "start=2040-01-01&end=2040-01-02", Repo.PostAvailability, http.StatusSeeOther, "/"},
+	}
+
+	for _, e := range tests {
+		req := httptest.NewRequest(e.method, e.url, strings.NewReader(e.body))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		ctx, cancel := context.WithCancel(getCtx(req))
+		// the client went away
+		cancel()
+		req = req.WithContext(ctx)
+
+		logs.Reset()
+		rr := httptest.NewRecorder()
+		e.handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatus {
+			t.Errorf("%s: expected %d, got %d", e.name, e.expectedStatus, rr.Code)
+		}
+		if loc := rr.Header().Get("Location"); loc != e.expectedLocation {
+			t.Errorf("%s: expected location %q, got %q", e.name, e.expectedLocation, loc)
+		}
+		if e.expectedStatus == http.StatusInternalServerError && !strings.Contains(logs.String(), context.Canceled.Error()) {
+			t.Errorf("%s: expected the cancellation in the log, got %q", e.name, logs.String())
+		}
+	}
+}
+
+// beforeSetupRepo is the test repository of an application that hasn't been set up.
+type beforeSetupRepo struct {
+	repository.DatabaseRepo
+}
+
+func (beforeSetupRepo) SetupDone(ctx context.Context) (bool, error) {
+	return false, nil
+}
+
+// TestSetup tests that the setup page is shown until the setup is done
+func TestSetup(t *testing.T) {
+	req, _ := http.NewRequest("GET", "/setup", nil)
+	req = req.WithContext(getCtx(req))
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(Repo.Setup).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("after the setup: expected code %d, but got %d", http.StatusNotFound, rr.Code)
+	}
+
+	db := Repo.DB
+	Repo.DB = beforeSetupRepo{db}
+	defer func() { Repo.DB = db }()
+
+	rr = httptest.NewRecorder()
+	http.HandlerFunc(Repo.Setup).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Errorf("before the setup: expected code %d, but got %d", http.StatusOK, rr.Code)
+	}
+	if !strings.Contains(rr.Body.String(), `action="/setup"`) {
+		t.Error("before the setup: expected the setup form")
+	}
+}
+
+// TestPostSetup tests creating the owner account and the property
+func TestPostSetup(t *testing.T) {
+	valid := func(changes ...string) url.Values {
+		v := url.Values{
+			"property_name":    {"Relax B&B"},
+			"timezone":         {"Europe/Paris"},
+			"contact_email":    {"hello@relax.com"},
+			"first_name":       {"Jane"},
+			"last_name":        {"Doe"},
+			"email":            {"jane@relax.com"},
+			"password":         {"Lower4ndUpper"},
+			"password_confirm": {"Lower4ndUpper"},
+		}
+		for i := 0; i < len(changes); i += 2 {
+			v.Set(changes[i], changes[i+1])
+		}
+		return v
+	}
+
+	tests := []struct {
+		name               string
+		postedData         url.Values
+		expectedStatusCode int
+		expectedHTML       string
+	}{
+		{"valid", valid(), http.StatusSeeOther, ""},
+		{"weak-password", valid("password", "password", "password_confirm", "password"), http.StatusOK, "Choose a stronger password"},
+		{"passwords-differ", valid("password_confirm", "Lower4ndUpper!"), http.StatusOK, "The passwords don&#39;t match"},
+		{"unknown-timezone", valid("timezone", "Mars/Olympus"), http.StatusOK, "Enter a time zone"},
+		{"invalid-email", valid("contact_email", "hello"), http.StatusOK, "Invalid email address"},
+		{"missing-name", valid("property_name", ""), http.StatusOK, "This field cannot be blank"},
+		{"done-already", valid("email", "taken@here.com"), http.StatusNotFound, ""},
+		{"database-error", valid("property_name", "Broken"), http.StatusInternalServerError, ""},
+	}
+
+	for _, e := range tests {
+		req, _ := http.NewRequest("POST", "/setup", strings.NewReader(e.postedData.Encode()))
+		req = req.WithContext(getCtx(req))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(Repo.PostSetup).ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("failed %s: expected code %d, but got %d", e.name, e.expectedStatusCode, rr.Code)
+		}
+		if e.expectedHTML != "" && !strings.Contains(rr.Body.String(), e.expectedHTML) {
+			t.Errorf("failed %s: expected to find %s but did not", e.name, e.expectedHTML)
+		}
+		if rr.Code == http.StatusOK && strings.Contains(rr.Body.String(), "Lower4ndUpper") {
+			t.Errorf("failed %s: the password was sent back", e.name)
+		}
+		if rr.Code == http.StatusSeeOther {
+			if loc := rr.Header().Get("Location"); loc != "/admin/dashboard" {
+				t.Errorf("failed %s: expected the dashboard, got %s", e.name, loc)
+			}
+			if id := session.GetInt(req.Context(), "user_id"); id != 1 {
+				t.Errorf("failed %s: expected the owner signed in, got user %d", e.name, id)
+			}
+		}
+	}
+}
+
+// waitlistRepo is the test repository with guests waiting for room 1, whose nights are all free.
+type waitlistRepo struct {
+	repository.DatabaseRepo
+	notified []int
+}
+
+func (w *waitlistRepo) GetWaitlistEntriesForDates(ctx context.Context, roomID int, start, end time.Time) ([]models.WaitlistEntry, error) {
+	return []models.WaitlistEntry{
+		{ID: 1, FirstName: "John", Email: "john@smith.com", RoomID: 1, StartDate: start, EndDate: end},
+		{ID: 2, FirstName: "Jane", Email: "jane@smith.com", StartDate: start, EndDate: end},
+	}, nil
+}
+
+func (w *waitlistRepo) SearchAvailabilityByDatesByRoomID(ctx context.Context, start, end time.Time, roomID int) (bool, error) {
+	return true, nil
+}
+
+func (w *waitlistRepo) UpdateWaitlistToken(ctx context.Context, id, roomID int, token string, expiresAt time.Time) error {
+	w.notified = append(w.notified, id)
+	return nil
+}
+
+// TestReleaseDates tests that freed nights are offered to the waitlist, unless it is turned off
+func TestReleaseDates(t *testing.T) {
+	db := Repo.DB
+	defer func() { Repo.DB = db }()
+	features := Repo.App.Features
+	defer func() { Repo.App.Features = features }()
+
+	start := time.Date(2050, 1, 1, 0, 0, 0, 0, time.UTC)
+	end := start.AddDate(0, 0, 3)
+
+	for _, enabled := range []bool{true, false} {
+		w := &waitlistRepo{DatabaseRepo: db}
+		Repo.DB = w
+		Repo.App.Features.Waitlist = enabled
+
+		Repo.ReleaseDates(context.Background(), "https://bookings.example.com", 1, start, end)
+
+		expected := 0
+		if enabled {
+			expected = 2
+		}
+		if len(w.notified) != expected {
+			t.Errorf("waitlist %v: expected %d guests notified, got %v", enabled, expected, w.notified)
+		}
+	}
+}
+
+// anyRoomRepo is the test repository of a guest happy with any room who was offered room offered, with the
+// rooms free tells free on their dates. Room 2 is taken by the time the hold is placed.
+type anyRoomRepo struct {
+	repository.DatabaseRepo
+	offered int
+	free    []int
+}
+
+func (a anyRoomRepo) GetWaitlistEntryByToken(ctx context.Context, token string) (models.WaitlistEntry, error) {
+	return models.WaitlistEntry{
+		OfferedRoomID: a.offered,
+		StartDate:     time.Date(2050, 1, 1, 0, 0, 0, 0, time.UTC),
+		EndDate:       time.Date(2050, 1, 2, 0, 0, 0, 0, time.UTC),
+	}, nil
+}
+
+func (a anyRoomRepo) SearchAvailabilityForAllRooms(ctx context.Context, start, end time.Time) ([]models.Room, error) {
+	var rooms []models.Room
+	for _, id := range a.free {
+		rooms = append(rooms, models.Room{ID: id})
+	}
+	return rooms, nil
+}
+
+func (a anyRoomRepo) GetRoomByID(ctx context.Context, id int) (models.Room, error) {
+	return models.Room{ID: id, RoomName: fmt.Sprintf("Room %d", id)}, nil
+}
+
+// TestWaitlistBookAnyRoom tests that guests happy with any room get the room freed for them, or another free one
+func TestWaitlistBookAnyRoom(t *testing.T) {
+	db := Repo.DB
+	defer func() { Repo.DB = db }()
+
+	tests := []struct {
+		name     string
+		offered  int
+		free     []int
+		expected int
+	}{
+		{"offered-room", 4, []int{1, 4}, 4},
+		{"offered-room-taken-again", 2, []int{1}, 1},
+		{"skips-taken-rooms", 0, []int{2, 3}, 3},
+	}
+
+	for _, e := range tests {
+		Repo.DB = anyRoomRepo{DatabaseRepo: db, offered: e.offered, free: e.free}
+
+		req, _ := http.NewRequest("GET", "/waitlist/book/abc", nil)
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("token", "abc")
+		ctx := context.WithValue(getCtx(req), chi.RouteCtxKey, rctx)
+		req = req.WithContext(ctx)
+
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(Repo.WaitlistBook).ServeHTTP(rr, req)
+
+		if loc := rr.Header().Get("Location"); loc != "/make-reservation" {
+			t.Errorf("%s: expected a redirect to /make-reservation, got %q", e.name, loc)
+			continue
+		}
+		res, _ := Repo.App.Session.Get(ctx, "reservation").(models.Reservation)
+		if res.RoomID != e.expected {
+			t.Errorf("%s: expected room %d held, got %d", e.name, e.expected, res.RoomID)
+		}
 	}
-	return ctx
 }
@@ -1,20 +1,35 @@
 package handlers
 
 import (
+	"bytes"
+	"context"
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"html"
+	"io"
+	"math"
 	"net/http"
+	"net/url"
 	"strconv"
 	"strings"
 	"time"
 
 	render "github.com/GitEagleY/BookingsWebApp/internal/Render"
+	"github.com/GitEagleY/BookingsWebApp/internal/cancellation"
 	"github.com/GitEagleY/BookingsWebApp/internal/config"
 	"github.com/GitEagleY/BookingsWebApp/internal/driver"
+	"github.com/GitEagleY/BookingsWebApp/internal/export"
 	"github.com/GitEagleY/BookingsWebApp/internal/forms"
 	"github.com/GitEagleY/BookingsWebApp/internal/helpers"
+	"github.com/GitEagleY/BookingsWebApp/internal/importer"
+	"github.com/GitEagleY/BookingsWebApp/internal/invoice"
+	"github.com/GitEagleY/BookingsWebApp/internal/logging"
 	"github.com/GitEagleY/BookingsWebApp/internal/models"
+	"github.com/GitEagleY/BookingsWebApp/internal/payments"
+	"github.com/GitEagleY/BookingsWebApp/internal/pricing"
+	"github.com/GitEagleY/BookingsWebApp/internal/promotions"
 	"github.com/GitEagleY/BookingsWebApp/internal/repository"
 	"github.com/GitEagleY/BookingsWebApp/internal/repository/dbrepo"
 	"github.com/go-chi/chi/v5"
@@ -23,6 +38,24 @@ import (
 // Repo the repository used by the handlers
 var Repo *Repository
 
+// holdDuration is how long a room stays held for a guest between choosing it and submitting the reservation.
+const holdDuration = 15 * time.Minute
+
+// waitlistLinkLifetime is how long the booking link emailed to a waitlisted guest stays valid.
+const waitlistLinkLifetime = 24 * time.Hour
+
+// specialRequestsMaxLength is the longest special requests text a guest can enter when booking.
+const specialRequestsMaxLength = 1000
+
+// maxGuests is the most guests a reservation can be made for.
+const maxGuests = 20
+
+// noteMaxLength is the longest internal note staff can add to a reservation.
+const noteMaxLength = 2000
+
+// waitlistNotifyLimit is how many waitlisted guests are emailed when nights free up.
+const waitlistNotifyLimit = 3
+
 // Repository is the repository type
 type Repository struct {
 	App *config.AppConfig
@@ -92,7 +125,7 @@ func (m *Repository) Reservation(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Get the room details based on the room ID stored in the reservation.
-	room, err := m.DB.GetRoomByID(res.RoomID)
+	room, err := m.DB.GetRoomByID(r.Context(), res.RoomID)
 	if err != nil {
 		// If there's an error fetching the room details, set an error message in the session and redirect.
 		m.App.Session.Put(r.Context(), "error", "can't find room!")
@@ -100,8 +133,17 @@ func (m *Repository) Reservation(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Attach the room name to the reservation.
-	res.Room.RoomName = room.RoomName
+	// Attach the room details to the reservation.
+	res.Room = room
+	if res.Guests < 1 {
+		res.Guests = 1
+	}
+
+	quote, err := m.quoteReservation(r.Context(), res)
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
 
 	// Update the reservation in the session to include room details.
 	m.App.Session.Put(r.Context(), "reservation", res)
@@ -114,16 +156,27 @@ func (m *Repository) Reservation(w http.ResponseWriter, r *http.Request) {
 	stringMap := make(map[string]string)
 	stringMap["start_date"] = sd
 	stringMap["end_date"] = ed
+	stringMap["currency"] = strings.ToUpper(quote.Currency)
+
+	// Let the guest know how long the room is held for them.
+	intMap := make(map[string]int)
+	if m.App.Session.Exists(r.Context(), "hold_id") {
+		intMap["hold_minutes"] = int(holdDuration.Minutes())
+	}
 
 	// Prepare data for the template rendering.
 	data := make(map[string]interface{})
 	data["reservation"] = res
+	data["policy"] = ReservationPolicy(models.Reservation{CancellationPolicy: room.CancellationPolicy})
+	data["quote"] = quote
+	data["promotions"] = m.App.Features.Promotions
 
 	// Render the "make a reservation" page template with the reservation data and formatted dates.
 	render.Template(w, r, "make-reservation.page.tmpl", &models.TemplateData{
 		Form:      forms.New(nil), // Initialize an empty form for form rendering.
 		Data:      data,           // Reservation data.
 		StringMap: stringMap,      // Formatted date strings.
+		IntMap:    intMap,
 	})
 }
 
@@ -164,7 +217,7 @@ func (m *Repository) PostReservation(w http.ResponseWriter, r *http.Request) {
 		http.Redirect(w, r, "/", http.StatusSeeOther)
 		return
 	}
-	room, err := m.DB.GetRoomByID(roomID)
+	room, err := m.DB.GetRoomByID(r.Context(), roomID)
 	if err != nil {
 		m.App.Session.Put(r.Context(), "error", "invalid data!")
 		http.Redirect(w, r, "/", http.StatusSeeOther)
@@ -179,69 +232,169 @@ func (m *Repository) PostReservation(w http.ResponseWriter, r *http.Request) {
 		EndDate:   endDate,
 		RoomID:    roomID,
 		Room:      room,
+
+		SpecialRequests:    strings.TrimSpace(r.Form.Get("special_requests")),
+		CancellationPolicy: room.CancellationPolicy,
+		Guests:             1,
+		Currency:           m.App.Currency,
 	}
 
 	form := forms.New(r.PostForm)
 
 	form.Required("first_name", "last_name", "email")
 	form.MinLength("first_name", 3)
+	form.MaxLength("special_requests", specialRequestsMaxLength)
 	form.IsEmail("email")
+	if form.Get("guests") != "" {
+		reservation.Guests = parseGuests(form)
+	}
+
+	err = m.applyPromotion(r.Context(), form, &reservation)
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "can't check the promo code!")
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+
+	quote, err := m.quoteReservation(r.Context(), reservation)
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "can't work out the price!")
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+	reservation.Amount = quote.Accommodation
+	reservation.Discount = quote.Discount
+	reservation.Charges = quote.Charges
 
 	if !form.Valid() {
 		data := make(map[string]interface{})
 		data["reservation"] = reservation
+		data["policy"] = ReservationPolicy(reservation)
+		data["quote"] = quote
+		data["promotions"] = m.App.Features.Promotions
+		stringMap := make(map[string]string)
+		stringMap["start_date"] = sd
+		stringMap["end_date"] = ed
+		stringMap["currency"] = strings.ToUpper(quote.Currency)
 		http.Error(w, "my own error message", http.StatusSeeOther)
 		render.Template(w, r, "make-reservation.page.tmpl", &models.TemplateData{
-			Form: form,
-			Data: data,
+			Form:      form,
+			Data:      data,
+			StringMap: stringMap,
 		})
 		return
 	}
 
-	newReservationID, err := m.DB.InsertReservation(reservation)
-	if err != nil {
+	// Ask for the deposit first when one is required, the room stays held while the guest pays.
+	if amount := depositAmount(quote.Total(), m.App.DepositPercent); amount > 0 && m.App.Payments != nil {
+		m.requestDeposit(w, r, reservation, amount)
+		return
+	}
+
+	id, ok := m.saveReservation(w, r, reservation)
+	if !ok {
+		return
+	}
+	reservation.ID = id
+
+	m.confirmReservation(w, r, reservation)
+}
+
+// saveReservation stores a reservation made by a guest, turning their hold into the reservation when they
+// have one, and returns its id. When it fails it redirects the guest and returns false.
+func (m *Repository) saveReservation(w http.ResponseWriter, r *http.Request, reservation models.Reservation) (int, bool) {
+	holdID := m.App.Session.GetInt(r.Context(), "hold_id")
+	if holdID > 0 {
+		// Turn the guest's hold into the real reservation.
+		newReservationID, err := m.DB.ConvertHoldToReservation(r.Context(), reservation, holdID)
+		if errors.Is(err, promotions.ErrNotApplicable) {
+			m.promotionRejected(w, r, reservation, err)
+			return 0, false
+		} else if errors.Is(err, repository.ErrRoomUnavailable) {
+			m.App.Session.Remove(r.Context(), "hold_id")
+			m.App.Session.Put(r.Context(), "error", "Sorry, your hold expired and the room is no longer available")
+			http.Redirect(w, r, "/search-availability", http.StatusSeeOther)
+			return 0, false
+		} else if err != nil {
+			m.App.Session.Put(r.Context(), "error", "can't insert reservation into database!")
+			http.Redirect(w, r, "/", http.StatusSeeOther)
+			return 0, false
+		}
+		m.App.Session.Remove(r.Context(), "hold_id")
+		m.countReservations("guest", 1)
+		return newReservationID, true
+	}
+
+	// Without a hold the room is locked and checked again, so the stay can't take someone else's hold or
+	// reservation, and the reservation and its room restriction are saved together.
+	newReservationID, err := m.DB.CreateReservation(r.Context(), reservation)
+	if errors.Is(err, promotions.ErrNotApplicable) {
+		m.promotionRejected(w, r, reservation, err)
+		return 0, false
+	} else if errors.Is(err, repository.ErrRoomUnavailable) {
+		m.App.Session.Put(r.Context(), "error", "Sorry, that room is no longer available")
+		http.Redirect(w, r, "/search-availability", http.StatusSeeOther)
+		return 0, false
+	} else if err != nil {
 		m.App.Session.Put(r.Context(), "error", "can't insert reservation into database!")
 		http.Redirect(w, r, "/", http.StatusSeeOther)
-		return
+		return 0, false
 	}
 
-	restriction := models.RoomRestriction{
-		StartDate:     startDate,
-		EndDate:       endDate,
-		RoomID:        roomID,
-		ReservationID: newReservationID,
-		RestrictionID: 1,
+	m.countReservations("guest", 1)
+	return newReservationID, true
+}
+
+// redeemedDiscount is the discount of the promo code a reservation was booked with on its accommodation
+// res.Amount, after its room or dates changed. The discount given when booking, at most the new accommodation,
+// is kept when the promotion has been deleted since.
+func (m *Repository) redeemedDiscount(r *http.Request, res models.Reservation, booked int) int {
+	if res.PromotionCode == "" {
+		return 0
 	}
 
-	err = m.DB.InsertRoomRestriction(restriction)
+	p, err := m.DB.GetPromotionByCode(r.Context(), res.PromotionCode)
 	if err != nil {
-		m.App.Session.Put(r.Context(), "error", "can't insert room restriction!")
-		http.Redirect(w, r, "/", http.StatusSeeOther)
-		return
+		helpers.Logger(r).Info("can't find the promotion of a changed reservation", "code", res.PromotionCode, "error", err)
+		return min(booked, res.Amount)
 	}
+	return promotions.Discount(p, res.Amount)
+}
+
+// countReservations counts n reservations made by source (guest, admin or import) in the metrics.
+func (m *Repository) countReservations(source string, n int) {
+	m.App.Metrics.Counter("bookings_reservations_total", "Reservations made, by where they were made.", "source").
+		Add(float64(n), source)
+}
+
+// promotionRejected sends the guest back to the reservation form, without their promo code, when it turned
+// out to be used up as the reservation was saved.
+func (m *Repository) promotionRejected(w http.ResponseWriter, r *http.Request, reservation models.Reservation, err error) {
+	helpers.Logger(r).Info("promo code rejected when saving the reservation", "code", reservation.PromotionCode, "error", err)
+	reservation.PromotionCode = ""
+	reservation.Discount = 0
+	m.App.Session.Put(r.Context(), "reservation", reservation)
+	m.App.Session.Put(r.Context(), "error", "Sorry, "+err.Error())
+	http.Redirect(w, r, "/make-reservation", http.StatusSeeOther)
+}
 
+// confirmReservation emails the guest and the owner about a saved reservation and shows the guest its summary.
+func (m *Repository) confirmReservation(w http.ResponseWriter, r *http.Request, reservation models.Reservation) {
 	//send email notification to guest
-	htmlMessage := fmt.Sprintf(`
-	<strong>Reservation Confiramtion</strong><br>
-	 %s, this is confirm your reservation from %s to %s.
-	`, reservation.FirstName, reservation.StartDate.Format("2006-01-02"), reservation.EndDate.Format("2006-01-02"))
-	msg := models.MailData{
-		To:       reservation.Email,
-		From:     "me@here.com",
-		Subject:  "Reservation Confiramtion",
-		Content:  htmlMessage,
-		Template: "basic.html",
-	}
-	m.App.MailChan <- msg
+	m.sendGuestConfirmation(r, reservation)
 
 	//send email notification to owner
-	htmlMessage = fmt.Sprintf(`
+	htmlMessage := fmt.Sprintf(`
 	<strong>Reservation Confiramtion</strong><br>
 	%s, this is confirm your reservation for %s from %s to %s.
 	`, reservation.FirstName, reservation.Room.RoomName, reservation.StartDate.Format("2006-01-02"), reservation.EndDate.Format("2006-01-02"))
-	msg = models.MailData{
+	if reservation.SpecialRequests != "" {
+		htmlMessage += fmt.Sprintf("<br><strong>Special requests:</strong> %s", html.EscapeString(reservation.SpecialRequests))
+	}
+	htmlMessage += priceHTML(reservation)
+	msg := models.MailData{
 		To:      "property@owner.com",
-		From:    "me@here.com",
+		From:    m.App.SMTP.From,
 		Subject: "Reservation Confiramtion",
 		Content: htmlMessage,
 	}
@@ -250,7 +403,249 @@ func (m *Repository) PostReservation(w http.ResponseWriter, r *http.Request) {
 	m.App.Session.Put(r.Context(), "reservation", reservation)
 
 	http.Redirect(w, r, "/reservation-summary", http.StatusSeeOther)
+}
+
+// depositAmount is the deposit in cents asked for a reservation, percent of the price of the stay with its
+// taxes and fees rounded to the nearest cent.
+func depositAmount(total, percent int) int {
+	if percent <= 0 {
+		return 0
+	}
+	return (total*percent + 50) / 100
+}
+
+// parseGuests returns the number of guests entered in the guests field of form, adding an error to the
+// form when it isn't between 1 and maxGuests.
+func parseGuests(form *forms.Form) int {
+	guests, err := strconv.Atoi(strings.TrimSpace(form.Get("guests")))
+	if err != nil || guests < 1 || guests > maxGuests {
+		form.Errors.Add("guests", fmt.Sprintf("Enter between 1 and %d guests", maxGuests))
+		return 1
+	}
+	return guests
+}
+
+// applyPromotion sets the promo code entered in form on res with its discount, adding an error to the form
+// when the code can't be used. Whether the guest has used it up is only known when the reservation is saved.
+func (m *Repository) applyPromotion(ctx context.Context, form *forms.Form, res *models.Reservation) error {
+	res.PromotionCode = promotions.Code(form.Get("promo_code"))
+	res.Discount = 0
+	if !m.App.Features.Promotions {
+		res.PromotionCode = ""
+	}
+	if res.PromotionCode == "" {
+		return nil
+	}
+
+	p, err := m.DB.GetPromotionByCode(ctx, res.PromotionCode)
+	if errors.Is(err, sql.ErrNoRows) {
+		form.Errors.Add("promo_code", "Unknown promo code")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	err = promotions.Check(p, *res, time.Now())
+	if err == nil {
+		err = promotions.CheckUses(p, p.Uses, 0)
+	}
+	if err != nil {
+		form.Errors.Add("promo_code", err.Error())
+		return nil
+	}
+
+	res.Discount = promotions.Discount(p, res.Room.NightlyRate*res.Nights())
+	return nil
+}
+
+// quoteReservation prices the stay of a reservation in its room with the taxes and fees of the tax rules.
+func (m *Repository) quoteReservation(ctx context.Context, res models.Reservation) (pricing.Quote, error) {
+	rules, err := m.DB.AllTaxRules(ctx)
+	if err != nil {
+		return pricing.Quote{}, err
+	}
+
+	currency := res.Currency
+	if currency == "" {
+		currency = m.App.Currency
+	}
+
+	return pricing.Calculate(pricing.Stay{
+		Arrival:     res.StartDate,
+		Departure:   res.EndDate,
+		Guests:      res.Guests,
+		NightlyRate: res.Room.NightlyRate,
+		Currency:    currency,
+		Discount:    res.Discount,
+	}, rules), nil
+}
+
+// requestDeposit starts the payment of the deposit of a reservation and sends the guest to pay it. The room
+// is held for the guest until the deposit is paid.
+func (m *Repository) requestDeposit(w http.ResponseWriter, r *http.Request, res models.Reservation, amount int) {
+	if m.App.Session.GetInt(r.Context(), "hold_id") == 0 {
+		err := m.placeHold(r, res)
+		if errors.Is(err, repository.ErrRoomUnavailable) {
+			m.App.Session.Put(r.Context(), "error", "Sorry, that room is no longer available")
+			http.Redirect(w, r, "/search-availability", http.StatusSeeOther)
+			return
+		} else if err != nil {
+			m.App.Session.Put(r.Context(), "error", "can't hold room!")
+			http.Redirect(w, r, "/", http.StatusSeeOther)
+			return
+		}
+	}
+
+	reference := fmt.Sprintf("hold-%d", m.App.Session.GetInt(r.Context(), "hold_id"))
+	intent, err := m.App.Payments.CreateIntent(r.Context(), amount, m.App.Currency, reference)
+	if err != nil {
+		helpers.Logger(r).Error("can't start deposit payment", "error", err)
+		m.App.Session.Put(r.Context(), "error", "Sorry, the deposit payment could not be started, please try again")
+		http.Redirect(w, r, "/make-reservation", http.StatusSeeOther)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "reservation", res)
+	m.App.Session.Put(r.Context(), "deposit_intent", intent.ID)
+	m.App.Session.Put(r.Context(), "deposit_secret", intent.ClientSecret)
+	m.App.Session.Put(r.Context(), "deposit_amount", amount)
+
+	http.Redirect(w, r, "/reservation-deposit", http.StatusSeeOther)
+}
+
+// Deposit shows the guest the deposit to pay for their reservation.
+func (m *Repository) Deposit(w http.ResponseWriter, r *http.Request) {
+	res, ok := m.App.Session.Get(r.Context(), "reservation").(models.Reservation)
+	if !ok || !m.App.Session.Exists(r.Context(), "deposit_intent") {
+		m.App.Session.Put(r.Context(), "error", "can't get reservation from session")
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["reservation"] = res
+	data["policy"] = ReservationPolicy(res)
+
+	stringMap := make(map[string]string)
+	stringMap["provider"] = m.App.Payments.Name()
+	stringMap["public_key"] = m.App.PaymentsPublicKey
+	stringMap["client_secret"] = m.App.Session.GetString(r.Context(), "deposit_secret")
+	stringMap["start_date"] = res.StartDate.Format("2006-01-02")
+	stringMap["end_date"] = res.EndDate.Format("2006-01-02")
+
+	intMap := make(map[string]int)
+	intMap["amount"] = m.App.Session.GetInt(r.Context(), "deposit_amount")
+	intMap["hold_minutes"] = int(holdDuration.Minutes())
+
+	render.Template(w, r, "deposit.page.tmpl", &models.TemplateData{
+		StringMap: stringMap,
+		IntMap:    intMap,
+		Data:      data,
+	})
+}
+
+// PostDeposit takes the deposit the guest has authorised and confirms their reservation. The deposit is
+// refunded when the room can no longer be booked.
+func (m *Repository) PostDeposit(w http.ResponseWriter, r *http.Request) {
+	res, ok := m.App.Session.Get(r.Context(), "reservation").(models.Reservation)
+	intentID := m.App.Session.GetString(r.Context(), "deposit_intent")
+	if !ok || intentID == "" {
+		m.App.Session.Put(r.Context(), "error", "can't get reservation from session")
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+
+	intent, err := m.App.Payments.Capture(r.Context(), intentID)
+	if errors.Is(err, payments.ErrNotCapturable) {
+		m.App.Session.Put(r.Context(), "error", "Your payment was not completed, please try again")
+		http.Redirect(w, r, "/reservation-deposit", http.StatusSeeOther)
+		return
+	} else if err != nil {
+		helpers.Logger(r).Error("can't capture deposit", "intent", intentID, "error", err)
+		m.App.Session.Put(r.Context(), "error", "Sorry, the deposit could not be taken, please try again")
+		http.Redirect(w, r, "/reservation-deposit", http.StatusSeeOther)
+		return
+	}
+
+	// the money is taken, the reservation is saved or refunded even if the guest goes away now
+	r = r.WithContext(context.WithoutCancel(r.Context()))
+
+	m.App.Session.Remove(r.Context(), "deposit_intent")
+	m.App.Session.Remove(r.Context(), "deposit_secret")
+	m.App.Session.Remove(r.Context(), "deposit_amount")
+
+	id, ok := m.saveReservation(w, r, res)
+	if !ok {
+		// the guest has been sent back already, give them their money back
+		_, err = m.App.Payments.Refund(r.Context(), intent.ID, intent.Amount)
+		if err != nil {
+			helpers.Logger(r).Error("can't refund deposit of a failed reservation", "intent", intent.ID, "error", err)
+		}
+		return
+	}
+
+	_, err = m.DB.InsertPayment(r.Context(), models.Payment{
+		ReservationID: id,
+		Provider:      m.App.Payments.Name(),
+		ProviderRef:   intent.ID,
+		Kind:          models.PaymentDeposit,
+		Amount:        intent.Amount,
+		Currency:      m.App.Currency,
+		Status:        intent.Status,
+	})
+	if err != nil {
+		// the reservation and the payment are both done, staff can match them up from the log
+		helpers.Logger(r).Error("can't record deposit", "intent", intent.ID, "reservation_id", id, "error", err)
+	}
+
+	res.ID = id
+	m.App.Session.Put(r.Context(), "deposit_paid", intent.Amount)
+	m.confirmReservation(w, r, res)
+}
+
+// PaymentWebhook receives the payment updates of the payment provider and updates the payment records.
+func (m *Repository) PaymentWebhook(w http.ResponseWriter, r *http.Request) {
+	if m.App.Payments == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	payload, err := io.ReadAll(io.LimitReader(r.Body, webhookMaxSize))
+	if err != nil {
+		helpers.ClientError(w, r, http.StatusBadRequest)
+		return
+	}
+
+	event, err := m.App.Payments.VerifyWebhook(payload, r.Header)
+	if err != nil {
+		helpers.Logger(r).Warn("rejected payment webhook", "error", err)
+		helpers.ClientError(w, r, http.StatusBadRequest)
+		return
+	}
+
+	var ref, status string
+	switch event.Type {
+	case payments.EventPaymentSucceeded:
+		ref, status = event.IntentID, payments.StatusSucceeded
+	case payments.EventPaymentFailed:
+		ref, status = event.IntentID, payments.StatusFailed
+	case payments.EventRefundSucceeded:
+		ref, status = event.RefundID, payments.StatusSucceeded
+	case payments.EventRefundFailed:
+		ref, status = event.RefundID, payments.StatusFailed
+	}
+
+	if ref != "" {
+		// an error makes the provider send the event again later
+		_, err = m.DB.UpdatePaymentStatus(r.Context(), m.App.Payments.Name(), ref, status)
+		if err != nil {
+			helpers.ServerError(w, r, err)
+			return
+		}
+	}
 
+	w.WriteHeader(http.StatusOK)
 }
 
 // PostAvailability handles the search availability form submission
@@ -287,19 +682,24 @@ func (m *Repository) PostAvailability(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Search for room availability for the specified dates.
-	rooms, err := m.DB.SearchAvailabilityForAllRooms(startDate, endDate)
+	rooms, err := m.DB.SearchAvailabilityForAllRooms(r.Context(), startDate, endDate)
 	if err != nil {
 		m.App.Session.Put(r.Context(), "error", "can't get availability for rooms")
 		http.Redirect(w, r, "/", http.StatusSeeOther)
 		return
 	}
 
-	// If no rooms are available, display an error message and redirect to the search availability page.
-	if len(rooms) == 0 {
+	// If no rooms are available, offer the guest a place on the waitlist for those dates.
+	if len(rooms) == 0 && !m.App.Features.Waitlist {
 		m.App.Session.Put(r.Context(), "error", "No availability")
 		http.Redirect(w, r, "/search-availability", http.StatusSeeOther)
 		return
 	}
+	if len(rooms) == 0 {
+		m.App.Session.Put(r.Context(), "warning", "No availability. Join the waitlist and we'll email you if a room frees up")
+		http.Redirect(w, r, fmt.Sprintf("/waitlist?s=%s&e=%s", start, end), http.StatusSeeOther)
+		return
+	}
 
 	// Store the reservation data in the session and render the "choose-room" page.
 	data := make(map[string]interface{})
@@ -349,7 +749,7 @@ func (m *Repository) AvailabilityJSON(w http.ResponseWriter, r *http.Request) {
 
 	roomID, _ := strconv.Atoi(r.Form.Get("room_id"))
 
-	availiable, err := m.DB.SearchAvailabilityByDatesByRoomID(startDate, endDate, roomID)
+	availiable, err := m.DB.SearchAvailabilityByDatesByRoomID(r.Context(), startDate, endDate, roomID)
 	if err != nil {
 		resp := jsonResponce{
 			OK:      false,
@@ -371,7 +771,7 @@ func (m *Repository) AvailabilityJSON(w http.ResponseWriter, r *http.Request) {
 
 	out, err := json.MarshalIndent(resp, "", "     ") // Marshal the response into JSON format.
 	if err != nil {
-		helpers.ServerError(w, err) // Handle and log server error if JSON marshaling fails.
+		helpers.ServerError(w, r, err) // Handle and log server error if JSON marshaling fails.
 		return
 	}
 	//log.Println(string(out)) // Log the JSON response.
@@ -380,12 +780,69 @@ func (m *Repository) AvailabilityJSON(w http.ResponseWriter, r *http.Request) {
 	w.Write(out)                                       // Write the JSON response to the response writer.
 }
 
+// sendGuestConfirmation emails the guest the confirmation of their reservation, with its booking number and
+// cancellation policy once it is saved.
+func (m *Repository) sendGuestConfirmation(r *http.Request, reservation models.Reservation) {
+	htmlMessage := fmt.Sprintf(`
+	<strong>Reservation Confiramtion</strong><br>
+	 %s, this is confirm your reservation from %s to %s.
+	`, reservation.FirstName, reservation.StartDate.Format("2006-01-02"), reservation.EndDate.Format("2006-01-02"))
+	if reservation.ID > 0 {
+		htmlMessage += fmt.Sprintf(`<br>Your booking number is <strong>%d</strong>.<br>
+	%s <a href="%s/cancel-reservation">Cancel your reservation</a> with your booking number and email.
+	`, reservation.ID, html.EscapeString(ReservationPolicy(reservation).Description()), siteURL(r))
+	}
+	htmlMessage += priceHTML(reservation)
+	msg := models.MailData{
+		To:       reservation.Email,
+		From:     m.App.SMTP.From,
+		Subject:  "Reservation Confiramtion",
+		Content:  htmlMessage,
+		Template: "basic.html",
+	}
+	if reservation.ID > 0 {
+		// the price is worked out by the database, so the invoice is made from the stored reservation
+		stored, err := m.DB.GetReservationByID(r.Context(), reservation.ID)
+		var attachment models.MailAttachment
+		if err == nil {
+			attachment, err = m.invoiceAttachment(r.Context(), stored)
+		}
+		if err != nil {
+			// the confirmation matters more, the invoice can be downloaded later
+			helpers.Logger(r).Error("can't attach invoice", "reservation_id", reservation.ID, "error", err)
+		} else {
+			msg.Attachments = append(msg.Attachments, attachment)
+		}
+	}
+	m.App.MailChan <- msg
+}
+
+// priceHTML itemises the price of a reservation with its taxes and fees for an email.
+func priceHTML(res models.Reservation) string {
+	if res.Amount == 0 {
+		return ""
+	}
+	currency := strings.ToUpper(res.Currency)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "<br><br><strong>Price for %d guest(s)</strong><br>\n", res.Guests)
+	fmt.Fprintf(&b, "%d night(s): %s %s<br>\n", res.Nights(), render.FormatMoney(res.Amount), currency)
+	if res.Discount > 0 {
+		fmt.Fprintf(&b, "Promo code %s: -%s %s<br>\n", html.EscapeString(res.PromotionCode), render.FormatMoney(res.Discount), currency)
+	}
+	for _, c := range res.Charges {
+		fmt.Fprintf(&b, "%s: %s %s<br>\n", html.EscapeString(c.Description), render.FormatMoney(c.Amount), currency)
+	}
+	fmt.Fprintf(&b, "<strong>Total: %s %s</strong><br>\n", render.FormatMoney(res.Total()), currency)
+	return b.String()
+}
+
 // ReservationSummary displays the reservation summary page.
 func (m *Repository) ReservationSummary(w http.ResponseWriter, r *http.Request) {
 	// Retrieve the reservation from the session.
 	reservation, ok := m.App.Session.Get(r.Context(), "reservation").(models.Reservation)
 	if !ok {
-		m.App.ErrorLog.Println("Can't get reservation from session")
+		helpers.Logger(r).Warn("can't get reservation from session")
 		m.App.Session.Put(r.Context(), "error", "can't get reservation from session") // Store an error message in the session.
 		http.Redirect(w, r, "/", http.StatusSeeOther)                                 // Redirect to the home page.
 		return
@@ -393,61 +850,245 @@ func (m *Repository) ReservationSummary(w http.ResponseWriter, r *http.Request)
 
 	m.App.Session.Remove(r.Context(), "reservation") // Remove the reservation from the session.
 
+	intMap := make(map[string]int)
+	intMap["deposit_paid"] = m.App.Session.PopInt(r.Context(), "deposit_paid")
+
 	// Prepare the data for rendering the template.
 	data := make(map[string]interface{})
 	data["reservation"] = reservation
+	data["policy"] = ReservationPolicy(reservation)
 
 	sd := reservation.StartDate.Format("2006-01-02")
 	ed := reservation.EndDate.Format("2006-01-02")
 	stringMap := make(map[string]string)
 	stringMap["start_date"] = sd
 	stringMap["end_date"] = ed
+	stringMap["currency"] = strings.ToUpper(reservation.Currency)
 	// Render the reservation summary page template.
 	render.Template(w, r, "reservation-summary.page.tmpl", &models.TemplateData{
 		Data:      data,
 		StringMap: stringMap,
+		IntMap:    intMap,
 	})
 }
 
-func (m *Repository) ChooseRoom(w http.ResponseWriter, r *http.Request) {
-	// Retrieve the room ID from the URL parameter.
-	roomID, err := strconv.Atoi(chi.URLParam(r, "id"))
+// CancelReservation shows guests the form to cancel their reservation.
+func (m *Repository) CancelReservation(w http.ResponseWriter, r *http.Request) {
+	render.Template(w, r, "cancel-reservation.page.tmpl", &models.TemplateData{
+		Form: forms.New(nil),
+		Data: make(map[string]interface{}),
+	})
+}
+
+// PostCancelReservation finds the reservation of a guest by its booking number and email and shows them the
+// refund and fee of cancelling it under its cancellation policy. The reservation is cancelled when the guest
+// confirms.
+func (m *Repository) PostCancelReservation(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
 	if err != nil {
-		helpers.ServerError(w, err) // Handle and log server error if room ID parsing fails.
+		m.App.Session.Put(r.Context(), "error", "can't parse form!")
+		http.Redirect(w, r, "/", http.StatusSeeOther)
 		return
 	}
 
-	// Retrieve the reservation from the session.
-	res, ok := m.App.Session.Get(r.Context(), "reservation").(models.Reservation)
-	if !ok {
-		helpers.ServerError(w, err) // Handle and log server error if reservation retrieval fails.
-		return
+	form := forms.New(r.PostForm)
+	res := m.findGuestReservation(r.Context(), form)
+
+	data := make(map[string]interface{})
+
+	var result cancellation.Result
+	if form.Valid() {
+		result, _, _, err = m.QuoteCancellation(r.Context(), res, time.Now())
+		if err != nil {
+			helpers.ServerError(w, r, err)
+			return
+		}
+		if result.DaysBefore < 0 {
+			form.Errors.Add("reservation_id", "This stay has already started, please contact us")
+		}
 	}
 
-	// Assign the selected room ID to the reservation.
-	res.RoomID = roomID
+	if !form.Valid() || r.Form.Get("confirm") != "1" {
+		data["reservation"] = res
+		data["result"] = result
+		data["policy"] = ReservationPolicy(res)
+		render.Template(w, r, "cancel-reservation.page.tmpl", &models.TemplateData{
+			Form: form,
+			Data: data,
+		})
+		return
+	}
 
-	// Store the updated reservation back in the session.
-	m.App.Session.Put(r.Context(), "reservation", res)
+	result, err = m.ApplyCancellation(r.Context(), siteURL(r), res, "guest", true)
+	if err != nil {
+		helpers.Logger(r).Error("can't cancel reservation", "reservation_id", res.ID, "error", err)
+		m.App.Session.Put(r.Context(), "error", "Sorry, your reservation could not be cancelled, please try again")
+		http.Redirect(w, r, "/cancel-reservation", http.StatusSeeOther)
+		return
+	}
 
-	// Redirect to the make-reservation page to complete the reservation.
-	http.Redirect(w, r, "/make-reservation", http.StatusSeeOther)
+	flash := "Your reservation has been cancelled"
+	if result.Refund > 0 {
+		flash += ", " + render.FormatMoney(result.Refund) + " will be refunded to your card"
+	}
+	m.App.Session.Put(r.Context(), "flash", flash)
+	http.Redirect(w, r, "/", http.StatusSeeOther)
 }
 
-// Book Room takes url parameters, builds a sessional variable and takes user to res screen
-func (m *Repository) BookRoom(w http.ResponseWriter, r *http.Request) {
+// findGuestReservation finds the reservation with the booking number and email posted in form. When there is
+// none the errors are added to form.
+func (m *Repository) findGuestReservation(ctx context.Context, form *forms.Form) models.Reservation {
+	form.Required("reservation_id", "email")
+	form.IsEmail("email")
 
-	roomID, _ := strconv.Atoi(r.URL.Query().Get("id"))
+	id, err := strconv.Atoi(strings.TrimSpace(form.Get("reservation_id")))
+	if err != nil || id <= 0 {
+		form.Errors.Add("reservation_id", "Invalid booking number")
+	}
+	if !form.Valid() {
+		return models.Reservation{}
+	}
 
-	sd := r.URL.Query().Get("s")
-	ed := r.URL.Query().Get("e")
-	// Define the layout for date parsing.
-	layout := "2006-01-02"
+	res, err := m.DB.GetReservationByID(ctx, id)
+	// the same answer for unknown numbers and wrong emails, so booking numbers can't be probed
+	if err != nil || !strings.EqualFold(res.Email, strings.TrimSpace(form.Get("email"))) {
+		form.Errors.Add("reservation_id", "No reservation matches this booking number and email")
+		return models.Reservation{}
+	}
 
-	// Parse the start date string into a time.Time object.
-	startDate, err := time.Parse(layout, sd)
+	return res
+}
+
+// PostReservationInvoice sends guests the invoice of their reservation, found by its booking number and email,
+// as a PDF or as a page when format is html.
+func (m *Repository) PostReservationInvoice(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
 	if err != nil {
-		m.App.Session.Put(r.Context(), "error", "can't parse start date")
+		m.App.Session.Put(r.Context(), "error", "can't parse form!")
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+
+	res := m.findGuestReservation(r.Context(), forms.New(r.PostForm))
+	if res.ID == 0 {
+		m.App.Session.Put(r.Context(), "error", "No reservation matches this booking number and email")
+		http.Redirect(w, r, "/cancel-reservation", http.StatusSeeOther)
+		return
+	}
+
+	m.writeInvoice(w, r, res, r.Form.Get("format"))
+}
+
+// reservationInvoice returns the invoice of a reservation, issuing it the first time.
+func (m *Repository) reservationInvoice(ctx context.Context, res models.Reservation) (invoice.Invoice, error) {
+	rec, err := m.DB.InvoiceForReservation(ctx, res.ID)
+	if err != nil {
+		return invoice.Invoice{}, err
+	}
+
+	records, err := m.DB.GetPaymentsForReservation(ctx, res.ID)
+	if err != nil {
+		return invoice.Invoice{}, err
+	}
+
+	return invoice.Build(rec, res, records, m.App.Currency), nil
+}
+
+// writeInvoice sends the invoice of a reservation as a PDF download, or as a page when format is html.
+func (m *Repository) writeInvoice(w http.ResponseWriter, r *http.Request, res models.Reservation, format string) {
+	inv, err := m.reservationInvoice(r.Context(), res)
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	if format == "html" {
+		data := make(map[string]interface{})
+		data["invoice"] = inv
+		render.Template(w, r, "invoice.page.tmpl", &models.TemplateData{
+			Data: data,
+		})
+		return
+	}
+
+	var buf bytes.Buffer
+	err = invoice.WritePDF(&buf, inv)
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, inv.Filename()))
+	w.Write(buf.Bytes())
+}
+
+// invoiceAttachment returns the invoice of a reservation as a PDF to attach to an email.
+func (m *Repository) invoiceAttachment(ctx context.Context, res models.Reservation) (models.MailAttachment, error) {
+	inv, err := m.reservationInvoice(ctx, res)
+	if err != nil {
+		return models.MailAttachment{}, err
+	}
+
+	var buf bytes.Buffer
+	err = invoice.WritePDF(&buf, inv)
+	if err != nil {
+		return models.MailAttachment{}, err
+	}
+
+	return models.MailAttachment{Name: inv.Filename(), ContentType: "application/pdf", Data: buf.Bytes()}, nil
+}
+
+func (m *Repository) ChooseRoom(w http.ResponseWriter, r *http.Request) {
+	// Retrieve the room ID from the URL parameter.
+	roomID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ServerError(w, r, err) // Handle and log server error if room ID parsing fails.
+		return
+	}
+
+	// Retrieve the reservation from the session.
+	res, ok := m.App.Session.Get(r.Context(), "reservation").(models.Reservation)
+	if !ok {
+		helpers.ServerError(w, r, err) // Handle and log server error if reservation retrieval fails.
+		return
+	}
+
+	// Assign the selected room ID to the reservation.
+	res.RoomID = roomID
+
+	// Hold the room so nobody else can take it while the guest fills in the form.
+	err = m.placeHold(r, res)
+	if errors.Is(err, repository.ErrRoomUnavailable) {
+		m.App.Session.Put(r.Context(), "error", "Sorry, that room has just been taken")
+		http.Redirect(w, r, "/search-availability", http.StatusSeeOther)
+		return
+	} else if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	// Store the updated reservation back in the session.
+	m.App.Session.Put(r.Context(), "reservation", res)
+
+	// Redirect to the make-reservation page to complete the reservation.
+	http.Redirect(w, r, "/make-reservation", http.StatusSeeOther)
+}
+
+// Book Room takes url parameters, builds a sessional variable and takes user to res screen
+func (m *Repository) BookRoom(w http.ResponseWriter, r *http.Request) {
+
+	roomID, _ := strconv.Atoi(r.URL.Query().Get("id"))
+
+	sd := r.URL.Query().Get("s")
+	ed := r.URL.Query().Get("e")
+	// Define the layout for date parsing.
+	layout := "2006-01-02"
+
+	// Parse the start date string into a time.Time object.
+	startDate, err := time.Parse(layout, sd)
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "can't parse start date")
 		http.Redirect(w, r, "/", http.StatusSeeOther)
 		return
 	}
@@ -460,7 +1101,7 @@ func (m *Repository) BookRoom(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	var res models.Reservation
-	room, err := m.DB.GetRoomByID(roomID)
+	room, err := m.DB.GetRoomByID(r.Context(), roomID)
 	if err != nil {
 		// If there's an error fetching the room details, set an error message in the session and redirect.
 		m.App.Session.Put(r.Context(), "error", "can't find room!")
@@ -472,11 +1113,43 @@ func (m *Repository) BookRoom(w http.ResponseWriter, r *http.Request) {
 	res.StartDate = startDate
 	res.EndDate = endDate
 
+	err = m.placeHold(r, res)
+	if errors.Is(err, repository.ErrRoomUnavailable) {
+		m.App.Session.Put(r.Context(), "error", "Sorry, that room is not available for those dates")
+		http.Redirect(w, r, "/search-availability", http.StatusSeeOther)
+		return
+	} else if err != nil {
+		m.App.Session.Put(r.Context(), "error", "can't hold room!")
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+
 	m.App.Session.Put(r.Context(), "reservation", res)
 
 	http.Redirect(w, r, "/make-reservation", http.StatusSeeOther)
 }
 
+// placeHold puts a temporary hold on the reservation's room and dates, releasing any hold the guest already had.
+func (m *Repository) placeHold(r *http.Request, res models.Reservation) error {
+	if oldHoldID := m.App.Session.GetInt(r.Context(), "hold_id"); oldHoldID > 0 {
+		_ = m.DB.DeleteHold(r.Context(), oldHoldID)
+		m.App.Session.Remove(r.Context(), "hold_id")
+	}
+
+	holdID, err := m.DB.InsertHold(r.Context(), models.RoomRestriction{
+		StartDate: res.StartDate,
+		EndDate:   res.EndDate,
+		RoomID:    res.RoomID,
+		ExpiresAt: time.Now().Add(holdDuration),
+	})
+	if err != nil {
+		return err
+	}
+
+	m.App.Session.Put(r.Context(), "hold_id", holdID)
+	return nil
+}
+
 func (m *Repository) ShowLogin(w http.ResponseWriter, r *http.Request) {
 
 	render.Template(w, r, "login.page.tmpl", &models.TemplateData{
@@ -489,8 +1162,7 @@ func (m *Repository) PostShowLogin(w http.ResponseWriter, r *http.Request) {
 
 	err := r.ParseForm()
 	if err != nil {
-
-		log.Println(err)
+		helpers.Logger(r).Info("can't parse login form", "error", err)
 	}
 	var email string
 	var password string
@@ -506,9 +1178,9 @@ func (m *Repository) PostShowLogin(w http.ResponseWriter, r *http.Request) {
 		render.Template(w, r, "login.page.tmpl", &models.TemplateData{Form: form})
 		return
 	}
-	id, _, err := m.DB.Authenticate(email, password)
+	id, _, err := m.DB.Authenticate(r.Context(), email, password)
 	if err != nil {
-		log.Println(err)
+		helpers.Logger(r).Info("failed login", "email", email, "error", err)
 		m.App.Session.Put(r.Context(), "error", "invalid login credantials")
 		http.Redirect(w, r, "/user/login", http.StatusSeeOther)
 		return
@@ -528,192 +1200,1868 @@ func (m *Repository) Logout(w http.ResponseWriter, r *http.Request) {
 
 }
 
-func (m *Repository) AdminDashboard(w http.ResponseWriter, r *http.Request) {
-	render.Template(w, r, "admin-dashboard.page.tmpl", &models.TemplateData{})
-}
-
-func (m *Repository) AdminNewReservations(w http.ResponseWriter, r *http.Request) {
-	reservations, err := m.DB.AllReservations()
+// Setup shows the first run form, which creates the owner account and describes the property. It is gone
+// once the setup is done.
+func (m *Repository) Setup(w http.ResponseWriter, r *http.Request) {
+	done, err := m.DB.SetupDone(r.Context())
 	if err != nil {
-		helpers.ServerError(w, err)
+		helpers.ServerError(w, r, err)
 		return
 	}
-	data := make(map[string]interface{})
-	data["reservations"] = reservations
-	render.Template(w, r, "admin-new-reservations.page.tmpl", &models.TemplateData{Data: data})
+	if done {
+		helpers.ClientError(w, r, http.StatusNotFound)
+		return
+	}
+
+	// the time zone the application runs in, unless it is just the server's
+	timezone := time.Local.String()
+	if timezone == "Local" {
+		timezone = ""
+	}
+
+	render.Template(w, r, "setup.page.tmpl", &models.TemplateData{
+		Form: forms.New(url.Values{"timezone": {timezone}}),
+	})
 }
 
-func (m *Repository) AdminAllReservations(w http.ResponseWriter, r *http.Request) {
-	reservations, err := m.DB.AllNewReservations()
+// PostSetup creates the owner account and the property and signs the owner in. It only succeeds once; the
+// database refuses a second setup, e.g. from a form submitted twice.
+func (m *Repository) PostSetup(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
 	if err != nil {
-		helpers.ServerError(w, err)
+		helpers.ServerError(w, r, err)
 		return
 	}
-	data := make(map[string]interface{})
-	data["reservations"] = reservations
-	render.Template(w, r, "admin-all-reservations.page.tmpl", &models.TemplateData{Data: data})
-}
 
-func (m *Repository) AdminShowReservation(w http.ResponseWriter, r *http.Request) {
-	spltd := strings.Split(r.RequestURI, "/")
-	id, err := strconv.Atoi(spltd[4])
-	if err != nil {
-		helpers.ServerError(w, err)
+	form := forms.New(r.PostForm)
+	form.Required("property_name", "timezone", "contact_email", "first_name", "last_name", "email", "password")
+	for _, field := range []string{"property_name", "contact_email", "first_name", "last_name", "email"} {
+		form.MaxLength(field, 255)
+	}
+	form.IsEmail("contact_email")
+	form.IsEmail("email")
+	form.StrongPassword("password")
+	if form.Get("password") != form.Get("password_confirm") {
+		form.Errors.Add("password_confirm", "The passwords don't match")
+	}
+
+	timezone := strings.TrimSpace(form.Get("timezone"))
+	if timezone != "" {
+		if _, err := time.LoadLocation(timezone); err != nil || timezone == "Local" {
+			form.Errors.Add("timezone", "Enter a time zone like Europe/Paris")
+		}
+	}
+
+	if !form.Valid() {
+		// the passwords are not sent back
+		form.Del("password")
+		form.Del("password_confirm")
+		render.Template(w, r, "setup.page.tmpl", &models.TemplateData{Form: form})
 		return
 	}
-	src := spltd[3]
 
-	strMap := make(map[string]string)
-	strMap["src"] = src
+	property := models.Property{
+		Name:         strings.TrimSpace(form.Get("property_name")),
+		Timezone:     timezone,
+		ContactEmail: strings.ToLower(strings.TrimSpace(form.Get("contact_email"))),
+	}
+	owner := models.User{
+		FirstName:  strings.TrimSpace(form.Get("first_name")),
+		LastName:   strings.TrimSpace(form.Get("last_name")),
+		Email:      strings.ToLower(strings.TrimSpace(form.Get("email"))),
+		AcessLevel: models.AccessLevelAdmin,
+	}
 
-	res, err := m.DB.GetReservationByID(id)
+	id, err := m.DB.CompleteSetup(r.Context(), property, owner, form.Get("password"))
+	if errors.Is(err, repository.ErrSetupDone) {
+		helpers.ClientError(w, r, http.StatusNotFound)
+		return
+	}
 	if err != nil {
-		helpers.ServerError(w, err)
+		helpers.ServerError(w, r, err)
 		return
-
 	}
+	helpers.Logger(r).Info("setup completed", "user_id", id, "property", property.Name)
 
-	data := make(map[string]interface{})
-	data["reservation"] = res
-	render.Template(w, r, "admin-reservations-show.page.tmpl", &models.TemplateData{
-		StringMap: strMap,
-		Data:      data})
+	_ = m.App.Session.RenewToken(r.Context())
+	m.App.Session.Put(r.Context(), "user_id", id)
+
+	flash := "Setup complete, welcome to " + property.Name
+	if timezone != time.Local.String() {
+		// the dates of the running application can't move under it
+		flash += ". Restart the application to use the time zone " + timezone
+	}
+	m.App.Session.Put(r.Context(), "flash", flash)
+	http.Redirect(w, r, "/admin/dashboard", http.StatusSeeOther)
 }
-func (m *Repository) AdminPostShowReservation(w http.ResponseWriter, r *http.Request) {
-	err := r.ParseForm()
+
+// AdminDashboard shows today's arrivals and departures and the booking statistics of a date range.
+func (m *Repository) AdminDashboard(w http.ResponseWriter, r *http.Request) {
+	today := dashboardToday()
+	start, end := dashboardRange(r.URL.Query(), today)
+
+	stats, err := m.DB.DashboardStats(r.Context(), today, start, end)
 	if err != nil {
-		helpers.ServerError(w, err)
+		helpers.ServerError(w, r, err)
 		return
 	}
-	spltd := strings.Split(r.RequestURI, "/")
-	id, err := strconv.Atoi(spltd[4])
+
+	data := make(map[string]interface{})
+	data["stats"] = stats
+
+	stringMap := make(map[string]string)
+	stringMap["from"] = start.Format("2006-01-02")
+	stringMap["to"] = end.AddDate(0, 0, -1).Format("2006-01-02")
+
+	render.Template(w, r, "admin-dashboard.page.tmpl", &models.TemplateData{
+		StringMap: stringMap,
+		Data:      data,
+	})
+}
+
+// chartData is the JSON the dashboard charts are drawn from.
+type chartData struct {
+	Labels   []string       `json:"labels"`
+	Datasets []chartDataset `json:"datasets"`
+}
+
+// chartDataset is one line or set of bars of a dashboard chart.
+type chartDataset struct {
+	Label string    `json:"label"`
+	Data  []float64 `json:"data"`
+}
+
+// AdminDashboardOccupancy returns the occupancy rate in percent per room and month as chart data.
+func (m *Repository) AdminDashboardOccupancy(w http.ResponseWriter, r *http.Request) {
+	start, end := dashboardRange(r.URL.Query(), dashboardToday())
+
+	occupancy, err := m.DB.RoomOccupancy(r.Context(), start, end)
 	if err != nil {
-		helpers.ServerError(w, err)
+		helpers.ServerError(w, r, err)
 		return
 	}
-	src := spltd[3]
 
-	strMap := make(map[string]string)
-	strMap["src"] = src
+	var chart chartData
+	rooms := make(map[int]int)
+	for _, o := range occupancy {
+		label := o.Month.Format("Jan 2006")
+		if len(chart.Labels) == 0 || chart.Labels[len(chart.Labels)-1] != label {
+			chart.Labels = append(chart.Labels, label)
+		}
+
+		i, ok := rooms[o.RoomID]
+		if !ok {
+			i = len(chart.Datasets)
+			rooms[o.RoomID] = i
+			chart.Datasets = append(chart.Datasets, chartDataset{Label: o.RoomName})
+		}
+		chart.Datasets[i].Data = append(chart.Datasets[i].Data, math.Round(o.Rate()*10)/10)
+	}
 
-	res, err := m.DB.GetReservationByID(id)
+	writeChartData(w, r, chart)
+}
+
+// AdminDashboardBookings returns arrivals, cancellations, average stay and lead time per month as chart data.
+func (m *Repository) AdminDashboardBookings(w http.ResponseWriter, r *http.Request) {
+	start, end := dashboardRange(r.URL.Query(), dashboardToday())
+
+	months, err := m.DB.MonthlyBookings(r.Context(), start, end)
 	if err != nil {
-		helpers.ServerError(w, err)
+		helpers.ServerError(w, r, err)
 		return
 	}
 
-	res.FirstName = r.Form.Get("first_name")
-	res.LastName = r.Form.Get("last_name")
-	res.Email = r.Form.Get("email")
-	res.Phone = r.Form.Get("phone")
+	chart := chartData{
+		Datasets: []chartDataset{
+			{Label: "Arrivals"},
+			{Label: "Cancellations"},
+			{Label: "Average stay (nights)"},
+			{Label: "Average lead time (days)"},
+		},
+	}
+	for _, mb := range months {
+		chart.Labels = append(chart.Labels, mb.Month.Format("Jan 2006"))
+		chart.Datasets[0].Data = append(chart.Datasets[0].Data, float64(mb.Arrivals))
+		chart.Datasets[1].Data = append(chart.Datasets[1].Data, float64(mb.Cancellations))
+		chart.Datasets[2].Data = append(chart.Datasets[2].Data, math.Round(mb.AverageStay*10)/10)
+		chart.Datasets[3].Data = append(chart.Datasets[3].Data, math.Round(mb.AverageLeadTime*10)/10)
+	}
+
+	writeChartData(w, r, chart)
+}
 
-	err = m.DB.UpdateReservation(res)
+func writeChartData(w http.ResponseWriter, r *http.Request, chart chartData) {
+	out, err := json.MarshalIndent(chart, "", "  ")
 	if err != nil {
-		helpers.ServerError(w, err)
+		helpers.ServerError(w, r, err)
 		return
 	}
-	m.App.Session.Put(r.Context(), "flash", "Changes saved")
-	http.Redirect(w, r, fmt.Sprintf("/admin/reservations-%s", src), http.StatusSeeOther)
 
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(out)
 }
-func (m *Repository) AdminProcessReservation(w http.ResponseWriter, r *http.Request) {
-	id, _ := strconv.Atoi(chi.URLParam(r, "id"))
-	src := chi.URLParam(r, "src")
 
-	_ = m.DB.UpdateProcessedForReservation(id, 1)
+// dashboardToday returns today's date the way reservation dates are stored.
+func dashboardToday() time.Time {
+	now := time.Now()
+	return time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+}
 
-	m.App.Session.Put(r.Context(), "flash", "Reservation marked as processed")
-	http.Redirect(w, r, fmt.Sprintf("/admin/reservations-%s", src), http.StatusSeeOther)
+// dashboardRange returns the dashboard date range from the from and to query parameters, both inclusive,
+// as [start, end). It defaults to the six months up to the end of the current month.
+func dashboardRange(q url.Values, today time.Time) (time.Time, time.Time) {
+	firstOfMonth := today.AddDate(0, 0, 1-today.Day())
+	start := firstOfMonth.AddDate(0, -5, 0)
+	end := firstOfMonth.AddDate(0, 1, 0)
+
+	layout := "2006-01-02"
+	from, err := time.Parse(layout, q.Get("from"))
+	if err != nil {
+		return start, end
+	}
+	to, err := time.Parse(layout, q.Get("to"))
+	if err != nil || to.Before(from) {
+		return start, end
+	}
+
+	return from, to.AddDate(0, 0, 1)
 }
 
-func (m *Repository) AdminDeleteReservation(w http.ResponseWriter, r *http.Request) {
-	id, _ := strconv.Atoi(chi.URLParam(r, "id"))
-	src := chi.URLParam(r, "src")
+// reservationsPerPage is the page size of the admin reservation lists.
+const reservationsPerPage = 25
 
-	_ = m.DB.DeleteReservation(id)
+// reservationSortableColumns are the columns the admin reservation lists can be sorted on.
+var reservationSortableColumns = []string{"id", "first_name", "last_name", "email", "phone", "room", "start_date", "end_date",
+	"created_at"}
 
-	m.App.Session.Put(r.Context(), "flash", "Reservation deleted")
-	http.Redirect(w, r, fmt.Sprintf("/admin/reservations-%s", src), http.StatusSeeOther)
+func (m *Repository) AdminNewReservations(w http.ResponseWriter, r *http.Request) {
+	f := reservationFilterFromQuery(r.URL.Query())
+	f.Status = "new"
+	m.adminReservationList(w, r, "admin-new-reservations.page.tmpl", "new", f)
 }
 
-func (m *Repository) AdminReservationsCalendar(w http.ResponseWriter, r *http.Request) {
-	now := time.Now()
+func (m *Repository) AdminAllReservations(w http.ResponseWriter, r *http.Request) {
+	f := reservationFilterFromQuery(r.URL.Query())
+	m.adminReservationList(w, r, "admin-all-reservations.page.tmpl", "all", f)
+}
 
-	if r.URL.Query().Get("y") != "" {
-		year, _ := strconv.Atoi(r.URL.Query().Get("y"))
-		mounth, _ := strconv.Atoi(r.URL.Query().Get("m"))
-		now = time.Date(year, time.Month(mounth), 1, 0, 0, 0, 0, time.UTC)
+// adminReservationList renders one page of an admin reservation list with its search, filter and sort controls.
+func (m *Repository) adminReservationList(w http.ResponseWriter, r *http.Request, tmpl, src string, f models.ReservationFilter) {
+	page, err := m.DB.SearchReservations(r.Context(), f)
+	if errors.Is(err, repository.ErrInvalidCursor) {
+		helpers.ClientError(w, r, http.StatusBadRequest)
+		return
+	} else if err != nil {
+		helpers.ServerError(w, r, err)
+		return
 	}
-	data := make(map[string]interface{})
-	data["now"] = now
-	next := now.AddDate(0, 1, 0)
-	last := now.AddDate(0, -1, 0)
 
-	nextMounth := next.Format("01")
-	nextMounthYear := next.Format("2006")
+	rooms, err := m.DB.AllRooms(r.Context())
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
 
-	lastMonth := last.Format("01")
-	lastMonthYear := last.Format("2006")
+	query := r.URL.Query()
+	query.Del("after")
+
+	// header links sort on that column, flipping the direction when it is already the sort column
+	sortLinks := make(map[string]string)
+	for _, col := range reservationSortableColumns {
+		v := cloneValues(query)
+		v.Set("sort", col)
+		if col == f.SortBy && !f.SortDesc {
+			v.Set("dir", "desc")
+		} else {
+			v.Set("dir", "asc")
+		}
+		sortLinks[col] = "?" + v.Encode()
+	}
+
+	data := make(map[string]interface{})
+	data["reservations"] = page.Reservations
+	data["rooms"] = rooms
+	data["filter"] = f
+	data["sort_links"] = sortLinks
 
 	stringMap := make(map[string]string)
-	stringMap["next_mounth"] = nextMounth
-	stringMap["next_mounth_year"] = nextMounthYear
-	stringMap["last_mounth"] = lastMonth
-	stringMap["last_mounth_year"] = lastMonthYear
+	stringMap["src"] = src
+	stringMap["from"] = query.Get("from")
+	stringMap["to"] = query.Get("to")
+	if f.After != "" {
+		stringMap["first_page"] = "?" + query.Encode()
+	}
+	if page.NextCursor != "" {
+		v := cloneValues(query)
+		v.Set("after", page.NextCursor)
+		stringMap["next_page"] = "?" + v.Encode()
+	}
 
-	stringMap["this_mounth"] = now.Format("01")
-	stringMap["this_mounth_year"] = now.Format("2006")
+	exportQuery := cloneValues(query)
+	if f.Status != "" {
+		exportQuery.Set("status", f.Status)
+	}
+	stringMap["export_query"] = exportQuery.Encode()
 
-	currentYear, currentMounth, _ := now.Date()
+	render.Template(w, r, tmpl, &models.TemplateData{
+		StringMap: stringMap,
+		Data:      data,
+	})
+}
 
-	currentLocation := now.Location()
-	firstOfMouth := time.Date(currentYear, currentMounth, 1, 0, 0, 0, 0, currentLocation)
+// AdminExportReservations streams the reservations matching the list filters as a CSV or XLSX download.
+func (m *Repository) AdminExportReservations(w http.ResponseWriter, r *http.Request) {
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "csv"
+	}
+	if format != "csv" && format != "xlsx" {
+		helpers.ClientError(w, r, http.StatusBadRequest)
+		return
+	}
 
-	lastOfTheMouth := firstOfMouth.AddDate(0, 1, -1)
+	f := reservationFilterFromQuery(r.URL.Query())
 
-	intMap := make(map[string]int)
-	intMap["days_in_mounth"] = lastOfTheMouth.Day()
+	w.Header().Set("Content-Type", export.ContentType(format))
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="reservations-%s.%s"`, time.Now().Format("2006-01-02"), format))
 
-	rooms, err := m.DB.AllRooms()
+	ew, err := export.NewWriter(format, w)
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
 
+	// the download has already started, so errors can only be logged from here on
+	err = m.DB.StreamReservations(r.Context(), f, ew.Write)
 	if err != nil {
-		helpers.ServerError(w, err)
+		helpers.Logger(r).Error("export interrupted", "error", err)
 		return
 	}
 
-	data["rooms"] = rooms
+	err = ew.Close()
+	if err != nil {
+		helpers.Logger(r).Error("can't finish export", "error", err)
+	}
+}
+
+// reservationFilterFromQuery builds the admin list filter from URL query parameters so list views can be bookmarked.
+func reservationFilterFromQuery(q url.Values) models.ReservationFilter {
+	f := models.ReservationFilter{
+		Query:    strings.TrimSpace(q.Get("q")),
+		Status:   q.Get("status"),
+		SortBy:   q.Get("sort"),
+		SortDesc: q.Get("dir") == "desc",
+		After:    q.Get("after"),
+		Limit:    reservationsPerPage,
+	}
+
+	f.RoomID, _ = strconv.Atoi(q.Get("room"))
+
+	layout := "2006-01-02"
+	if from, err := time.Parse(layout, q.Get("from")); err == nil {
+		f.From = from
+	}
+	if to, err := time.Parse(layout, q.Get("to")); err == nil {
+		f.To = to
+	}
+
+	if f.Status != "new" && f.Status != "processed" {
+		f.Status = ""
+	}
+
+	sortable := false
+	for _, col := range reservationSortableColumns {
+		if col == f.SortBy {
+			sortable = true
+		}
+	}
+	if !sortable {
+		f.SortBy = "start_date"
+	}
+
+	return f
+}
+
+// cloneValues returns a copy of v that can be changed without touching v.
+func cloneValues(v url.Values) url.Values {
+	c := make(url.Values, len(v))
+	for k, vals := range v {
+		c[k] = append([]string(nil), vals...)
+	}
+	return c
+}
+
+// AdminNewReservation shows the form staff use to book a room for phone and walk-in guests.
+func (m *Repository) AdminNewReservation(w http.ResponseWriter, r *http.Request) {
+	m.renderAdminNewReservation(w, r, forms.New(nil), models.Reservation{Source: models.SourcePhone, Guests: 1})
+}
+
+// AdminPostNewReservation books a room entered by staff. Unlike PostReservation it records the booking
+// source, a note and the initial status, and only emails the guest when asked to.
+func (m *Repository) AdminPostNewReservation(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	form.Required("first_name", "last_name", "email", "room_id", "start_date", "end_date")
+	form.IsEmail("email")
+
+	res := models.Reservation{
+		FirstName: r.Form.Get("first_name"),
+		LastName:  r.Form.Get("last_name"),
+		Email:     r.Form.Get("email"),
+		Phone:     r.Form.Get("phone"),
+		Source:    r.Form.Get("source"),
+		Note:      strings.TrimSpace(r.Form.Get("note")),
+		Guests:    1,
+		Currency:  m.App.Currency,
+	}
+	if form.Get("guests") != "" {
+		res.Guests = parseGuests(form)
+	}
+
+	layout := "2006-01-02"
+	if form.Has("start_date") {
+		res.StartDate, err = time.Parse(layout, r.Form.Get("start_date"))
+		if err != nil {
+			form.Errors.Add("start_date", "Invalid date")
+		}
+	}
+	if form.Has("end_date") {
+		res.EndDate, err = time.Parse(layout, r.Form.Get("end_date"))
+		if err != nil {
+			form.Errors.Add("end_date", "Invalid date")
+		}
+	}
+	if !res.StartDate.IsZero() && !res.EndDate.IsZero() && !res.EndDate.After(res.StartDate) {
+		form.Errors.Add("end_date", "Departure must be after arrival")
+	}
+
+	if form.Has("room_id") {
+		res.RoomID, err = strconv.Atoi(r.Form.Get("room_id"))
+		if err == nil {
+			res.Room, err = m.DB.GetRoomByID(r.Context(), res.RoomID)
+			res.CancellationPolicy = res.Room.CancellationPolicy
+		}
+		if err != nil {
+			form.Errors.Add("room_id", "Choose a room")
+		}
+	}
+
+	validSource := false
+	for _, source := range models.StaffSources {
+		if res.Source == source {
+			validSource = true
+		}
+	}
+	if !validSource {
+		form.Errors.Add("source", "Choose how the booking came in")
+	}
+
+	switch r.Form.Get("status") {
+	case "new":
+	case "processed":
+		res.Processed = 1
+	default:
+		form.Errors.Add("status", "Choose a status")
+	}
+
+	if !form.Valid() {
+		m.renderAdminNewReservation(w, r, form, res)
+		return
+	}
+
+	quote, err := m.quoteReservation(r.Context(), res)
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+	res.Amount = quote.Accommodation
+	res.Charges = quote.Charges
+
+	res.ID, err = m.DB.CreateReservation(r.Context(), res)
+	if errors.Is(err, repository.ErrRoomUnavailable) {
+		form.Errors.Add("room_id", "The room is not available for these dates")
+		m.renderAdminNewReservation(w, r, form, res)
+		return
+	}
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+	m.countReservations("admin", 1)
+
+	if r.Form.Get("notify_guest") == "1" {
+		m.sendGuestConfirmation(r, res)
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "Reservation created")
+	http.Redirect(w, r, fmt.Sprintf("/admin/reservations/all/%d", res.ID), http.StatusSeeOther)
+}
+
+func (m *Repository) renderAdminNewReservation(w http.ResponseWriter, r *http.Request, form *forms.Form, res models.Reservation) {
+	rooms, err := m.DB.AllRooms(r.Context())
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["reservation"] = res
+	data["rooms"] = rooms
+
+	if res.GuestID != 0 {
+		guest, err := m.DB.GetGuestByID(r.Context(), res.GuestID)
+		if err != nil {
+			helpers.ServerError(w, r, err)
+			return
+		}
+		data["guest"] = guest
+	}
+	data["sources"] = models.StaffSources
+
+	stringMap := make(map[string]string)
+	if !res.StartDate.IsZero() {
+		stringMap["start_date"] = res.StartDate.Format("2006-01-02")
+	}
+	if !res.EndDate.IsZero() {
+		stringMap["end_date"] = res.EndDate.Format("2006-01-02")
+	}
+
+	render.Template(w, r, "admin-new-reservation.page.tmpl", &models.TemplateData{
+		Form:      form,
+		StringMap: stringMap,
+		Data:      data,
+	})
+}
+
+// AdminGuests lists the guests matching the search query q.
+func (m *Repository) AdminGuests(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query().Get("q")
+
+	guests, err := m.DB.SearchGuests(r.Context(), q)
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["guests"] = guests
+
+	stringMap := make(map[string]string)
+	stringMap["q"] = q
+
+	render.Template(w, r, "admin-guests.page.tmpl", &models.TemplateData{
+		StringMap: stringMap,
+		Data:      data,
+	})
+}
+
+// AdminShowGuest shows a guest with all their stays and possible duplicates to merge.
+func (m *Repository) AdminShowGuest(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ClientError(w, r, http.StatusBadRequest)
+		return
+	}
+
+	guest, err := m.DB.GetGuestByID(r.Context(), id)
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	stays, err := m.DB.GetReservationsForGuest(r.Context(), id)
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	duplicates, err := m.DB.GetPossibleDuplicateGuests(r.Context(), guest.Guest)
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["guest"] = guest
+	data["stays"] = stays
+	data["duplicates"] = duplicates
+
+	stringMap := make(map[string]string)
+	stringMap["tags"] = strings.Join(guest.Tags, ", ")
+
+	render.Template(w, r, "admin-guest.page.tmpl", &models.TemplateData{
+		StringMap: stringMap,
+		Data:      data,
+	})
+}
+
+// AdminPostGuest saves the contact details, notes and tags of a guest.
+func (m *Repository) AdminPostGuest(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ClientError(w, r, http.StatusBadRequest)
+		return
+	}
+
+	err = r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	guest, err := m.DB.GetGuestByID(r.Context(), id)
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	g := guest.Guest
+	g.FirstName = r.Form.Get("first_name")
+	g.LastName = r.Form.Get("last_name")
+	g.Email = r.Form.Get("email")
+	g.Phone = r.Form.Get("phone")
+	g.Notes = strings.TrimSpace(r.Form.Get("notes"))
+	g.Tags = parseTags(r.Form.Get("tags"))
+
+	form := forms.New(r.PostForm)
+	form.Required("email")
+	form.IsEmail("email")
+	if !form.Valid() {
+		m.App.Session.Put(r.Context(), "error", "Invalid email address")
+		http.Redirect(w, r, fmt.Sprintf("/admin/guests/%d", id), http.StatusSeeOther)
+		return
+	}
+
+	err = m.DB.UpdateGuest(r.Context(), g)
+	if errors.Is(err, repository.ErrGuestEmailTaken) {
+		m.App.Session.Put(r.Context(), "error", "Another guest has that email address, merge the two guests instead")
+		http.Redirect(w, r, fmt.Sprintf("/admin/guests/%d", id), http.StatusSeeOther)
+		return
+	} else if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "Changes saved")
+	http.Redirect(w, r, fmt.Sprintf("/admin/guests/%d", id), http.StatusSeeOther)
+}
+
+// AdminMergeGuest merges the guest posted as merge_id into the guest in the URL.
+func (m *Repository) AdminMergeGuest(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ClientError(w, r, http.StatusBadRequest)
+		return
+	}
+
+	err = r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	mergeID, err := strconv.Atoi(r.Form.Get("merge_id"))
+	if err != nil || mergeID == id {
+		m.App.Session.Put(r.Context(), "error", "Choose another guest to merge")
+		http.Redirect(w, r, fmt.Sprintf("/admin/guests/%d", id), http.StatusSeeOther)
+		return
+	}
+
+	err = m.DB.MergeGuests(r.Context(), id, mergeID)
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", fmt.Sprintf("Guest %d merged into this guest", mergeID))
+	http.Redirect(w, r, fmt.Sprintf("/admin/guests/%d", id), http.StatusSeeOther)
+}
+
+// parseTags splits a comma separated list of tags, dropping blanks and duplicates.
+func parseTags(s string) []string {
+	var tags []string
+	seen := make(map[string]bool)
+	for _, t := range strings.Split(s, ",") {
+		t = strings.TrimSpace(t)
+		if t == "" || seen[strings.ToLower(t)] {
+			continue
+		}
+		seen[strings.ToLower(t)] = true
+		tags = append(tags, t)
+	}
+	return tags
+}
+
+// webhookMaxSize is the largest webhook payload accepted from the payment provider.
+const webhookMaxSize = 64 << 10
+
+// importMaxSize is the largest CSV file accepted by the admin import page.
+const importMaxSize = 10 << 20
+
+// AdminImport shows the CSV import page.
+func (m *Repository) AdminImport(w http.ResponseWriter, r *http.Request) {
+	data := make(map[string]interface{})
+	data["fields"] = importer.Fields
+	data["mapping"] = importer.DefaultMapping()
+
+	render.Template(w, r, "admin-import.page.tmpl", &models.TemplateData{
+		Data: data,
+	})
+}
+
+// AdminPostImport validates an uploaded CSV file and, unless it is a dry run, imports all valid rows.
+func (m *Repository) AdminPostImport(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseMultipartForm(importMaxSize)
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "can't read the uploaded file")
+		http.Redirect(w, r, "/admin/import", http.StatusSeeOther)
+		return
+	}
+
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "choose a CSV file to import")
+		http.Redirect(w, r, "/admin/import", http.StatusSeeOther)
+		return
+	}
+	defer file.Close()
+
+	mapping := importer.DefaultMapping()
+	for _, field := range importer.Fields {
+		if column := strings.TrimSpace(r.Form.Get("map_" + field)); column != "" {
+			mapping[field] = column
+		}
+	}
+	dryRun := r.Form.Get("dry_run") == "1"
+
+	report, err := importer.Validate(r.Context(), file, mapping, m.DB)
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", err.Error())
+		http.Redirect(w, r, "/admin/import", http.StatusSeeOther)
+		return
+	}
+
+	switch {
+	case dryRun:
+		m.App.Session.Put(r.Context(), "flash", fmt.Sprintf("Dry run: %d rows can be imported, %d have errors", report.Valid, report.Invalid))
+	case report.Valid == 0:
+		m.App.Session.Put(r.Context(), "warning", "No valid rows to import")
+	default:
+		// files carry no prices, so imported stays are priced at the room's current rate in our currency
+		reservations := report.Reservations()
+		for i := range reservations {
+			reservations[i].Currency = m.App.Currency
+		}
+		n, err := m.DB.ImportReservations(r.Context(), reservations)
+		if errors.Is(err, repository.ErrRoomUnavailable) {
+			m.App.Session.Put(r.Context(), "error", fmt.Sprintf("Nothing was imported: %s", err))
+			http.Redirect(w, r, "/admin/import", http.StatusSeeOther)
+			return
+		}
+		if err != nil {
+			helpers.ServerError(w, r, err)
+			return
+		}
+		m.countReservations("import", n)
+		m.App.Session.Put(r.Context(), "flash", fmt.Sprintf("Imported %d reservations, skipped %d rows with errors", n, report.Invalid))
+	}
+
+	data := make(map[string]interface{})
+	data["fields"] = importer.Fields
+	data["mapping"] = mapping
+	data["report"] = report
+
+	strMap := make(map[string]string)
+	if dryRun {
+		strMap["dry_run"] = "1"
+	}
+
+	render.Template(w, r, "admin-import.page.tmpl", &models.TemplateData{
+		StringMap: strMap,
+		Data:      data,
+	})
+}
+
+func (m *Repository) AdminShowReservation(w http.ResponseWriter, r *http.Request) {
+	spltd := strings.Split(r.RequestURI, "/")
+	id, err := strconv.Atoi(spltd[4])
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+	src := spltd[3]
+
+	strMap := make(map[string]string)
+	strMap["src"] = src
+
+	res, err := m.DB.GetReservationByID(r.Context(), id)
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+
+	}
+
+	rooms, err := m.DB.AllRooms(r.Context())
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["reservation"] = res
+	data["rooms"] = rooms
+
+	if res.GuestID != 0 {
+		guest, err := m.DB.GetGuestByID(r.Context(), res.GuestID)
+		if err != nil {
+			helpers.ServerError(w, r, err)
+			return
+		}
+		data["guest"] = guest
+	}
+
+	notes, err := m.DB.GetReservationNotes(r.Context(), id)
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+	data["notes"] = notes
+
+	// what cancelling now would refund under the policy the guest booked with
+	quote, _, paymentRecords, err := m.QuoteCancellation(r.Context(), res, time.Now())
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+	data["payments"] = paymentRecords
+	data["policy"] = ReservationPolicy(res)
+	data["cancellation"] = quote
+
+	render.Template(w, r, "admin-reservations-show.page.tmpl", &models.TemplateData{
+		StringMap: strMap,
+		Data:      data})
+}
+func (m *Repository) AdminPostShowReservation(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+	spltd := strings.Split(r.RequestURI, "/")
+	id, err := strconv.Atoi(spltd[4])
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+	src := spltd[3]
+
+	strMap := make(map[string]string)
+	strMap["src"] = src
+
+	res, err := m.DB.GetReservationByID(r.Context(), id)
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	old := res
+	showURL := fmt.Sprintf("/admin/reservations/%s/%d", src, id)
+
+	res.FirstName = r.Form.Get("first_name")
+	res.LastName = r.Form.Get("last_name")
+	res.Email = r.Form.Get("email")
+	res.Phone = r.Form.Get("phone")
+
+	// room and dates are only changed when the form sends them
+	if r.Form.Get("room_id") != "" {
+		res.RoomID, err = strconv.Atoi(r.Form.Get("room_id"))
+		if err != nil {
+			m.App.Session.Put(r.Context(), "error", "invalid room")
+			http.Redirect(w, r, showURL, http.StatusSeeOther)
+			return
+		}
+	}
+
+	layout := "2006-01-02"
+	if r.Form.Get("start_date") != "" {
+		res.StartDate, err = time.Parse(layout, r.Form.Get("start_date"))
+		if err != nil {
+			m.App.Session.Put(r.Context(), "error", "invalid arrival date")
+			http.Redirect(w, r, showURL, http.StatusSeeOther)
+			return
+		}
+	}
+	if r.Form.Get("end_date") != "" {
+		res.EndDate, err = time.Parse(layout, r.Form.Get("end_date"))
+		if err != nil {
+			m.App.Session.Put(r.Context(), "error", "invalid departure date")
+			http.Redirect(w, r, showURL, http.StatusSeeOther)
+			return
+		}
+	}
+
+	if r.Form.Get("guests") != "" {
+		res.Guests, err = strconv.Atoi(r.Form.Get("guests"))
+		if err != nil || res.Guests < 1 || res.Guests > maxGuests {
+			m.App.Session.Put(r.Context(), "error", fmt.Sprintf("enter between 1 and %d guests", maxGuests))
+			http.Redirect(w, r, showURL, http.StatusSeeOther)
+			return
+		}
+	}
+
+	moved := res.RoomID != old.RoomID || !res.StartDate.Equal(old.StartDate) || !res.EndDate.Equal(old.EndDate)
+	if moved && !res.EndDate.After(res.StartDate) {
+		m.App.Session.Put(r.Context(), "error", "departure must be after arrival")
+		http.Redirect(w, r, showURL, http.StatusSeeOther)
+		return
+	}
+
+	// the price, taxes and fees agreed when booking are kept unless the stay changes
+	if moved || res.Guests != old.Guests {
+		res.Room, err = m.DB.GetRoomByID(r.Context(), res.RoomID)
+		if err != nil {
+			m.App.Session.Put(r.Context(), "error", "invalid room")
+			http.Redirect(w, r, showURL, http.StatusSeeOther)
+			return
+		}
+		if moved {
+			res.Amount = res.Room.NightlyRate * res.Nights()
+			res.Discount = m.redeemedDiscount(r, res, old.Discount)
+		}
+		quote, err := m.quoteReservation(r.Context(), res)
+		if err != nil {
+			helpers.ServerError(w, r, err)
+			return
+		}
+		res.Charges = quote.Charges
+	}
+
+	err = m.DB.UpdateReservation(r.Context(), res)
+	if errors.Is(err, repository.ErrRoomUnavailable) {
+		m.App.Session.Put(r.Context(), "error", "The room is not available for these dates")
+		http.Redirect(w, r, showURL, http.StatusSeeOther)
+		return
+	}
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	if moved {
+		// the old room and dates may be what somebody on the waitlist is waiting for
+		m.ReleaseDates(r.Context(), siteURL(r), old.RoomID, old.StartDate, old.EndDate)
+
+		if r.Form.Get("notify_guest") == "1" {
+			m.sendReservationChangedMail(r, res)
+		}
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "Changes saved")
+	http.Redirect(w, r, fmt.Sprintf("/admin/reservations-%s", src), http.StatusSeeOther)
+
+}
+
+// sendReservationChangedMail tells the guest about their new room or dates.
+func (m *Repository) sendReservationChangedMail(r *http.Request, res models.Reservation) {
+	room, err := m.DB.GetRoomByID(r.Context(), res.RoomID)
+	if err != nil {
+		helpers.Logger(r).Error("can't email changed reservation", "reservation_id", res.ID, "error", err)
+		return
+	}
+
+	htmlMessage := fmt.Sprintf(`
+	<strong>Your reservation has changed</strong><br>
+	%s, your reservation is now for the %s from %s to %s.
+	`, res.FirstName, room.RoomName, res.StartDate.Format("2006-01-02"), res.EndDate.Format("2006-01-02"))
+	m.App.MailChan <- models.MailData{
+		To:       res.Email,
+		From:     m.App.SMTP.From,
+		Subject:  "Your reservation has changed",
+		Content:  htmlMessage,
+		Template: "basic.html",
+	}
+}
+
+func (m *Repository) AdminProcessReservation(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(chi.URLParam(r, "id"))
+	src := chi.URLParam(r, "src")
+
+	_ = m.DB.UpdateProcessedForReservation(r.Context(), id, 1)
+
+	m.App.Session.Put(r.Context(), "flash", "Reservation marked as processed")
+	http.Redirect(w, r, fmt.Sprintf("/admin/reservations-%s", src), http.StatusSeeOther)
+}
+
+func (m *Repository) AdminDeleteReservation(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(chi.URLParam(r, "id"))
+	src := chi.URLParam(r, "src")
+
+	res, err := m.DB.GetReservationByID(r.Context(), id)
+	if err == nil {
+		_, err = m.ApplyCancellation(r.Context(), siteURL(r), res, "staff", true)
+		if err != nil {
+			helpers.Logger(r).Error("can't cancel reservation", "reservation_id", res.ID, "error", err)
+			m.App.Session.Put(r.Context(), "error", "The deposit could not be refunded, the reservation was not cancelled")
+			http.Redirect(w, r, fmt.Sprintf("/admin/reservations/%s/%d", src, id), http.StatusSeeOther)
+			return
+		}
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "Reservation deleted")
+	http.Redirect(w, r, fmt.Sprintf("/admin/reservations-%s", src), http.StatusSeeOther)
+}
+
+// AdminPostReservationNote adds a note, or a reply to a note, to a reservation. The logged in user is
+// stored as its author.
+func (m *Repository) AdminPostReservationNote(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ClientError(w, r, http.StatusBadRequest)
+		return
+	}
+	src := chi.URLParam(r, "src")
+	showURL := fmt.Sprintf("/admin/reservations/%s/%d#notes", src, id)
+
+	err = r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	form.Required("body")
+	form.MaxLength("body", noteMaxLength)
+	if !form.Valid() {
+		m.App.Session.Put(r.Context(), "error", "A note must have between 1 and "+strconv.Itoa(noteMaxLength)+" characters")
+		http.Redirect(w, r, showURL, http.StatusSeeOther)
+		return
+	}
+
+	parentID, _ := strconv.Atoi(r.Form.Get("parent_id"))
+
+	note := models.ReservationNote{
+		ReservationID: id,
+		ParentID:      parentID,
+		UserID:        m.App.Session.GetInt(r.Context(), "user_id"),
+		Body:          strings.TrimSpace(r.Form.Get("body")),
+		Pinned:        r.Form.Get("pinned") == "1",
+	}
+
+	_, err = m.DB.InsertReservationNote(r.Context(), note)
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "Note added")
+	http.Redirect(w, r, showURL, http.StatusSeeOther)
+}
+
+// AdminReservationInvoice downloads the invoice of a reservation as a PDF, or shows it when format is html.
+func (m *Repository) AdminReservationInvoice(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ClientError(w, r, http.StatusBadRequest)
+		return
+	}
+
+	res, err := m.DB.GetReservationByID(r.Context(), id)
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	m.writeInvoice(w, r, res, r.URL.Query().Get("format"))
+}
+
+// AdminSendInvoice emails the guest their receipt, with the invoice of the reservation attached, when they
+// check out.
+func (m *Repository) AdminSendInvoice(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ClientError(w, r, http.StatusBadRequest)
+		return
+	}
+	src := chi.URLParam(r, "src")
+
+	res, err := m.DB.GetReservationByID(r.Context(), id)
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	attachment, err := m.invoiceAttachment(r.Context(), res)
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	htmlMessage := fmt.Sprintf(`
+	<strong>Thank you for staying with us</strong><br>
+	%s, your receipt for your stay from %s to %s is attached.
+	`, html.EscapeString(res.FirstName), res.StartDate.Format("2006-01-02"), res.EndDate.Format("2006-01-02"))
+	m.App.MailChan <- models.MailData{
+		To:          res.Email,
+		From:        m.App.SMTP.From,
+		Subject:     "Your receipt",
+		Content:     htmlMessage,
+		Template:    "basic.html",
+		Attachments: []models.MailAttachment{attachment},
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "Receipt sent to "+res.Email)
+	http.Redirect(w, r, fmt.Sprintf("/admin/reservations/%s/%d", src, id), http.StatusSeeOther)
+}
+
+// AdminPinReservationNote pins a note to the top of the notes of a reservation, or unpins it when pinned is
+// not 1.
+func (m *Repository) AdminPinReservationNote(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ClientError(w, r, http.StatusBadRequest)
+		return
+	}
+	noteID, err := strconv.Atoi(chi.URLParam(r, "noteID"))
+	if err != nil {
+		helpers.ClientError(w, r, http.StatusBadRequest)
+		return
+	}
+	src := chi.URLParam(r, "src")
+
+	err = r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	err = m.DB.SetReservationNotePinned(r.Context(), noteID, r.Form.Get("pinned") == "1")
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	http.Redirect(w, r, fmt.Sprintf("/admin/reservations/%s/%d#notes", src, id), http.StatusSeeOther)
+}
+
+// ReservationPolicy is the cancellation policy a reservation was booked under.
+func ReservationPolicy(res models.Reservation) cancellation.Policy {
+	p, err := cancellation.Parse(res.CancellationPolicy)
+	if err != nil {
+		return cancellation.Flexible
+	}
+	return p
+}
+
+// QuoteCancellation evaluates the cancellation policy of a reservation cancelled at now against the deposits
+// paid for it. It also returns the amount refunded already and the payment records.
+func (m *Repository) QuoteCancellation(ctx context.Context, res models.Reservation, now time.Time) (cancellation.Result, int, []models.Payment, error) {
+	records, err := m.DB.GetPaymentsForReservation(ctx, res.ID)
+	if err != nil {
+		return cancellation.Result{}, 0, nil, err
+	}
+
+	paid, refunded := 0, 0
+	for _, p := range records {
+		switch {
+		case p.Kind == models.PaymentDeposit && p.Status == payments.StatusSucceeded:
+			paid += p.Amount
+		case p.Kind == models.PaymentRefund && p.Status != payments.StatusFailed:
+			refunded += p.Amount
+		}
+	}
+
+	return cancellation.Evaluate(ReservationPolicy(res), res.StartDate, now, time.Local, paid), refunded, records, nil
+}
+
+// ApplyCancellation refunds what the cancellation policy of a reservation allows, unless refund is false, e.g.
+// when the guest was refunded some other way, deletes the reservation, records the cancellation and offers the
+// freed nights to the waitlist with links to siteURL. by is "guest" or "staff". The site and the reservation
+// cancel command both cancel through it.
+func (m *Repository) ApplyCancellation(ctx context.Context, siteURL string, res models.Reservation, by string, refund bool) (cancellation.Result, error) {
+	result, refunded, records, err := m.QuoteCancellation(ctx, res, time.Now())
+	if err != nil {
+		return result, err
+	}
+
+	// from the refund on, the cancellation is finished even if the client goes away
+	ctx = context.WithoutCancel(ctx)
+
+	if refund {
+		err = m.refundReservation(ctx, res, records, result.Refund-refunded)
+		if err != nil {
+			return result, err
+		}
+	}
+
+	err = m.DB.CancelReservation(ctx, models.Cancellation{
+		ReservationID: res.ID,
+		Policy:        result.Policy,
+		DaysBefore:    result.DaysBefore,
+		RefundPercent: result.RefundPercent,
+		Paid:          result.Paid,
+		Refund:        result.Refund,
+		Fee:           result.Fee,
+		CancelledBy:   by,
+	})
+	if err != nil {
+		return result, err
+	}
+	m.App.Metrics.Counter("bookings_cancellations_total", "Reservations cancelled, by who cancelled them.", "by").Inc(by)
+
+	m.ReleaseDates(ctx, siteURL, res.RoomID, res.StartDate, res.EndDate)
+	return result, nil
+}
+
+// refundReservation refunds due cents of the deposits in records of a cancelled reservation, and records the
+// refunds.
+func (m *Repository) refundReservation(ctx context.Context, res models.Reservation, records []models.Payment, due int) error {
+	if m.App.Payments == nil {
+		return nil
+	}
+
+	for _, p := range records {
+		if due <= 0 {
+			break
+		}
+		if p.Kind != models.PaymentDeposit || p.Status != payments.StatusSucceeded || p.Provider != m.App.Payments.Name() {
+			continue
+		}
+
+		amount := p.Amount
+		if amount > due {
+			amount = due
+		}
+		refund, err := m.App.Payments.Refund(ctx, p.ProviderRef, amount)
+		if errors.Is(err, payments.ErrRefundTooLarge) {
+			// this deposit was refunded outside the site already
+			continue
+		} else if err != nil {
+			return err
+		}
+
+		_, err = m.DB.InsertPayment(ctx, models.Payment{
+			ReservationID: res.ID,
+			Provider:      m.App.Payments.Name(),
+			ProviderRef:   refund.ID,
+			Kind:          models.PaymentRefund,
+			Amount:        refund.Amount,
+			Currency:      p.Currency,
+			Status:        refund.Status,
+		})
+		if err != nil {
+			logging.FromContext(ctx, m.App.Logger).Error("can't record refund", "refund", refund.ID, "reservation_id", res.ID, "error", err)
+		}
+		due -= refund.Amount
+	}
+
+	return nil
+}
+
+func (m *Repository) AdminReservationsCalendar(w http.ResponseWriter, r *http.Request) {
+	now := time.Now()
+
+	if r.URL.Query().Get("y") != "" {
+		year, _ := strconv.Atoi(r.URL.Query().Get("y"))
+		mounth, _ := strconv.Atoi(r.URL.Query().Get("m"))
+		now = time.Date(year, time.Month(mounth), 1, 0, 0, 0, 0, time.UTC)
+	}
+	data := make(map[string]interface{})
+	data["now"] = now
+	next := now.AddDate(0, 1, 0)
+	last := now.AddDate(0, -1, 0)
+
+	nextMounth := next.Format("01")
+	nextMounthYear := next.Format("2006")
+
+	lastMonth := last.Format("01")
+	lastMonthYear := last.Format("2006")
+
+	stringMap := make(map[string]string)
+	stringMap["next_mounth"] = nextMounth
+	stringMap["next_mounth_year"] = nextMounthYear
+	stringMap["last_mounth"] = lastMonth
+	stringMap["last_mounth_year"] = lastMonthYear
+
+	stringMap["this_mounth"] = now.Format("01")
+	stringMap["this_mounth_year"] = now.Format("2006")
+
+	currentYear, currentMounth, _ := now.Date()
+
+	currentLocation := now.Location()
+	firstOfMouth := time.Date(currentYear, currentMounth, 1, 0, 0, 0, 0, currentLocation)
+
+	lastOfTheMouth := firstOfMouth.AddDate(0, 1, -1)
+
+	intMap := make(map[string]int)
+	intMap["days_in_mounth"] = lastOfTheMouth.Day()
+
+	rooms, err := m.DB.AllRooms(r.Context())
+
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	data["rooms"] = rooms
+
+	for _, x := range rooms {
+		reservationMap := make(map[string]int)
+		blockMap := make(map[string]int)
+
+		for d := firstOfMouth; d.After(lastOfTheMouth) == false; d = d.AddDate(0, 0, 1) {
+			reservationMap[d.Format("2006-01-2")] = 0
+			blockMap[d.Format("2006-01-2")] = 0
+		}
+
+		restrictions, err := m.DB.GetRestrictionsForRoomByDate(r.Context(), x.ID, firstOfMouth, lastOfTheMouth)
+		if err != nil {
+			helpers.ServerError(w, r, err)
+			return
+		}
+
+		for _, y := range restrictions {
+			if y.ReservationID > 0 {
+				for d := y.StartDate; d.After(y.EndDate) == false; d = d.AddDate(0, 0, 1) {
+					reservationMap[d.Format("2006-01-2")] = y.ReservationID
+				}
+			} else {
+				blockMap[y.StartDate.Format("2006-01-2")] = y.RestrictionID
+
+			}
+
+			data[fmt.Sprintf("reservation_map_%d", x.ID)] = reservationMap
+			data[fmt.Sprintf("block_map_%d", x.ID)] = blockMap
+			m.App.Session.Put(r.Context(), fmt.Sprintf("block_map_%d", x.ID), blockMap)
+		}
+	}
+
+	render.Template(w, r, "admin-reservations-calendar.page.tmpl", &models.TemplateData{StringMap: stringMap,
+		Data: data})
+}
+
+// Waitlist renders the waitlist form, pre-filled with the dates the guest searched for.
+func (m *Repository) Waitlist(w http.ResponseWriter, r *http.Request) {
+	rooms, err := m.DB.AllRooms(r.Context())
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["rooms"] = rooms
+	data["entry"] = models.WaitlistEntry{}
+
+	stringMap := make(map[string]string)
+	stringMap["start_date"] = r.URL.Query().Get("s")
+	stringMap["end_date"] = r.URL.Query().Get("e")
+
+	render.Template(w, r, "waitlist.page.tmpl", &models.TemplateData{
+		Form:      forms.New(nil),
+		Data:      data,
+		StringMap: stringMap,
+	})
+}
 
-	for _, x := range rooms {
-		reservationMap := make(map[string]int)
-		blockMap := make(map[string]int)
+// PostWaitlist puts the guest on the waitlist for the submitted dates and room preference.
+func (m *Repository) PostWaitlist(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "can't parse form!")
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
 
-		for d := firstOfMouth; d.After(lastOfTheMouth) == false; d = d.AddDate(0, 0, 1) {
-			reservationMap[d.Format("2006-01-2")] = 0
-			blockMap[d.Format("2006-01-2")] = 0
-		}
+	form := forms.New(r.PostForm)
+	form.Required("first_name", "email", "start_date", "end_date")
+	form.IsEmail("email")
+
+	layout := "2006-01-02"
+	startDate, err := time.Parse(layout, r.Form.Get("start_date"))
+	if err != nil {
+		form.Errors.Add("start_date", "Invalid arrival date")
+	}
+	endDate, err := time.Parse(layout, r.Form.Get("end_date"))
+	if err != nil {
+		form.Errors.Add("end_date", "Invalid departure date")
+	} else if !endDate.After(startDate) {
+		form.Errors.Add("end_date", "Departure must be after arrival")
+	}
+
+	// 0 means the guest is happy with any room
+	roomID, _ := strconv.Atoi(r.Form.Get("room_id"))
+
+	entry := models.WaitlistEntry{
+		FirstName: r.Form.Get("first_name"),
+		Email:     r.Form.Get("email"),
+		RoomID:    roomID,
+		StartDate: startDate,
+		EndDate:   endDate,
+	}
 
-		restrictions, err := m.DB.GetRestrictionsForRoomByDate(x.ID, firstOfMouth, lastOfTheMouth)
+	if !form.Valid() {
+		rooms, err := m.DB.AllRooms(r.Context())
 		if err != nil {
-			helpers.ServerError(w, err)
+			helpers.ServerError(w, r, err)
 			return
 		}
 
-		for _, y := range restrictions {
-			if y.ReservationID > 0 {
-				for d := y.StartDate; d.After(y.EndDate) == false; d = d.AddDate(0, 0, 1) {
-					reservationMap[d.Format("2006-01-2")] = y.ReservationID
-				}
-			} else {
-				blockMap[y.StartDate.Format("2006-01-2")] = y.RestrictionID
+		data := make(map[string]interface{})
+		data["rooms"] = rooms
+		data["entry"] = entry
+
+		stringMap := make(map[string]string)
+		stringMap["start_date"] = r.Form.Get("start_date")
+		stringMap["end_date"] = r.Form.Get("end_date")
+
+		render.Template(w, r, "waitlist.page.tmpl", &models.TemplateData{
+			Form:      form,
+			Data:      data,
+			StringMap: stringMap,
+		})
+		return
+	}
+
+	_, err = m.DB.InsertWaitlistEntry(r.Context(), entry)
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "can't add you to the waitlist!")
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "You are on the waitlist. We'll email you if a room frees up")
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+// WaitlistBook takes the booking link from a waitlist email, holds the room and takes the guest to the
+// reservation screen the same way BookRoom does. Guests happy with any room get the room that was freed for
+// them, or when it has been taken again, the first other room free on their dates.
+func (m *Repository) WaitlistBook(w http.ResponseWriter, r *http.Request) {
+	entry, err := m.DB.GetWaitlistEntryByToken(r.Context(), chi.URLParam(r, "token"))
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "This booking link is invalid or has expired")
+		http.Redirect(w, r, "/search-availability", http.StatusSeeOther)
+		return
+	}
 
+	candidates := []int{entry.RoomID}
+	if entry.RoomID == 0 {
+		candidates = nil
+		if entry.OfferedRoomID > 0 {
+			candidates = append(candidates, entry.OfferedRoomID)
+		}
+		rooms, err := m.DB.SearchAvailabilityForAllRooms(r.Context(), entry.StartDate, entry.EndDate)
+		if err != nil {
+			helpers.ServerError(w, r, err)
+			return
+		}
+		for _, room := range rooms {
+			if room.ID != entry.OfferedRoomID {
+				candidates = append(candidates, room.ID)
 			}
+		}
+	}
 
-			data[fmt.Sprintf("reservation_map_%d", x.ID)] = reservationMap
-			data[fmt.Sprintf("block_map_%d", x.ID)] = blockMap
-			m.App.Session.Put(r.Context(), fmt.Sprintf("block_map_%d", x.ID), blockMap)
+	var res models.Reservation
+	res.FirstName = entry.FirstName
+	res.Email = entry.Email
+	res.StartDate = entry.StartDate
+	res.EndDate = entry.EndDate
+
+	// the hold is what tells whether a room is still free
+	for _, roomID := range candidates {
+		res.RoomID = roomID
+		err = m.placeHold(r, res)
+		if errors.Is(err, repository.ErrRoomUnavailable) {
+			continue
+		} else if err != nil {
+			helpers.ServerError(w, r, err)
+			return
+		}
+
+		room, err := m.DB.GetRoomByID(r.Context(), roomID)
+		if err != nil {
+			helpers.ServerError(w, r, err)
+			return
 		}
+		res.Room.RoomName = room.RoomName
+
+		m.App.Session.Put(r.Context(), "reservation", res)
+		http.Redirect(w, r, "/make-reservation", http.StatusSeeOther)
+		return
 	}
 
-	render.Template(w, r, "admin-reservations-calendar.page.tmpl", &models.TemplateData{StringMap: stringMap,
-		Data: data})
+	m.App.Session.Put(r.Context(), "error", "Sorry, the room has been taken again")
+	http.Redirect(w, r, "/search-availability", http.StatusSeeOther)
+}
+
+// ReleaseDates is called whenever the nights of a room from start to end are freed, by a cancelled or moved
+// reservation or a removed owner block, from the site or a command. It emails the earliest waitlisted guests
+// whose dates are free again a booking link to siteURL. Failures are logged and never stop the action that
+// freed the nights.
+func (m *Repository) ReleaseDates(ctx context.Context, siteURL string, roomID int, start, end time.Time) {
+	if !m.App.Features.Waitlist {
+		return
+	}
+	logger := logging.FromContext(ctx, m.App.Logger)
+
+	entries, err := m.DB.GetWaitlistEntriesForDates(ctx, roomID, start, end)
+	if err != nil {
+		logger.Error("can't get waitlist", "room_id", roomID, "error", err)
+		return
+	}
+
+	notified := 0
+	for _, entry := range entries {
+		if notified >= waitlistNotifyLimit {
+			break
+		}
+
+		available, err := m.DB.SearchAvailabilityByDatesByRoomID(ctx, entry.StartDate, entry.EndDate, roomID)
+		if err != nil {
+			logger.Error("can't check availability for waitlist", "waitlist_id", entry.ID, "error", err)
+			continue
+		}
+		if !available {
+			continue
+		}
+
+		token, err := helpers.RandomToken(32)
+		if err != nil {
+			logger.Error("can't make waitlist token", "error", err)
+			return
+		}
+
+		err = m.DB.UpdateWaitlistToken(ctx, entry.ID, roomID, token, time.Now().Add(waitlistLinkLifetime))
+		if err != nil {
+			logger.Error("can't save waitlist token", "waitlist_id", entry.ID, "error", err)
+			continue
+		}
+
+		htmlMessage := fmt.Sprintf(`
+	<strong>A room is available</strong><br>
+	%s, a room has become available from %s to %s.<br>
+	<a href="%s/waitlist/book/%s">Book it now</a>. This link is valid for %d hours.
+	`, entry.FirstName, entry.StartDate.Format("2006-01-02"), entry.EndDate.Format("2006-01-02"),
+			siteURL, token, int(waitlistLinkLifetime.Hours()))
+		m.App.MailChan <- models.MailData{
+			To:       entry.Email,
+			From:     m.App.SMTP.From,
+			Subject:  "A room is available",
+			Content:  htmlMessage,
+			Template: "basic.html",
+		}
+		notified++
+	}
+}
+
+// AdminTaxes lists the tax and fee rules with the form to add one.
+func (m *Repository) AdminTaxes(w http.ResponseWriter, r *http.Request) {
+	m.renderAdminTaxes(w, r, forms.New(nil))
+}
+
+// AdminPostTax adds a tax or fee rule. Percentages are entered as e.g. 7.5 and amounts as e.g. 2.50.
+func (m *Repository) AdminPostTax(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	form.Required("name", "kind", "method", "basis", "amount")
+	form.MaxLength("name", 255)
+
+	rule := models.TaxRule{
+		Name:     strings.TrimSpace(r.Form.Get("name")),
+		Kind:     r.Form.Get("kind"),
+		Method:   r.Form.Get("method"),
+		Basis:    r.Form.Get("basis"),
+		Currency: m.App.Currency,
+	}
+
+	if form.Get("amount") != "" {
+		if rule.Method == models.TaxRulePercent {
+			rule.Amount, err = pricing.ParsePercent(r.Form.Get("amount"))
+		} else {
+			rule.Amount, err = pricing.ParseMoney(r.Form.Get("amount"))
+		}
+		if err != nil {
+			form.Errors.Add("amount", "Enter a number with at most two decimals")
+		}
+	}
+
+	layout := "2006-01-02"
+	if v := r.Form.Get("valid_from"); v != "" {
+		rule.ValidFrom, err = time.Parse(layout, v)
+		if err != nil {
+			form.Errors.Add("valid_from", "Invalid date")
+		}
+	}
+	if v := r.Form.Get("valid_until"); v != "" {
+		rule.ValidUntil, err = time.Parse(layout, v)
+		if err != nil {
+			form.Errors.Add("valid_until", "Invalid date")
+		}
+	}
+
+	if form.Valid() {
+		if err = pricing.Validate(rule); err != nil {
+			form.Errors.Add("basis", strings.TrimPrefix(err.Error(), pricing.ErrInvalidRule.Error()+": "))
+		}
+	}
+
+	if !form.Valid() {
+		m.renderAdminTaxes(w, r, form)
+		return
+	}
+
+	_, err = m.DB.InsertTaxRule(r.Context(), rule)
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "Tax rule added")
+	http.Redirect(w, r, "/admin/taxes", http.StatusSeeOther)
+}
+
+// AdminDeleteTax deletes a tax or fee rule. Reservations already charged keep their charges.
+func (m *Repository) AdminDeleteTax(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ClientError(w, r, http.StatusBadRequest)
+		return
+	}
+
+	err = m.DB.DeleteTaxRule(r.Context(), id)
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "Tax rule deleted")
+	http.Redirect(w, r, "/admin/taxes", http.StatusSeeOther)
+}
+
+func (m *Repository) renderAdminTaxes(w http.ResponseWriter, r *http.Request, form *forms.Form) {
+	rules, err := m.DB.AllTaxRules(r.Context())
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["rules"] = rules
+
+	stringMap := make(map[string]string)
+	stringMap["currency"] = strings.ToUpper(m.App.Currency)
+
+	render.Template(w, r, "admin-taxes.page.tmpl", &models.TemplateData{
+		Form:      form,
+		StringMap: stringMap,
+		Data:      data,
+	})
+}
+
+// AdminPromotions lists the promo codes with the form to add one.
+func (m *Repository) AdminPromotions(w http.ResponseWriter, r *http.Request) {
+	m.renderAdminPromotions(w, r, forms.New(nil))
+}
+
+// AdminPostPromotion adds a promo code. Percentages are entered as e.g. 15 and amounts as e.g. 25.00.
+func (m *Repository) AdminPostPromotion(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	form.Required("code", "method", "amount")
+	form.MaxLength("code", 50)
+	form.MaxLength("description", 255)
+
+	p := models.Promotion{
+		Code:        promotions.Code(r.Form.Get("code")),
+		Description: strings.TrimSpace(r.Form.Get("description")),
+		Method:      r.Form.Get("method"),
+		Currency:    m.App.Currency,
+	}
+
+	if form.Get("amount") != "" {
+		if p.Method == models.PromotionPercent {
+			p.Amount, err = pricing.ParsePercent(r.Form.Get("amount"))
+		} else {
+			p.Amount, err = pricing.ParseMoney(r.Form.Get("amount"))
+		}
+		if err != nil {
+			form.Errors.Add("amount", "Enter a number with at most two decimals")
+		}
+	}
+
+	layout := "2006-01-02"
+	if v := r.Form.Get("valid_from"); v != "" {
+		p.ValidFrom, err = time.Parse(layout, v)
+		if err != nil {
+			form.Errors.Add("valid_from", "Invalid date")
+		}
+	}
+	if v := r.Form.Get("valid_until"); v != "" {
+		p.ValidUntil, err = time.Parse(layout, v)
+		if err != nil {
+			form.Errors.Add("valid_until", "Invalid date")
+		}
+	}
+
+	for _, field := range []string{"min_nights", "max_uses", "max_uses_per_guest"} {
+		v := r.Form.Get(field)
+		if v == "" {
+			continue
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			form.Errors.Add(field, "Enter a whole number, or leave empty for no limit")
+			continue
+		}
+		switch field {
+		case "min_nights":
+			p.MinNights = n
+		case "max_uses":
+			p.MaxUses = n
+		case "max_uses_per_guest":
+			p.MaxUsesPerGuest = n
+		}
+	}
+
+	for _, v := range r.Form["room_id"] {
+		id, err := strconv.Atoi(v)
+		if err != nil {
+			helpers.ClientError(w, r, http.StatusBadRequest)
+			return
+		}
+		p.RoomIDs = append(p.RoomIDs, id)
+	}
+
+	if form.Valid() {
+		if err = promotions.Validate(p); err != nil {
+			form.Errors.Add("code", strings.TrimPrefix(err.Error(), promotions.ErrInvalidPromotion.Error()+": "))
+		}
+	}
+
+	if !form.Valid() {
+		m.renderAdminPromotions(w, r, form)
+		return
+	}
+
+	_, err = m.DB.InsertPromotion(r.Context(), p)
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "Promo code "+p.Code+" added")
+	http.Redirect(w, r, "/admin/promotions", http.StatusSeeOther)
+}
+
+// AdminDeletePromotion deletes a promo code. Its redemptions stay in the report.
+func (m *Repository) AdminDeletePromotion(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ClientError(w, r, http.StatusBadRequest)
+		return
+	}
+
+	err = m.DB.DeletePromotion(r.Context(), id)
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "Promo code deleted")
+	http.Redirect(w, r, "/admin/promotions", http.StatusSeeOther)
+}
+
+// AdminPromotionRedemptions shows the report of the reservations made with promo codes, optionally for the
+// code given in the query string.
+func (m *Repository) AdminPromotionRedemptions(w http.ResponseWriter, r *http.Request) {
+	code := promotions.Code(r.URL.Query().Get("code"))
+
+	redemptions, err := m.DB.GetPromotionRedemptions(r.Context(), code)
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	// totals per currency, as fixed discounts may be in several
+	totals := make(map[string]int)
+	for _, rd := range redemptions {
+		totals[strings.ToUpper(rd.Currency)] += rd.Discount
+	}
+
+	data := make(map[string]interface{})
+	data["redemptions"] = redemptions
+	data["totals"] = totals
+
+	stringMap := make(map[string]string)
+	stringMap["code"] = code
+
+	render.Template(w, r, "admin-promotion-redemptions.page.tmpl", &models.TemplateData{
+		StringMap: stringMap,
+		Data:      data,
+	})
+}
+
+func (m *Repository) renderAdminPromotions(w http.ResponseWriter, r *http.Request, form *forms.Form) {
+	list, err := m.DB.AllPromotions(r.Context())
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	rooms, err := m.DB.AllRooms(r.Context())
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+
+	// names of the rooms by id, for the list
+	roomNames := make(map[int]string)
+	for _, room := range rooms {
+		roomNames[room.ID] = room.RoomName
+	}
+
+	// rooms ticked in the form
+	checked := make(map[string]bool)
+	for _, v := range form.Values["room_id"] {
+		checked[v] = true
+	}
+
+	data := make(map[string]interface{})
+	data["promotions"] = list
+	data["rooms"] = rooms
+	data["room_names"] = roomNames
+	data["checked"] = checked
+
+	stringMap := make(map[string]string)
+	stringMap["currency"] = strings.ToUpper(m.App.Currency)
+
+	render.Template(w, r, "admin-promotions.page.tmpl", &models.TemplateData{
+		Form:      form,
+		StringMap: stringMap,
+		Data:      data,
+	})
+}
+
+// siteURL returns the scheme and host the request was made to, for building links in emails.
+func siteURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return fmt.Sprintf("%s://%s", scheme, r.Host)
 }
@@ -1,10 +1,12 @@
 package handlers
 
 import (
+	"bytes"
 	"encoding/gob"
 	"fmt"
 	"html/template"
 	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"path/filepath"
@@ -13,7 +15,11 @@ import (
 
 	render "github.com/GitEagleY/BookingsWebApp/internal/Render"
 	"github.com/GitEagleY/BookingsWebApp/internal/config"
+	"github.com/GitEagleY/BookingsWebApp/internal/helpers"
+	"github.com/GitEagleY/BookingsWebApp/internal/logging"
 	"github.com/GitEagleY/BookingsWebApp/internal/models"
+	"github.com/GitEagleY/BookingsWebApp/internal/payments"
+	"github.com/GitEagleY/BookingsWebApp/internal/pricing"
 
 	"github.com/alexedwards/scs/v2"
 	"github.com/go-chi/chi"
@@ -26,11 +32,16 @@ var app config.AppConfig
 var session *scs.SessionManager
 var pathToTemplates = "./../../templates"
 
+// logs is what the handlers logged, reset by the tests looking at it.
+var logs bytes.Buffer
+
 var functions = template.FuncMap{
-	"humanDate":  render.HumanDate,
-	"formatDate": render.FormatDate,
-	"iterate":    render.Iterate,
-	"add":        render.Add,
+	"humanDate":     render.HumanDate,
+	"formatDate":    render.FormatDate,
+	"iterate":       render.Iterate,
+	"add":           render.Add,
+	"formatMoney":   render.FormatMoney,
+	"formatPercent": pricing.Percent,
 }
 
 func TestMain(m *testing.M) {
@@ -43,11 +54,7 @@ func TestMain(m *testing.M) {
 	// change this to true when in production
 	app.InProduction = false
 
-	infoLog := log.New(os.Stdout, "INFO\t", log.Ldate|log.Ltime)
-	app.InfoLog = infoLog
-
-	errorLog := log.New(os.Stdout, "ERROR\t", log.Ldate|log.Ltime|log.Lshortfile)
-	app.ErrorLog = errorLog
+	app.Logger = logging.New(&logs, "text", slog.LevelDebug)
 
 	session = scs.New()
 	session.Lifetime = 24 * time.Hour
@@ -57,6 +64,11 @@ func TestMain(m *testing.M) {
 
 	app.Session = session
 
+	app.Payments = payments.NewFake("test-secret")
+	app.Currency = "usd"
+	app.SMTP = config.SMTPSettings{From: "me@here.com"}
+	app.Features = config.Features{Waitlist: true, Promotions: true}
+
 	mailChan := make(chan models.MailData)
 	app.MailChan = mailChan
 	defer close(mailChan)
@@ -74,6 +86,7 @@ func TestMain(m *testing.M) {
 	repo := NewTestRepo(&app)
 	NewHandlers(repo)
 	render.NewRenderer(&app)
+	helpers.NewHelpers(&app)
 
 	os.Exit(m.Run())
 }
@@ -93,6 +106,9 @@ func getRoutes() http.Handler {
 	//mux.Use(NoSurf)
 	mux.Use(SessionLoad)
 
+	mux.Get("/setup", Repo.Setup)
+	mux.Post("/setup", Repo.PostSetup)
+
 	mux.Get("/", Repo.Home)
 	mux.Get("/about", Repo.About)
 	mux.Get("/generals-quarters", Repo.Generals)
@@ -104,25 +120,57 @@ func getRoutes() http.Handler {
 
 	mux.Get("/contact", Repo.Contact)
 
+	mux.Get("/waitlist", Repo.Waitlist)
+	mux.Post("/waitlist", Repo.PostWaitlist)
+	mux.Get("/cancel-reservation", Repo.CancelReservation)
+	mux.Post("/cancel-reservation", Repo.PostCancelReservation)
+	mux.Post("/reservation-invoice", Repo.PostReservationInvoice)
+
 	mux.Get("/make-reservation", Repo.Reservation)
 	mux.Post("/make-reservation", Repo.PostReservation)
+	mux.Get("/reservation-deposit", Repo.Deposit)
+	mux.Post("/reservation-deposit", Repo.PostDeposit)
 	mux.Get("/reservation-summary", Repo.ReservationSummary)
 
+	mux.Post("/payments/webhook", Repo.PaymentWebhook)
+
 	mux.Get("/user/login", Repo.ShowLogin)
 	mux.Post("/user/login", Repo.PostShowLogin)
 	mux.Get("/user/logout", Repo.Logout)
 
 	mux.Get("/admin/dashboard", Repo.AdminDashboard)
+	mux.Get("/admin/dashboard/occupancy", Repo.AdminDashboardOccupancy)
+	mux.Get("/admin/dashboard/bookings", Repo.AdminDashboardBookings)
 
 	mux.Get("/admin/reservations-new", Repo.AdminNewReservations)
 	mux.Get("/admin/reservations-all", Repo.AdminAllReservations)
 	mux.Get("/admin/reservations-calendar", Repo.AdminReservationsCalendar)
+	mux.Get("/admin/new-reservation", Repo.AdminNewReservation)
+	mux.Post("/admin/new-reservation", Repo.AdminPostNewReservation)
+	mux.Get("/admin/reservations/export", Repo.AdminExportReservations)
+	mux.Get("/admin/guests", Repo.AdminGuests)
+	mux.Get("/admin/guests/{id}", Repo.AdminShowGuest)
+	mux.Post("/admin/guests/{id}", Repo.AdminPostGuest)
+	mux.Post("/admin/guests/{id}/merge", Repo.AdminMergeGuest)
+	mux.Get("/admin/import", Repo.AdminImport)
+	mux.Post("/admin/import", Repo.AdminPostImport)
+	mux.Get("/admin/taxes", Repo.AdminTaxes)
+	mux.Post("/admin/taxes", Repo.AdminPostTax)
+	mux.Post("/admin/taxes/{id}/delete", Repo.AdminDeleteTax)
+	mux.Get("/admin/promotions", Repo.AdminPromotions)
+	mux.Post("/admin/promotions", Repo.AdminPostPromotion)
+	mux.Post("/admin/promotions/{id}/delete", Repo.AdminDeletePromotion)
+	mux.Get("/admin/promotions/redemptions", Repo.AdminPromotionRedemptions)
 	//mux.Post("/admin/reservations-calendar", Repo.AdminPostReservationsCalendar)
 	mux.Get("/admin/process-reservation/{src}/{id}/do", Repo.AdminProcessReservation)
-	mux.Get("/admin/delete-reservation/{src}/{id}/do", Repo.AdminDeleteReservation)
+	mux.Post("/admin/delete-reservation/{src}/{id}", Repo.AdminDeleteReservation)
 
 	mux.Get("/admin/reservations/{src}/{id}/show", Repo.AdminShowReservation)
 	mux.Post("/admin/reservations/{src}/{id}", Repo.AdminPostShowReservation)
+	mux.Post("/admin/reservations/{src}/{id}/notes", Repo.AdminPostReservationNote)
+	mux.Post("/admin/reservations/{src}/{id}/notes/{noteID}/pin", Repo.AdminPinReservationNote)
+	mux.Get("/admin/reservations/{src}/{id}/invoice", Repo.AdminReservationInvoice)
+	mux.Post("/admin/reservations/{src}/{id}/invoice/send", Repo.AdminSendInvoice)
 
 	fileServer := http.FileServer(http.Dir("./static/"))
 	mux.Handle("/static/*", http.StripPrefix("/static", fileServer))
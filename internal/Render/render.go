@@ -5,21 +5,25 @@ import (
 	"errors"
 	"fmt"
 	"html/template"
-	"log"
 	"net/http"
 	"path/filepath"
 	"time"
 
 	config "github.com/GitEagleY/BookingsWebApp/internal/config"
+	"github.com/GitEagleY/BookingsWebApp/internal/csp"
+	"github.com/GitEagleY/BookingsWebApp/internal/logging"
 	"github.com/GitEagleY/BookingsWebApp/internal/models"
+	"github.com/GitEagleY/BookingsWebApp/internal/pricing"
 	"github.com/justinas/nosurf"
 )
 
 var functions = template.FuncMap{
-	"humanDate":  HumanDate,
-	"formatDate": FormatDate,
-	"iterate":    Iterate,
-	"add":        Add,
+	"humanDate":     HumanDate,
+	"formatDate":    FormatDate,
+	"iterate":       Iterate,
+	"add":           Add,
+	"formatMoney":   FormatMoney,
+	"formatPercent": pricing.Percent,
 } // Custom template functions.
 
 var app *config.AppConfig // Holds the application configuration.
@@ -53,6 +57,16 @@ func Add(a, b int) int {
 	return a + b
 }
 
+// FormatMoney formats an amount in cents, e.g. 8900 as 89.00.
+func FormatMoney(cents int) string {
+	sign := ""
+	if cents < 0 {
+		sign = "-"
+		cents = -cents
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, cents/100, cents%100)
+}
+
 // AddDefaultData adds common data to the template data.
 func AddDefaultData(td *models.TemplateData, r *http.Request) *models.TemplateData {
 	// Retrieve flash messages from the session and add them to the template data.
@@ -66,6 +80,7 @@ func AddDefaultData(td *models.TemplateData, r *http.Request) *models.TemplateDa
 		td.IsAuthenticated = 1
 	}
 	td.CSRFToken = nosurf.Token(r)
+	td.CSPNonce = csp.Nonce(r.Context())
 	return td
 }
 
@@ -80,9 +95,11 @@ func Template(w http.ResponseWriter, r *http.Request, tmpl string, td *models.Te
 		tc, _ = CreateTemplateCache()
 	}
 
+	logger := logging.FromContext(r.Context(), app.Logger)
+
 	t, ok := tc[tmpl]
 	if !ok {
-		log.Fatal("Could not get template from template cache")
+		logger.Error("template not in the template cache", "template", tmpl)
 		return errors.New("cant get error from cache")
 	}
 
@@ -90,11 +107,14 @@ func Template(w http.ResponseWriter, r *http.Request, tmpl string, td *models.Te
 
 	td = AddDefaultData(td, r)
 
-	_ = t.Execute(buf, td)
+	err := t.Execute(buf, td)
+	if err != nil {
+		logger.Error("can't execute template", "template", tmpl, "error", err)
+	}
 
-	_, err := buf.WriteTo(w)
+	_, err = buf.WriteTo(w)
 	if err != nil {
-		fmt.Println("error writing template to browser", err)
+		logger.Warn("error writing template to browser", "template", tmpl, "error", err)
 		return err
 	}
 	return nil
@@ -2,6 +2,10 @@ package render
 
 import (
 	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
 	"testing"
 
 	"github.com/GitEagleY/BookingsWebApp/internal/models"
@@ -51,10 +55,14 @@ func TestRenderTemplate(t *testing.T) {
 		t.Error("error writing template to browser", err)
 	}
 
+	logs.Reset()
 	err = Template(&ww, r, "non-existent.page.tmpl", &models.TemplateData{})
 	if err == nil {
 		t.Error("rendered template that does not exist")
 	}
+	if !strings.Contains(logs.String(), `level=ERROR msg="template not in the template cache" template=non-existent.page.tmpl`) {
+		t.Errorf("missing template not logged: %q", logs.String())
+	}
 
 }
 
@@ -69,3 +77,25 @@ func TestCreateTemplateCache(t *testing.T) {
 	}
 
 }
+
+// TestScriptsCarryNonce checks every script of the templates carries the nonce, the content security policy
+// refuses the others.
+func TestScriptsCarryNonce(t *testing.T) {
+	pages, err := filepath.Glob("./../../templates/*.tmpl")
+	if err != nil || len(pages) == 0 {
+		t.Fatalf("no templates found: %v", err)
+	}
+
+	script := regexp.MustCompile(`<script\b[^>]*>`)
+	for _, page := range pages {
+		b, err := os.ReadFile(page)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, tag := range script.FindAllString(string(b), -1) {
+			if !strings.Contains(tag, `nonce="{{$.CSPNonce}}"`) {
+				t.Errorf("%s: script without the nonce: %s", filepath.Base(page), tag)
+			}
+		}
+	}
+}
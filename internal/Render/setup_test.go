@@ -1,14 +1,16 @@
 package render
 
 import (
+	"bytes"
 	"encoding/gob"
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"testing"
 	"time"
 
 	"github.com/GitEagleY/BookingsWebApp/internal/config"
+	"github.com/GitEagleY/BookingsWebApp/internal/logging"
 	"github.com/GitEagleY/BookingsWebApp/internal/models"
 	"github.com/alexedwards/scs/v2"
 )
@@ -16,16 +18,16 @@ import (
 var session *scs.SessionManager
 var testApp config.AppConfig
 
+// logs is what the tests logged.
+var logs bytes.Buffer
+
 func TestMain(m *testing.M) {
 	gob.Register(models.Reservation{})
 
 	// change this to true when in production
 	testApp.InProduction = false
-	infoLog := log.New(os.Stdout, "INFO:\t", log.Ldate|log.Ltime)
-	app.InfoLog = infoLog
+	testApp.Logger = logging.New(&logs, "text", slog.LevelDebug)
 
-	errorLog := log.New(os.Stdout, "ERROR:\t", log.Ldate|log.Ltime|log.Lshortfile)
-	app.ErrorLog = errorLog
 	// set up the session
 	session = scs.New()
 	session.Lifetime = 24 * time.Hour
@@ -0,0 +1,165 @@
+// Package cancellation evaluates cancellation policies. A Policy is kept on every room and copied onto
+// each reservation when it is booked, encoded with Policy.String, so later changes to the room do not
+// change what the guest agreed to.
+package cancellation
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Tier refunds RefundPercent of the amount paid when a reservation is cancelled at least DaysBefore days
+// before arrival.
+type Tier struct {
+	DaysBefore    int
+	RefundPercent int
+}
+
+// Policy is a named set of tiers. Cancelling later than every tier refunds nothing.
+type Policy struct {
+	Name  string
+	Tiers []Tier
+}
+
+// The preset policies
+var (
+	Flexible = Policy{Name: "flexible", Tiers: []Tier{{DaysBefore: 1, RefundPercent: 100}}}
+	Moderate = Policy{Name: "moderate", Tiers: []Tier{{DaysBefore: 5, RefundPercent: 100}, {DaysBefore: 1, RefundPercent: 50}}}
+	Strict   = Policy{Name: "strict", Tiers: []Tier{{DaysBefore: 14, RefundPercent: 100}, {DaysBefore: 7, RefundPercent: 50}}}
+)
+
+// Presets are the preset policies by name.
+var Presets = map[string]Policy{
+	Flexible.Name: Flexible,
+	Moderate.Name: Moderate,
+	Strict.Name:   Strict,
+}
+
+// ErrInvalidPolicy is returned by Parse for text that is not an encoded policy.
+var ErrInvalidPolicy = errors.New("invalid cancellation policy")
+
+// String encodes the policy as "name:days=percent,...", e.g. "moderate:5=100,1=50".
+func (p Policy) String() string {
+	tiers := make([]string, len(p.Tiers))
+	for i, t := range p.sorted() {
+		tiers[i] = fmt.Sprintf("%d=%d", t.DaysBefore, t.RefundPercent)
+	}
+	return p.Name + ":" + strings.Join(tiers, ",")
+}
+
+// Parse decodes a policy encoded with Policy.String. The name of a preset alone, e.g. "strict", gives the preset.
+func Parse(s string) (Policy, error) {
+	s = strings.TrimSpace(s)
+	name, rest, found := strings.Cut(s, ":")
+	if !found {
+		if p, ok := Presets[s]; ok {
+			return p, nil
+		}
+		return Policy{}, fmt.Errorf("%w: %q", ErrInvalidPolicy, s)
+	}
+	if name == "" {
+		return Policy{}, fmt.Errorf("%w: missing name in %q", ErrInvalidPolicy, s)
+	}
+
+	p := Policy{Name: name}
+	if rest == "" {
+		return p, nil
+	}
+	for _, part := range strings.Split(rest, ",") {
+		days, percent, found := strings.Cut(part, "=")
+		d, err1 := strconv.Atoi(strings.TrimSpace(days))
+		pc, err2 := strconv.Atoi(strings.TrimSpace(percent))
+		if !found || err1 != nil || err2 != nil || d < 0 || pc < 0 || pc > 100 {
+			return Policy{}, fmt.Errorf("%w: bad tier %q", ErrInvalidPolicy, part)
+		}
+		p.Tiers = append(p.Tiers, Tier{DaysBefore: d, RefundPercent: pc})
+	}
+	p.Tiers = p.sorted()
+
+	return p, nil
+}
+
+// sorted returns the tiers ordered from the earliest cancellation to the latest.
+func (p Policy) sorted() []Tier {
+	tiers := append([]Tier(nil), p.Tiers...)
+	sort.SliceStable(tiers, func(i, j int) bool {
+		return tiers[i].DaysBefore > tiers[j].DaysBefore
+	})
+	return tiers
+}
+
+// Description explains the policy to guests.
+func (p Policy) Description() string {
+	var parts []string
+	for _, t := range p.sorted() {
+		refund := fmt.Sprintf("%d%% refund", t.RefundPercent)
+		switch t.RefundPercent {
+		case 100:
+			refund = "Full refund"
+		case 0:
+			refund = "No refund"
+		}
+		parts = append(parts, fmt.Sprintf("%s if cancelled at least %s before arrival", refund, days(t.DaysBefore)))
+	}
+	parts = append(parts, "no refund after that")
+	if len(parts) == 1 {
+		return "No refund."
+	}
+
+	s := strings.Join(parts, ", ")
+	return strings.ToUpper(s[:1]) + s[1:] + "."
+}
+
+func days(n int) string {
+	if n == 1 {
+		return "1 day"
+	}
+	return fmt.Sprintf("%d days", n)
+}
+
+// Result is the outcome of cancelling a reservation.
+type Result struct {
+	Policy        string // the policy, encoded with Policy.String
+	DaysBefore    int    // whole days between the cancellation and arrival, negative after arrival
+	RefundPercent int
+	Paid          int
+	Refund        int
+	Fee           int // the part of Paid that is kept
+}
+
+// Evaluate works out the refund of paid, in cents, when a reservation arriving on arrival is cancelled at
+// cancelledAt. Days are counted between calendar dates in loc, the time zone of the property; arrival is a
+// date, as read from the database its time zone is UTC whatever loc is. The refund is rounded to the nearest
+// cent.
+func Evaluate(p Policy, arrival, cancelledAt time.Time, loc *time.Location, paid int) Result {
+	arrivalDay := time.Date(arrival.Year(), arrival.Month(), arrival.Day(), 0, 0, 0, 0, time.UTC)
+	c := cancelledAt.In(loc)
+	cancelDay := time.Date(c.Year(), c.Month(), c.Day(), 0, 0, 0, 0, time.UTC)
+	daysBefore := int(arrivalDay.Sub(cancelDay).Hours() / 24)
+
+	percent := 0
+	for _, t := range p.sorted() {
+		if daysBefore >= t.DaysBefore {
+			percent = t.RefundPercent
+			break
+		}
+	}
+
+	if paid < 0 {
+		paid = 0
+	}
+	refund := (paid*percent + 50) / 100
+
+	return Result{
+		Policy:        p.String(),
+		DaysBefore:    daysBefore,
+		RefundPercent: percent,
+		Paid:          paid,
+		Refund:        refund,
+		Fee:           paid - refund,
+	}
+}
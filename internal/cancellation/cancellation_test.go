@@ -0,0 +1,200 @@
+package cancellation
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+var arrival = time.Date(2050, 3, 20, 0, 0, 0, 0, time.UTC)
+
+// daysBefore is the time n days before arrival, at noon.
+func daysBefore(n int) time.Time {
+	return arrival.AddDate(0, 0, -n).Add(12 * time.Hour)
+}
+
+var evaluateTests = []struct {
+	name           string
+	policy         Policy
+	cancelledAt    time.Time
+	paid           int
+	expectedDays   int
+	expectedPct    int
+	expectedRefund int
+	expectedFee    int
+}{
+	// flexible: 100% from 1 day before
+	{"flexible-long-before", Flexible, daysBefore(30), 10000, 30, 100, 10000, 0},
+	{"flexible-2-days", Flexible, daysBefore(2), 10000, 2, 100, 10000, 0},
+	{"flexible-1-day", Flexible, daysBefore(1), 10000, 1, 100, 10000, 0},
+	{"flexible-same-day", Flexible, daysBefore(0), 10000, 0, 0, 0, 10000},
+	{"flexible-after-arrival", Flexible, daysBefore(-2), 10000, -2, 0, 0, 10000},
+
+	// moderate: 100% from 5 days, 50% from 1 day
+	{"moderate-6-days", Moderate, daysBefore(6), 10000, 6, 100, 10000, 0},
+	{"moderate-5-days", Moderate, daysBefore(5), 10000, 5, 100, 10000, 0},
+	{"moderate-4-days", Moderate, daysBefore(4), 10000, 4, 50, 5000, 5000},
+	{"moderate-1-day", Moderate, daysBefore(1), 10000, 1, 50, 5000, 5000},
+	{"moderate-same-day", Moderate, daysBefore(0), 10000, 0, 0, 0, 10000},
+	{"moderate-after-arrival", Moderate, daysBefore(-1), 10000, -1, 0, 0, 10000},
+
+	// strict: 100% from 14 days, 50% from 7 days
+	{"strict-15-days", Strict, daysBefore(15), 10000, 15, 100, 10000, 0},
+	{"strict-14-days", Strict, daysBefore(14), 10000, 14, 100, 10000, 0},
+	{"strict-13-days", Strict, daysBefore(13), 10000, 13, 50, 5000, 5000},
+	{"strict-7-days", Strict, daysBefore(7), 10000, 7, 50, 5000, 5000},
+	{"strict-6-days", Strict, daysBefore(6), 10000, 6, 0, 0, 10000},
+	{"strict-same-day", Strict, daysBefore(0), 10000, 0, 0, 0, 10000},
+
+	// amounts
+	{"nothing-paid", Moderate, daysBefore(3), 0, 3, 50, 0, 0},
+	{"negative-paid", Moderate, daysBefore(3), -100, 3, 50, 0, 0},
+	{"rounds-half-up", Moderate, daysBefore(3), 8901, 3, 50, 4451, 4450},
+	{"rounds-down", Policy{Name: "custom", Tiers: []Tier{{DaysBefore: 0, RefundPercent: 33}}}, daysBefore(0), 1001, 0, 33, 330, 671},
+
+	// custom policies
+	{"no-tiers", Policy{Name: "none"}, daysBefore(100), 10000, 100, 0, 0, 10000},
+	{"zero-day-tier", Policy{Name: "custom", Tiers: []Tier{{DaysBefore: 0, RefundPercent: 80}}}, daysBefore(0), 10000, 0, 80, 8000, 2000},
+	{"unsorted-tiers", Policy{Name: "custom", Tiers: []Tier{{DaysBefore: 1, RefundPercent: 25}, {DaysBefore: 10, RefundPercent: 90}}}, daysBefore(12), 10000, 12, 90, 9000, 1000},
+	{"unsorted-tiers-late", Policy{Name: "custom", Tiers: []Tier{{DaysBefore: 1, RefundPercent: 25}, {DaysBefore: 10, RefundPercent: 90}}}, daysBefore(3), 10000, 3, 25, 2500, 7500},
+
+	// time of day and time zones, days are counted in the time zone of arrival
+	{"just-before-midnight", Flexible, arrival.Add(-time.Second), 10000, 1, 100, 10000, 0},
+	{"midnight-of-arrival", Flexible, arrival, 10000, 0, 0, 0, 10000},
+	{"other-time-zone", Flexible, time.Date(2050, 3, 19, 23, 30, 0, 0, time.FixedZone("UTC-2", -2*3600)), 10000, 0, 0, 0, 10000},
+	{"month-before", Policy{Name: "custom", Tiers: []Tier{{DaysBefore: 30, RefundPercent: 100}}}, daysBefore(30), 10000, 30, 100, 10000, 0},
+}
+
+func TestEvaluate(t *testing.T) {
+	for _, e := range evaluateTests {
+		r := Evaluate(e.policy, arrival, e.cancelledAt, time.UTC, e.paid)
+
+		if r.DaysBefore != e.expectedDays {
+			t.Errorf("%s: expected %d days before, got %d", e.name, e.expectedDays, r.DaysBefore)
+		}
+		if r.RefundPercent != e.expectedPct {
+			t.Errorf("%s: expected %d%%, got %d%%", e.name, e.expectedPct, r.RefundPercent)
+		}
+		if r.Refund != e.expectedRefund || r.Fee != e.expectedFee {
+			t.Errorf("%s: expected refund %d and fee %d, got %d and %d", e.name, e.expectedRefund, e.expectedFee, r.Refund, r.Fee)
+		}
+		if r.Refund+r.Fee != r.Paid {
+			t.Errorf("%s: refund and fee do not add up to the amount paid", e.name)
+		}
+		if r.Policy != e.policy.String() {
+			t.Errorf("%s: expected policy %q, got %q", e.name, e.policy.String(), r.Policy)
+		}
+	}
+}
+
+func TestEvaluate_AllDays(t *testing.T) {
+	// walking towards arrival the refund never goes up
+	for _, p := range Presets {
+		last := 100
+		for d := 40; d >= -3; d-- {
+			r := Evaluate(p, arrival, daysBefore(d), time.UTC, 10000)
+			if r.RefundPercent > last {
+				t.Errorf("%s: refund goes up from %d%% to %d%% at %d days", p.Name, last, r.RefundPercent, d)
+			}
+			last = r.RefundPercent
+		}
+		if last != 0 {
+			t.Errorf("%s: expected no refund after arrival, got %d%%", p.Name, last)
+		}
+	}
+}
+
+var parseTests = []struct {
+	name        string
+	input       string
+	expected    string
+	expectedErr bool
+}{
+	{"flexible", "flexible:1=100", "flexible:1=100", false},
+	{"moderate", "moderate:5=100,1=50", "moderate:5=100,1=50", false},
+	{"preset-name", "strict", "strict:14=100,7=50", false},
+	{"unsorted", "custom:1=50,5=100", "custom:5=100,1=50", false},
+	{"spaces", " custom: 3 = 70 , 0 = 10 ", "custom:3=70,0=10", false},
+	{"no-tiers", "none:", "none:", false},
+	{"unknown-name", "lenient", "", true},
+	{"empty", "", "", true},
+	{"missing-name", ":1=100", "", true},
+	{"missing-percent", "custom:1", "", true},
+	{"bad-days", "custom:x=100", "", true},
+	{"negative-days", "custom:-1=100", "", true},
+	{"over-100", "custom:1=101", "", true},
+	{"negative-percent", "custom:1=-5", "", true},
+	{"trailing-comma", "custom:1=100,", "", true},
+}
+
+func TestParse(t *testing.T) {
+	for _, e := range parseTests {
+		p, err := Parse(e.input)
+		if e.expectedErr {
+			if !errors.Is(err, ErrInvalidPolicy) {
+				t.Errorf("%s: expected ErrInvalidPolicy, got %v", e.name, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", e.name, err)
+			continue
+		}
+		if p.String() != e.expected {
+			t.Errorf("%s: expected %q, got %q", e.name, e.expected, p.String())
+		}
+	}
+}
+
+func TestParse_RoundTrip(t *testing.T) {
+	for name, p := range Presets {
+		parsed, err := Parse(p.String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if parsed.String() != p.String() || parsed.Name != name {
+			t.Errorf("%s: round trip gave %q", name, parsed.String())
+		}
+	}
+}
+
+var descriptionTests = []struct {
+	name     string
+	policy   Policy
+	expected string
+}{
+	{"flexible", Flexible, "Full refund if cancelled at least 1 day before arrival, no refund after that."},
+	{"moderate", Moderate, "Full refund if cancelled at least 5 days before arrival, 50% refund if cancelled at least 1 day before arrival, no refund after that."},
+	{"strict", Strict, "Full refund if cancelled at least 14 days before arrival, 50% refund if cancelled at least 7 days before arrival, no refund after that."},
+	{"no-tiers", Policy{Name: "none"}, "No refund."},
+}
+
+func TestDescription(t *testing.T) {
+	for _, e := range descriptionTests {
+		if got := e.policy.Description(); got != e.expected {
+			t.Errorf("%s: expected %q, got %q", e.name, e.expected, got)
+		}
+	}
+}
+
+func TestEvaluate_PropertyTimeZone(t *testing.T) {
+	// arrival is read from a date column, at midnight UTC; days are counted in the time zone of the property
+	tests := []struct {
+		name         string
+		loc          *time.Location
+		cancelledAt  time.Time
+		expectedDays int
+	}{
+		{"west-evening-before", time.FixedZone("UTC-5", -5*3600), time.Date(2050, 3, 20, 2, 0, 0, 0, time.UTC), 1},
+		{"west-midnight", time.FixedZone("UTC-5", -5*3600), time.Date(2050, 3, 20, 5, 0, 0, 0, time.UTC), 0},
+		{"east-morning-before", time.FixedZone("UTC+9", 9*3600), time.Date(2050, 3, 18, 20, 0, 0, 0, time.UTC), 1},
+		{"east-just-before-midnight", time.FixedZone("UTC+9", 9*3600), time.Date(2050, 3, 18, 14, 59, 0, 0, time.UTC), 2},
+	}
+
+	for _, e := range tests {
+		r := Evaluate(Moderate, arrival, e.cancelledAt, e.loc, 10000)
+		if r.DaysBefore != e.expectedDays {
+			t.Errorf("%s: expected %d days before, got %d", e.name, e.expectedDays, r.DaysBefore)
+		}
+	}
+}
@@ -2,18 +2,41 @@ package config
 
 import (
 	"html/template"
-	"log"
+	"log/slog"
+	"time"
 
+	"github.com/GitEagleY/BookingsWebApp/internal/health"
+	"github.com/GitEagleY/BookingsWebApp/internal/metrics"
 	"github.com/GitEagleY/BookingsWebApp/internal/models"
+	"github.com/GitEagleY/BookingsWebApp/internal/payments"
 	"github.com/alexedwards/scs/v2"
 )
 
 type AppConfig struct {
 	UseCache      bool
 	TemplateCache map[string]*template.Template
-	InfoLog       *log.Logger
-	ErrorLog      *log.Logger
+	Logger        *slog.Logger // the requests being served log with logging.FromContext
 	InProduction  bool
 	Session       *scs.SessionManager
 	MailChan      chan models.MailData
+	QueryTimeout  time.Duration // of the queries of each repository method
+
+	AdminIdleTimeout time.Duration // staff are signed out after this long without a request
+
+	TrustedProxies string // whose X-Forwarded-For and X-Forwarded-Proto are believed
+	RedirectHTTPS  bool
+
+	Payments          payments.PaymentProvider
+	PaymentsPublicKey string
+	Currency          string
+	DepositPercent    int
+
+	SiteURL string // of the links in the emails sent outside a request, without the trailing slash
+
+	SMTP     SMTPSettings
+	Features Features
+
+	Metrics       *metrics.Registry
+	MetricsAccess MetricsSettings
+	ReadyChecks   []health.Check // run by /readyz
 }
@@ -0,0 +1,141 @@
+package config
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// The config file formats are the part of YAML and TOML needed for settings: one level of sections holding
+// keys with single line values. The values are returned by key, e.g. "db.host".
+
+// parseYAML reads a config file such as
+//
+//	addr: ":8080"
+//	db:
+//	  host: localhost
+//	  name: bookings
+func parseYAML(r io.Reader) (map[string]string, error) {
+	values := make(map[string]string)
+	section := ""
+
+	sc := bufio.NewScanner(r)
+	for n := 1; sc.Scan(); n++ {
+		line := stripComment(sc.Text())
+		if strings.TrimSpace(line) == "" || strings.TrimSpace(line) == "---" {
+			continue
+		}
+
+		indented := line[0] == ' ' || line[0] == '\t'
+		key, value, ok := strings.Cut(strings.TrimSpace(line), ":")
+		if !ok || strings.TrimSpace(key) == "" || strings.HasPrefix(key, "- ") {
+			return nil, fmt.Errorf("line %d: expected key: value", n)
+		}
+		key = strings.TrimSpace(key)
+		value = strings.TrimSpace(value)
+
+		switch {
+		case !indented && value == "":
+			section = key
+			continue
+		case !indented:
+			section = ""
+		case section == "":
+			return nil, fmt.Errorf("line %d: indented key outside a section", n)
+		default:
+			key = section + "." + key
+		}
+
+		v, err := unquote(value)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", n, err)
+		}
+		values[key] = v
+	}
+
+	return values, sc.Err()
+}
+
+// parseTOML reads a config file such as
+//
+//	addr = ":8080"
+//
+//	[db]
+//	host = "localhost"
+//	name = "bookings"
+func parseTOML(r io.Reader) (map[string]string, error) {
+	values := make(map[string]string)
+	section := ""
+
+	sc := bufio.NewScanner(r)
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(stripComment(sc.Text()))
+		if line == "" {
+			continue
+		}
+
+		if strings.HasPrefix(line, "[") {
+			if !strings.HasSuffix(line, "]") || strings.Contains(line, ".") {
+				return nil, fmt.Errorf("line %d: expected [section]", n)
+			}
+			section = strings.TrimSpace(line[1 : len(line)-1])
+			continue
+		}
+
+		key, value, ok := strings.Cut(line, "=")
+		if !ok || strings.TrimSpace(key) == "" {
+			return nil, fmt.Errorf("line %d: expected key = value", n)
+		}
+		key = strings.TrimSpace(key)
+		if section != "" {
+			key = section + "." + key
+		}
+
+		v, err := unquote(strings.TrimSpace(value))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", n, err)
+		}
+		values[key] = v
+	}
+
+	return values, sc.Err()
+}
+
+// stripComment removes a # comment from line, unless the # is in a quoted value or part of a word.
+func stripComment(line string) string {
+	quote := rune(0)
+	for i, c := range line {
+		switch {
+		case quote != 0 && c == quote:
+			quote = 0
+		case quote != 0:
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t'):
+			return strings.TrimRight(line[:i], " \t")
+		}
+	}
+	return strings.TrimRight(line, " \t")
+}
+
+// unquote returns a value without its quotes, "..." strings may use Go escapes and '...' strings are taken as is.
+func unquote(v string) (string, error) {
+	switch {
+	case strings.HasPrefix(v, `"`):
+		s, err := strconv.Unquote(v)
+		if err != nil {
+			return "", fmt.Errorf("invalid string %s", v)
+		}
+		return s, nil
+	case strings.HasPrefix(v, "'"):
+		if len(v) < 2 || !strings.HasSuffix(v, "'") {
+			return "", fmt.Errorf("invalid string %s", v)
+		}
+		return v[1 : len(v)-1], nil
+	case strings.HasPrefix(v, "[") || strings.HasPrefix(v, "{"):
+		return "", fmt.Errorf("lists and tables aren't supported")
+	}
+	return v, nil
+}
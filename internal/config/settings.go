@@ -0,0 +1,591 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/GitEagleY/BookingsWebApp/internal/logging"
+	"github.com/GitEagleY/BookingsWebApp/internal/models"
+)
+
+// EnvPrefix starts the names of the environment variables read by Load, e.g. BOOKINGS_DB_HOST for db.host.
+const EnvPrefix = "BOOKINGS_"
+
+// Settings is the configuration the application is started with.
+type Settings struct {
+	Addr            string        // address the web server listens on
+	ShutdownTimeout time.Duration // to finish requests and send queued emails when stopping
+	Production      bool
+	UseCache        bool
+	Timezone        string
+	Currency        string
+	SiteURL         string // of the links in the emails sent by commands, e.g. https://bookings.example.com
+
+	TrustedProxies string // comma separated addresses or networks whose X-Forwarded-For and -Proto are believed
+	RedirectHTTPS  bool   // send the requests that came over plain HTTP through a proxy to HTTPS
+
+	TLS      TLSSettings
+	DB       DBSettings
+	SMTP     SMTPSettings
+	Session  SessionSettings
+	Payments PaymentSettings
+	Features Features
+	Metrics  MetricsSettings
+	Log      LogSettings
+}
+
+// TLSSettings is HTTPS served by the application itself, with a certificate from files or from Let's Encrypt,
+// rather than by a proxy in front of it.
+type TLSSettings struct {
+	CertFile string
+	KeyFile  string
+	Autocert string // comma separated host names to get certificates for from Let's Encrypt
+	CacheDir string // of the Let's Encrypt certificates
+	Email    string // given to Let's Encrypt for expiry notices
+	HTTPAddr string // address redirecting plain HTTP to HTTPS, e.g. :80, empty for none
+}
+
+// Enabled reports whether the application serves HTTPS.
+func (t TLSSettings) Enabled() bool {
+	return t.CertFile != "" || t.Autocert != ""
+}
+
+// Hosts returns the host names to get certificates for.
+func (t TLSSettings) Hosts() []string {
+	var hosts []string
+	for _, h := range strings.Split(t.Autocert, ",") {
+		if h = strings.TrimSpace(h); h != "" {
+			hosts = append(hosts, h)
+		}
+	}
+	return hosts
+}
+
+// DBSettings is the database connection.
+type DBSettings struct {
+	Host     string
+	Port     string
+	Name     string
+	User     string
+	Password string
+	SSLMode  string
+
+	QueryTimeout time.Duration // of the queries of each request
+	Migrate      bool          // apply the pending migrations on startup
+}
+
+// DSN returns the connection string of the database.
+func (db DBSettings) DSN() string {
+	return fmt.Sprintf("host=%s port=%s dbname=%s user=%s password=%s sslmode=%s", db.Host, db.Port, db.Name, db.User, db.Password, db.SSLMode)
+}
+
+// SMTPSettings is the mail server emails are sent through.
+type SMTPSettings struct {
+	Host       string
+	Port       int
+	Username   string
+	Password   string
+	Encryption string // none, ssl or starttls
+	From       string // sender of the emails
+}
+
+// SessionSettings are where sessions are kept and how long they last.
+type SessionSettings struct {
+	Store            string // memory, postgres or file
+	Dir              string // of the file store
+	Lifetime         time.Duration
+	IdleTimeout      time.Duration // without a request, 0 for none
+	AdminIdleTimeout time.Duration // without a request, for the sessions of signed in staff
+	CookieName       string
+}
+
+// PaymentSettings is the payment provider deposits are taken with.
+type PaymentSettings struct {
+	Provider       string // fake or stripe
+	Key            string
+	PublicKey      string
+	WebhookSecret  string
+	DepositPercent int
+}
+
+// MetricsSettings is who may read /metrics: requests with the token, or from the allowed networks. No network
+// is allowed by default, as behind a reverse proxy on the same host every request comes from localhost.
+type MetricsSettings struct {
+	Token string
+	Allow string // comma separated addresses or networks, e.g. 127.0.0.1,10.0.0.0/8
+}
+
+// Networks returns the allowed networks, single addresses as networks of one.
+func (m MetricsSettings) Networks() ([]*net.IPNet, error) {
+	return ParseNetworks(m.Allow)
+}
+
+// ParseNetworks returns the comma separated addresses and networks of list, single addresses as networks of one.
+func ParseNetworks(list string) ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+	for _, s := range strings.Split(list, ",") {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		if !strings.Contains(s, "/") {
+			ip := net.ParseIP(s)
+			if ip == nil {
+				return nil, fmt.Errorf("%q is not an address or network", s)
+			}
+			bits := 8 * net.IPv4len
+			if ip.To4() == nil {
+				bits = 8 * net.IPv6len
+			}
+			s = fmt.Sprintf("%s/%d", s, bits)
+		}
+		_, n, err := net.ParseCIDR(s)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not an address or network", s)
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
+
+// LogSettings is what is logged and how.
+type LogSettings struct {
+	Level  string // debug, info, warn or error
+	Format string // text or json
+}
+
+// Features turns parts of the application on and off.
+type Features struct {
+	Waitlist   bool
+	Promotions bool
+}
+
+// Defaults returns the settings used for anything not configured.
+func Defaults() Settings {
+	return Settings{
+		Addr:            ":8080",
+		ShutdownTimeout: 30 * time.Second,
+		Production:      true,
+		UseCache:        true,
+		Timezone:        "Local",
+		Currency:        models.DefaultCurrency,
+		TLS: TLSSettings{
+			CacheDir: "certs",
+		},
+		DB: DBSettings{
+			Host:    "localhost",
+			Port:    "5432",
+			SSLMode: "disable",
+
+			QueryTimeout: 3 * time.Second,
+		},
+		SMTP: SMTPSettings{
+			Host:       "localhost",
+			Port:       1025,
+			Encryption: "none",
+			From:       "me@here.com",
+		},
+		Session: SessionSettings{
+			Store:            "postgres",
+			Dir:              "sessions",
+			Lifetime:         24 * time.Hour,
+			IdleTimeout:      2 * time.Hour,
+			AdminIdleTimeout: 30 * time.Minute,
+			CookieName:       "session",
+		},
+		Payments: PaymentSettings{
+			Provider: "fake",
+		},
+		Features: Features{
+			Waitlist:   true,
+			Promotions: true,
+		},
+		Log: LogSettings{
+			Level:  "info",
+			Format: "text",
+		},
+	}
+}
+
+// setting is one configurable value, read from the file key, the environment variable named after the key and
+// the flag.
+type setting struct {
+	key    string // in the config file, e.g. db.host
+	flag   string
+	usage  string
+	secret bool // left out of the printed configuration
+	value  flag.Value
+}
+
+// env returns the environment variable of the setting, e.g. BOOKINGS_DB_HOST.
+func (s setting) env() string {
+	return EnvPrefix + strings.ToUpper(strings.ReplaceAll(s.key, ".", "_"))
+}
+
+func (s *Settings) settings() []setting {
+	return []setting{
+		{"addr", "addr", "Address the web server listens on", false, (*stringValue)(&s.Addr)},
+		{"shutdown_timeout", "shutdown-timeout", "Time to finish requests and send queued emails when stopping", false, (*durationValue)(&s.ShutdownTimeout)},
+		{"production", "production", "Application is in production", false, (*boolValue)(&s.Production)},
+		{"cache", "cache", "Use template cache", false, (*boolValue)(&s.UseCache)},
+		{"timezone", "timezone", "Time zone of the property, e.g. Europe/Paris", false, (*stringValue)(&s.Timezone)},
+		{"currency", "currency", "Currency of room rates and payments", false, (*stringValue)(&s.Currency)},
+		{"site_url", "site-url", "Address of the site in the links of the emails sent by commands, e.g. https://bookings.example.com", false, (*stringValue)(&s.SiteURL)},
+		{"trusted_proxies", "trusted-proxies", "Addresses and networks of the proxies whose X-Forwarded-For and X-Forwarded-Proto are believed", false, (*stringValue)(&s.TrustedProxies)},
+		{"https_redirect", "https-redirect", "Redirect the requests that came over plain HTTP through a trusted proxy to HTTPS", false, (*boolValue)(&s.RedirectHTTPS)},
+
+		{"tls.cert_file", "tls-cert", "TLS certificate file, to serve HTTPS", false, (*stringValue)(&s.TLS.CertFile)},
+		{"tls.key_file", "tls-key", "TLS key file", false, (*stringValue)(&s.TLS.KeyFile)},
+		{"tls.autocert", "autocert", "Host names to serve HTTPS for with certificates from Let's Encrypt, e.g. example.com,www.example.com", false, (*stringValue)(&s.TLS.Autocert)},
+		{"tls.cache_dir", "autocert-dir", "Directory the Let's Encrypt certificates are kept in", false, (*stringValue)(&s.TLS.CacheDir)},
+		{"tls.email", "autocert-email", "Email address Let's Encrypt sends expiry notices to", false, (*stringValue)(&s.TLS.Email)},
+		{"tls.http_addr", "http-addr", "Address redirecting plain HTTP to HTTPS, e.g. :80", false, (*stringValue)(&s.TLS.HTTPAddr)},
+
+		{"db.host", "dbhost", "Database host", false, (*stringValue)(&s.DB.Host)},
+		{"db.port", "dbport", "Database port", false, (*stringValue)(&s.DB.Port)},
+		{"db.name", "dbname", "Database name", false, (*stringValue)(&s.DB.Name)},
+		{"db.user", "dbuser", "Database user", false, (*stringValue)(&s.DB.User)},
+		{"db.password", "dbpass", "Database password", true, (*stringValue)(&s.DB.Password)},
+		{"db.sslmode", "dbssl", "Database ssl settings (disable, prefer, require)", false, (*stringValue)(&s.DB.SSLMode)},
+		{"db.query_timeout", "dbtimeout", "Time the queries of a request may take, e.g. 3s", false, (*durationValue)(&s.DB.QueryTimeout)},
+		{"db.migrate", "migrate", "Apply the pending database migrations on startup", false, (*boolValue)(&s.DB.Migrate)},
+
+		{"smtp.host", "smtp-host", "Mail server host", false, (*stringValue)(&s.SMTP.Host)},
+		{"smtp.port", "smtp-port", "Mail server port", false, (*intValue)(&s.SMTP.Port)},
+		{"smtp.username", "smtp-user", "Mail server user", false, (*stringValue)(&s.SMTP.Username)},
+		{"smtp.password", "smtp-pass", "Mail server password", true, (*stringValue)(&s.SMTP.Password)},
+		{"smtp.encryption", "smtp-encryption", "Mail server encryption (none, ssl, starttls)", false, (*stringValue)(&s.SMTP.Encryption)},
+		{"smtp.from", "smtp-from", "Sender of the emails", false, (*stringValue)(&s.SMTP.From)},
+
+		{"session.store", "session-store", "Where sessions are kept (memory, postgres, file)", false, (*stringValue)(&s.Session.Store)},
+		{"session.dir", "session-dir", "Directory of the file session store", false, (*stringValue)(&s.Session.Dir)},
+		{"session.lifetime", "session-lifetime", "How long sessions last, e.g. 24h", false, (*durationValue)(&s.Session.Lifetime)},
+		{"session.idle_timeout", "session-idle", "How long sessions last without a request, 0 for no limit", false, (*durationValue)(&s.Session.IdleTimeout)},
+		{"session.admin_idle_timeout", "session-admin-idle", "How long staff stay signed in without a request", false, (*durationValue)(&s.Session.AdminIdleTimeout)},
+		{"session.cookie_name", "session-cookie", "Name of the session cookie", false, (*stringValue)(&s.Session.CookieName)},
+
+		{"payments.provider", "payments", "Payment provider (fake, stripe)", false, (*stringValue)(&s.Payments.Provider)},
+		{"payments.key", "payments-key", "Secret API key of the payment provider", true, (*stringValue)(&s.Payments.Key)},
+		{"payments.public_key", "payments-public-key", "Publishable key of the payment provider", false, (*stringValue)(&s.Payments.PublicKey)},
+		{"payments.webhook_secret", "payments-webhook-secret", "Signing secret of the payment webhooks", true, (*stringValue)(&s.Payments.WebhookSecret)},
+		{"payments.deposit", "deposit", "Percent of the price taken as a deposit when booking, 0 for none", false, (*intValue)(&s.Payments.DepositPercent)},
+
+		{"features.waitlist", "waitlist", "Offer the waitlist when no room is available", false, (*boolValue)(&s.Features.Waitlist)},
+		{"features.promotions", "promotions", "Accept promo codes when booking", false, (*boolValue)(&s.Features.Promotions)},
+
+		{"metrics.token", "metrics-token", "Bearer token giving access to /metrics", true, (*stringValue)(&s.Metrics.Token)},
+		{"metrics.allow", "metrics-allow", "Addresses and networks allowed to read /metrics without the token", false, (*stringValue)(&s.Metrics.Allow)},
+
+		{"log.level", "log-level", "Least important messages logged (debug, info, warn, error)", false, (*stringValue)(&s.Log.Level)},
+		{"log.format", "log-format", "Format of the logs (text, json)", false, (*stringValue)(&s.Log.Format)},
+	}
+}
+
+// Load returns the settings given by the command line arguments args, the environment and the config file,
+// over the defaults. Flags take precedence over environment variables, which take precedence over the file.
+// The file is given by the -config flag or the BOOKINGS_CONFIG variable and is read as TOML when it ends in
+// .toml, YAML otherwise. getenv is usually os.LookupEnv.
+func Load(args []string, getenv func(string) (string, bool)) (Settings, error) {
+	return Parse(flag.NewFlagSet("bookings", flag.ContinueOnError), args, getenv)
+}
+
+// Parse is Load with the flags of the settings added to fs, which may hold flags of its own, such as those of
+// a command. The arguments left after the flags are in fs.Args().
+func Parse(fs *flag.FlagSet, args []string, getenv func(string) (string, bool)) (Settings, error) {
+	s := Defaults()
+	list := s.settings()
+
+	configFile := fs.String("config", "", "Config file (YAML or TOML), also "+EnvPrefix+"CONFIG")
+	given := make(map[string]*flagValue)
+	for _, st := range list {
+		v := &flagValue{isBool: isBool(st.value)}
+		given[st.flag] = v
+		fs.Var(v, st.flag, fmt.Sprintf("%s (%s)", st.usage, st.env()))
+		fs.Lookup(st.flag).DefValue = st.value.String()
+	}
+	err := fs.Parse(args)
+	if err != nil {
+		return s, err
+	}
+
+	if *configFile == "" {
+		*configFile, _ = getenv(EnvPrefix + "CONFIG")
+	}
+	if *configFile != "" {
+		err = s.readFile(*configFile)
+		if err != nil {
+			return s, err
+		}
+	}
+
+	for _, st := range list {
+		v, ok := getenv(st.env())
+		if !ok {
+			continue
+		}
+		if err := st.value.Set(v); err != nil {
+			return s, fmt.Errorf("%s: %w", st.env(), err)
+		}
+	}
+
+	// only the flags given on the command line, the others would put back the defaults
+	fs.Visit(func(f *flag.Flag) {
+		if err != nil || f.Name == "config" {
+			return
+		}
+		for _, st := range list {
+			if st.flag == f.Name {
+				if e := st.value.Set(given[f.Name].value); e != nil {
+					err = fmt.Errorf("-%s: %w", f.Name, e)
+				}
+			}
+		}
+	})
+	if err != nil {
+		return s, err
+	}
+
+	return s, s.Validate()
+}
+
+// readFile sets the settings found in the config file name.
+func (s *Settings) readFile(name string) error {
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var values map[string]string
+	if strings.EqualFold(filepath.Ext(name), ".toml") {
+		values, err = parseTOML(f)
+	} else {
+		values, err = parseYAML(f)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+
+	list := s.settings()
+	for key, v := range values {
+		found := false
+		for _, st := range list {
+			if st.key == key {
+				found = true
+				if err := st.value.Set(v); err != nil {
+					return fmt.Errorf("%s: %s: %w", name, key, err)
+				}
+			}
+		}
+		if !found {
+			return fmt.Errorf("%s: unknown setting %s", name, key)
+		}
+	}
+	return nil
+}
+
+// Validate checks the settings can be used, listing every problem found.
+func (s Settings) Validate() error {
+	var errs []error
+	add := func(format string, a ...interface{}) {
+		errs = append(errs, fmt.Errorf(format, a...))
+	}
+
+	if _, _, err := net.SplitHostPort(s.Addr); err != nil {
+		add("addr: %q is not a host:port address", s.Addr)
+	}
+	if s.ShutdownTimeout <= 0 {
+		add("shutdown_timeout must be more than zero")
+	}
+	if _, err := time.LoadLocation(s.Timezone); err != nil {
+		add("timezone: unknown time zone %q", s.Timezone)
+	}
+	if len(s.Currency) != 3 {
+		add("currency: %q is not a three letter currency code", s.Currency)
+	}
+	if s.SiteURL != "" {
+		if u, err := url.Parse(s.SiteURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			add("site_url: %q is not an http or https address", s.SiteURL)
+		}
+	}
+
+	if _, err := ParseNetworks(s.TrustedProxies); err != nil {
+		add("trusted_proxies: %v", err)
+	}
+	if s.RedirectHTTPS && s.TrustedProxies == "" {
+		add("https_redirect needs trusted_proxies, to tell the requests that came over HTTPS")
+	}
+	if (s.TLS.CertFile == "") != (s.TLS.KeyFile == "") {
+		add("tls.cert_file and tls.key_file are given together")
+	}
+	if s.TLS.CertFile != "" && s.TLS.Autocert != "" {
+		add("tls.autocert can't be used with tls.cert_file")
+	}
+	if s.TLS.Autocert != "" && s.TLS.CacheDir == "" {
+		add("tls.autocert needs tls.cache_dir")
+	}
+	if s.TLS.HTTPAddr != "" {
+		if !s.TLS.Enabled() {
+			add("tls.http_addr needs tls.cert_file or tls.autocert")
+		}
+		if _, _, err := net.SplitHostPort(s.TLS.HTTPAddr); err != nil {
+			add("tls.http_addr: %q is not a host:port address", s.TLS.HTTPAddr)
+		}
+	}
+
+	if s.DB.QueryTimeout <= 0 {
+		add("db.query_timeout must be more than zero")
+	}
+	if s.DB.Name == "" {
+		add("db.name is required (-dbname or %sDB_NAME)", EnvPrefix)
+	}
+	if s.DB.User == "" {
+		add("db.user is required (-dbuser or %sDB_USER)", EnvPrefix)
+	}
+	if s.DB.Port != "" {
+		if port, err := strconv.Atoi(s.DB.Port); err != nil || port < 1 || port > 65535 {
+			add("db.port: %q is not a port number", s.DB.Port)
+		}
+	}
+	switch s.DB.SSLMode {
+	case "disable", "allow", "prefer", "require", "verify-ca", "verify-full":
+	default:
+		add("db.sslmode: unknown mode %q", s.DB.SSLMode)
+	}
+
+	if s.SMTP.Port < 1 || s.SMTP.Port > 65535 {
+		add("smtp.port: %d is not a port number", s.SMTP.Port)
+	}
+	switch s.SMTP.Encryption {
+	case "none", "ssl", "starttls":
+	default:
+		add("smtp.encryption: unknown encryption %q, use none, ssl or starttls", s.SMTP.Encryption)
+	}
+
+	if s.Session.Lifetime <= 0 {
+		add("session.lifetime must be more than zero")
+	}
+	if s.Session.CookieName == "" {
+		add("session.cookie_name is required")
+	}
+	switch s.Session.Store {
+	case "memory", "postgres":
+	case "file":
+		if s.Session.Dir == "" {
+			add("the file session store needs session.dir")
+		}
+	default:
+		add("session.store: unknown store %q, use memory, postgres or file", s.Session.Store)
+	}
+	if s.Session.IdleTimeout < 0 {
+		add("session.idle_timeout can't be negative")
+	}
+	if s.Session.AdminIdleTimeout <= 0 {
+		add("session.admin_idle_timeout must be more than zero")
+	} else if s.Session.IdleTimeout > 0 && s.Session.AdminIdleTimeout > s.Session.IdleTimeout {
+		add("session.admin_idle_timeout must not be longer than session.idle_timeout")
+	}
+
+	switch s.Payments.Provider {
+	case "fake":
+	case "stripe":
+		if s.Payments.Key == "" || s.Payments.WebhookSecret == "" {
+			add("the stripe payment provider needs payments.key and payments.webhook_secret")
+		}
+	default:
+		add("payments.provider: unknown payment provider %q", s.Payments.Provider)
+	}
+	if s.Payments.DepositPercent < 0 || s.Payments.DepositPercent > 100 {
+		add("payments.deposit: %d is not a percentage", s.Payments.DepositPercent)
+	}
+
+	if _, err := s.Metrics.Networks(); err != nil {
+		add("metrics.allow: %v", err)
+	}
+	if _, err := logging.ParseLevel(s.Log.Level); err != nil {
+		add("log.level: %v", err)
+	}
+	if s.Log.Format != "text" && s.Log.Format != "json" {
+		add("log.format: %q is not text or json", s.Log.Format)
+	}
+
+	return errors.Join(errs...)
+}
+
+// LogValue logs the effective configuration, one attribute a setting, with passwords and keys hidden.
+func (s Settings) LogValue() slog.Value {
+	var attrs []slog.Attr
+	for _, st := range s.settings() {
+		v := st.value.String()
+		if st.secret && v != "" {
+			v = "********"
+		}
+		attrs = append(attrs, slog.String(st.key, v))
+	}
+	return slog.GroupValue(attrs...)
+}
+
+// flagValue keeps a flag as given until it is applied over the file and the environment.
+type flagValue struct {
+	value  string
+	isBool bool
+}
+
+func (v *flagValue) String() string     { return v.value }
+func (v *flagValue) Set(s string) error { v.value = s; return nil }
+func (v *flagValue) IsBoolFlag() bool   { return v.isBool }
+
+func isBool(v flag.Value) bool {
+	_, ok := v.(*boolValue)
+	return ok
+}
+
+type stringValue string
+
+func (v *stringValue) String() string     { return string(*v) }
+func (v *stringValue) Set(s string) error { *v = stringValue(s); return nil }
+
+type boolValue bool
+
+func (v *boolValue) String() string { return strconv.FormatBool(bool(*v)) }
+func (v *boolValue) Set(s string) error {
+	b, err := strconv.ParseBool(s)
+	if err != nil {
+		return fmt.Errorf("%q is not true or false", s)
+	}
+	*v = boolValue(b)
+	return nil
+}
+
+type intValue int
+
+func (v *intValue) String() string { return strconv.Itoa(int(*v)) }
+func (v *intValue) Set(s string) error {
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return fmt.Errorf("%q is not a whole number", s)
+	}
+	*v = intValue(n)
+	return nil
+}
+
+type durationValue time.Duration
+
+func (v *durationValue) String() string { return time.Duration(*v).String() }
+func (v *durationValue) Set(s string) error {
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return fmt.Errorf("%q is not a duration such as 30m or 24h", s)
+	}
+	*v = durationValue(d)
+	return nil
+}
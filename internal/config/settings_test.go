@@ -0,0 +1,185 @@
+package config
+
+import (
+	"bytes"
+	"flag"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// env returns a getenv function reading the variables of vars.
+func env(vars map[string]string) func(string) (string, bool) {
+	return func(key string) (string, bool) {
+		v, ok := vars[key]
+		return v, ok
+	}
+}
+
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+const yamlFile = `# bookings
+addr: "127.0.0.1:9000"
+timezone: UTC
+db:
+  name: bookings   # the main database
+  user: file-user
+  password: 'p#ss word'
+smtp:
+  port: 587
+session:
+  lifetime: 12h
+features:
+  waitlist: false
+`
+
+func TestLoadPrecedence(t *testing.T) {
+	path := writeFile(t, "bookings.yaml", yamlFile)
+
+	s, err := Load([]string{"-config", path, "-dbuser=flag-user", "-cache=false"}, env(map[string]string{
+		"BOOKINGS_DB_USER": "env-user",
+		"BOOKINGS_DB_HOST": "db.internal",
+		"BOOKINGS_ADDR":    ":9090",
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		got      interface{}
+		expected interface{}
+	}{
+		{"default", s.DB.SSLMode, "disable"},
+		{"file", s.DB.Name, "bookings"},
+		{"file-quoted", s.DB.Password, "p#ss word"},
+		{"file-int", s.SMTP.Port, 587},
+		{"file-duration", s.Session.Lifetime, 12 * time.Hour},
+		{"file-bool", s.Features.Waitlist, false},
+		{"env", s.DB.Host, "db.internal"},
+		{"env-over-file", s.Addr, ":9090"},
+		{"flag-over-env", s.DB.User, "flag-user"},
+		{"bool-flag", s.UseCache, false},
+		{"not-given", s.Production, true},
+	}
+	for _, e := range tests {
+		if e.got != e.expected {
+			t.Errorf("%s: expected %v, got %v", e.name, e.expected, e.got)
+		}
+	}
+}
+
+func TestLoadTOML(t *testing.T) {
+	path := writeFile(t, "bookings.toml", `
+production = false
+
+[db]
+name = "bookings"
+user = "user" # comment
+
+[payments]
+deposit = 30
+`)
+
+	s, err := Load(nil, env(map[string]string{"BOOKINGS_CONFIG": path}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Production || s.DB.Name != "bookings" || s.DB.User != "user" || s.Payments.DepositPercent != 30 {
+		t.Errorf("settings not read from the TOML file: %+v", s)
+	}
+}
+
+func TestParseCommand(t *testing.T) {
+	fs := flag.NewFlagSet("user create", flag.ContinueOnError)
+	email := fs.String("email", "", "Email")
+
+	s, err := Parse(fs, []string{"-email=owner@example.com", "-dbname=b", "-dbuser=u", "extra"}, env(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *email != "owner@example.com" {
+		t.Errorf("expected the command flag to be set, got %q", *email)
+	}
+	if s.DB.Name != "b" || s.DB.User != "u" {
+		t.Errorf("expected the settings flags to be set, got %+v", s.DB)
+	}
+	if args := fs.Args(); len(args) != 1 || args[0] != "extra" {
+		t.Errorf("expected the remaining argument extra, got %v", args)
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		file     string
+		vars     map[string]string
+		expected string
+	}{
+		{"missing-db", nil, "", nil, "db.name is required"},
+		{"bad-flag", []string{"-dbname=b", "-dbuser=u", "-deposit=half"}, "", nil, `-deposit: "half" is not a whole number`},
+		{"bad-env", []string{"-dbname=b", "-dbuser=u"}, "", map[string]string{"BOOKINGS_PRODUCTION": "maybe"}, "BOOKINGS_PRODUCTION"},
+		{"unknown-key", nil, "db:\n  nmae: bookings\n", nil, "unknown setting db.nmae"},
+		{"bad-yaml", nil, "db:\n  - bookings\n", nil, "line 2"},
+		{"invalid", []string{"-dbname=b", "-dbuser=u", "-timezone=Mars/Olympus", "-deposit=150", "-payments=stripe"}, "", nil, "unknown time zone"},
+		{"log-level", []string{"-dbname=b", "-dbuser=u", "-log-level=loud"}, "", nil, "log.level"},
+		{"query-timeout", []string{"-dbname=b", "-dbuser=u", "-dbtimeout=0s"}, "", nil, "db.query_timeout"},
+		{"tls-key", []string{"-dbname=b", "-dbuser=u", "-tls-cert=cert.pem"}, "", nil, "tls.key_file"},
+		{"http-addr", []string{"-dbname=b", "-dbuser=u", "-http-addr=:80"}, "", nil, "tls.http_addr needs"},
+		{"https-redirect", []string{"-dbname=b", "-dbuser=u", "-https-redirect"}, "", nil, "https_redirect needs trusted_proxies"},
+		{"trusted-proxies", []string{"-dbname=b", "-dbuser=u", "-trusted-proxies=proxy"}, "", nil, "trusted_proxies"},
+		{"site-url", []string{"-dbname=b", "-dbuser=u", "-site-url=bookings.example.com"}, "", nil, "site_url"},
+		{"session-store", []string{"-dbname=b", "-dbuser=u", "-session-store=bolt"}, "", nil, "session.store"},
+		{"admin-idle", []string{"-dbname=b", "-dbuser=u", "-session-idle=10m", "-session-admin-idle=1h"}, "", nil, "session.admin_idle_timeout"},
+	}
+
+	for _, e := range tests {
+		args := e.args
+		if e.file != "" {
+			args = append(args, "-config", writeFile(t, "bookings.yml", e.file))
+		}
+		_, err := Load(args, env(e.vars))
+		if err == nil || !strings.Contains(err.Error(), e.expected) {
+			t.Errorf("%s: expected an error with %q, got %v", e.name, e.expected, err)
+		}
+	}
+
+	// every problem is listed
+	_, err := Load([]string{"-dbname=b", "-dbuser=u", "-deposit=150", "-payments=stripe"}, env(nil))
+	for _, want := range []string{"payments.deposit", "payments.key"} {
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("expected an error for %s, got %v", want, err)
+		}
+	}
+}
+
+func TestLogValue(t *testing.T) {
+	s := Defaults()
+	s.DB.User = "bookings"
+	s.DB.Password = "hunter2"
+	s.Payments.Key = "sk_live_123"
+
+	var buf bytes.Buffer
+	slog.New(slog.NewJSONHandler(&buf, nil)).Info("configuration", "settings", s)
+	out := buf.String()
+
+	if strings.Contains(out, "hunter2") || strings.Contains(out, "sk_live_123") {
+		t.Errorf("secrets logged:\n%s", out)
+	}
+	for _, want := range []string{`"db.user":"bookings"`, `"db.password":"********"`, `"smtp.password":""`} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected %s in the configuration:\n%s", want, out)
+		}
+	}
+}
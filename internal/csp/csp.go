@@ -0,0 +1,64 @@
+// Package csp is the content security policy of the pages. Only the scripts carrying the nonce of their request,
+// and the ones they load, are run, so a script injected into a page is not, even one from a CDN the pages use.
+package csp
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"strings"
+)
+
+// nonceKey is the context key of the nonce of a request.
+type nonceKey struct{}
+
+// NewNonce returns a nonce for the scripts of a request.
+func NewNonce() (string, error) {
+	b := make([]byte, 16)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(b), nil
+}
+
+// WithNonce returns ctx carrying the nonce of its request.
+func WithNonce(ctx context.Context, nonce string) context.Context {
+	return context.WithValue(ctx, nonceKey{}, nonce)
+}
+
+// Nonce returns the nonce carried by ctx, or "".
+func Nonce(ctx context.Context) string {
+	nonce, _ := ctx.Value(nonceKey{}).(string)
+	return nonce
+}
+
+// scripts are the third-party scripts of the pages, at the exact versions they use. Browsers supporting
+// 'strict-dynamic' ignore them and go by the nonce alone; older ones run only these files.
+var scripts = []string{
+	"https://code.jquery.com/jquery-3.5.1.slim.min.js",
+	"https://cdn.jsdelivr.net/npm/bootstrap@4.6.0/dist/js/bootstrap.bundle.min.js",
+	"https://cdn.jsdelivr.net/npm/vanillajs-datepicker@1.1.2/dist/js/datepicker-full.min.js",
+	"https://cdn.jsdelivr.net/npm/notie@4.3.1/dist/notie.min.js",
+	"https://cdn.jsdelivr.net/npm/sweetalert2@10.15.5/dist/sweetalert2.min.js",
+	"https://js.stripe.com/v3/",
+}
+
+// Policy returns the Content-Security-Policy header of a page served with nonce. Styles may be inline, the
+// templates and the libraries they use have style attributes.
+func Policy(nonce string) string {
+	directives := []string{
+		"default-src 'self'",
+		"script-src 'nonce-" + nonce + "' 'strict-dynamic' 'self' " + strings.Join(scripts, " "),
+		"style-src 'self' 'unsafe-inline' https://cdn.jsdelivr.net",
+		"img-src 'self' data:",
+		"font-src 'self' data:",
+		"connect-src 'self' https://api.stripe.com",
+		"frame-src https://js.stripe.com https://hooks.stripe.com",
+		"object-src 'none'",
+		"base-uri 'self'",
+		"form-action 'self'",
+		"frame-ancestors 'none'",
+	}
+	return strings.Join(directives, "; ")
+}
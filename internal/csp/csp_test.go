@@ -0,0 +1,50 @@
+package csp
+
+import (
+	"context"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestNonce(t *testing.T) {
+	a, err := NewNonce()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := NewNonce()
+	if a == "" || a == b {
+		t.Errorf("expected different nonces, got %q and %q", a, b)
+	}
+
+	ctx := WithNonce(context.Background(), a)
+	if got := Nonce(ctx); got != a {
+		t.Errorf("expected the nonce of the context, got %q", got)
+	}
+	if got := Nonce(context.Background()); got != "" {
+		t.Errorf("expected no nonce, got %q", got)
+	}
+}
+
+func TestPolicy(t *testing.T) {
+	policy := Policy("abc")
+	for _, want := range []string{"script-src 'nonce-abc' 'strict-dynamic' ", "frame-ancestors 'none'", "object-src 'none'"} {
+		if !strings.Contains(policy, want) {
+			t.Errorf("expected %q in the policy %q", want, policy)
+		}
+	}
+	for _, directive := range strings.Split(policy, "; ") {
+		if !strings.HasPrefix(directive, "script-src") {
+			continue
+		}
+		if strings.Contains(directive, "unsafe-inline") {
+			t.Errorf("expected inline scripts without the nonce refused, got %q", directive)
+		}
+		// a whole host would let anything it serves run in browsers without 'strict-dynamic'
+		for _, source := range strings.Fields(directive)[1:] {
+			if u, err := url.Parse(source); err == nil && u.Host != "" && (u.Path == "" || u.Path == "/") {
+				t.Errorf("expected the scripts of %s pinned to a path, got %q", u.Host, source)
+			}
+		}
+	}
+}
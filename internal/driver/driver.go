@@ -40,7 +40,7 @@ func ConnectSQL(dsn string) (*DB, error) {
 	// Create a new database connection.
 	d, err := NewDatabase(dsn)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
 
 	// Set connection pool settings.
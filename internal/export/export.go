@@ -0,0 +1,150 @@
+package export
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/GitEagleY/BookingsWebApp/internal/models"
+)
+
+// Columns is the header row of a reservations export.
+var Columns = []string{"ID", "First Name", "Last Name", "Email", "Phone", "Room", "Arrival", "Departure", "Nights", "Status", "Created",
+	"Guests", "Amount", "Discount", "Fees", "Taxes", "Total", "Currency"}
+
+// ErrUnknownFormat is returned by NewWriter for formats other than csv and xlsx.
+var ErrUnknownFormat = errors.New("unknown export format")
+
+// Writer writes reservations to an export file one row at a time.
+type Writer interface {
+	Write(res models.Reservation) error
+	Close() error
+}
+
+// NewWriter returns a Writer for the format ("csv" or "xlsx") and writes the header row.
+func NewWriter(format string, w io.Writer) (Writer, error) {
+	switch format {
+	case "csv":
+		return newCSVWriter(w)
+	case "xlsx":
+		return newXLSXWriter(w)
+	default:
+		return nil, ErrUnknownFormat
+	}
+}
+
+// ContentType returns the MIME type of an export format.
+func ContentType(format string) string {
+	if format == "xlsx" {
+		return "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	}
+	return "text/csv; charset=utf-8"
+}
+
+// Nights returns the number of nights of a stay.
+func Nights(res models.Reservation) int {
+	return res.Nights()
+}
+
+// Status returns the human readable status of a reservation.
+func Status(res models.Reservation) string {
+	if res.Processed == 1 {
+		return "processed"
+	}
+	return "new"
+}
+
+// row returns the export columns of a reservation as text.
+func row(res models.Reservation) []string {
+	return []string{
+		strconv.Itoa(res.ID),
+		res.FirstName,
+		res.LastName,
+		res.Email,
+		res.Phone,
+		res.Room.RoomName,
+		res.StartDate.Format("2006-01-02"),
+		res.EndDate.Format("2006-01-02"),
+		strconv.Itoa(Nights(res)),
+		Status(res),
+		res.CreatedAt.Format("2006-01-02 15:04"),
+		strconv.Itoa(res.Guests),
+		money(res.Amount),
+		money(res.Discount),
+		money(res.FeeTotal()),
+		money(res.TaxTotal()),
+		money(res.Total()),
+		strings.ToUpper(res.Currency),
+	}
+}
+
+// money formats an amount in cents as a decimal number, e.g. 8900 as 89.00.
+func money(cents int) string {
+	sign := ""
+	if cents < 0 {
+		sign = "-"
+		cents = -cents
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, cents/100, cents%100)
+}
+
+// numericColumns are the columns written as numbers rather than text in spreadsheets.
+var numericColumns = map[int]bool{0: true, 8: true, 11: true, 12: true, 13: true, 14: true, 15: true, 16: true}
+
+// formulaPrefixes start the cells spreadsheets run as formulas when they open a CSV file.
+const formulaPrefixes = "=+-@\t\r"
+
+// EscapeFormula prefixes a text cell that would be run as a formula with ', so a guest's name such as
+// =HYPERLINK(...) is shown as text. The ' is not shown.
+func EscapeFormula(s string) string {
+	if s != "" && strings.ContainsRune(formulaPrefixes, rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
+
+// UnescapeFormula removes the ' added by EscapeFormula, so an export imports as it was.
+func UnescapeFormula(s string) string {
+	if len(s) > 1 && s[0] == '\'' && strings.ContainsRune(formulaPrefixes, rune(s[1])) {
+		return s[1:]
+	}
+	return s
+}
+
+// csvWriter writes reservations as comma separated values. The text cells are escaped with EscapeFormula, the
+// xlsx cells are typed and need no escaping.
+type csvWriter struct {
+	w *csv.Writer
+}
+
+func newCSVWriter(w io.Writer) (*csvWriter, error) {
+	cw := &csvWriter{w: csv.NewWriter(w)}
+	if err := cw.w.Write(Columns); err != nil {
+		return nil, err
+	}
+	return cw, nil
+}
+
+// Write writes one reservation, flushing so rows reach the client as they are produced.
+func (cw *csvWriter) Write(res models.Reservation) error {
+	cells := row(res)
+	for i := range cells {
+		if !numericColumns[i] {
+			cells[i] = EscapeFormula(cells[i])
+		}
+	}
+	if err := cw.w.Write(cells); err != nil {
+		return err
+	}
+	cw.w.Flush()
+	return cw.w.Error()
+}
+
+// Close flushes any buffered rows.
+func (cw *csvWriter) Close() error {
+	cw.w.Flush()
+	return cw.w.Error()
+}
@@ -0,0 +1,143 @@
+package export
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/GitEagleY/BookingsWebApp/internal/models"
+)
+
+var testReservation = models.Reservation{
+	ID:        7,
+	FirstName: "John",
+	LastName:  "Smith & Sons",
+	Email:     "john@smith.com",
+	Phone:     "555-555-5555",
+	StartDate: time.Date(2050, 1, 1, 0, 0, 0, 0, time.UTC),
+	EndDate:   time.Date(2050, 1, 4, 0, 0, 0, 0, time.UTC),
+	CreatedAt: time.Date(2049, 12, 1, 10, 30, 0, 0, time.UTC),
+	Room:      models.Room{ID: 1, RoomName: "Generals Quarters"},
+	Processed: 1,
+	Guests:    2,
+	Amount:    30000,
+	Currency:  "usd",
+	Discount:  3000,
+	Charges: []models.Charge{
+		{Kind: models.TaxRuleFee, Description: "Cleaning fee", Amount: 3000},
+		{Kind: models.TaxRuleTax, Description: "Tourist tax", Amount: 1500},
+	},
+}
+
+func TestCSVWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := NewWriter("csv", &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = w.Write(testReservation); err != nil {
+		t.Fatal(err)
+	}
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "ID,First Name,Last Name,Email,Phone,Room,Arrival,Departure,Nights,Status,Created,Guests,Amount,Discount,Fees,Taxes,Total,Currency\n" +
+		"7,John,Smith & Sons,john@smith.com,555-555-5555,Generals Quarters,2050-01-01,2050-01-04,3,processed,2049-12-01 10:30,2,300.00,30.00,30.00,15.00,315.00,USD\n"
+	if buf.String() != expected {
+		t.Errorf("unexpected csv output:\n%s", buf.String())
+	}
+}
+
+func TestCSVWriterEscapesFormulas(t *testing.T) {
+	res := testReservation
+	res.FirstName = "=HYPERLINK(\"http://evil.example\",\"click\")"
+	res.LastName = "@SUM(A1)"
+	res.Phone = "+1 555 5555"
+	res.Email = "-2+3@evil.example"
+
+	var buf bytes.Buffer
+	w, _ := NewWriter("csv", &buf)
+	_ = w.Write(res)
+	_ = w.Close()
+
+	rows, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, want := range map[int]string{1: "'" + res.FirstName, 2: "'@SUM(A1)", 3: "'-2+3@evil.example", 4: "'+1 555 5555"} {
+		if rows[1][i] != want {
+			t.Errorf("%s: expected %q, got %q", Columns[i], want, rows[1][i])
+		}
+		if got := UnescapeFormula(rows[1][i]); got != want[1:] {
+			t.Errorf("%s: expected %q unescaped, got %q", Columns[i], want[1:], got)
+		}
+	}
+
+	for _, s := range []string{"John", "'quoted'", "", "'"} {
+		if got := UnescapeFormula(EscapeFormula(s)); got != s {
+			t.Errorf("expected %q back, got %q", s, got)
+		}
+	}
+}
+
+func TestXLSXWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := NewWriter("xlsx", &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = w.Write(testReservation); err != nil {
+		t.Fatal(err)
+	}
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal("export is not a valid zip archive:", err)
+	}
+
+	var sheet string
+	for _, f := range zr.File {
+		if f.Name == "xl/worksheets/sheet1.xml" {
+			rc, _ := f.Open()
+			b, _ := io.ReadAll(rc)
+			rc.Close()
+			sheet = string(b)
+		}
+	}
+
+	for _, want := range []string{
+		`<c r="A2" s="0"><v>7</v></c>`,
+		`Smith &amp; Sons`,
+		`<c r="I2" s="0"><v>3</v></c>`,
+		`<c r="Q2" s="0"><v>315.00</v></c>`,
+		`<c r="R2" s="0" t="inlineStr"><is><t xml:space="preserve">USD</t></is></c>`,
+		`</sheetData></worksheet>`,
+	} {
+		if !strings.Contains(sheet, want) {
+			t.Errorf("sheet does not contain %s", want)
+		}
+	}
+}
+
+func TestUnknownFormat(t *testing.T) {
+	_, err := NewWriter("pdf", io.Discard)
+	if err != ErrUnknownFormat {
+		t.Errorf("expected ErrUnknownFormat, got %v", err)
+	}
+}
+
+func TestColumnName(t *testing.T) {
+	for i, want := range map[int]string{0: "A", 10: "K", 25: "Z", 26: "AA", 27: "AB", 701: "ZZ", 702: "AAA"} {
+		if got := columnName(i); got != want {
+			t.Errorf("columnName(%d) = %s, want %s", i, got, want)
+		}
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"net/url"
 	"strings"
+	"unicode/utf8"
 
 	"github.com/asaskevich/govalidator"
 )
@@ -57,6 +58,16 @@ func (f *Form) MinLength(field string, length int) bool {
 	return true
 }
 
+// MaxLength checks that a string form field is no longer than length characters.
+func (f *Form) MaxLength(field string, length int) bool {
+	x := f.Get(field)
+	if utf8.RuneCountInString(x) > length {
+		f.Errors.Add(field, fmt.Sprintf("This field must be at most %d characters long", length))
+		return false
+	}
+	return true
+}
+
 // IsEmail checks if a form field contains a valid email address using the govalidator package.
 func (f *Form) IsEmail(field string) {
 	if !govalidator.IsEmail(f.Get(field)) {
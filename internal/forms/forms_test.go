@@ -94,6 +94,39 @@ func TestForm_MinLenghth(t *testing.T) {
 
 }
 
+func TestForm_MaxLength(t *testing.T) {
+	postedData := url.Values{}
+	form := New(postedData)
+
+	form.MaxLength("a", 10)
+	if !form.Valid() {
+		t.Error("form shows max length exceeded for non-existent field")
+	}
+
+	postedData = url.Values{}
+	postedData.Add("afield", "avalue")
+	form = New(postedData)
+
+	form.MaxLength("afield", 3)
+	if form.Valid() {
+		t.Error("shows max length of 3 met when data is longer")
+	}
+
+	isError := form.Errors.Get("afield")
+	if isError == "" {
+		t.Error("should have error but did not get one")
+	}
+
+	postedData = url.Values{}
+	postedData.Add("b_field", "héllo")
+	form = New(postedData)
+
+	form.MaxLength("b_field", 5)
+	if !form.Valid() {
+		t.Error("counts bytes instead of characters")
+	}
+}
+
 func TestForm_IsEmail(t *testing.T) {
 	r := httptest.NewRequest("POST", "/something", nil)
 
@@ -115,3 +148,39 @@ func TestForm_IsEmail(t *testing.T) {
 		t.Error("have error when shouldt")
 	}
 }
+
+func TestCheckPassword(t *testing.T) {
+	tests := []struct {
+		password string
+		valid    bool
+	}{
+		{"Sh0rt!", false},
+		{"alllowercaseletters", false},
+		{"Lowerandupper", false},
+		{"Lower4ndUpper", true},
+		{"lower-and-digits-1", true},
+		{"correct horse battery staple", true},
+	}
+
+	for _, e := range tests {
+		err := CheckPassword(e.password)
+		if e.valid && err != nil {
+			t.Errorf("%q: expected the password to be accepted, got %v", e.password, err)
+		}
+		if !e.valid && err == nil {
+			t.Errorf("%q: expected the password to be refused", e.password)
+		}
+	}
+}
+
+func TestForm_StrongPassword(t *testing.T) {
+	form := New(url.Values{"password": {"password"}})
+	if form.StrongPassword("password") || form.Errors.Get("password") == "" {
+		t.Error("expected a weak password to be refused with a message")
+	}
+
+	form = New(url.Values{"password": {"Lower4ndUpper"}})
+	if !form.StrongPassword("password") || !form.Valid() {
+		t.Error("expected a strong password to be accepted")
+	}
+}
@@ -0,0 +1,51 @@
+package forms
+
+import (
+	"fmt"
+	"unicode"
+	"unicode/utf8"
+)
+
+// MinPasswordLength is the shortest password accepted for staff accounts.
+const MinPasswordLength = 12
+
+// CheckPassword returns why a staff password is too weak, or nil. A password needs MinPasswordLength characters
+// and three of lower case letters, upper case letters, digits and symbols, unless it is a passphrase of twice
+// the length.
+func CheckPassword(password string) error {
+	n := utf8.RuneCountInString(password)
+	if n < MinPasswordLength {
+		return fmt.Errorf("the password must be at least %d characters long", MinPasswordLength)
+	}
+	if n >= 2*MinPasswordLength {
+		return nil
+	}
+
+	var lower, upper, digit, symbol int
+	for _, c := range password {
+		switch {
+		case unicode.IsLower(c):
+			lower = 1
+		case unicode.IsUpper(c):
+			upper = 1
+		case unicode.IsDigit(c):
+			digit = 1
+		default:
+			symbol = 1
+		}
+	}
+	if lower+upper+digit+symbol < 3 {
+		return fmt.Errorf("the password must mix three of lower case letters, upper case letters, digits and symbols, or be a longer passphrase")
+	}
+	return nil
+}
+
+// StrongPassword checks that a password form field passes CheckPassword.
+func (f *Form) StrongPassword(field string) bool {
+	err := CheckPassword(f.Get(field))
+	if err != nil {
+		f.Errors.Add(field, "Choose a stronger password, "+err.Error())
+		return false
+	}
+	return true
+}
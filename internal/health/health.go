@@ -0,0 +1,74 @@
+// Package health serves the liveness and readiness checks of the application.
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// checkTimeout is how long a readiness check may take before it counts as failed.
+const checkTimeout = 2 * time.Second
+
+// Check is one thing the application needs to serve requests, such as the database.
+type Check struct {
+	Name string
+	Run  func(ctx context.Context) error
+}
+
+// Result is the outcome of the checks, as served by Ready.
+type Result struct {
+	Status string            `json:"status"` // ok or unavailable
+	Checks map[string]string `json:"checks"` // ok or the error, by check name
+}
+
+// Live answers that the process is up and serving requests, without checking anything else, so a failing
+// database doesn't get the application restarted.
+func Live(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write([]byte("ok\n"))
+}
+
+// Ready runs the checks in parallel and answers 200 when they all pass, 503 otherwise, with the result of
+// each check as JSON.
+func Ready(checks ...Check) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		res := Run(r.Context(), checks...)
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		if res.Status != "ok" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		json.NewEncoder(w).Encode(res)
+	}
+}
+
+// Run runs the checks in parallel, each within checkTimeout.
+func Run(ctx context.Context, checks ...Check) Result {
+	ctx, cancel := context.WithTimeout(ctx, checkTimeout)
+	defer cancel()
+
+	type outcome struct {
+		name string
+		err  error
+	}
+	outcomes := make(chan outcome, len(checks))
+	for _, c := range checks {
+		go func(c Check) {
+			outcomes <- outcome{c.Name, c.Run(ctx)}
+		}(c)
+	}
+
+	res := Result{Status: "ok", Checks: make(map[string]string)}
+	for range checks {
+		o := <-outcomes
+		res.Checks[o.name] = "ok"
+		if o.err != nil {
+			res.Status = "unavailable"
+			res.Checks[o.name] = o.err.Error()
+		}
+	}
+	return res
+}
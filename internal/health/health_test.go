@@ -0,0 +1,66 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+var ok = Check{"database", func(ctx context.Context) error { return nil }}
+
+func TestReady(t *testing.T) {
+	tests := []struct {
+		name           string
+		checks         []Check
+		expectedStatus int
+		expectedChecks map[string]string
+	}{
+		{"all-ok", []Check{ok}, http.StatusOK, map[string]string{"database": "ok"}},
+		{"failing", []Check{ok, {"mail", func(ctx context.Context) error { return errors.New("worker stopped") }}},
+			http.StatusServiceUnavailable, map[string]string{"database": "ok", "mail": "worker stopped"}},
+		{"no-checks", nil, http.StatusOK, map[string]string{}},
+	}
+
+	for _, e := range tests {
+		rr := httptest.NewRecorder()
+		Ready(e.checks...)(rr, httptest.NewRequest("GET", "/readyz", nil))
+
+		if rr.Code != e.expectedStatus {
+			t.Errorf("%s: expected code %d, got %d", e.name, e.expectedStatus, rr.Code)
+		}
+		var res Result
+		if err := json.Unmarshal(rr.Body.Bytes(), &res); err != nil {
+			t.Fatalf("%s: invalid JSON %q", e.name, rr.Body.String())
+		}
+		for name, expected := range e.expectedChecks {
+			if res.Checks[name] != expected {
+				t.Errorf("%s: expected %s to be %q, got %q", e.name, name, expected, res.Checks[name])
+			}
+		}
+	}
+}
+
+func TestRunTimeout(t *testing.T) {
+	slow := Check{"database", func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	res := Run(ctx, slow)
+	if res.Status != "unavailable" {
+		t.Errorf("expected a check past its deadline to fail, got %+v", res)
+	}
+}
+
+func TestLive(t *testing.T) {
+	rr := httptest.NewRecorder()
+	Live(rr, httptest.NewRequest("GET", "/healthz", nil))
+	if rr.Code != http.StatusOK || rr.Body.String() != "ok\n" {
+		t.Errorf("unexpected liveness answer %d %q", rr.Code, rr.Body.String())
+	}
+}
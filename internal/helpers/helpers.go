@@ -1,11 +1,14 @@
 package helpers
 
 import (
-	"fmt"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
 	"net/http"
 	"runtime/debug"
 
 	"github.com/GitEagleY/BookingsWebApp/internal/config"
+	"github.com/GitEagleY/BookingsWebApp/internal/logging"
 )
 
 var app *config.AppConfig
@@ -15,19 +18,23 @@ func NewHelpers(a *config.AppConfig) {
 	app = a // Assign the provided AppConfig to the app variable for access in helper functions.
 }
 
+// Logger returns the logger of the request, carrying its id, or the application's.
+func Logger(r *http.Request) *slog.Logger {
+	return logging.FromContext(r.Context(), app.Logger)
+}
+
 // ClientError logs a client error and responds with the specified status.
-func ClientError(w http.ResponseWriter, status int) {
+func ClientError(w http.ResponseWriter, r *http.Request, status int) {
 	// Log the client error with the provided status.
-	app.InfoLog.Println("Client error with status of:", status)
+	Logger(r).Info("client error", "status", status)
 	// Respond with the appropriate status and message.
 	http.Error(w, http.StatusText(status), status)
 }
 
 // ServerError logs a server error, including a stack trace, and responds with a 500 status.
-func ServerError(w http.ResponseWriter, err error) {
-	// Generate a stack trace and log the server error.
-	trace := fmt.Sprintf("%s\n%s", err.Error(), debug.Stack())
-	app.ErrorLog.Println(trace)
+func ServerError(w http.ResponseWriter, r *http.Request, err error) {
+	// Log the server error with a stack trace.
+	Logger(r).Error("server error", "error", err, "stack", string(debug.Stack()))
 	// Respond with a 500 status and generic server error message.
 	http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 }
@@ -36,3 +43,12 @@ func IsAuthenticated(r *http.Request) bool {
 	exists := app.Session.Exists(r.Context(), "user_id")
 	return exists
 }
+
+// RandomToken returns a hex encoded random token made from n random bytes.
+func RandomToken(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
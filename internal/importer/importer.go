@@ -0,0 +1,258 @@
+package importer
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/GitEagleY/BookingsWebApp/internal/export"
+	"github.com/GitEagleY/BookingsWebApp/internal/models"
+	"github.com/asaskevich/govalidator"
+)
+
+// DateLayout is the format of the arrival and departure columns.
+const DateLayout = "2006-01-02"
+
+// Fields are the reservation fields an import can fill.
+var Fields = []string{"first_name", "last_name", "email", "phone", "room", "start_date", "end_date", "status"}
+
+// requiredFields must be mapped to a column of the file.
+var requiredFields = []string{"first_name", "last_name", "email", "room", "start_date", "end_date"}
+
+// Mapping maps reservation fields to the column headers of an import file.
+type Mapping map[string]string
+
+// DefaultMapping matches the header row of a reservations export, so exported files can be imported again.
+func DefaultMapping() Mapping {
+	return Mapping{
+		"first_name": "First Name",
+		"last_name":  "Last Name",
+		"email":      "Email",
+		"phone":      "Phone",
+		"room":       "Room",
+		"start_date": "Arrival",
+		"end_date":   "Departure",
+		"status":     "Status",
+	}
+}
+
+// ParseMapping overrides the default mapping with a list like "first_name=Guest,room=Room Name".
+func ParseMapping(s string) (Mapping, error) {
+	m := DefaultMapping()
+	if strings.TrimSpace(s) == "" {
+		return m, nil
+	}
+
+	for _, pair := range strings.Split(s, ",") {
+		field, column, ok := strings.Cut(pair, "=")
+		field = strings.TrimSpace(field)
+		if !ok || !isField(field) {
+			return nil, fmt.Errorf("invalid column mapping %q", pair)
+		}
+		m[field] = strings.TrimSpace(column)
+	}
+	return m, nil
+}
+
+func isField(field string) bool {
+	for _, f := range Fields {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
+
+// Checker is the part of the database the validation needs.
+type Checker interface {
+	AllRooms(ctx context.Context) ([]models.Room, error)
+	SearchAvailabilityByDatesByRoomID(ctx context.Context, start, end time.Time, roomID int) (bool, error)
+}
+
+// Row is one data row of an import file.
+type Row struct {
+	Line        int // line in the file, the header being line 1
+	Reservation models.Reservation
+	Errors      []string
+}
+
+// Valid reports whether the row can be imported.
+func (r Row) Valid() bool {
+	return len(r.Errors) == 0
+}
+
+// Report is the result of validating an import file.
+type Report struct {
+	Rows    []Row
+	Valid   int
+	Invalid int
+}
+
+// Reservations returns the reservations of all valid rows.
+func (r Report) Reservations() []models.Reservation {
+	var res []models.Reservation
+	for _, row := range r.Rows {
+		if row.Valid() {
+			res = append(res, row.Reservation)
+		}
+	}
+	return res
+}
+
+// ErrNoRows is returned for files without a header row.
+var ErrNoRows = errors.New("import file is empty")
+
+// Validate reads a CSV file and checks every row: the room must exist, the dates must parse and the stay
+// must overlap neither an existing restriction nor an earlier row of the same file. Errors in a row are
+// reported on the row; the returned error is only set when the file itself can't be read.
+func Validate(ctx context.Context, r io.Reader, mapping Mapping, db Checker) (Report, error) {
+	var report Report
+
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+
+	header, err := cr.Read()
+	if err == io.EOF {
+		return report, ErrNoRows
+	}
+	if err != nil {
+		return report, err
+	}
+
+	index := make(map[string]int)
+	for i, h := range header {
+		index[strings.ToLower(strings.TrimSpace(h))] = i
+	}
+
+	columns := make(map[string]int)
+	for _, field := range Fields {
+		if i, ok := index[strings.ToLower(mapping[field])]; ok && mapping[field] != "" {
+			columns[field] = i
+		}
+	}
+	for _, field := range requiredFields {
+		if _, ok := columns[field]; !ok {
+			return report, fmt.Errorf("column %q for %s not found in header", mapping[field], field)
+		}
+	}
+
+	rooms, err := db.AllRooms(ctx)
+	if err != nil {
+		return report, err
+	}
+	roomsByName := make(map[string]models.Room)
+	roomsByID := make(map[string]models.Room)
+	for _, room := range rooms {
+		roomsByName[strings.ToLower(room.RoomName)] = room
+		roomsByID[fmt.Sprint(room.ID)] = room
+	}
+
+	// stays already accepted from this file, per room
+	accepted := make(map[int][]models.Reservation)
+
+	for line := 2; ; line++ {
+		record, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return report, err
+		}
+
+		get := func(field string) string {
+			i, ok := columns[field]
+			if !ok || i >= len(record) {
+				return ""
+			}
+			// exported text cells are escaped against spreadsheet formulas
+			return export.UnescapeFormula(strings.TrimSpace(record[i]))
+		}
+
+		row := Row{Line: line}
+		res := models.Reservation{
+			FirstName: get("first_name"),
+			LastName:  get("last_name"),
+			Email:     get("email"),
+			Phone:     get("phone"),
+			Source:    models.SourceImport,
+		}
+
+		if res.FirstName == "" {
+			row.Errors = append(row.Errors, "first name is missing")
+		}
+		if res.LastName == "" {
+			row.Errors = append(row.Errors, "last name is missing")
+		}
+		if !govalidator.IsEmail(res.Email) {
+			row.Errors = append(row.Errors, fmt.Sprintf("invalid email address %q", res.Email))
+		}
+
+		switch strings.ToLower(get("status")) {
+		case "", "new":
+		case "processed":
+			res.Processed = 1
+		default:
+			row.Errors = append(row.Errors, fmt.Sprintf("unknown status %q", get("status")))
+		}
+
+		room, ok := roomsByID[get("room")]
+		if !ok {
+			room, ok = roomsByName[strings.ToLower(get("room"))]
+		}
+		if ok {
+			res.RoomID = room.ID
+			res.Room = room
+		} else {
+			row.Errors = append(row.Errors, fmt.Sprintf("room %q does not exist", get("room")))
+		}
+
+		datesOK := true
+		res.StartDate, err = time.Parse(DateLayout, get("start_date"))
+		if err != nil {
+			datesOK = false
+			row.Errors = append(row.Errors, fmt.Sprintf("invalid arrival date %q", get("start_date")))
+		}
+		res.EndDate, err = time.Parse(DateLayout, get("end_date"))
+		if err != nil {
+			datesOK = false
+			row.Errors = append(row.Errors, fmt.Sprintf("invalid departure date %q", get("end_date")))
+		}
+		if datesOK && !res.EndDate.After(res.StartDate) {
+			datesOK = false
+			row.Errors = append(row.Errors, "departure must be after arrival")
+		}
+
+		if datesOK && res.RoomID != 0 {
+			available, err := db.SearchAvailabilityByDatesByRoomID(ctx, res.StartDate, res.EndDate, res.RoomID)
+			if err != nil {
+				return report, err
+			}
+			if !available {
+				row.Errors = append(row.Errors, "room is already booked for these dates")
+			}
+
+			for _, other := range accepted[res.RoomID] {
+				if res.StartDate.Before(other.EndDate) && res.EndDate.After(other.StartDate) {
+					row.Errors = append(row.Errors, "overlaps an earlier row for the same room")
+					break
+				}
+			}
+		}
+
+		row.Reservation = res
+		if row.Valid() {
+			accepted[res.RoomID] = append(accepted[res.RoomID], res)
+			report.Valid++
+		} else {
+			report.Invalid++
+		}
+		report.Rows = append(report.Rows, row)
+	}
+
+	return report, nil
+}
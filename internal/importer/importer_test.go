@@ -0,0 +1,145 @@
+package importer
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/GitEagleY/BookingsWebApp/internal/export"
+	"github.com/GitEagleY/BookingsWebApp/internal/models"
+)
+
+// fakeDB has two rooms; room 2 is booked from 2050-02-01 to 2050-02-05.
+type fakeDB struct{}
+
+func (fakeDB) AllRooms(ctx context.Context) ([]models.Room, error) {
+	return []models.Room{{ID: 1, RoomName: "Generals Quarters"}, {ID: 2, RoomName: "Majors Suite"}}, nil
+}
+
+func (fakeDB) SearchAvailabilityByDatesByRoomID(ctx context.Context, start, end time.Time, roomID int) (bool, error) {
+	bookedFrom := time.Date(2050, 2, 1, 0, 0, 0, 0, time.UTC)
+	bookedTo := time.Date(2050, 2, 5, 0, 0, 0, 0, time.UTC)
+	if roomID == 2 && start.Before(bookedTo) && end.After(bookedFrom) {
+		return false, nil
+	}
+	return true, nil
+}
+
+func TestValidate(t *testing.T) {
+	file := `First Name,Last Name,Email,Phone,Room,Arrival,Departure,Status
+John,Smith,john@smith.com,555,Generals Quarters,2050-01-01,2050-01-03,processed
+Jane,Doe,jane@doe.com,,2,2050-01-01,2050-01-03,
+Bad,Room,bad@room.com,,Penthouse,2050-01-01,2050-01-03,new
+Bad,Dates,bad@dates.com,,1,01/02/2050,2050-01-03,new
+Late,Guest,late@guest.com,,Majors Suite,2050-02-03,2050-02-06,new
+Double,Booked,double@booked.com,,1,2050-01-02,2050-01-04,new
+Backwards,Stay,back@stay.com,,1,2050-03-05,2050-03-01,new
+No,Email,not-an-email,,1,2050-04-01,2050-04-02,maybe
+`
+	report, err := Validate(context.Background(), strings.NewReader(file), DefaultMapping(), fakeDB{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if report.Valid != 2 || report.Invalid != 6 {
+		t.Fatalf("expected 2 valid and 6 invalid rows, got %d and %d", report.Valid, report.Invalid)
+	}
+
+	expected := map[int]string{
+		4: `room "Penthouse" does not exist`,
+		5: `invalid arrival date "01/02/2050"`,
+		6: "room is already booked for these dates",
+		7: "overlaps an earlier row for the same room",
+		8: "departure must be after arrival",
+		9: `invalid email address "not-an-email"`,
+	}
+	for _, row := range report.Rows {
+		want, ok := expected[row.Line]
+		if !ok {
+			if !row.Valid() {
+				t.Errorf("line %d: unexpected errors %v", row.Line, row.Errors)
+			}
+			continue
+		}
+		if len(row.Errors) == 0 || row.Errors[0] != want {
+			t.Errorf("line %d: expected error %q, got %v", row.Line, want, row.Errors)
+		}
+	}
+
+	if len(report.Rows[7].Errors) != 2 {
+		t.Errorf("expected the unknown status to be reported too, got %v", report.Rows[7].Errors)
+	}
+
+	res := report.Reservations()
+	if len(res) != 2 {
+		t.Fatalf("expected 2 reservations, got %d", len(res))
+	}
+	if res[0].RoomID != 1 || res[0].Processed != 1 || res[1].RoomID != 2 || res[1].Processed != 0 {
+		t.Errorf("rooms or status not mapped: %+v", res)
+	}
+}
+
+func TestValidateMapping(t *testing.T) {
+	file := "guest,surname,mail,unit,in,out\nJohn,Smith,john@smith.com,1,2050-01-01,2050-01-03\n"
+
+	_, err := Validate(context.Background(), strings.NewReader(file), DefaultMapping(), fakeDB{})
+	if err == nil {
+		t.Error("expected an error for unmapped columns")
+	}
+
+	m, err := ParseMapping("first_name=Guest, last_name=Surname,email=mail,room=unit,start_date=in,end_date=out")
+	if err != nil {
+		t.Fatal(err)
+	}
+	report, err := Validate(context.Background(), strings.NewReader(file), m, fakeDB{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Valid != 1 {
+		t.Errorf("expected the row to be valid, got %v", report.Rows)
+	}
+
+	if _, err = ParseMapping("guest=First"); err == nil {
+		t.Error("expected an error for an unknown field")
+	}
+}
+
+func TestValidateExport(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := export.NewWriter("csv", &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = w.Write(models.Reservation{
+		FirstName: "=John",
+		LastName:  "Smith",
+		Email:     "john@smith.com",
+		StartDate: time.Date(2050, 1, 1, 0, 0, 0, 0, time.UTC),
+		EndDate:   time.Date(2050, 1, 4, 0, 0, 0, 0, time.UTC),
+		Room:      models.Room{ID: 1, RoomName: "Generals Quarters"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+
+	report, err := Validate(context.Background(), &buf, DefaultMapping(), fakeDB{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Valid != 1 {
+		t.Errorf("expected an export to import cleanly, got %v", report.Rows)
+	}
+	if res := report.Reservations(); len(res) != 1 || res[0].FirstName != "=John" {
+		t.Errorf("expected the escaped name imported as it was exported, got %v", res)
+	}
+}
+
+func TestValidateEmpty(t *testing.T) {
+	_, err := Validate(context.Background(), strings.NewReader(""), DefaultMapping(), fakeDB{})
+	if err != ErrNoRows {
+		t.Errorf("expected ErrNoRows, got %v", err)
+	}
+}
@@ -0,0 +1,167 @@
+// Package invoice builds the invoice of a reservation and renders it as a PDF. Amounts are in cents.
+package invoice
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/GitEagleY/BookingsWebApp/internal/models"
+	"github.com/GitEagleY/BookingsWebApp/internal/payments"
+)
+
+// Line is a charge on an invoice.
+type Line struct {
+	Description string
+	Quantity    int
+	UnitAmount  int
+	Amount      int
+}
+
+// Payment is money received for, or refunded on, the reservation. Refunds have a negative Amount.
+type Payment struct {
+	Date        time.Time
+	Description string
+	Amount      int
+}
+
+// Invoice is the invoice of a reservation.
+type Invoice struct {
+	Number   string
+	IssuedAt time.Time
+	Currency string
+
+	ReservationID int
+	GuestName     string
+	GuestEmail    string
+	Room          string
+	Arrival       time.Time
+	Departure     time.Time
+
+	Lines    []Line
+	Taxes    []Line
+	Payments []Payment
+}
+
+// Number formats a sequential invoice number, e.g. 42 as INV-000042.
+func Number(n int) string {
+	return fmt.Sprintf("INV-%06d", n)
+}
+
+// Build makes the invoice rec of the reservation res, with a line for each night of the stay, its discount,
+// fees and taxes, and the payments of records that went through. The price of the stay is spread evenly over the
+// nights, any cents left over go on the last night. The currency of the reservation is used when it has one.
+func Build(rec models.Invoice, res models.Reservation, records []models.Payment, currency string) Invoice {
+	if res.Currency != "" {
+		currency = res.Currency
+	}
+	inv := Invoice{
+		Number:        Number(rec.Number),
+		IssuedAt:      rec.CreatedAt,
+		Currency:      strings.ToUpper(currency),
+		ReservationID: res.ID,
+		GuestName:     strings.TrimSpace(res.FirstName + " " + res.LastName),
+		GuestEmail:    res.Email,
+		Room:          res.Room.RoomName,
+		Arrival:       res.StartDate,
+		Departure:     res.EndDate,
+	}
+
+	nights := res.Nights()
+	if nights > 0 {
+		rate := res.Amount / nights
+		for i := 0; i < nights; i++ {
+			amount := rate
+			if i == nights-1 {
+				amount = res.Amount - rate*(nights-1)
+			}
+			inv.Lines = append(inv.Lines, Line{
+				Description: fmt.Sprintf("%s, night of %s", res.Room.RoomName, res.StartDate.AddDate(0, 0, i).Format("2006-01-02")),
+				Quantity:    1,
+				UnitAmount:  amount,
+				Amount:      amount,
+			})
+		}
+	}
+
+	if res.Discount > 0 {
+		inv.Lines = append(inv.Lines, Line{
+			Description: fmt.Sprintf("Discount (%s)", res.PromotionCode),
+			Quantity:    1,
+			UnitAmount:  -res.Discount,
+			Amount:      -res.Discount,
+		})
+	}
+
+	for _, c := range res.Charges {
+		l := Line{Description: c.Description, Quantity: c.Quantity, UnitAmount: c.UnitAmount, Amount: c.Amount}
+		if c.Kind == models.TaxRuleTax {
+			inv.Taxes = append(inv.Taxes, l)
+		} else {
+			inv.Lines = append(inv.Lines, l)
+		}
+	}
+
+	for _, p := range records {
+		switch {
+		case p.Kind == models.PaymentDeposit && p.Status == payments.StatusSucceeded:
+			inv.Payments = append(inv.Payments, Payment{Date: p.CreatedAt, Description: "Deposit", Amount: p.Amount})
+		case p.Kind == models.PaymentRefund && p.Status != payments.StatusFailed:
+			inv.Payments = append(inv.Payments, Payment{Date: p.CreatedAt, Description: "Refund", Amount: -p.Amount})
+		}
+	}
+
+	return inv
+}
+
+// Subtotal is the sum of the lines before taxes.
+func (inv Invoice) Subtotal() int {
+	return sum(inv.Lines)
+}
+
+// TaxTotal is the sum of the taxes.
+func (inv Invoice) TaxTotal() int {
+	return sum(inv.Taxes)
+}
+
+// Total is the amount invoiced.
+func (inv Invoice) Total() int {
+	return inv.Subtotal() + inv.TaxTotal()
+}
+
+// Paid is the amount received less refunds.
+func (inv Invoice) Paid() int {
+	paid := 0
+	for _, p := range inv.Payments {
+		paid += p.Amount
+	}
+	return paid
+}
+
+// Balance is the amount still due.
+func (inv Invoice) Balance() int {
+	return inv.Total() - inv.Paid()
+}
+
+// Filename is the name of the PDF file of the invoice.
+func (inv Invoice) Filename() string {
+	return inv.Number + ".pdf"
+}
+
+func sum(lines []Line) int {
+	total := 0
+	for _, l := range lines {
+		total += l.Amount
+	}
+	return total
+}
+
+// Money formats an amount in cents, e.g. 8900 as 89.00.
+func Money(cents int) string {
+	sign := ""
+	if cents < 0 {
+		sign = "-"
+		cents = -cents
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, cents/100, cents%100)
+}
@@ -0,0 +1,181 @@
+package invoice
+
+import (
+	"bytes"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/GitEagleY/BookingsWebApp/internal/models"
+)
+
+var testReservation = models.Reservation{
+	ID:        7,
+	FirstName: "John",
+	LastName:  "Smith (Sons)",
+	Email:     "john@smith.com",
+	StartDate: time.Date(2050, 1, 1, 0, 0, 0, 0, time.UTC),
+	EndDate:   time.Date(2050, 1, 4, 0, 0, 0, 0, time.UTC),
+	Room:      models.Room{ID: 1, RoomName: "Generals Quarters"},
+	Amount:    10000,
+}
+
+var testPayments = []models.Payment{
+	{Kind: models.PaymentDeposit, Amount: 3000, Status: "succeeded"},
+	{Kind: models.PaymentDeposit, Amount: 9999, Status: "requires_capture"},
+	{Kind: models.PaymentRefund, Amount: 500, Status: "pending"},
+	{Kind: models.PaymentRefund, Amount: 700, Status: "failed"},
+}
+
+func TestBuild(t *testing.T) {
+	inv := Build(models.Invoice{Number: 42}, testReservation, testPayments, "usd")
+
+	if inv.Number != "INV-000042" {
+		t.Errorf("expected number INV-000042, got %s", inv.Number)
+	}
+	if inv.Currency != "USD" {
+		t.Errorf("expected currency USD, got %s", inv.Currency)
+	}
+	if inv.GuestName != "John Smith (Sons)" {
+		t.Errorf("unexpected guest name %q", inv.GuestName)
+	}
+
+	// 10000 over 3 nights leaves a cent for the last night
+	expected := []int{3333, 3333, 3334}
+	if len(inv.Lines) != len(expected) {
+		t.Fatalf("expected %d lines, got %d", len(expected), len(inv.Lines))
+	}
+	for i, l := range inv.Lines {
+		if l.Amount != expected[i] || l.Quantity != 1 {
+			t.Errorf("line %d: expected %d, got %d x %d", i, expected[i], l.Quantity, l.Amount)
+		}
+	}
+	if !strings.Contains(inv.Lines[2].Description, "2050-01-03") {
+		t.Errorf("expected the last line for 2050-01-03, got %q", inv.Lines[2].Description)
+	}
+
+	if inv.Subtotal() != 10000 || inv.Total() != 10000 {
+		t.Errorf("expected a total of 10000, got %d", inv.Total())
+	}
+	if inv.Paid() != 2500 {
+		t.Errorf("expected 2500 paid, got %d", inv.Paid())
+	}
+	if inv.Balance() != 7500 {
+		t.Errorf("expected 7500 due, got %d", inv.Balance())
+	}
+
+}
+
+func TestBuildCharges(t *testing.T) {
+	res := testReservation
+	res.Currency = "eur"
+	res.Charges = []models.Charge{
+		{Kind: models.TaxRuleFee, Description: "Cleaning fee", Quantity: 1, UnitAmount: 3000, Amount: 3000},
+		{Kind: models.TaxRuleTax, Description: "Tourist tax", Quantity: 6, UnitAmount: 250, Amount: 1500},
+	}
+
+	inv := Build(models.Invoice{Number: 1}, res, testPayments, "usd")
+
+	if inv.Currency != "EUR" {
+		t.Errorf("expected the currency of the reservation, got %s", inv.Currency)
+	}
+	if len(inv.Lines) != 4 || inv.Lines[3].Description != "Cleaning fee" {
+		t.Errorf("expected the fee after the nights, got %+v", inv.Lines)
+	}
+	if len(inv.Taxes) != 1 || inv.Taxes[0].Quantity != 6 {
+		t.Errorf("expected the tourist tax in the taxes, got %+v", inv.Taxes)
+	}
+	if inv.Subtotal() != 13000 || inv.TaxTotal() != 1500 || inv.Total() != 14500 || inv.Balance() != 12000 {
+		t.Errorf("charges not added: subtotal %d, taxes %d, balance %d", inv.Subtotal(), inv.TaxTotal(), inv.Balance())
+	}
+}
+
+func TestBuildDiscount(t *testing.T) {
+	res := testReservation
+	res.PromotionCode = "SUMMER"
+	res.Discount = 1000
+
+	inv := Build(models.Invoice{Number: 1}, res, nil, "usd")
+
+	if len(inv.Lines) != 4 || inv.Lines[3].Description != "Discount (SUMMER)" || inv.Lines[3].Amount != -1000 {
+		t.Errorf("expected the discount after the nights, got %+v", inv.Lines)
+	}
+	if inv.Total() != 9000 {
+		t.Errorf("expected a total of 9000, got %d", inv.Total())
+	}
+}
+
+func TestMoney(t *testing.T) {
+	tests := map[int]string{0: "0.00", 5: "0.05", 8900: "89.00", -1250: "-12.50"}
+	for cents, expected := range tests {
+		if got := Money(cents); got != expected {
+			t.Errorf("Money(%d): expected %s, got %s", cents, expected, got)
+		}
+	}
+}
+
+func TestWritePDF(t *testing.T) {
+	inv := Build(models.Invoice{Number: 1}, testReservation, testPayments, "eur")
+
+	var buf bytes.Buffer
+	err := WritePDF(&buf, inv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pdf := buf.String()
+
+	if !strings.HasPrefix(pdf, "%PDF-1.4\n") || !strings.HasSuffix(pdf, "%%EOF\n") {
+		t.Fatal("not a PDF file")
+	}
+	for _, s := range []string{"(INV-000001)", `(John Smith \(Sons\))`, "(100.00 EUR)", "(75.00 EUR)"} {
+		if !strings.Contains(pdf, s) {
+			t.Errorf("expected %s in the PDF", s)
+		}
+	}
+
+	// every object is where the cross-reference table says
+	start, err := strconv.Atoi(regexp.MustCompile(`startxref\n(\d+)\n`).FindStringSubmatch(pdf)[1])
+	if err != nil || !strings.HasPrefix(pdf[start:], "xref\n") {
+		t.Fatalf("startxref does not point to the xref table")
+	}
+	offsets := regexp.MustCompile(`(\d{10}) 00000 n `).FindAllStringSubmatch(pdf[start:], -1)
+	if len(offsets) != 6 {
+		t.Fatalf("expected 6 objects, got %d", len(offsets))
+	}
+	for i, o := range offsets {
+		offset, _ := strconv.Atoi(o[1])
+		if !strings.HasPrefix(pdf[offset:], strconv.Itoa(i+1)+" 0 obj") {
+			t.Errorf("object %d is not at offset %d", i+1, offset)
+		}
+	}
+}
+
+func TestWritePDFPages(t *testing.T) {
+	res := testReservation
+	res.EndDate = res.StartDate.AddDate(0, 0, 90)
+
+	var buf bytes.Buffer
+	err := WritePDF(&buf, Build(models.Invoice{Number: 1}, res, nil, "usd"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(buf.String(), "/Count 2 >>") {
+		t.Error("expected a long stay to take two pages")
+	}
+}
+
+func TestEncode(t *testing.T) {
+	tests := map[string]string{
+		"Café":     "Caf\xe9",
+		"5 €":      "5 \x80",
+		"Zürich ☃": "Z\xfcrich ?",
+	}
+	for s, expected := range tests {
+		if got := encode(s); got != expected {
+			t.Errorf("encode(%q): expected %q, got %q", s, expected, got)
+		}
+	}
+}
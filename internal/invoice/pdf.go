@@ -0,0 +1,215 @@
+package invoice
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// A4 in points
+const (
+	pageWidth  = 595
+	pageHeight = 842
+	margin     = 50
+)
+
+// helveticaWidths are the widths of the printable ASCII characters of Helvetica, in 1/1000 of the font size.
+var helveticaWidths = [95]int{
+	278, 278, 355, 556, 556, 889, 667, 191, 333, 333, 389, 584, 278, 333, 278, 278, // space to /
+	556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 278, 278, 584, 584, 584, 556, // 0 to ?
+	1015, 667, 667, 722, 722, 667, 611, 778, 722, 278, 500, 667, 556, 833, 722, 778, // @ to O
+	667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 278, 278, 278, 469, 556, // P to _
+	333, 556, 556, 500, 556, 556, 278, 556, 556, 222, 222, 500, 222, 833, 556, 556, // ` to o
+	556, 556, 333, 500, 278, 556, 500, 722, 500, 500, 500, 334, 260, 334, 584, // p to ~
+}
+
+// document is a PDF of text and lines in the standard Helvetica fonts, which every PDF reader has, so no
+// font files are embedded.
+type document struct {
+	pages []*bytes.Buffer
+	page  *bytes.Buffer
+	y     float64 // baseline of the next line, from the bottom of the page
+}
+
+func newDocument() *document {
+	d := &document{}
+	d.addPage()
+	return d
+}
+
+func (d *document) addPage() {
+	d.page = &bytes.Buffer{}
+	d.pages = append(d.pages, d.page)
+	d.y = pageHeight - margin
+}
+
+// space moves down by h points, starting a new page when the next line would not fit.
+func (d *document) space(h float64) {
+	d.y -= h
+	if d.y < margin {
+		d.addPage()
+	}
+}
+
+// text writes s at x on the current line.
+func (d *document) text(x float64, size float64, bold bool, s string) {
+	font := "F1"
+	if bold {
+		font = "F2"
+	}
+	fmt.Fprintf(d.page, "BT /%s %.1f Tf %.2f %.2f Td (%s) Tj ET\n", font, size, x, d.y, escape(s))
+}
+
+// textRight writes s ending at x on the current line.
+func (d *document) textRight(x float64, size float64, s string) {
+	d.text(x-textWidth(s, size), size, false, s)
+}
+
+// rule draws a line across the page below the current line.
+func (d *document) rule() {
+	fmt.Fprintf(d.page, "0.5 w %d %.2f m %d %.2f l S\n", margin, d.y-6, pageWidth-margin, d.y-6)
+}
+
+// textWidth is the width of s in Helvetica at size.
+func textWidth(s string, size float64) float64 {
+	w := 0
+	for _, b := range []byte(encode(s)) {
+		if b >= 32 && b < 127 {
+			w += helveticaWidths[b-32]
+		} else {
+			w += 556
+		}
+	}
+	return float64(w) * size / 1000
+}
+
+// encode converts s to WinAnsiEncoding, replacing characters it does not have with "?".
+func encode(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '€':
+			b.WriteByte(0x80)
+		case r < 0x80 || (r >= 0xa0 && r <= 0xff):
+			b.WriteByte(byte(r))
+		default:
+			b.WriteByte('?')
+		}
+	}
+	return b.String()
+}
+
+// escape encodes s as the contents of a PDF string.
+func escape(s string) string {
+	s = encode(s)
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, "(", `\(`)
+	return strings.ReplaceAll(s, ")", `\)`)
+}
+
+// writeTo writes the PDF file: the catalog, the page tree, the two fonts, then a page and its content for
+// each page, followed by the cross-reference table.
+func (d *document) writeTo(w io.Writer) error {
+	var out bytes.Buffer
+	var offsets []int
+
+	object := func(body string) {
+		offsets = append(offsets, out.Len())
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+
+	out.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+
+	kids := make([]string, len(d.pages))
+	for i := range d.pages {
+		kids[i] = fmt.Sprintf("%d 0 R", 5+2*i)
+	}
+	object("<< /Type /Catalog /Pages 2 0 R >>")
+	object(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(d.pages)))
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>")
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>")
+	for i, p := range d.pages {
+		object(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %d %d] /Resources << /Font << /F1 3 0 R /F2 4 0 R >> >> /Contents %d 0 R >>",
+			pageWidth, pageHeight, 6+2*i))
+		object(fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", p.Len(), p.String()))
+	}
+
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, o := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", o)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+
+	_, err := w.Write(out.Bytes())
+	return err
+}
+
+// WritePDF writes the invoice to w as a PDF.
+func WritePDF(w io.Writer, inv Invoice) error {
+	d := newDocument()
+	right := float64(pageWidth - margin)
+
+	d.text(margin, 20, true, "Invoice")
+	d.textRight(right, 10, inv.Number)
+	d.space(16)
+	d.textRight(right, 10, "Issued "+inv.IssuedAt.Format("2006-01-02"))
+	d.space(30)
+
+	d.text(margin, 10, true, "Billed to")
+	d.text(300, 10, true, "Reservation")
+	d.space(14)
+	d.text(margin, 10, false, inv.GuestName)
+	d.text(300, 10, false, fmt.Sprintf("Booking number %d", inv.ReservationID))
+	d.space(14)
+	d.text(margin, 10, false, inv.GuestEmail)
+	d.text(300, 10, false, inv.Room)
+	d.space(14)
+	d.text(300, 10, false, inv.Arrival.Format("2006-01-02")+" to "+inv.Departure.Format("2006-01-02"))
+	d.space(30)
+
+	d.text(margin, 10, true, "Description")
+	d.textRight(380, 10, "Qty")
+	d.textRight(460, 10, "Unit")
+	d.textRight(right, 10, "Amount")
+	d.rule()
+	d.space(20)
+	for _, l := range append(append([]Line(nil), inv.Lines...), inv.Taxes...) {
+		d.text(margin, 10, false, l.Description)
+		d.textRight(380, 10, fmt.Sprint(l.Quantity))
+		d.textRight(460, 10, Money(l.UnitAmount))
+		d.textRight(right, 10, Money(l.Amount))
+		d.space(14)
+	}
+	d.rule()
+	d.space(20)
+
+	total := func(label string, amount int, bold bool) {
+		d.text(340, 10, bold, label)
+		d.textRight(right, 10, Money(amount)+" "+inv.Currency)
+		d.space(14)
+	}
+	total("Subtotal", inv.Subtotal(), false)
+	if len(inv.Taxes) > 0 {
+		total("Taxes", inv.TaxTotal(), false)
+	}
+	total("Total", inv.Total(), true)
+	d.space(16)
+
+	if len(inv.Payments) > 0 {
+		d.text(margin, 10, true, "Payments received")
+		d.rule()
+		d.space(20)
+		for _, p := range inv.Payments {
+			d.text(margin, 10, false, p.Date.Format("2006-01-02"))
+			d.text(130, 10, false, p.Description)
+			d.textRight(right, 10, Money(p.Amount)+" "+inv.Currency)
+			d.space(14)
+		}
+		d.space(6)
+	}
+	total("Balance due", inv.Balance(), true)
+
+	return d.writeTo(w)
+}
@@ -0,0 +1,116 @@
+// Package lifecycle starts the parts of the application in order and stops them in reverse order when it
+// shuts down.
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+)
+
+// Component is a part of the application with work running in the background, such as the web server or
+// the mail worker.
+type Component interface {
+	// Name is used in logs and errors.
+	Name() string
+	// Start starts the component and returns once it is running.
+	Start() error
+	// Stop finishes the work in progress and stops the component, giving up when ctx is done.
+	Stop(ctx context.Context) error
+}
+
+// Func makes a Component of a name and two functions. A nil start does nothing.
+func Func(name string, start func() error, stop func(ctx context.Context) error) Component {
+	return funcComponent{name, start, stop}
+}
+
+type funcComponent struct {
+	name  string
+	start func() error
+	stop  func(ctx context.Context) error
+}
+
+func (c funcComponent) Name() string { return c.name }
+
+func (c funcComponent) Start() error {
+	if c.start == nil {
+		return nil
+	}
+	return c.start()
+}
+
+func (c funcComponent) Stop(ctx context.Context) error { return c.stop(ctx) }
+
+// Group is the components of the application. The zero value is ready to use.
+type Group struct {
+	// Logger, when set, logs components starting and stopping.
+	Logger *slog.Logger
+
+	components []Component
+	started    []Component
+	failed     chan error
+}
+
+// Add adds a component, started after the ones added before it and stopped before them. Components depended
+// on by others, such as the database, are added first.
+func (g *Group) Add(c Component) {
+	g.components = append(g.components, c)
+}
+
+// Start starts the components in order. When one fails to start, the ones already started are stopped.
+func (g *Group) Start(ctx context.Context) error {
+	if g.failed == nil {
+		g.failed = make(chan error, 1)
+	}
+	for _, c := range g.components {
+		g.log("starting", c)
+		if err := c.Start(); err != nil {
+			err = fmt.Errorf("%s: %w", c.Name(), err)
+			return errors.Join(err, g.Stop(ctx))
+		}
+		g.started = append(g.started, c)
+	}
+	return nil
+}
+
+// Stop stops the started components in reverse order, each within the deadline of ctx. Every component is
+// stopped even when one fails, the errors are returned together.
+func (g *Group) Stop(ctx context.Context) error {
+	var errs []error
+	for i := len(g.started) - 1; i >= 0; i-- {
+		c := g.started[i]
+		g.log("stopping", c)
+		if err := c.Stop(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", c.Name(), err))
+		}
+	}
+	g.started = nil
+	return errors.Join(errs...)
+}
+
+// Fail reports a component that stopped working on its own, e.g. a web server that can't accept connections,
+// ending Wait. It is called once the group is started.
+func (g *Group) Fail(err error) {
+	select {
+	case g.failed <- err:
+	default:
+		// already failing, the first error is enough
+	}
+}
+
+// Wait waits until ctx is done, e.g. on SIGTERM, or a component fails, and returns the failure.
+func (g *Group) Wait(ctx context.Context) error {
+	select {
+	case <-ctx.Done():
+		return nil
+	case err := <-g.failed:
+		return err
+	}
+}
+
+func (g *Group) log(msg string, c Component) {
+	if g.Logger != nil {
+		g.Logger.Info(msg, "component", c.Name())
+	}
+}
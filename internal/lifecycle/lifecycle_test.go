@@ -0,0 +1,118 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// recorder is a component writing what happens to it to events.
+type recorder struct {
+	name      string
+	events    *[]string
+	startErr  error
+	stopErr   error
+	stopDelay time.Duration
+}
+
+func (r *recorder) Name() string { return r.name }
+
+func (r *recorder) Start() error {
+	*r.events = append(*r.events, "start "+r.name)
+	return r.startErr
+}
+
+func (r *recorder) Stop(ctx context.Context) error {
+	if r.stopDelay > 0 {
+		select {
+		case <-time.After(r.stopDelay):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	*r.events = append(*r.events, "stop "+r.name)
+	return r.stopErr
+}
+
+func TestGroupOrder(t *testing.T) {
+	var events []string
+	var g Group
+	g.Add(&recorder{name: "db", events: &events})
+	g.Add(&recorder{name: "mail", events: &events})
+	g.Add(&recorder{name: "web", events: &events})
+
+	if err := g.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Stop(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "start db,start mail,start web,stop web,stop mail,stop db"
+	if got := strings.Join(events, ","); got != expected {
+		t.Errorf("expected %s, got %s", expected, got)
+	}
+}
+
+func TestGroupStartFailure(t *testing.T) {
+	var events []string
+	var g Group
+	g.Add(&recorder{name: "db", events: &events})
+	g.Add(&recorder{name: "web", events: &events, startErr: errors.New("address in use")})
+	g.Add(&recorder{name: "never", events: &events})
+
+	err := g.Start(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "web: address in use") {
+		t.Errorf("expected the web start error, got %v", err)
+	}
+
+	expected := "start db,start web,stop db"
+	if got := strings.Join(events, ","); got != expected {
+		t.Errorf("expected %s, got %s", expected, got)
+	}
+}
+
+func TestGroupStopErrors(t *testing.T) {
+	var events []string
+	var g Group
+	g.Add(&recorder{name: "db", events: &events, stopErr: errors.New("close failed")})
+	g.Add(&recorder{name: "mail", events: &events, stopDelay: time.Second})
+	g.Add(Func("web", nil, func(ctx context.Context) error { return nil }))
+
+	if err := g.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	err := g.Stop(ctx)
+
+	// the slow component gives up at the deadline and the rest are still stopped
+	if !errors.Is(err, context.DeadlineExceeded) || !strings.Contains(err.Error(), "db: close failed") {
+		t.Errorf("expected both errors, got %v", err)
+	}
+	if events[len(events)-1] != "stop db" {
+		t.Errorf("expected the database to be stopped, got %v", events)
+	}
+}
+
+func TestGroupWait(t *testing.T) {
+	var g Group
+	if err := g.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	go g.Fail(errors.New("serve failed"))
+	go g.Fail(errors.New("second failure"))
+	err := g.Wait(context.Background())
+	if err == nil {
+		t.Error("expected a failure to end Wait")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	// the second failure may be waiting, a done context still ends Wait
+	g.Wait(ctx)
+}
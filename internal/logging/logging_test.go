@@ -0,0 +1,73 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestNew(t *testing.T) {
+	var buf bytes.Buffer
+	l := New(&buf, "json", slog.LevelInfo)
+	l.Debug("hidden")
+	l.Info("shown", "request_id", "abc")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 1 {
+		t.Fatalf("expected 1 record, got %q", buf.String())
+	}
+	var record map[string]interface{}
+	if err := json.Unmarshal([]byte(lines[0]), &record); err != nil {
+		t.Fatal(err)
+	}
+	if record["msg"] != "shown" || record["request_id"] != "abc" || record["level"] != "INFO" {
+		t.Errorf("unexpected record %v", record)
+	}
+
+	buf.Reset()
+	New(&buf, "text", slog.LevelDebug).Debug("shown", "n", 1)
+	if !strings.Contains(buf.String(), "level=DEBUG msg=shown n=1") {
+		t.Errorf("unexpected text record %q", buf.String())
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected slog.Level
+		ok       bool
+	}{
+		{"debug", slog.LevelDebug, true},
+		{"INFO", slog.LevelInfo, true},
+		{"warn", slog.LevelWarn, true},
+		{"error", slog.LevelError, true},
+		{"loud", 0, false},
+	}
+	for _, e := range tests {
+		l, err := ParseLevel(e.name)
+		if (err == nil) != e.ok || (e.ok && l != e.expected) {
+			t.Errorf("%s: expected %v, got %v %v", e.name, e.expected, l, err)
+		}
+	}
+}
+
+func TestFromContext(t *testing.T) {
+	var buf bytes.Buffer
+	fallback := New(&buf, "text", slog.LevelInfo)
+	reqLogger := fallback.With("request_id", "r1")
+
+	FromContext(context.Background(), fallback).Info("outside")
+	FromContext(WithLogger(context.Background(), reqLogger), fallback).Info("inside")
+	FromContext(context.Background(), nil).Info("discarded")
+
+	out := buf.String()
+	if !strings.Contains(out, "msg=outside\n") || !strings.Contains(out, "msg=inside request_id=r1") {
+		t.Errorf("unexpected records:\n%s", out)
+	}
+	if strings.Contains(out, "discarded") {
+		t.Errorf("record without a logger written:\n%s", out)
+	}
+}
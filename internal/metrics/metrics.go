@@ -0,0 +1,266 @@
+// Package metrics keeps counters, gauges and histograms and writes them in the Prometheus text format.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultBuckets are the upper bounds of the histogram buckets of request durations, in seconds.
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Registry is a set of metrics. Metrics are created the first time they are asked for, so the code counting
+// something also declares it. A nil *Registry, e.g. in tests, hands out metrics that count nothing.
+type Registry struct {
+	mu      sync.Mutex
+	metrics map[string]metric
+}
+
+// NewRegistry returns an empty registry.
+func NewRegistry() *Registry {
+	return &Registry{metrics: make(map[string]metric)}
+}
+
+type metric interface {
+	write(w io.Writer, name string)
+}
+
+// Counter returns the counter name, a value that only goes up, with one series for each combination of values
+// of labels.
+func (r *Registry) Counter(name, help string, labels ...string) *Counter {
+	if r == nil {
+		return nil
+	}
+	return r.get(name, func() metric {
+		return &Counter{help: help, labels: labels, values: make(map[string]float64)}
+	}).(*Counter)
+}
+
+// Histogram returns the histogram name, counting observations in buckets with the upper bounds of buckets.
+func (r *Registry) Histogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	if r == nil {
+		return nil
+	}
+	return r.get(name, func() metric {
+		return &Histogram{help: help, labels: labels, buckets: buckets, series: make(map[string]*histogramSeries)}
+	}).(*Histogram)
+}
+
+// GaugeFunc adds the gauge name, a value that goes up and down read by f when the metrics are written.
+func (r *Registry) GaugeFunc(name, help string, f func() float64) {
+	if r == nil {
+		return
+	}
+	r.get(name, func() metric { return &gaugeFunc{help: help, f: f} })
+}
+
+func (r *Registry) get(name string, create func() metric) metric {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	m, ok := r.metrics[name]
+	if !ok {
+		m = create()
+		r.metrics[name] = m
+	}
+	return m
+}
+
+// Write writes every metric to w in the Prometheus text format, sorted by name.
+func (r *Registry) Write(w io.Writer) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	names := make([]string, 0, len(r.metrics))
+	for name := range r.metrics {
+		names = append(names, name)
+	}
+	metrics := make(map[string]metric, len(r.metrics))
+	for name, m := range r.metrics {
+		metrics[name] = m
+	}
+	r.mu.Unlock()
+
+	sort.Strings(names)
+	for _, name := range names {
+		metrics[name].write(w, name)
+	}
+}
+
+// Handler serves the metrics.
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		r.Write(w)
+	})
+}
+
+// Counter is a value that only goes up, such as the number of requests served.
+type Counter struct {
+	mu     sync.Mutex
+	help   string
+	labels []string
+	values map[string]float64 // by label values joined by \x00
+}
+
+// Inc adds one to the series of the label values, given in the order of the labels of the counter.
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add adds v to the series of the label values.
+func (c *Counter) Add(v float64, labelValues ...string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	c.values[strings.Join(labelValues, "\x00")] += v
+	c.mu.Unlock()
+}
+
+// Value returns the value of the series of the label values.
+func (c *Counter) Value(labelValues ...string) float64 {
+	if c == nil {
+		return 0
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.values[strings.Join(labelValues, "\x00")]
+}
+
+func (c *Counter) write(w io.Writer, name string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	header(w, name, c.help, "counter")
+	if len(c.labels) == 0 && len(c.values) == 0 {
+		fmt.Fprintf(w, "%s 0\n", name)
+	}
+	for _, key := range sortedKeys(c.values) {
+		fmt.Fprintf(w, "%s%s %s\n", name, labelPairs(c.labels, key, "", ""), number(c.values[key]))
+	}
+}
+
+// Histogram counts observations, such as request durations, in buckets.
+type Histogram struct {
+	mu      sync.Mutex
+	help    string
+	labels  []string
+	buckets []float64
+	series  map[string]*histogramSeries
+}
+
+type histogramSeries struct {
+	counts []uint64 // per bucket, not cumulative
+	count  uint64
+	sum    float64
+}
+
+// Observe counts v in the series of the label values.
+func (h *Histogram) Observe(v float64, labelValues ...string) {
+	if h == nil {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	key := strings.Join(labelValues, "\x00")
+	s, ok := h.series[key]
+	if !ok {
+		s = &histogramSeries{counts: make([]uint64, len(h.buckets))}
+		h.series[key] = s
+	}
+	for i, upper := range h.buckets {
+		if v <= upper {
+			s.counts[i]++
+			break
+		}
+	}
+	s.count++
+	s.sum += v
+}
+
+func (h *Histogram) write(w io.Writer, name string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	header(w, name, h.help, "histogram")
+	keys := make([]string, 0, len(h.series))
+	for key := range h.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		s := h.series[key]
+		var cumulative uint64
+		for i, upper := range h.buckets {
+			cumulative += s.counts[i]
+			fmt.Fprintf(w, "%s_bucket%s %d\n", name, labelPairs(h.labels, key, "le", number(upper)), cumulative)
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", name, labelPairs(h.labels, key, "le", "+Inf"), s.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", name, labelPairs(h.labels, key, "", ""), number(s.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", name, labelPairs(h.labels, key, "", ""), s.count)
+	}
+}
+
+type gaugeFunc struct {
+	help string
+	f    func() float64
+}
+
+func (g *gaugeFunc) write(w io.Writer, name string) {
+	header(w, name, g.help, "gauge")
+	fmt.Fprintf(w, "%s %s\n", name, number(g.f()))
+}
+
+func header(w io.Writer, name, help, kind string) {
+	help = strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(help)
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+// labelPairs formats the labels of a series, e.g. {method="GET",route="/"}, with the extra label when given.
+func labelPairs(labels []string, key, extraLabel, extraValue string) string {
+	var values []string
+	if len(labels) > 0 {
+		values = strings.Split(key, "\x00")
+	}
+
+	var pairs []string
+	for i, l := range labels {
+		v := ""
+		if i < len(values) {
+			v = values[i]
+		}
+		pairs = append(pairs, l+"="+strconv.Quote(v))
+	}
+	if extraLabel != "" {
+		pairs = append(pairs, extraLabel+"="+strconv.Quote(extraValue))
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func number(v float64) string {
+	if math.IsInf(v, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func sortedKeys(m map[string]float64) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
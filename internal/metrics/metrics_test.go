@@ -0,0 +1,72 @@
+package metrics
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestWrite(t *testing.T) {
+	r := NewRegistry()
+	r.Counter("bookings_http_requests_total", "Requests served.", "route", "status").Inc("/", "200")
+	r.Counter("bookings_http_requests_total", "Requests served.", "route", "status").Inc("/", "200")
+	r.Counter("bookings_http_requests_total", "Requests served.", "route", "status").Add(3, `/rooms/{id}`, "404")
+	r.Counter("bookings_mail_failures_total", "Emails that couldn't be sent.")
+	h := r.Histogram("bookings_http_request_duration_seconds", "Request durations.", []float64{0.1, 1}, "route")
+	h.Observe(0.05, "/")
+	h.Observe(0.5, "/")
+	h.Observe(5, "/")
+	r.GaugeFunc("bookings_mail_queue_length", "Emails waiting.", func() float64 { return 2 })
+
+	var buf bytes.Buffer
+	r.Write(&buf)
+
+	expected := `# HELP bookings_http_request_duration_seconds Request durations.
+# TYPE bookings_http_request_duration_seconds histogram
+bookings_http_request_duration_seconds_bucket{route="/",le="0.1"} 1
+bookings_http_request_duration_seconds_bucket{route="/",le="1"} 2
+bookings_http_request_duration_seconds_bucket{route="/",le="+Inf"} 3
+bookings_http_request_duration_seconds_sum{route="/"} 5.55
+bookings_http_request_duration_seconds_count{route="/"} 3
+# HELP bookings_http_requests_total Requests served.
+# TYPE bookings_http_requests_total counter
+bookings_http_requests_total{route="/",status="200"} 2
+bookings_http_requests_total{route="/rooms/{id}",status="404"} 3
+# HELP bookings_mail_failures_total Emails that couldn't be sent.
+# TYPE bookings_mail_failures_total counter
+bookings_mail_failures_total 0
+# HELP bookings_mail_queue_length Emails waiting.
+# TYPE bookings_mail_queue_length gauge
+bookings_mail_queue_length 2
+`
+	if buf.String() != expected {
+		t.Errorf("unexpected metrics:\n%s", buf.String())
+	}
+}
+
+func TestNilRegistry(t *testing.T) {
+	var r *Registry
+	r.Counter("bookings_reservations_total", "", "source").Inc("guest")
+	r.Histogram("d", "", DefaultBuckets).Observe(1)
+	r.GaugeFunc("g", "", func() float64 { return 1 })
+
+	if v := r.Counter("bookings_reservations_total", "", "source").Value("guest"); v != 0 {
+		t.Errorf("expected nothing counted, got %v", v)
+	}
+}
+
+func TestHandler(t *testing.T) {
+	r := NewRegistry()
+	r.Counter("bookings_reservations_total", "Reservations made.", "source").Inc("guest")
+
+	rr := httptest.NewRecorder()
+	r.Handler().ServeHTTP(rr, httptest.NewRequest("GET", "/metrics", nil))
+
+	if !strings.HasPrefix(rr.Header().Get("Content-Type"), "text/plain; version=0.0.4") {
+		t.Errorf("unexpected content type %s", rr.Header().Get("Content-Type"))
+	}
+	if !strings.Contains(rr.Body.String(), `bookings_reservations_total{source="guest"} 1`) {
+		t.Errorf("counter not served:\n%s", rr.Body.String())
+	}
+}
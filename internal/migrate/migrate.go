@@ -0,0 +1,333 @@
+// Package migrate applies and rolls back the SQL migrations of the database, keeping the versions applied in
+// the schema_migrations table.
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// lockKey is the advisory lock held while migrating, so two instances started together don't both migrate.
+const lockKey = 72_616_179_002
+
+// fileName matches the migration files, e.g. 20201116173120_create_user_table.up.sql.
+var fileName = regexp.MustCompile(`^(\d{14})_(\w+)\.(up|down)\.sql$`)
+
+// Migration is one change of the database schema or data, with the SQL applying and undoing it.
+type Migration struct {
+	Version string // yyyymmddhhmmss
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Status is a migration and when it was applied, zero when it is pending.
+type Status struct {
+	Migration
+	AppliedAt time.Time
+}
+
+// Load reads the migrations in the root of fsys, sorted by version. Every migration needs an up and a down file.
+func Load(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[string]*Migration)
+	var list []*Migration
+	for _, e := range entries {
+		if e.IsDir() || path.Ext(e.Name()) != ".sql" {
+			continue
+		}
+		m := fileName.FindStringSubmatch(e.Name())
+		if m == nil {
+			return nil, fmt.Errorf("%s: not a migration, name it <yyyymmddhhmmss>_<name>.up.sql or .down.sql", e.Name())
+		}
+		version, name, direction := m[1], m[2], m[3]
+
+		b, err := fs.ReadFile(fsys, e.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		mig := byVersion[version]
+		if mig == nil {
+			mig = &Migration{Version: version, Name: name}
+			byVersion[version] = mig
+			list = append(list, mig)
+		}
+		if mig.Name != name {
+			return nil, fmt.Errorf("version %s is used by %s and %s", version, mig.Name, name)
+		}
+		if direction == "up" {
+			mig.Up = string(b)
+		} else {
+			mig.Down = string(b)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(list))
+	for _, mig := range list {
+		if mig.Up == "" || mig.Down == "" {
+			return nil, fmt.Errorf("%s_%s needs both an up and a down file", mig.Version, mig.Name)
+		}
+		migrations = append(migrations, *mig)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// pending returns the migrations not applied yet, in order.
+func pending(migrations []Migration, applied map[string]time.Time) []Migration {
+	var list []Migration
+	for _, m := range migrations {
+		if _, ok := applied[m.Version]; !ok {
+			list = append(list, m)
+		}
+	}
+	return list
+}
+
+// rollback returns the last steps applied migrations, latest first.
+func rollback(migrations []Migration, applied map[string]time.Time, steps int) ([]Migration, error) {
+	versions := make([]string, 0, len(applied))
+	for v := range applied {
+		versions = append(versions, v)
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(versions)))
+	if steps < len(versions) {
+		versions = versions[:steps]
+	}
+
+	byVersion := make(map[string]Migration)
+	for _, m := range migrations {
+		byVersion[m.Version] = m
+	}
+	var list []Migration
+	for _, v := range versions {
+		m, ok := byVersion[v]
+		if !ok {
+			return nil, fmt.Errorf("version %s is applied but has no migration file", v)
+		}
+		list = append(list, m)
+	}
+	return list, nil
+}
+
+// Migrator runs the migrations against a database.
+type Migrator struct {
+	db         *sql.DB
+	migrations []Migration
+	logger     *slog.Logger
+}
+
+// New returns a migrator of the database db running the migrations found in fsys.
+func New(db *sql.DB, fsys fs.FS, logger *slog.Logger) (*Migrator, error) {
+	migrations, err := Load(fsys)
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{db: db, migrations: migrations, logger: logger}, nil
+}
+
+// Up applies the pending migrations in order and returns how many were applied. It stops at the first
+// failure, leaving the failed migration unapplied.
+func (m *Migrator) Up(ctx context.Context) (int, error) {
+	n := 0
+	err := m.locked(ctx, func(conn *sql.Conn, applied map[string]time.Time) error {
+		for _, mig := range pending(m.migrations, applied) {
+			err := m.apply(ctx, conn, mig, "up")
+			if err != nil {
+				return err
+			}
+			n++
+		}
+		return nil
+	})
+	return n, err
+}
+
+// Down rolls back the last steps applied migrations, latest first, and returns how many were rolled back.
+func (m *Migrator) Down(ctx context.Context, steps int) (int, error) {
+	if steps < 1 {
+		return 0, errors.New("roll back at least one migration")
+	}
+	n := 0
+	err := m.locked(ctx, func(conn *sql.Conn, applied map[string]time.Time) error {
+		list, err := rollback(m.migrations, applied, steps)
+		if err != nil {
+			return err
+		}
+		for _, mig := range list {
+			err := m.apply(ctx, conn, mig, "down")
+			if err != nil {
+				return err
+			}
+			n++
+		}
+		return nil
+	})
+	return n, err
+}
+
+// Redo rolls back the last applied migration and applies it again, to try out changes to it.
+func (m *Migrator) Redo(ctx context.Context) error {
+	return m.locked(ctx, func(conn *sql.Conn, applied map[string]time.Time) error {
+		list, err := rollback(m.migrations, applied, 1)
+		if err != nil {
+			return err
+		}
+		if len(list) == 0 {
+			return errors.New("no migration applied")
+		}
+		err = m.apply(ctx, conn, list[0], "down")
+		if err != nil {
+			return err
+		}
+		return m.apply(ctx, conn, list[0], "up")
+	})
+}
+
+// Status returns every migration with when it was applied.
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	var list []Status
+	err := m.locked(ctx, func(conn *sql.Conn, applied map[string]time.Time) error {
+		for _, mig := range m.migrations {
+			list = append(list, Status{Migration: mig, AppliedAt: applied[mig.Version]})
+		}
+		return nil
+	})
+	return list, err
+}
+
+// locked runs f on a connection holding the advisory lock, with the versions applied.
+func (m *Migrator) locked(ctx context.Context, f func(conn *sql.Conn, applied map[string]time.Time) error) error {
+	// the lock belongs to the session, so everything runs on the same connection
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	_, err = conn.ExecContext(ctx, "select pg_advisory_lock($1)", lockKey)
+	if err != nil {
+		return fmt.Errorf("cannot lock the migrations: %w", err)
+	}
+	defer conn.ExecContext(context.WithoutCancel(ctx), "select pg_advisory_unlock($1)", lockKey)
+
+	err = m.createTable(ctx, conn)
+	if err != nil {
+		return err
+	}
+
+	applied, err := appliedVersions(ctx, conn)
+	if err != nil {
+		return err
+	}
+	return f(conn, applied)
+}
+
+// createTable creates the schema_migrations table the first time. A database set up with soda already has
+// the versions it applied in schema_migration, which are copied over so they aren't applied again.
+func (m *Migrator) createTable(ctx context.Context, conn *sql.Conn) error {
+	var exists bool
+	err := conn.QueryRowContext(ctx, "select to_regclass('schema_migrations') is not null").Scan(&exists)
+	if err != nil || exists {
+		return err
+	}
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `create table schema_migrations (
+		version varchar(14) primary key,
+		applied_at timestamp not null default now()
+	)`)
+	if err != nil {
+		return err
+	}
+
+	var soda bool
+	err = tx.QueryRowContext(ctx, "select to_regclass('schema_migration') is not null").Scan(&soda)
+	if err != nil {
+		return err
+	}
+	if soda {
+		res, err := tx.ExecContext(ctx, "insert into schema_migrations (version) select version from schema_migration")
+		if err != nil {
+			return err
+		}
+		n, _ := res.RowsAffected()
+		m.logger.Info("adopted the migrations applied by soda", "count", n)
+	}
+	return tx.Commit()
+}
+
+// appliedVersions returns the versions applied and when.
+func appliedVersions(ctx context.Context, conn *sql.Conn) (map[string]time.Time, error) {
+	rows, err := conn.QueryContext(ctx, "select version, applied_at from schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := make(map[string]time.Time)
+	for rows.Next() {
+		var version string
+		var at time.Time
+		if err := rows.Scan(&version, &at); err != nil {
+			return nil, err
+		}
+		applied[version] = at
+	}
+	return applied, rows.Err()
+}
+
+// apply runs the up or down SQL of a migration and records it, in one transaction.
+func (m *Migrator) apply(ctx context.Context, conn *sql.Conn, mig Migration, direction string) error {
+	start := time.Now()
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query, record := mig.Up, "insert into schema_migrations (version) values ($1)"
+	if direction == "down" {
+		query, record = mig.Down, "delete from schema_migrations where version = $1"
+	}
+
+	// without arguments the statements are sent as they are, so a file may hold several
+	if strings.TrimSpace(query) != "" {
+		_, err = tx.ExecContext(ctx, query)
+		if err != nil {
+			return fmt.Errorf("%s_%s %s: %w", mig.Version, mig.Name, direction, err)
+		}
+	}
+	_, err = tx.ExecContext(ctx, record, mig.Version)
+	if err != nil {
+		return err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+
+	m.logger.Info("migrated", "version", mig.Version, "name", mig.Name, "direction", direction,
+		"duration", time.Since(start))
+	return nil
+}
@@ -0,0 +1,108 @@
+package migrate
+
+import (
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/GitEagleY/BookingsWebApp/migrations"
+)
+
+func file(s string) *fstest.MapFile {
+	return &fstest.MapFile{Data: []byte(s)}
+}
+
+func TestLoad(t *testing.T) {
+	fsys := fstest.MapFS{
+		"20200102000000_second.up.sql":   file("create table b (id int);"),
+		"20200102000000_second.down.sql": file("drop table b;"),
+		"20200101000000_first.up.sql":    file("create table a (id int);"),
+		"20200101000000_first.down.sql":  file("drop table a;"),
+		"README.md":                      file("not a migration"),
+	}
+
+	list, err := Load(fsys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 2 {
+		t.Fatalf("expected 2 migrations, got %d", len(list))
+	}
+	if list[0].Name != "first" || list[1].Name != "second" {
+		t.Errorf("expected the migrations sorted by version, got %s then %s", list[0].Name, list[1].Name)
+	}
+	if list[0].Up != "create table a (id int);" || list[0].Down != "drop table a;" {
+		t.Errorf("wrong SQL for %s: %q, %q", list[0].Name, list[0].Up, list[0].Down)
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		fsys     fstest.MapFS
+		expected string
+	}{
+		{"missing down", fstest.MapFS{
+			"20200101000000_first.up.sql": file("select 1;"),
+		}, "needs both an up and a down file"},
+		{"bad name", fstest.MapFS{
+			"2020_first.up.sql": file("select 1;"),
+		}, "not a migration"},
+		{"version used twice", fstest.MapFS{
+			"20200101000000_first.up.sql":    file("select 1;"),
+			"20200101000000_first.down.sql":  file("select 1;"),
+			"20200101000000_second.up.sql":   file("select 1;"),
+			"20200101000000_second.down.sql": file("select 1;"),
+		}, "is used by"},
+	}
+
+	for _, e := range tests {
+		_, err := Load(e.fsys)
+		if err == nil || !strings.Contains(err.Error(), e.expected) {
+			t.Errorf("%s: expected an error containing %q, got %v", e.name, e.expected, err)
+		}
+	}
+}
+
+func TestPendingAndRollback(t *testing.T) {
+	list := []Migration{{Version: "1"}, {Version: "2"}, {Version: "3"}}
+	applied := map[string]time.Time{"1": time.Now(), "2": time.Now()}
+
+	p := pending(list, applied)
+	if len(p) != 1 || p[0].Version != "3" {
+		t.Errorf("expected version 3 pending, got %v", p)
+	}
+
+	r, err := rollback(list, applied, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r) != 2 || r[0].Version != "2" || r[1].Version != "1" {
+		t.Errorf("expected versions 2 then 1 rolled back, got %v", r)
+	}
+
+	r, err = rollback(list, applied, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r) != 1 || r[0].Version != "2" {
+		t.Errorf("expected version 2 rolled back, got %v", r)
+	}
+
+	applied["4"] = time.Now()
+	_, err = rollback(list, applied, 1)
+	if err == nil {
+		t.Error("expected an error rolling back a version without a file")
+	}
+}
+
+func TestEmbeddedMigrations(t *testing.T) {
+	list, err := Load(migrations.FS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) == 0 || list[0].Name != "create_user_table" {
+		t.Errorf("expected the migrations to start with create_user_table, got %v", list)
+	}
+}
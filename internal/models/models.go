@@ -1,6 +1,7 @@
 package models
 
 import (
+	"strings"
 	"time"
 )
 
@@ -14,15 +15,31 @@ type User struct {
 	AcessLevel int
 	CreatedAt  time.Time
 	UpdatedAt  time.Time
+	DisabledAt time.Time // zero while the user may sign in
 }
 
+// Property is the bed and breakfast itself, as entered on the setup page.
+type Property struct {
+	Name         string
+	Timezone     string // e.g. Europe/Paris
+	ContactEmail string
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+}
+
+// AccessLevelAdmin is the access level of the staff accounts
+const AccessLevelAdmin = 3
+
 // Room model
 type Room struct {
-	ID        int
-	RoomName  string
-	Rooms     string
-	CreatedAt time.Time
-	UpdatedAt time.Time
+	ID          int
+	RoomName    string
+	NightlyRate int // in cents
+	Rooms       string
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+
+	CancellationPolicy string // encoded cancellation.Policy
 }
 
 // Restriction model
@@ -47,6 +64,168 @@ type Reservation struct {
 	UpdatedAt time.Time
 	Room      Room
 	Processed int
+	Source    string // how the booking came in, one of the Source constants
+	Note      string // internal note by staff
+	GuestID   int
+	Amount    int // price of the stay in cents
+
+	SpecialRequests    string // free text entered by the guest when booking
+	CancellationPolicy string // encoded cancellation.Policy agreed when booking
+
+	Guests   int
+	Currency string   // of Amount and the charges
+	Charges  []Charge // taxes and fees on top of Amount
+	Fees     int      // sum of the fees in cents, filled in by lists without the charges
+	Taxes    int      // sum of the taxes in cents, filled in by lists without the charges
+
+	PromotionCode string // promo code entered when booking
+	Discount      int    // taken off Amount by the promo code, in cents
+}
+
+// Nights returns the number of nights of the stay.
+func (r Reservation) Nights() int {
+	return int(r.EndDate.Sub(r.StartDate).Hours() / 24)
+}
+
+// FeeTotal returns the fees of the reservation in cents.
+func (r Reservation) FeeTotal() int {
+	if r.Charges == nil {
+		return r.Fees
+	}
+	return r.chargeTotal(TaxRuleFee)
+}
+
+// TaxTotal returns the taxes of the reservation in cents.
+func (r Reservation) TaxTotal() int {
+	if r.Charges == nil {
+		return r.Taxes
+	}
+	return r.chargeTotal(TaxRuleTax)
+}
+
+// Total returns the price of the stay less its discount, with taxes and fees in cents.
+func (r Reservation) Total() int {
+	return r.Amount - r.Discount + r.FeeTotal() + r.TaxTotal()
+}
+
+func (r Reservation) chargeTotal(kind string) int {
+	total := 0
+	for _, c := range r.Charges {
+		if c.Kind == kind {
+			total += c.Amount
+		}
+	}
+	return total
+}
+
+// Charge is a tax or fee charged on a reservation, worked out from a TaxRule when it was booked
+type Charge struct {
+	ID            int
+	ReservationID int
+	TaxRuleID     int
+	Kind          string // TaxRuleFee or TaxRuleTax
+	Description   string
+	Quantity      int
+	UnitAmount    int // in cents
+	Amount        int // in cents
+	Currency      string
+}
+
+// Cancellation records how a reservation was cancelled and what was refunded
+type Cancellation struct {
+	ReservationID int
+	Policy        string
+	DaysBefore    int
+	RefundPercent int
+	Paid          int    // in cents
+	Refund        int    // in cents
+	Fee           int    // in cents
+	CancelledBy   string // "guest" or "staff"
+}
+
+// ReservationNote is an internal staff note on a reservation. Replies to a note are kept in Replies.
+type ReservationNote struct {
+	ID            int
+	ReservationID int
+	ParentID      int
+	UserID        int
+	Author        string
+	Body          string
+	Pinned        bool
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+	Replies       []ReservationNote
+}
+
+// Guest model, shared by all reservations made with the same email address or phone number
+type Guest struct {
+	ID        int
+	FirstName string
+	LastName  string
+	Email     string
+	Phone     string
+	Notes     string
+	Tags      []string // e.g. VIP, do-not-rebook
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// HasTag reports whether the guest is tagged with tag, ignoring case.
+func (g Guest) HasTag(tag string) bool {
+	for _, t := range g.Tags {
+		if strings.EqualFold(t, tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// GuestSummary is a guest together with the totals of their stays
+type GuestSummary struct {
+	Guest
+	Stays      int
+	Nights     int
+	TotalSpent int // in cents, with fees, taxes and the deposits kept on cancelled stays
+	LastStay   time.Time
+}
+
+// Booking sources of a reservation
+const (
+	SourceWebsite = "website"
+	SourcePhone   = "phone"
+	SourceWalkIn  = "walk-in"
+	SourceEmail   = "email"
+	SourceChannel = "channel"
+	SourceImport  = "import"
+)
+
+// StaffSources are the booking sources staff can pick when entering a reservation
+var StaffSources = []string{SourcePhone, SourceWalkIn, SourceEmail, SourceChannel}
+
+// Restriction IDs as seeded into the restrictions table
+const (
+	RestrictionReservation = 1
+	RestrictionOwnerBlock  = 2
+	RestrictionHold        = 3
+)
+
+// ReservationFilter narrows down, orders and pages the admin reservation lists
+type ReservationFilter struct {
+	Query    string    // matched against name, email and phone
+	RoomID   int       // 0 means all rooms
+	From     time.Time // stays that end on or after this date
+	To       time.Time // stays that start on or before this date
+	Status   string    // "new", "processed" or empty for all
+	SortBy   string    // one of the sortable reservation columns
+	SortDesc bool
+	After    string // cursor of the last row on the previous page
+	Limit    int
+}
+
+// ReservationPage is one page of reservations matching a ReservationFilter
+type ReservationPage struct {
+	Reservations []Reservation
+	NextCursor   string // empty on the last page
 }
 
 // Room Restriction model
@@ -59,16 +238,184 @@ type RoomRestriction struct {
 	EndDate       time.Time
 	CreatedAt     time.Time
 	UpdatedAt     time.Time
+	ExpiresAt     time.Time // only set for holds
 	Room          Room
 	Reservations  Reservation
 	Restriction   Restriction
 }
 
+// WaitlistEntry model
+type WaitlistEntry struct {
+	ID             int
+	FirstName      string
+	Email          string
+	RoomID         int // 0 means any room
+	OfferedRoomID  int // the room whose freed nights the guest was emailed about
+	StartDate      time.Time
+	EndDate        time.Time
+	Token          string
+	TokenExpiresAt time.Time
+	NotifiedAt     time.Time
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+	Room           Room
+}
+
+// DashboardStats are the headline numbers of the admin dashboard
+type DashboardStats struct {
+	ArrivalsToday      int
+	DeparturesToday    int
+	ArrivalsThisWeek   int
+	DeparturesThisWeek int
+	NewReservations    int     // not processed yet
+	Cancellations      int     // cancelled in the selected range
+	AverageStay        float64 // nights, for arrivals in the selected range
+	AverageLeadTime    float64 // days between booking and arrival, for arrivals in the selected range
+}
+
+// RoomOccupancy is the number of booked nights of a room in one month
+type RoomOccupancy struct {
+	RoomID       int
+	RoomName     string
+	Month        time.Time
+	BookedNights int
+	Nights       int // nights of the month inside the selected range
+}
+
+// Rate returns the occupancy in percent.
+func (o RoomOccupancy) Rate() float64 {
+	if o.Nights == 0 {
+		return 0
+	}
+	return float64(o.BookedNights) * 100 / float64(o.Nights)
+}
+
+// MonthlyBookings are the booking numbers of one month
+type MonthlyBookings struct {
+	Month           time.Time
+	Arrivals        int
+	Cancellations   int
+	AverageStay     float64
+	AverageLeadTime float64
+}
+
+// TaxRule is a tax or fee charged on reservations. Fixed rules charge Amount cents per stay, night, guest or
+// guest and night; percentage rules charge Amount hundredths of a percent of the price of the stay.
+type TaxRule struct {
+	ID         int
+	Name       string
+	Kind       string // TaxRuleFee or TaxRuleTax
+	Method     string // TaxRulePercent or TaxRuleFixed
+	Basis      string // one of the TaxRulePer constants
+	Amount     int
+	Currency   string    // of fixed rules
+	ValidFrom  time.Time // first night the rule applies to, zero for no start
+	ValidUntil time.Time // last night the rule applies to, zero for no end
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+}
+
+// DefaultCurrency is the currency of reservations made without one
+const DefaultCurrency = "usd"
+
+// Kinds, methods and bases of a TaxRule
+const (
+	TaxRuleFee = "fee"
+	TaxRuleTax = "tax"
+
+	TaxRulePercent = "percent"
+	TaxRuleFixed   = "fixed"
+
+	TaxRulePerStay       = "stay"
+	TaxRulePerNight      = "night"
+	TaxRulePerGuest      = "guest"
+	TaxRulePerGuestNight = "guest_night"
+)
+
+// Promotion is a promo code giving a discount on the price of the stay. Percent promotions take Amount
+// hundredths of a percent off, fixed ones Amount cents. Zero limits are unlimited.
+type Promotion struct {
+	ID              int
+	Code            string
+	Description     string
+	Method          string // PromotionPercent or PromotionFixed
+	Amount          int
+	Currency        string    // of fixed promotions
+	ValidFrom       time.Time // first day it can be booked with, zero for no start
+	ValidUntil      time.Time // last day it can be booked with, zero for no end
+	RoomIDs         []int     // rooms it applies to, all rooms when empty
+	MinNights       int
+	MaxUses         int
+	MaxUsesPerGuest int
+	Uses            int // filled in by lists
+	CreatedAt       time.Time
+	UpdatedAt       time.Time
+}
+
+// Methods of a Promotion
+const (
+	PromotionPercent = "percent"
+	PromotionFixed   = "fixed"
+)
+
+// PromotionRedemption is the use of a promo code for a reservation
+type PromotionRedemption struct {
+	ID            int
+	PromotionID   int
+	Code          string
+	ReservationID int // 0 once the reservation is cancelled
+	GuestID       int
+	FirstName     string
+	LastName      string
+	Email         string
+	Discount      int
+	Currency      string
+	CreatedAt     time.Time
+}
+
+// Payment is money taken for, or refunded on, a reservation through a payment provider
+type Payment struct {
+	ID            int
+	ReservationID int
+	Provider      string
+	ProviderRef   string // id of the intent or refund at the provider
+	Kind          string // one of the Payment constants
+	Amount        int    // in cents
+	Currency      string
+	Status        string
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+}
+
+// Kinds of a Payment
+const (
+	PaymentDeposit = "deposit"
+	PaymentRefund  = "refund"
+)
+
+// Invoice is the invoice issued for a reservation. Its lines are worked out from the reservation and its
+// payments when it is rendered.
+type Invoice struct {
+	ID            int
+	Number        int // sequential, without gaps
+	ReservationID int
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+}
+
 // Holds an email message
 type MailData struct {
-	To       string
-	From     string
-	Subject  string
-	Content  string
-	Template string
+	To          string
+	From        string
+	Subject     string
+	Content     string
+	Template    string
+	Attachments []MailAttachment
+}
+
+// MailAttachment is a file attached to an email
+type MailAttachment struct {
+	Name        string
+	ContentType string
+	Data        []byte
 }
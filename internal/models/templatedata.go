@@ -8,6 +8,7 @@ type TemplateData struct {
 	FloatMap        map[string]float32
 	Data            map[string]interface{}
 	CSRFToken       string
+	CSPNonce        string // of the inline scripts
 	Flash           string
 	Warning         string
 	Error           string
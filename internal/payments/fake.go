@@ -0,0 +1,160 @@
+package payments
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+)
+
+// FakeSignatureHeader is the header holding the signature of a Fake webhook.
+const FakeSignatureHeader = "Fake-Signature"
+
+// Fake is a PaymentProvider that keeps its payments in memory, for tests and development.
+// Intents are authorised as soon as they are created, as if the guest had entered a working card,
+// unless they are declined with Decline.
+type Fake struct {
+	mu      sync.Mutex
+	secret  []byte
+	next    int
+	intents map[string]*fakeIntent
+}
+
+type fakeIntent struct {
+	Intent
+	refunded int
+}
+
+// fakeEvent is the webhook payload of the Fake provider.
+type fakeEvent struct {
+	Type     string `json:"type"`
+	IntentID string `json:"intent_id"`
+	RefundID string `json:"refund_id"`
+	Amount   int    `json:"amount"`
+}
+
+// NewFake returns a Fake provider whose webhooks are signed with webhookSecret.
+func NewFake(webhookSecret string) *Fake {
+	return &Fake{
+		secret:  []byte(webhookSecret),
+		intents: make(map[string]*fakeIntent),
+	}
+}
+
+// Name returns "fake".
+func (f *Fake) Name() string {
+	return "fake"
+}
+
+// CreateIntent creates an authorised intent.
+func (f *Fake) CreateIntent(ctx context.Context, amount int, currency, reference string) (Intent, error) {
+	if amount <= 0 {
+		return Intent{}, fmt.Errorf("payments: invalid amount %d", amount)
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.next++
+	id := fmt.Sprintf("pi_fake_%d", f.next)
+	i := &fakeIntent{Intent: Intent{
+		ID:           id,
+		ClientSecret: id + "_secret",
+		Status:       StatusRequiresCapture,
+		Amount:       amount,
+		Currency:     currency,
+	}}
+	f.intents[id] = i
+
+	return i.Intent, nil
+}
+
+// Decline makes the intent fail as if the card of the guest had been declined.
+func (f *Fake) Decline(intentID string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if i, ok := f.intents[intentID]; ok {
+		i.Status = StatusRequiresPayment
+	}
+}
+
+// Capture captures an authorised intent.
+func (f *Fake) Capture(ctx context.Context, intentID string) (Intent, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	i, ok := f.intents[intentID]
+	if !ok {
+		return Intent{}, ErrNotFound
+	}
+	if i.Status != StatusRequiresCapture {
+		return i.Intent, ErrNotCapturable
+	}
+	i.Status = StatusSucceeded
+
+	return i.Intent, nil
+}
+
+// Refund refunds amount of a captured intent.
+func (f *Fake) Refund(ctx context.Context, intentID string, amount int) (Refund, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	i, ok := f.intents[intentID]
+	if !ok {
+		return Refund{}, ErrNotFound
+	}
+	if i.Status != StatusSucceeded {
+		return Refund{}, ErrNotCapturable
+	}
+	if amount <= 0 || i.refunded+amount > i.Amount {
+		return Refund{}, ErrRefundTooLarge
+	}
+	i.refunded += amount
+
+	f.next++
+	return Refund{
+		ID:       fmt.Sprintf("re_fake_%d", f.next),
+		IntentID: intentID,
+		Status:   StatusSucceeded,
+		Amount:   amount,
+	}, nil
+}
+
+// VerifyWebhook checks the FakeSignatureHeader of a payload made by Webhook.
+func (f *Fake) VerifyWebhook(payload []byte, header http.Header) (Event, error) {
+	signature, err := hex.DecodeString(header.Get(FakeSignatureHeader))
+	if err != nil || !hmac.Equal(signature, f.sign(payload)) {
+		return Event{}, ErrInvalidSignature
+	}
+
+	var e fakeEvent
+	err = json.Unmarshal(payload, &e)
+	if err != nil {
+		return Event{}, err
+	}
+
+	return Event{Type: e.Type, IntentID: e.IntentID, RefundID: e.RefundID, Amount: e.Amount}, nil
+}
+
+// Webhook returns the payload and signature header of a webhook reporting e, to replay events
+// in tests and development.
+func (f *Fake) Webhook(e Event) ([]byte, http.Header) {
+	payload, _ := json.Marshal(fakeEvent{Type: e.Type, IntentID: e.IntentID, RefundID: e.RefundID, Amount: e.Amount})
+
+	header := make(http.Header)
+	header.Set(FakeSignatureHeader, hex.EncodeToString(f.sign(payload)))
+
+	return payload, header
+}
+
+func (f *Fake) sign(payload []byte) []byte {
+	mac := hmac.New(sha256.New, f.secret)
+	mac.Write(payload)
+	return mac.Sum(nil)
+}
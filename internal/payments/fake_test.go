@@ -0,0 +1,98 @@
+package payments
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+)
+
+func TestFake_CaptureAndRefund(t *testing.T) {
+	f := NewFake("secret")
+	ctx := context.Background()
+
+	i, err := f.CreateIntent(ctx, 5000, "usd", "res-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if i.Status != StatusRequiresCapture || i.ClientSecret == "" {
+		t.Errorf("unexpected intent %+v", i)
+	}
+
+	_, err = f.Refund(ctx, i.ID, 1000)
+	if !errors.Is(err, ErrNotCapturable) {
+		t.Errorf("refund before capture: expected ErrNotCapturable, got %v", err)
+	}
+
+	i, err = f.Capture(ctx, i.ID)
+	if err != nil || i.Status != StatusSucceeded {
+		t.Fatalf("capture failed: %+v %v", i, err)
+	}
+
+	_, err = f.Capture(ctx, i.ID)
+	if !errors.Is(err, ErrNotCapturable) {
+		t.Errorf("second capture: expected ErrNotCapturable, got %v", err)
+	}
+
+	r, err := f.Refund(ctx, i.ID, 3000)
+	if err != nil || r.Amount != 3000 || r.IntentID != i.ID || r.Status != StatusSucceeded {
+		t.Errorf("unexpected refund %+v %v", r, err)
+	}
+
+	_, err = f.Refund(ctx, i.ID, 2001)
+	if !errors.Is(err, ErrRefundTooLarge) {
+		t.Errorf("over refund: expected ErrRefundTooLarge, got %v", err)
+	}
+
+	_, err = f.Refund(ctx, i.ID, 2000)
+	if err != nil {
+		t.Errorf("refund of the rest failed: %v", err)
+	}
+}
+
+func TestFake_Decline(t *testing.T) {
+	f := NewFake("secret")
+	ctx := context.Background()
+
+	i, _ := f.CreateIntent(ctx, 5000, "usd", "res-1")
+	f.Decline(i.ID)
+
+	_, err := f.Capture(ctx, i.ID)
+	if !errors.Is(err, ErrNotCapturable) {
+		t.Errorf("expected ErrNotCapturable, got %v", err)
+	}
+
+	_, err = f.Capture(ctx, "pi_unknown")
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+
+	_, err = f.CreateIntent(ctx, 0, "usd", "res-1")
+	if err == nil {
+		t.Error("expected an error for a zero amount")
+	}
+}
+
+func TestFake_VerifyWebhook(t *testing.T) {
+	f := NewFake("secret")
+
+	payload, header := f.Webhook(Event{Type: EventPaymentSucceeded, IntentID: "pi_fake_1", Amount: 5000})
+
+	e, err := f.VerifyWebhook(payload, header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.Type != EventPaymentSucceeded || e.IntentID != "pi_fake_1" || e.Amount != 5000 {
+		t.Errorf("unexpected event %+v", e)
+	}
+
+	_, err = NewFake("other").VerifyWebhook(payload, header)
+	if !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("wrong secret: expected ErrInvalidSignature, got %v", err)
+	}
+
+	_, err = f.VerifyWebhook(payload, http.Header{})
+	if !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("missing header: expected ErrInvalidSignature, got %v", err)
+	}
+}
@@ -0,0 +1,77 @@
+// Package payments takes card payments through a PaymentProvider. Amounts are in cents.
+package payments
+
+import (
+	"context"
+	"errors"
+	"net/http"
+)
+
+// Statuses of an Intent or a Refund
+const (
+	StatusRequiresPayment = "requires_payment_method"
+	StatusRequiresCapture = "requires_capture"
+	StatusSucceeded       = "succeeded"
+	StatusFailed          = "failed"
+	StatusCanceled        = "canceled"
+	StatusPending         = "pending"
+)
+
+// Types of an Event
+const (
+	EventPaymentSucceeded = "payment_succeeded"
+	EventPaymentFailed    = "payment_failed"
+	EventRefundSucceeded  = "refund_succeeded"
+	EventRefundFailed     = "refund_failed"
+)
+
+var (
+	// ErrNotFound is returned for intents and refunds the provider does not know.
+	ErrNotFound = errors.New("payments: not found")
+	// ErrInvalidSignature is returned by VerifyWebhook when the payload was not signed by the provider.
+	ErrInvalidSignature = errors.New("payments: invalid webhook signature")
+	// ErrNotCapturable is returned by Capture when the guest has not authorised the payment.
+	ErrNotCapturable = errors.New("payments: payment is not authorised")
+	// ErrRefundTooLarge is returned by Refund when more than the captured amount would be refunded.
+	ErrRefundTooLarge = errors.New("payments: refund exceeds captured amount")
+)
+
+// Intent is a payment the guest authorises in the browser and the site captures afterwards.
+type Intent struct {
+	ID           string
+	ClientSecret string // handed to the browser to authorise the payment
+	Status       string
+	Amount       int
+	Currency     string
+}
+
+// Refund gives back all or part of a captured Intent.
+type Refund struct {
+	ID       string
+	IntentID string
+	Status   string
+	Amount   int
+}
+
+// Event is a change of a payment reported by the provider through a webhook. Events of other
+// types than the Event constants have an empty Type.
+type Event struct {
+	Type     string
+	IntentID string
+	RefundID string
+	Amount   int
+}
+
+// PaymentProvider is a payment service provider.
+type PaymentProvider interface {
+	// Name is the name of the provider, stored with the payment records.
+	Name() string
+	// CreateIntent starts a payment of amount in currency. reference identifies the payment on our side.
+	CreateIntent(ctx context.Context, amount int, currency, reference string) (Intent, error)
+	// Capture takes the money of an intent the guest has authorised.
+	Capture(ctx context.Context, intentID string) (Intent, error)
+	// Refund gives back amount of a captured intent.
+	Refund(ctx context.Context, intentID string, amount int) (Refund, error)
+	// VerifyWebhook checks the signature of a webhook request and returns the event it reports.
+	VerifyWebhook(payload []byte, header http.Header) (Event, error)
+}
@@ -0,0 +1,234 @@
+package payments
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// StripeSignatureHeader is the header holding the signature of a Stripe webhook.
+const StripeSignatureHeader = "Stripe-Signature"
+
+// stripeWebhookTolerance is how old a signed webhook may be before it is rejected as a replay.
+const stripeWebhookTolerance = 5 * time.Minute
+
+// Stripe is a PaymentProvider talking to the Stripe API. Intents are created with manual capture,
+// so the money is only taken once the reservation is confirmed.
+type Stripe struct {
+	SecretKey     string
+	WebhookSecret string
+	BaseURL       string
+	Client        *http.Client
+	Now           func() time.Time
+}
+
+// NewStripe returns a Stripe provider using the secret API key and the signing secret of the webhook endpoint.
+func NewStripe(secretKey, webhookSecret string) *Stripe {
+	return &Stripe{
+		SecretKey:     secretKey,
+		WebhookSecret: webhookSecret,
+		BaseURL:       "https://api.stripe.com",
+		Client:        &http.Client{Timeout: 10 * time.Second},
+		Now:           time.Now,
+	}
+}
+
+type stripeIntent struct {
+	ID           string `json:"id"`
+	ClientSecret string `json:"client_secret"`
+	Status       string `json:"status"`
+	Amount       int    `json:"amount"`
+	Currency     string `json:"currency"`
+}
+
+func (i stripeIntent) intent() Intent {
+	return Intent{ID: i.ID, ClientSecret: i.ClientSecret, Status: i.Status, Amount: i.Amount, Currency: i.Currency}
+}
+
+type stripeRefund struct {
+	ID            string `json:"id"`
+	PaymentIntent string `json:"payment_intent"`
+	Status        string `json:"status"`
+	Amount        int    `json:"amount"`
+}
+
+type stripeError struct {
+	Error struct {
+		Type    string `json:"type"`
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// Name returns "stripe".
+func (s *Stripe) Name() string {
+	return "stripe"
+}
+
+// CreateIntent creates a payment intent to be captured later.
+func (s *Stripe) CreateIntent(ctx context.Context, amount int, currency, reference string) (Intent, error) {
+	form := url.Values{}
+	form.Set("amount", strconv.Itoa(amount))
+	form.Set("currency", strings.ToLower(currency))
+	form.Set("capture_method", "manual")
+	form.Set("metadata[reference]", reference)
+
+	var i stripeIntent
+	err := s.post(ctx, "/v1/payment_intents", form, &i)
+	if err != nil {
+		return Intent{}, err
+	}
+	return i.intent(), nil
+}
+
+// Capture captures an intent the guest has confirmed in the browser.
+func (s *Stripe) Capture(ctx context.Context, intentID string) (Intent, error) {
+	var i stripeIntent
+	err := s.post(ctx, "/v1/payment_intents/"+url.PathEscape(intentID)+"/capture", url.Values{}, &i)
+	if err != nil {
+		return Intent{}, err
+	}
+	return i.intent(), nil
+}
+
+// Refund refunds amount of a captured intent.
+func (s *Stripe) Refund(ctx context.Context, intentID string, amount int) (Refund, error) {
+	form := url.Values{}
+	form.Set("payment_intent", intentID)
+	form.Set("amount", strconv.Itoa(amount))
+
+	var r stripeRefund
+	err := s.post(ctx, "/v1/refunds", form, &r)
+	if err != nil {
+		return Refund{}, err
+	}
+	return Refund{ID: r.ID, IntentID: r.PaymentIntent, Status: r.Status, Amount: r.Amount}, nil
+}
+
+// post sends form to the API and decodes the JSON response into v.
+func (s *Stripe) post(ctx context.Context, path string, form url.Values, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, "POST", s.BaseURL+path, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(s.SecretKey, "")
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		var e stripeError
+		_ = json.NewDecoder(resp.Body).Decode(&e)
+		switch {
+		case resp.StatusCode == http.StatusNotFound || e.Error.Code == "resource_missing":
+			return ErrNotFound
+		case e.Error.Code == "payment_intent_unexpected_state":
+			return ErrNotCapturable
+		case e.Error.Code == "amount_too_large":
+			return ErrRefundTooLarge
+		}
+		return fmt.Errorf("payments: stripe returned %d: %s", resp.StatusCode, e.Error.Message)
+	}
+
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// stripeEvent is the part of a Stripe webhook event we read.
+type stripeEvent struct {
+	Type string `json:"type"`
+	Data struct {
+		Object struct {
+			ID            string `json:"id"`
+			Object        string `json:"object"`
+			Status        string `json:"status"`
+			Amount        int    `json:"amount"`
+			PaymentIntent string `json:"payment_intent"`
+		} `json:"object"`
+	} `json:"data"`
+}
+
+// VerifyWebhook checks the Stripe-Signature header of a webhook and returns its event.
+func (s *Stripe) VerifyWebhook(payload []byte, header http.Header) (Event, error) {
+	err := s.verifySignature(payload, header.Get(StripeSignatureHeader))
+	if err != nil {
+		return Event{}, err
+	}
+
+	var e stripeEvent
+	err = json.Unmarshal(payload, &e)
+	if err != nil {
+		return Event{}, err
+	}
+
+	o := e.Data.Object
+	switch e.Type {
+	case "payment_intent.succeeded":
+		return Event{Type: EventPaymentSucceeded, IntentID: o.ID, Amount: o.Amount}, nil
+	case "payment_intent.payment_failed", "payment_intent.canceled":
+		return Event{Type: EventPaymentFailed, IntentID: o.ID, Amount: o.Amount}, nil
+	case "refund.updated", "refund.failed":
+		switch o.Status {
+		case StatusSucceeded:
+			return Event{Type: EventRefundSucceeded, IntentID: o.PaymentIntent, RefundID: o.ID, Amount: o.Amount}, nil
+		case StatusFailed, StatusCanceled:
+			return Event{Type: EventRefundFailed, IntentID: o.PaymentIntent, RefundID: o.ID, Amount: o.Amount}, nil
+		}
+	}
+
+	return Event{IntentID: o.ID}, nil
+}
+
+// verifySignature checks a header of the form "t=timestamp,v1=signature,..." against the payload.
+func (s *Stripe) verifySignature(payload []byte, header string) error {
+	var timestamp string
+	var signatures [][]byte
+	for _, part := range strings.Split(header, ",") {
+		kv := strings.SplitN(strings.TrimSpace(part), "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		switch kv[0] {
+		case "t":
+			timestamp = kv[1]
+		case "v1":
+			sig, err := hex.DecodeString(kv[1])
+			if err == nil {
+				signatures = append(signatures, sig)
+			}
+		}
+	}
+
+	sec, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil || len(signatures) == 0 {
+		return ErrInvalidSignature
+	}
+	age := s.Now().Sub(time.Unix(sec, 0))
+	if age > stripeWebhookTolerance || age < -stripeWebhookTolerance {
+		return fmt.Errorf("%w: timestamp outside tolerance", ErrInvalidSignature)
+	}
+
+	mac := hmac.New(sha256.New, []byte(s.WebhookSecret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(payload)
+	expected := mac.Sum(nil)
+
+	for _, sig := range signatures {
+		if hmac.Equal(sig, expected) {
+			return nil
+		}
+	}
+	return ErrInvalidSignature
+}
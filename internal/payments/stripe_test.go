@@ -0,0 +1,136 @@
+package payments
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// newTestStripe returns a Stripe provider talking to a test server with handler.
+func newTestStripe(t *testing.T, handler http.HandlerFunc) *Stripe {
+	ts := httptest.NewServer(handler)
+	t.Cleanup(ts.Close)
+
+	s := NewStripe("sk_test", "whsec_test")
+	s.BaseURL = ts.URL
+	s.Client = ts.Client()
+	return s
+}
+
+func TestStripe_CreateIntent(t *testing.T) {
+	s := newTestStripe(t, func(w http.ResponseWriter, r *http.Request) {
+		user, _, _ := r.BasicAuth()
+		if r.URL.Path != "/v1/payment_intents" || user != "sk_test" {
+			t.Errorf("unexpected request %s as %q", r.URL.Path, user)
+		}
+		_ = r.ParseForm()
+		if r.Form.Get("amount") != "5000" || r.Form.Get("currency") != "usd" ||
+			r.Form.Get("capture_method") != "manual" || r.Form.Get("metadata[reference]") != "res-1" {
+			t.Errorf("unexpected form %v", r.Form)
+		}
+		fmt.Fprint(w, `{"id":"pi_1","client_secret":"pi_1_secret","status":"requires_payment_method","amount":5000,"currency":"usd"}`)
+	})
+
+	i, err := s.CreateIntent(context.Background(), 5000, "USD", "res-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if i.ID != "pi_1" || i.ClientSecret != "pi_1_secret" || i.Amount != 5000 {
+		t.Errorf("unexpected intent %+v", i)
+	}
+}
+
+func TestStripe_CaptureAndRefund(t *testing.T) {
+	s := newTestStripe(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/payment_intents/pi_1/capture":
+			fmt.Fprint(w, `{"id":"pi_1","status":"succeeded","amount":5000,"currency":"usd"}`)
+		case "/v1/payment_intents/pi_2/capture":
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"error":{"code":"payment_intent_unexpected_state","message":"not confirmed"}}`)
+		case "/v1/refunds":
+			_ = r.ParseForm()
+			fmt.Fprintf(w, `{"id":"re_1","payment_intent":%q,"status":"succeeded","amount":%s}`,
+				r.Form.Get("payment_intent"), r.Form.Get("amount"))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"error":{"code":"resource_missing","message":"no such intent"}}`)
+		}
+	})
+	ctx := context.Background()
+
+	i, err := s.Capture(ctx, "pi_1")
+	if err != nil || i.Status != StatusSucceeded {
+		t.Errorf("capture: %+v %v", i, err)
+	}
+
+	_, err = s.Capture(ctx, "pi_2")
+	if !errors.Is(err, ErrNotCapturable) {
+		t.Errorf("expected ErrNotCapturable, got %v", err)
+	}
+
+	_, err = s.Capture(ctx, "pi_3")
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+
+	r, err := s.Refund(ctx, "pi_1", 2500)
+	if err != nil || r.ID != "re_1" || r.IntentID != "pi_1" || r.Amount != 2500 {
+		t.Errorf("refund: %+v %v", r, err)
+	}
+}
+
+// stripeSignature signs a payload the way Stripe does.
+func stripeSignature(secret string, at time.Time, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d.%s", at.Unix(), payload)
+	return fmt.Sprintf("t=%d,v1=%s", at.Unix(), hex.EncodeToString(mac.Sum(nil)))
+}
+
+func TestStripe_VerifyWebhook(t *testing.T) {
+	now := time.Date(2050, 1, 1, 12, 0, 0, 0, time.UTC)
+	s := NewStripe("sk_test", "whsec_test")
+	s.Now = func() time.Time { return now }
+
+	succeeded := []byte(`{"type":"payment_intent.succeeded","data":{"object":{"id":"pi_1","amount":5000}}}`)
+	refunded := []byte(`{"type":"refund.updated","data":{"object":{"id":"re_1","status":"succeeded","amount":2500,"payment_intent":"pi_1"}}}`)
+	other := []byte(`{"type":"customer.created","data":{"object":{"id":"cus_1"}}}`)
+
+	var tests = []struct {
+		name          string
+		payload       []byte
+		signature     string
+		expectedEvent Event
+		expectedErr   error
+	}{
+		{"succeeded", succeeded, stripeSignature("whsec_test", now, succeeded),
+			Event{Type: EventPaymentSucceeded, IntentID: "pi_1", Amount: 5000}, nil},
+		{"refunded", refunded, stripeSignature("whsec_test", now.Add(-time.Minute), refunded),
+			Event{Type: EventRefundSucceeded, IntentID: "pi_1", RefundID: "re_1", Amount: 2500}, nil},
+		{"ignored-type", other, stripeSignature("whsec_test", now, other), Event{IntentID: "cus_1"}, nil},
+		{"wrong-secret", succeeded, stripeSignature("whsec_other", now, succeeded), Event{}, ErrInvalidSignature},
+		{"tampered", []byte(`{"type":"payment_intent.succeeded"}`), stripeSignature("whsec_test", now, succeeded), Event{}, ErrInvalidSignature},
+		{"too-old", succeeded, stripeSignature("whsec_test", now.Add(-time.Hour), succeeded), Event{}, ErrInvalidSignature},
+		{"missing", succeeded, "", Event{}, ErrInvalidSignature},
+	}
+
+	for _, e := range tests {
+		header := http.Header{}
+		header.Set(StripeSignatureHeader, e.signature)
+
+		event, err := s.VerifyWebhook(e.payload, header)
+		if !errors.Is(err, e.expectedErr) {
+			t.Errorf("%s: expected error %v, got %v", e.name, e.expectedErr, err)
+		}
+		if event != e.expectedEvent {
+			t.Errorf("%s: expected event %+v, got %+v", e.name, e.expectedEvent, event)
+		}
+	}
+}
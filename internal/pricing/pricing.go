@@ -0,0 +1,240 @@
+// Package pricing works out the price of a stay with its taxes and fees from the tax rules. Amounts are
+// in cents.
+package pricing
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/GitEagleY/BookingsWebApp/internal/models"
+)
+
+// ErrInvalidRule is returned by Validate for rules that can't be applied.
+var ErrInvalidRule = errors.New("invalid tax rule")
+
+// Validate checks a tax rule can be applied.
+func Validate(r models.TaxRule) error {
+	switch {
+	case strings.TrimSpace(r.Name) == "":
+		return fmt.Errorf("%w: missing name", ErrInvalidRule)
+	case r.Kind != models.TaxRuleFee && r.Kind != models.TaxRuleTax:
+		return fmt.Errorf("%w: unknown kind %q", ErrInvalidRule, r.Kind)
+	case r.Amount < 0:
+		return fmt.Errorf("%w: negative amount", ErrInvalidRule)
+	case !r.ValidFrom.IsZero() && !r.ValidUntil.IsZero() && r.ValidUntil.Before(r.ValidFrom):
+		return fmt.Errorf("%w: ends before it starts", ErrInvalidRule)
+	}
+
+	switch r.Method {
+	case models.TaxRulePercent:
+		if r.Basis != models.TaxRulePerStay {
+			return fmt.Errorf("%w: percentages are charged on the stay", ErrInvalidRule)
+		}
+	case models.TaxRuleFixed:
+		switch r.Basis {
+		case models.TaxRulePerStay, models.TaxRulePerNight, models.TaxRulePerGuest, models.TaxRulePerGuestNight:
+		default:
+			return fmt.Errorf("%w: unknown basis %q", ErrInvalidRule, r.Basis)
+		}
+		if len(r.Currency) != 3 {
+			return fmt.Errorf("%w: fixed amounts need a currency", ErrInvalidRule)
+		}
+	default:
+		return fmt.Errorf("%w: unknown method %q", ErrInvalidRule, r.Method)
+	}
+
+	return nil
+}
+
+// Stay is what is being priced.
+type Stay struct {
+	Arrival     time.Time
+	Departure   time.Time
+	Guests      int
+	NightlyRate int
+	Currency    string
+	Discount    int // taken off the price of the nights, before taxes and fees
+}
+
+// Quote is the price of a stay.
+type Quote struct {
+	Currency      string
+	Nights        int
+	Accommodation int
+	Discount      int
+	Charges       []models.Charge
+}
+
+// Fees returns the fees of the quote.
+func (q Quote) Fees() int {
+	return q.sum(models.TaxRuleFee)
+}
+
+// Taxes returns the taxes of the quote.
+func (q Quote) Taxes() int {
+	return q.sum(models.TaxRuleTax)
+}
+
+// Total returns the price of the stay less its discount, with taxes and fees.
+func (q Quote) Total() int {
+	return q.Accommodation - q.Discount + q.Fees() + q.Taxes()
+}
+
+func (q Quote) sum(kind string) int {
+	total := 0
+	for _, c := range q.Charges {
+		if c.Kind == kind {
+			total += c.Amount
+		}
+	}
+	return total
+}
+
+// Calculate prices the stay. Fees are worked out before taxes, so percentage taxes are charged on the fees too,
+// and percentages are charged on the price after the discount.
+//
+// A rule only applies to the nights between its ValidFrom and ValidUntil dates: per night rules count those
+// nights, percentage rules are charged on the part of the price falling on them, and per stay and per guest
+// rules apply when the first night does. Invalid rules, and fixed rules in another currency than the stay,
+// are left out.
+func Calculate(s Stay, rules []models.TaxRule) Quote {
+	nights := int(day(s.Departure).Sub(day(s.Arrival)).Hours() / 24)
+	if nights < 0 {
+		nights = 0
+	}
+	guests := s.Guests
+	if guests < 1 {
+		guests = 1
+	}
+
+	q := Quote{
+		Currency:      strings.ToLower(s.Currency),
+		Nights:        nights,
+		Accommodation: s.NightlyRate * nights,
+	}
+	if nights == 0 {
+		return q
+	}
+	q.Discount = s.Discount
+	if q.Discount > q.Accommodation {
+		q.Discount = q.Accommodation
+	}
+
+	for _, kind := range []string{models.TaxRuleFee, models.TaxRuleTax} {
+		// taxes are charged on the fees worked out before them
+		base := q.Accommodation - q.Discount + q.Fees()
+
+		for _, r := range rules {
+			if r.Kind != kind || Validate(r) != nil {
+				continue
+			}
+
+			inRange := 0
+			for i := 0; i < nights; i++ {
+				if applies(r, day(s.Arrival).AddDate(0, 0, i)) {
+					inRange++
+				}
+			}
+			if inRange == 0 {
+				continue
+			}
+
+			c := models.Charge{
+				TaxRuleID:   r.ID,
+				Kind:        r.Kind,
+				Description: r.Name,
+				Quantity:    1,
+				Currency:    q.Currency,
+			}
+
+			if r.Method == models.TaxRulePercent {
+				c.Description += " (" + Percent(r.Amount) + ")"
+				c.UnitAmount = roundDiv(int64(base)*int64(inRange)*int64(r.Amount), int64(nights)*10000)
+				c.Amount = c.UnitAmount
+				q.Charges = append(q.Charges, c)
+				continue
+			}
+
+			if !strings.EqualFold(r.Currency, s.Currency) {
+				continue
+			}
+			switch r.Basis {
+			case models.TaxRulePerStay, models.TaxRulePerGuest:
+				if !applies(r, day(s.Arrival)) {
+					continue
+				}
+				if r.Basis == models.TaxRulePerGuest {
+					c.Quantity = guests
+				}
+			case models.TaxRulePerNight:
+				c.Quantity = inRange
+			case models.TaxRulePerGuestNight:
+				c.Quantity = guests * inRange
+			}
+			c.UnitAmount = r.Amount
+			c.Amount = r.Amount * c.Quantity
+			q.Charges = append(q.Charges, c)
+		}
+	}
+
+	return q
+}
+
+// applies reports whether the rule applies to the night starting on date.
+func applies(r models.TaxRule, date time.Time) bool {
+	if !r.ValidFrom.IsZero() && date.Before(day(r.ValidFrom)) {
+		return false
+	}
+	if !r.ValidUntil.IsZero() && date.After(day(r.ValidUntil)) {
+		return false
+	}
+	return true
+}
+
+// day is the calendar date of t, at midnight UTC.
+func day(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// roundDiv divides a by b, rounding halves up.
+func roundDiv(a, b int64) int {
+	return int((a + b/2) / b)
+}
+
+// Percent formats a percentage in hundredths of a percent, e.g. 2000 as 20% and 750 as 7.5%.
+func Percent(hundredths int) string {
+	s := strconv.Itoa(hundredths/100) + "." + fmt.Sprintf("%02d", hundredths%100)
+	s = strings.TrimRight(strings.TrimRight(s, "0"), ".")
+	return s + "%"
+}
+
+// ParsePercent parses a percentage such as "20" or "7.5" into hundredths of a percent.
+func ParsePercent(s string) (int, error) {
+	s = strings.TrimSuffix(strings.TrimSpace(s), "%")
+	whole, frac, _ := strings.Cut(s, ".")
+	if len(frac) > 2 {
+		return 0, fmt.Errorf("%w: at most two decimals", ErrInvalidRule)
+	}
+	frac += strings.Repeat("0", 2-len(frac))
+	w, err := strconv.Atoi(whole)
+	if err != nil || w < 0 {
+		return 0, fmt.Errorf("%w: invalid percentage %q", ErrInvalidRule, s)
+	}
+	f, err := strconv.Atoi(frac)
+	if err != nil || f < 0 {
+		return 0, fmt.Errorf("%w: invalid percentage %q", ErrInvalidRule, s)
+	}
+	return w*100 + f, nil
+}
+
+// ParseMoney parses an amount such as "2" or "2.50" into cents.
+func ParseMoney(s string) (int, error) {
+	cents, err := ParsePercent(s)
+	if err != nil {
+		return 0, fmt.Errorf("%w: invalid amount %q", ErrInvalidRule, s)
+	}
+	return cents, nil
+}
@@ -0,0 +1,224 @@
+package pricing
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/GitEagleY/BookingsWebApp/internal/models"
+)
+
+func date(s string) time.Time {
+	t, _ := time.Parse("2006-01-02", s)
+	return t
+}
+
+var (
+	cleaning   = models.TaxRule{ID: 1, Name: "Cleaning fee", Kind: models.TaxRuleFee, Method: models.TaxRuleFixed, Basis: models.TaxRulePerStay, Amount: 3000, Currency: "usd"}
+	tourist    = models.TaxRule{ID: 2, Name: "Tourist tax", Kind: models.TaxRuleTax, Method: models.TaxRuleFixed, Basis: models.TaxRulePerGuestNight, Amount: 250, Currency: "usd"}
+	vat        = models.TaxRule{ID: 3, Name: "VAT", Kind: models.TaxRuleTax, Method: models.TaxRulePercent, Basis: models.TaxRulePerStay, Amount: 1000}
+	towels     = models.TaxRule{ID: 4, Name: "Towels", Kind: models.TaxRuleFee, Method: models.TaxRuleFixed, Basis: models.TaxRulePerGuest, Amount: 500, Currency: "usd"}
+	parking    = models.TaxRule{ID: 5, Name: "Parking", Kind: models.TaxRuleFee, Method: models.TaxRuleFixed, Basis: models.TaxRulePerNight, Amount: 1000, Currency: "usd"}
+	service    = models.TaxRule{ID: 6, Name: "Service", Kind: models.TaxRuleFee, Method: models.TaxRulePercent, Basis: models.TaxRulePerStay, Amount: 500}
+	euroFee    = models.TaxRule{ID: 7, Name: "Euro fee", Kind: models.TaxRuleFee, Method: models.TaxRuleFixed, Basis: models.TaxRulePerStay, Amount: 100, Currency: "eur"}
+	summerTax  = models.TaxRule{ID: 8, Name: "Summer tax", Kind: models.TaxRuleTax, Method: models.TaxRuleFixed, Basis: models.TaxRulePerNight, Amount: 100, Currency: "usd", ValidFrom: date("2050-06-01"), ValidUntil: date("2050-08-31")}
+	oldVAT     = models.TaxRule{ID: 9, Name: "VAT", Kind: models.TaxRuleTax, Method: models.TaxRulePercent, Basis: models.TaxRulePerStay, Amount: 1000, ValidUntil: date("2050-06-01")}
+	newVAT     = models.TaxRule{ID: 10, Name: "VAT", Kind: models.TaxRuleTax, Method: models.TaxRulePercent, Basis: models.TaxRulePerStay, Amount: 2000, ValidFrom: date("2050-06-02")}
+	futureFee  = models.TaxRule{ID: 11, Name: "Future fee", Kind: models.TaxRuleFee, Method: models.TaxRuleFixed, Basis: models.TaxRulePerStay, Amount: 100, Currency: "usd", ValidFrom: date("2050-06-02")}
+	brokenRule = models.TaxRule{ID: 12, Name: "Broken", Kind: models.TaxRuleTax, Method: models.TaxRulePercent, Basis: models.TaxRulePerNight, Amount: 100}
+)
+
+var calculateTests = []struct {
+	name    string
+	stay    Stay
+	rules   []models.TaxRule
+	charges map[string]int // amount by description
+	total   int
+}{
+	{
+		name:  "no-rules",
+		stay:  Stay{Arrival: date("2050-01-01"), Departure: date("2050-01-04"), Guests: 2, NightlyRate: 10000, Currency: "usd"},
+		total: 30000,
+	},
+	{
+		name:    "cleaning-tourist-tax-and-vat",
+		stay:    Stay{Arrival: date("2050-01-01"), Departure: date("2050-01-04"), Guests: 2, NightlyRate: 10000, Currency: "USD"},
+		rules:   []models.TaxRule{vat, tourist, cleaning},
+		charges: map[string]int{"Cleaning fee": 3000, "Tourist tax": 1500, "VAT (10%)": 3300},
+		total:   30000 + 3000 + 1500 + 3300,
+	},
+	{
+		name:    "per-guest-and-per-night",
+		stay:    Stay{Arrival: date("2050-01-01"), Departure: date("2050-01-03"), Guests: 3, NightlyRate: 5000, Currency: "usd"},
+		rules:   []models.TaxRule{towels, parking},
+		charges: map[string]int{"Towels": 1500, "Parking": 2000},
+		total:   10000 + 1500 + 2000,
+	},
+	{
+		name:    "percentage-fee-rounded",
+		stay:    Stay{Arrival: date("2050-01-01"), Departure: date("2050-01-02"), Guests: 1, NightlyRate: 8999, Currency: "usd"},
+		rules:   []models.TaxRule{service},
+		charges: map[string]int{"Service (5%)": 450},
+		total:   8999 + 450,
+	},
+	{
+		name:    "other-currency-left-out",
+		stay:    Stay{Arrival: date("2050-01-01"), Departure: date("2050-01-02"), Guests: 1, NightlyRate: 1000, Currency: "usd"},
+		rules:   []models.TaxRule{euroFee, cleaning},
+		charges: map[string]int{"Cleaning fee": 3000},
+		total:   4000,
+	},
+	{
+		name:    "nights-in-range-only",
+		stay:    Stay{Arrival: date("2050-05-30"), Departure: date("2050-06-03"), Guests: 1, NightlyRate: 1000, Currency: "usd"},
+		rules:   []models.TaxRule{summerTax},
+		charges: map[string]int{"Summer tax": 200},
+		total:   4000 + 200,
+	},
+	{
+		name:    "rate-change-mid-stay",
+		stay:    Stay{Arrival: date("2050-05-31"), Departure: date("2050-06-04"), Guests: 1, NightlyRate: 1000, Currency: "usd"},
+		rules:   []models.TaxRule{oldVAT, newVAT},
+		charges: map[string]int{"VAT (10%)": 200, "VAT (20%)": 400},
+		total:   4000 + 600,
+	},
+	{
+		name:  "per-stay-needs-first-night",
+		stay:  Stay{Arrival: date("2050-05-31"), Departure: date("2050-06-04"), Guests: 1, NightlyRate: 1000, Currency: "usd"},
+		rules: []models.TaxRule{futureFee},
+		total: 4000,
+	},
+	{
+		name:  "invalid-rule-left-out",
+		stay:  Stay{Arrival: date("2050-01-01"), Departure: date("2050-01-02"), Guests: 1, NightlyRate: 1000, Currency: "usd"},
+		rules: []models.TaxRule{brokenRule},
+		total: 1000,
+	},
+	{
+		name:    "discount-before-vat",
+		stay:    Stay{Arrival: date("2050-01-01"), Departure: date("2050-01-03"), Guests: 1, NightlyRate: 10000, Currency: "usd", Discount: 5000},
+		rules:   []models.TaxRule{cleaning, vat},
+		charges: map[string]int{"Cleaning fee": 3000, "VAT (10%)": 1800},
+		total:   20000 - 5000 + 3000 + 1800,
+	},
+	{
+		name:  "discount-capped",
+		stay:  Stay{Arrival: date("2050-01-01"), Departure: date("2050-01-02"), Guests: 1, NightlyRate: 1000, Currency: "usd", Discount: 5000},
+		total: 0,
+	},
+	{
+		name:  "no-nights",
+		stay:  Stay{Arrival: date("2050-01-01"), Departure: date("2050-01-01"), Guests: 1, NightlyRate: 1000, Currency: "usd"},
+		rules: []models.TaxRule{cleaning, vat},
+		total: 0,
+	},
+	{
+		name:    "no-guests-counts-one",
+		stay:    Stay{Arrival: date("2050-01-01"), Departure: date("2050-01-02"), NightlyRate: 1000, Currency: "usd"},
+		rules:   []models.TaxRule{tourist},
+		charges: map[string]int{"Tourist tax": 250},
+		total:   1250,
+	},
+}
+
+func TestCalculate(t *testing.T) {
+	for _, e := range calculateTests {
+		q := Calculate(e.stay, e.rules)
+
+		if len(q.Charges) != len(e.charges) {
+			t.Errorf("%s: expected %d charges, got %+v", e.name, len(e.charges), q.Charges)
+		}
+		for _, c := range q.Charges {
+			expected, ok := e.charges[c.Description]
+			if !ok || c.Amount != expected {
+				t.Errorf("%s: unexpected charge %s of %d", e.name, c.Description, c.Amount)
+			}
+			if c.Amount != c.UnitAmount*c.Quantity {
+				t.Errorf("%s: %s is not %d x %d", e.name, c.Description, c.Quantity, c.UnitAmount)
+			}
+			if c.Currency != "usd" {
+				t.Errorf("%s: expected the charges in usd, got %s", e.name, c.Currency)
+			}
+		}
+		if q.Total() != e.total {
+			t.Errorf("%s: expected a total of %d, got %d", e.name, e.total, q.Total())
+		}
+	}
+}
+
+func TestQuoteFeesAndTaxes(t *testing.T) {
+	q := Calculate(calculateTests[1].stay, calculateTests[1].rules)
+
+	if q.Accommodation != 30000 || q.Fees() != 3000 || q.Taxes() != 4800 {
+		t.Errorf("expected 30000 + 3000 fees + 4800 taxes, got %d + %d + %d", q.Accommodation, q.Fees(), q.Taxes())
+	}
+}
+
+var validateTests = []struct {
+	name  string
+	rule  models.TaxRule
+	valid bool
+}{
+	{"fixed", cleaning, true},
+	{"percent", vat, true},
+	{"missing-name", models.TaxRule{Kind: models.TaxRuleFee, Method: models.TaxRuleFixed, Basis: models.TaxRulePerStay, Currency: "usd"}, false},
+	{"unknown-kind", models.TaxRule{Name: "x", Kind: "discount", Method: models.TaxRuleFixed, Basis: models.TaxRulePerStay, Currency: "usd"}, false},
+	{"unknown-method", models.TaxRule{Name: "x", Kind: models.TaxRuleFee, Method: "tiered", Basis: models.TaxRulePerStay, Currency: "usd"}, false},
+	{"unknown-basis", models.TaxRule{Name: "x", Kind: models.TaxRuleFee, Method: models.TaxRuleFixed, Basis: "week", Currency: "usd"}, false},
+	{"percent-per-night", brokenRule, false},
+	{"fixed-without-currency", models.TaxRule{Name: "x", Kind: models.TaxRuleFee, Method: models.TaxRuleFixed, Basis: models.TaxRulePerStay}, false},
+	{"negative", models.TaxRule{Name: "x", Kind: models.TaxRuleFee, Method: models.TaxRuleFixed, Basis: models.TaxRulePerStay, Currency: "usd", Amount: -1}, false},
+	{"ends-before-start", models.TaxRule{Name: "x", Kind: models.TaxRuleFee, Method: models.TaxRuleFixed, Basis: models.TaxRulePerStay, Currency: "usd", ValidFrom: date("2050-02-01"), ValidUntil: date("2050-01-01")}, false},
+}
+
+func TestValidate(t *testing.T) {
+	for _, e := range validateTests {
+		err := Validate(e.rule)
+		if e.valid && err != nil {
+			t.Errorf("%s: expected valid, got %v", e.name, err)
+		}
+		if !e.valid && !errors.Is(err, ErrInvalidRule) {
+			t.Errorf("%s: expected ErrInvalidRule, got %v", e.name, err)
+		}
+	}
+}
+
+func TestPercent(t *testing.T) {
+	tests := map[int]string{0: "0%", 750: "7.5%", 1000: "10%", 2000: "20%", 1234: "12.34%", 10000: "100%"}
+	for hundredths, expected := range tests {
+		if got := Percent(hundredths); got != expected {
+			t.Errorf("Percent(%d): expected %s, got %s", hundredths, expected, got)
+		}
+	}
+}
+
+func TestParsePercent(t *testing.T) {
+	tests := []struct {
+		s        string
+		expected int
+		valid    bool
+	}{
+		{"20", 2000, true},
+		{"7.5", 750, true},
+		{"12.34%", 1234, true},
+		{" 0 ", 0, true},
+		{"1.234", 0, false},
+		{"-5", 0, false},
+		{"abc", 0, false},
+		{"", 0, false},
+	}
+	for _, e := range tests {
+		got, err := ParsePercent(e.s)
+		if e.valid && (err != nil || got != e.expected) {
+			t.Errorf("ParsePercent(%q): expected %d, got %d, %v", e.s, e.expected, got, err)
+		}
+		if !e.valid && err == nil {
+			t.Errorf("ParsePercent(%q): expected an error, got %d", e.s, got)
+		}
+	}
+
+	cents, err := ParseMoney("2.5")
+	if err != nil || cents != 250 {
+		t.Errorf("ParseMoney(2.5): expected 250, got %d, %v", cents, err)
+	}
+}
@@ -0,0 +1,108 @@
+// Package promotions checks promo codes and works out their discount. Amounts are in cents.
+package promotions
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/GitEagleY/BookingsWebApp/internal/models"
+)
+
+// ErrInvalidPromotion is returned by Validate for promotions that can't be saved.
+var ErrInvalidPromotion = errors.New("invalid promotion")
+
+// ErrNotApplicable is returned by Check and CheckUses when a promo code can't be used for a reservation.
+var ErrNotApplicable = errors.New("this promo code can't be used")
+
+// Code normalises a promo code as entered by a guest, e.g. " summer24 " as SUMMER24.
+func Code(s string) string {
+	return strings.ToUpper(strings.TrimSpace(s))
+}
+
+// Validate checks a promotion can be saved.
+func Validate(p models.Promotion) error {
+	switch {
+	case p.Code == "" || p.Code != Code(p.Code) || strings.ContainsAny(p.Code, " \t"):
+		return fmt.Errorf("%w: codes are one word in capitals", ErrInvalidPromotion)
+	case p.Amount <= 0:
+		return fmt.Errorf("%w: the discount must be more than zero", ErrInvalidPromotion)
+	case p.MinNights < 0 || p.MaxUses < 0 || p.MaxUsesPerGuest < 0:
+		return fmt.Errorf("%w: negative limit", ErrInvalidPromotion)
+	case !p.ValidFrom.IsZero() && !p.ValidUntil.IsZero() && p.ValidUntil.Before(p.ValidFrom):
+		return fmt.Errorf("%w: ends before it starts", ErrInvalidPromotion)
+	}
+
+	switch p.Method {
+	case models.PromotionPercent:
+		if p.Amount > 10000 {
+			return fmt.Errorf("%w: more than 100%% off", ErrInvalidPromotion)
+		}
+	case models.PromotionFixed:
+		if len(p.Currency) != 3 {
+			return fmt.Errorf("%w: fixed discounts need a currency", ErrInvalidPromotion)
+		}
+	default:
+		return fmt.Errorf("%w: unknown method %q", ErrInvalidPromotion, p.Method)
+	}
+
+	return nil
+}
+
+// Check reports whether the promotion can be used for the reservation res booked at now: on a day within its
+// validity window, for one of its rooms and for at least its minimum stay. Usage limits are checked by
+// CheckUses.
+func Check(p models.Promotion, res models.Reservation, now time.Time) error {
+	today := day(now)
+	switch {
+	case !p.ValidFrom.IsZero() && today.Before(day(p.ValidFrom)):
+		return fmt.Errorf("%w: it isn't valid yet", ErrNotApplicable)
+	case !p.ValidUntil.IsZero() && today.After(day(p.ValidUntil)):
+		return fmt.Errorf("%w: it has expired", ErrNotApplicable)
+	case p.MinNights > 0 && res.Nights() < p.MinNights:
+		return fmt.Errorf("%w: it needs a stay of at least %d nights", ErrNotApplicable, p.MinNights)
+	case p.Method == models.PromotionFixed && !strings.EqualFold(p.Currency, res.Currency):
+		return fmt.Errorf("%w: it is for bookings in %s", ErrNotApplicable, strings.ToUpper(p.Currency))
+	}
+
+	if len(p.RoomIDs) == 0 {
+		return nil
+	}
+	for _, id := range p.RoomIDs {
+		if id == res.RoomID {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: it isn't valid for this room", ErrNotApplicable)
+}
+
+// CheckUses reports whether the promotion can be used again, given it has been used uses times in all and
+// guestUses times by the guest.
+func CheckUses(p models.Promotion, uses, guestUses int) error {
+	if p.MaxUses > 0 && uses >= p.MaxUses {
+		return fmt.Errorf("%w: it has been used up", ErrNotApplicable)
+	}
+	if p.MaxUsesPerGuest > 0 && guestUses >= p.MaxUsesPerGuest {
+		return fmt.Errorf("%w: you have already used it", ErrNotApplicable)
+	}
+	return nil
+}
+
+// Discount returns the discount of the promotion on a stay priced accommodation, never more than the
+// accommodation itself. Percentages are rounded to the nearest cent.
+func Discount(p models.Promotion, accommodation int) int {
+	discount := p.Amount
+	if p.Method == models.PromotionPercent {
+		discount = int((int64(accommodation)*int64(p.Amount) + 5000) / 10000)
+	}
+	if discount > accommodation {
+		return accommodation
+	}
+	return discount
+}
+
+// day is the calendar date of t, at midnight UTC.
+func day(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
@@ -0,0 +1,122 @@
+package promotions
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/GitEagleY/BookingsWebApp/internal/models"
+)
+
+func date(s string) time.Time {
+	t, _ := time.Parse("2006-01-02", s)
+	return t
+}
+
+var (
+	summer = models.Promotion{Code: "SUMMER", Method: models.PromotionPercent, Amount: 1500,
+		ValidFrom: date("2050-06-01"), ValidUntil: date("2050-08-31")}
+	tenOff = models.Promotion{Code: "TENOFF", Method: models.PromotionFixed, Amount: 1000, Currency: "usd",
+		RoomIDs: []int{1, 3}, MinNights: 2}
+
+	stay = models.Reservation{RoomID: 1, Currency: "usd", StartDate: date("2050-07-01"), EndDate: date("2050-07-03")}
+)
+
+var checkTests = []struct {
+	name  string
+	promo models.Promotion
+	res   models.Reservation
+	now   time.Time
+	valid bool
+}{
+	{"in-window", summer, stay, date("2050-06-01"), true},
+	{"last-day", summer, stay, time.Date(2050, 8, 31, 23, 59, 0, 0, time.UTC), true},
+	{"not-started", summer, stay, date("2050-05-31"), false},
+	{"expired", summer, stay, date("2050-09-01"), false},
+	{"room-and-stay", tenOff, stay, date("2050-01-01"), true},
+	{"other-room", tenOff, models.Reservation{RoomID: 2, Currency: "usd", StartDate: stay.StartDate, EndDate: stay.EndDate}, date("2050-01-01"), false},
+	{"too-short", tenOff, models.Reservation{RoomID: 1, Currency: "usd", StartDate: stay.StartDate, EndDate: stay.StartDate.AddDate(0, 0, 1)}, date("2050-01-01"), false},
+	{"other-currency", tenOff, models.Reservation{RoomID: 1, Currency: "eur", StartDate: stay.StartDate, EndDate: stay.EndDate}, date("2050-01-01"), false},
+}
+
+func TestCheck(t *testing.T) {
+	for _, e := range checkTests {
+		err := Check(e.promo, e.res, e.now)
+		if e.valid && err != nil {
+			t.Errorf("%s: expected the code to apply, got %v", e.name, err)
+		}
+		if !e.valid && !errors.Is(err, ErrNotApplicable) {
+			t.Errorf("%s: expected ErrNotApplicable, got %v", e.name, err)
+		}
+	}
+}
+
+func TestCheckUses(t *testing.T) {
+	p := models.Promotion{MaxUses: 10, MaxUsesPerGuest: 1}
+
+	if err := CheckUses(p, 9, 0); err != nil {
+		t.Errorf("expected a use left, got %v", err)
+	}
+	if err := CheckUses(p, 10, 0); !errors.Is(err, ErrNotApplicable) {
+		t.Errorf("expected the code to be used up, got %v", err)
+	}
+	if err := CheckUses(p, 3, 1); !errors.Is(err, ErrNotApplicable) {
+		t.Errorf("expected the guest to have used the code, got %v", err)
+	}
+	if err := CheckUses(models.Promotion{}, 1000, 1000); err != nil {
+		t.Errorf("expected no limits, got %v", err)
+	}
+}
+
+func TestDiscount(t *testing.T) {
+	tests := []struct {
+		promo         models.Promotion
+		accommodation int
+		expected      int
+	}{
+		{summer, 20000, 3000},
+		{summer, 8999, 1350},
+		{tenOff, 20000, 1000},
+		{tenOff, 500, 500},
+		{models.Promotion{Method: models.PromotionPercent, Amount: 10000}, 12345, 12345},
+	}
+	for _, e := range tests {
+		if got := Discount(e.promo, e.accommodation); got != e.expected {
+			t.Errorf("%s on %d: expected %d, got %d", e.promo.Code, e.accommodation, e.expected, got)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name  string
+		promo models.Promotion
+		valid bool
+	}{
+		{"percent", summer, true},
+		{"fixed", tenOff, true},
+		{"lower-case", models.Promotion{Code: "summer", Method: models.PromotionPercent, Amount: 100}, false},
+		{"two-words", models.Promotion{Code: "BIG SALE", Method: models.PromotionPercent, Amount: 100}, false},
+		{"no-discount", models.Promotion{Code: "ZERO", Method: models.PromotionPercent}, false},
+		{"over-100", models.Promotion{Code: "FREE", Method: models.PromotionPercent, Amount: 10001}, false},
+		{"fixed-without-currency", models.Promotion{Code: "TEN", Method: models.PromotionFixed, Amount: 1000}, false},
+		{"unknown-method", models.Promotion{Code: "BOGO", Method: "bogo", Amount: 1}, false},
+		{"negative-limit", models.Promotion{Code: "X", Method: models.PromotionPercent, Amount: 1, MaxUses: -1}, false},
+		{"ends-before-start", models.Promotion{Code: "X", Method: models.PromotionPercent, Amount: 1, ValidFrom: date("2050-02-01"), ValidUntil: date("2050-01-01")}, false},
+	}
+	for _, e := range tests {
+		err := Validate(e.promo)
+		if e.valid && err != nil {
+			t.Errorf("%s: expected valid, got %v", e.name, err)
+		}
+		if !e.valid && !errors.Is(err, ErrInvalidPromotion) {
+			t.Errorf("%s: expected ErrInvalidPromotion, got %v", e.name, err)
+		}
+	}
+}
+
+func TestCode(t *testing.T) {
+	if got := Code(" summer24 "); got != "SUMMER24" {
+		t.Errorf("expected SUMMER24, got %s", got)
+	}
+}
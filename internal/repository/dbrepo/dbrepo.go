@@ -1,9 +1,13 @@
 package dbrepo
 
 import (
+	"context"
 	"database/sql"
+	"log/slog"
+	"time"
 
 	"github.com/GitEagleY/BookingsWebApp/internal/config"
+	"github.com/GitEagleY/BookingsWebApp/internal/logging"
 	repository "github.com/GitEagleY/BookingsWebApp/internal/repository"
 )
 
@@ -25,6 +29,26 @@ func NewPostgresRepo(conn *sql.DB, a *config.AppConfig) repository.DatabaseRepo
 	}
 }
 
+// DefaultQueryTimeout limits the queries of a repository method when the application doesn't set a timeout.
+const DefaultQueryTimeout = 3 * time.Second
+
+// withTimeout returns ctx limited to the query timeout of the application, the queries of a method run with it.
+func (m *postgresDBRepo) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	timeout := DefaultQueryTimeout
+	if m.App != nil && m.App.QueryTimeout > 0 {
+		timeout = m.App.QueryTimeout
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// logger returns the logger carried by ctx or the application's.
+func (m *postgresDBRepo) logger(ctx context.Context) *slog.Logger {
+	if m.App == nil {
+		return logging.FromContext(ctx, nil)
+	}
+	return logging.FromContext(ctx, m.App.Logger)
+}
+
 func NewTestingRepo(a *config.AppConfig) repository.DatabaseRepo {
 	return &testDBRepo{
 		App: a, // Initialize the App field with the provided AppConfig.
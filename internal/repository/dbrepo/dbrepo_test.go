@@ -0,0 +1,102 @@
+package dbrepo
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/GitEagleY/BookingsWebApp/internal/config"
+	"github.com/GitEagleY/BookingsWebApp/internal/models"
+	"github.com/GitEagleY/BookingsWebApp/internal/repository"
+)
+
+func TestWithTimeout(t *testing.T) {
+	tests := []struct {
+		name     string
+		app      *config.AppConfig
+		expected time.Duration
+	}{
+		{"no-app", nil, DefaultQueryTimeout},
+		{"not-set", &config.AppConfig{}, DefaultQueryTimeout},
+		{"configured", &config.AppConfig{QueryTimeout: 10 * time.Second}, 10 * time.Second},
+	}
+
+	for _, e := range tests {
+		m := &postgresDBRepo{App: e.app}
+		ctx, cancel := m.withTimeout(context.Background())
+		deadline, ok := ctx.Deadline()
+		cancel()
+
+		if left := time.Until(deadline); !ok || left > e.expected || left < e.expected-time.Second {
+			t.Errorf("%s: expected a deadline in %s, got %s", e.name, e.expected, left)
+		}
+	}
+
+	// the request going away cancels the queries
+	parent, cancelRequest := context.WithCancel(context.Background())
+	ctx, cancel := (&postgresDBRepo{}).withTimeout(parent)
+	defer cancel()
+	cancelRequest()
+	select {
+	case <-ctx.Done():
+	case <-time.After(time.Second):
+		t.Error("query context not cancelled with the request")
+	}
+
+	// a shorter deadline of the request is kept
+	parent, cancelRequest = context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancelRequest()
+	ctx, cancel = (&postgresDBRepo{}).withTimeout(parent)
+	defer cancel()
+	if deadline, _ := ctx.Deadline(); time.Until(deadline) > time.Second {
+		t.Errorf("request deadline not kept, got %s", time.Until(deadline))
+	}
+}
+
+func TestReservationCursor(t *testing.T) {
+	res := models.Reservation{
+		ID:        7,
+		FirstName: "John",
+		LastName:  "Smith",
+		StartDate: time.Date(2050, 1, 1, 0, 0, 0, 0, time.UTC),
+		EndDate:   time.Date(2050, 1, 3, 0, 0, 0, 0, time.UTC),
+		CreatedAt: time.Date(2049, 12, 1, 10, 30, 0, 123456000, time.UTC),
+	}
+
+	// the cursor of a page can be read back whatever the list is sorted on
+	for sortBy, col := range reservationSortColumns {
+		cursor := encodeReservationCursor(reservationSortValue(res, sortBy), res.ID)
+		value, id, err := decodeReservationCursor(cursor, col.sqlType)
+		if err != nil || id != res.ID || value != reservationSortValue(res, sortBy) {
+			t.Errorf("%s: cursor came back as %q, %d, %v", sortBy, value, id, err)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		cursor string
+		sortBy string
+	}{
+		{"not-base64", "not a cursor!", "last_name"},
+		{"no-separator", base64.RawURLEncoding.EncodeToString([]byte("7")), "last_name"},
+		{"bad-id", base64.RawURLEncoding.EncodeToString([]byte("x:Smith")), "last_name"},
+		{"bad-date", base64.RawURLEncoding.EncodeToString([]byte("7:junk")), "start_date"},
+		{"bad-timestamp", base64.RawURLEncoding.EncodeToString([]byte("7:2050-01-01")), "created_at"},
+		{"bad-integer", base64.RawURLEncoding.EncodeToString([]byte("7:99999999999")), "id"},
+	}
+
+	for _, e := range tests {
+		_, _, err := decodeReservationCursor(e.cursor, reservationSortColumns[e.sortBy].sqlType)
+		if !errors.Is(err, repository.ErrInvalidCursor) {
+			t.Errorf("%s: expected ErrInvalidCursor, got %v", e.name, err)
+		}
+
+		// the query isn't built, so a bad cursor never reaches Postgres
+		_, _, err = reservationSearchQuery(models.ReservationFilter{SortBy: e.sortBy, After: e.cursor}, 25)
+		if !errors.Is(err, repository.ErrInvalidCursor) {
+			t.Errorf("%s: expected the search to fail with ErrInvalidCursor, got %v", e.name, err)
+		}
+	}
+}
@@ -2,30 +2,136 @@ package dbrepo
 
 import (
 	"context"
+	"database/sql"
+	"encoding/base64"
 	"errors"
+	"fmt"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/GitEagleY/BookingsWebApp/internal/models"
+	"github.com/GitEagleY/BookingsWebApp/internal/promotions"
+	"github.com/GitEagleY/BookingsWebApp/internal/repository"
 	"golang.org/x/crypto/bcrypt"
 )
 
-// AllUsers returns a boolean value (always true in this case).
-func (m *postgresDBRepo) AllUsers() bool {
-	return true
+// SetupDone reports whether the setup page was completed, or users were added some other way, e.g. with
+// the user create command or before there was a setup page.
+func (m *postgresDBRepo) SetupDone(ctx context.Context) (bool, error) {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	var done bool
+	err := m.DB.QueryRowContext(ctx, `select exists(select 1 from property) or exists(select 1 from users)`).Scan(&done)
+	return done, err
+}
+
+// CompleteSetup saves the property and adds its owner, signing in with password, and returns the owner's ID.
+// It returns repository.ErrSetupDone unless it is the first setup and there are no users.
+func (m *postgresDBRepo) CompleteSetup(ctx context.Context, p models.Property, owner models.User, password string) (int, error) {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), passwordCost)
+	if err != nil {
+		return 0, err
+	}
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	// the table has a single row, a second setup waits for the first one here and then inserts nothing
+	now := time.Now()
+	result, err := tx.ExecContext(ctx, `insert into property (id, name, timezone, contact_email, created_at, updated_at)
+			values (1, $1, $2, $3, $4, $4) on conflict (id) do nothing`,
+		p.Name, p.Timezone, p.ContactEmail, now)
+	if err != nil {
+		return 0, err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	var users bool
+	err = tx.QueryRowContext(ctx, `select exists(select 1 from users)`).Scan(&users)
+	if err != nil {
+		return 0, err
+	}
+	if n == 0 || users {
+		return 0, repository.ErrSetupDone
+	}
+
+	var newID int
+	err = tx.QueryRowContext(ctx, `insert into users (first_name, last_name, email, password, access_level, created_at, updated_at)
+			values ($1, $2, $3, $4, $5, $6, $6) returning id`,
+		owner.FirstName,
+		owner.LastName,
+		owner.Email,
+		string(hash),
+		owner.AcessLevel,
+		now,
+	).Scan(&newID)
+	if err != nil {
+		return 0, err
+	}
+
+	return newID, tx.Commit()
 }
 
-// InsertReservations inserts a new reservation into the database and returns the new ID.
-func (m *postgresDBRepo) InsertReservation(res models.Reservation) (int, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+// GetProperty returns the property entered on the setup page, or sql.ErrNoRows before the setup.
+func (m *postgresDBRepo) GetProperty(ctx context.Context) (models.Property, error) {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	var p models.Property
+	err := m.DB.QueryRowContext(ctx, `select name, timezone, contact_email, created_at, updated_at from property`).Scan(
+		&p.Name,
+		&p.Timezone,
+		&p.ContactEmail,
+		&p.CreatedAt,
+		&p.UpdatedAt,
+	)
+	return p, err
+}
+
+// reservationAmount is the SQL for the price of a stay, given the start date as $5, the end date as $6
+// and the room as $7.
+const reservationAmount = `(select nightly_rate from rooms where id = $7) * ($6::date - $5::date)`
+
+// reservationPolicy is the SQL for the cancellation policy of the room $7, copied onto a new reservation.
+const reservationPolicy = `(select cancellation_policy from rooms where id = $7)`
+
+// InsertReservations inserts a new reservation with its charges into the database and returns the new ID.
+// The reservation is linked to the guest with the same email address or phone number, or to a new guest.
+func (m *postgresDBRepo) InsertReservation(ctx context.Context, res models.Reservation) (int, error) {
+	ctx, cancel := m.withTimeout(ctx)
 	defer cancel()
 
 	var newID int
 
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	guestID, err := guestForReservation(ctx, tx, res)
+	if err != nil {
+		return 0, err
+	}
+
 	stmt := `insert into reservations (first_name, last_name, email, phone, start_date,
-			end_date, room_id, created_at, updated_at) 
-			values ($1, $2, $3, $4, $5, $6, $7, $8, $9) returning id`
+			end_date, room_id, guest_id, amount, created_at, updated_at, special_requests, cancellation_policy,
+			guests, currency, promotion_code, discount)
+			values ($1, $2, $3, $4, $5, $6, $7, $8, ` + reservationAmount + `, $9, $10, $11, ` + reservationPolicy + `,
+			$12, $13, $14, $15) returning id`
 
-	err := m.DB.QueryRowContext(ctx, stmt,
+	err = tx.QueryRowContext(ctx, stmt,
 		res.FirstName,
 		res.LastName,
 		res.Email,
@@ -33,20 +139,132 @@ func (m *postgresDBRepo) InsertReservation(res models.Reservation) (int, error)
 		res.StartDate,
 		res.EndDate,
 		res.RoomID,
+		guestID,
 		time.Now(),
 		time.Now(),
+		res.SpecialRequests,
+		reservationGuests(res),
+		reservationCurrency(res),
+		res.PromotionCode,
+		res.Discount,
 	).Scan(&newID)
 
 	if err != nil {
 		return 0, err
 	}
 
+	err = insertChargesTx(ctx, tx, newID, res.Charges)
+	if err != nil {
+		return 0, err
+	}
+
+	err = redeemPromotionTx(ctx, tx, newID, guestID, res)
+	if err != nil {
+		return 0, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, err
+	}
 	return newID, nil
 }
 
+// reservationGuests is the number of guests stored for a reservation, at least one.
+func reservationGuests(res models.Reservation) int {
+	if res.Guests < 1 {
+		return 1
+	}
+	return res.Guests
+}
+
+// reservationCurrency is the currency stored for a reservation.
+func reservationCurrency(res models.Reservation) string {
+	if res.Currency == "" {
+		return models.DefaultCurrency
+	}
+	return strings.ToLower(res.Currency)
+}
+
+// insertChargesTx inserts the taxes and fees of the reservation id.
+func insertChargesTx(ctx context.Context, q querier, id int, charges []models.Charge) error {
+	stmt := `insert into reservation_charges (reservation_id, tax_rule_id, kind, description, quantity, unit_amount,
+			amount, currency, created_at, updated_at)
+			values ($1, nullif($2, 0), $3, $4, $5, $6, $7, $8, $9, $9)`
+
+	for _, c := range charges {
+		_, err := q.ExecContext(ctx, stmt,
+			id,
+			c.TaxRuleID,
+			c.Kind,
+			c.Description,
+			c.Quantity,
+			c.UnitAmount,
+			c.Amount,
+			strings.ToLower(c.Currency),
+			time.Now(),
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// redeemPromotionTx records the use of the promo code of res for the reservation id booked by the guest
+// guestID. The promotion is locked while its uses are counted, so its limits hold with concurrent bookings;
+// an error wrapping promotions.ErrNotApplicable is returned when it can't be used.
+func redeemPromotionTx(ctx context.Context, q querier, id, guestID int, res models.Reservation) error {
+	if res.PromotionCode == "" {
+		return nil
+	}
+
+	p, err := scanPromotion(q.QueryRowContext(ctx, promotionQuery+` where p.code = $1 for update of p`, res.PromotionCode))
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("%w: unknown code", promotions.ErrNotApplicable)
+	}
+	if err != nil {
+		return err
+	}
+
+	err = promotions.Check(p, res, time.Now())
+	if err != nil {
+		return err
+	}
+
+	var uses, guestUses int
+	err = q.QueryRowContext(ctx, `select count(*), count(*) filter (where guest_id = $2)
+			from promotion_redemptions where promotion_id = $1`, p.ID, guestID).Scan(&uses, &guestUses)
+	if err != nil {
+		return err
+	}
+
+	err = promotions.CheckUses(p, uses, guestUses)
+	if err != nil {
+		return err
+	}
+
+	stmt := `insert into promotion_redemptions (promotion_id, code, reservation_id, guest_id, first_name, last_name,
+			email, discount, currency, created_at, updated_at)
+			values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $10)`
+
+	_, err = q.ExecContext(ctx, stmt,
+		p.ID,
+		p.Code,
+		id,
+		guestID,
+		res.FirstName,
+		res.LastName,
+		res.Email,
+		res.Discount,
+		reservationCurrency(res),
+		time.Now(),
+	)
+	return err
+}
+
 // InsertRoomRestrictions inserts room restrictions into the database.
-func (m *postgresDBRepo) InsertRoomRestriction(r models.RoomRestriction) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+func (m *postgresDBRepo) InsertRoomRestriction(ctx context.Context, r models.RoomRestriction) error {
+	ctx, cancel := m.withTimeout(ctx)
 	defer cancel()
 
 	stmt := `insert into room_restrictions (start_date, end_date, room_id,restriction_id, reservation_id,	
@@ -71,8 +289,8 @@ func (m *postgresDBRepo) InsertRoomRestriction(r models.RoomRestriction) error {
 }
 
 // SearchAvailabilityDatesByRoomsID checks if a room is available within a specified time range.
-func (m *postgresDBRepo) SearchAvailabilityByDatesByRoomID(start, end time.Time, roomID int) (bool, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+func (m *postgresDBRepo) SearchAvailabilityByDatesByRoomID(ctx context.Context, start, end time.Time, roomID int) (bool, error) {
+	ctx, cancel := m.withTimeout(ctx)
 	defer cancel()
 
 	var numRows int
@@ -84,9 +302,10 @@ func (m *postgresDBRepo) SearchAvailabilityByDatesByRoomID(start, end time.Time,
 			room_restrictions
 		where
 			room_id = $1
-			and $2 < end_date and $3 > start_date;`
+			and $2 < end_date and $3 > start_date
+			and (expires_at is null or expires_at > $4);`
 
-	row := m.DB.QueryRowContext(ctx, query, roomID, start, end)
+	row := m.DB.QueryRowContext(ctx, query, roomID, start, end, time.Now())
 	err := row.Scan(&numRows)
 	if err != nil {
 		return false, err
@@ -99,8 +318,8 @@ func (m *postgresDBRepo) SearchAvailabilityByDatesByRoomID(start, end time.Time,
 }
 
 // SearchAvailabilityForAllRooms searches for available rooms within a specified time range.
-func (m *postgresDBRepo) SearchAvailabilityForAllRooms(start, end time.Time) ([]models.Room, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+func (m *postgresDBRepo) SearchAvailabilityForAllRooms(ctx context.Context, start, end time.Time) ([]models.Room, error) {
+	ctx, cancel := m.withTimeout(ctx)
 	defer cancel()
 
 	var rooms []models.Room
@@ -111,10 +330,12 @@ func (m *postgresDBRepo) SearchAvailabilityForAllRooms(start, end time.Time) ([]
 		from
 			rooms r
 		where r.id not in 
-		(select room_id from room_restrictions rr where $1 < rr.end_date and $2 > rr.start_date);
+		(select room_id from room_restrictions rr where $1 < rr.end_date and $2 > rr.start_date
+			and (rr.expires_at is null or rr.expires_at > $3))
+		order by r.id;
 		`
 
-	rows, err := m.DB.QueryContext(ctx, query, start, end)
+	rows, err := m.DB.QueryContext(ctx, query, start, end, time.Now())
 	if err != nil {
 		return rooms, err
 	}
@@ -139,20 +360,22 @@ func (m *postgresDBRepo) SearchAvailabilityForAllRooms(start, end time.Time) ([]
 }
 
 // GetRoomByID gets a room by id
-func (m *postgresDBRepo) GetRoomByID(id int) (models.Room, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+func (m *postgresDBRepo) GetRoomByID(ctx context.Context, id int) (models.Room, error) {
+	ctx, cancel := m.withTimeout(ctx)
 	defer cancel()
 
 	var room models.Room
 
 	query := `
-		select id, room_name, created_at, updated_at from rooms where id = $1
+		select id, room_name, nightly_rate, cancellation_policy, created_at, updated_at from rooms where id = $1
 `
 
 	row := m.DB.QueryRowContext(ctx, query, id)
 	err := row.Scan(
 		&room.ID,
 		&room.RoomName,
+		&room.NightlyRate,
+		&room.CancellationPolicy,
 		&room.CreatedAt,
 		&room.UpdatedAt,
 	)
@@ -164,8 +387,8 @@ func (m *postgresDBRepo) GetRoomByID(id int) (models.Room, error) {
 	return room, nil
 }
 
-func (m *postgresDBRepo) GetUserByID(id int) (models.User, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+func (m *postgresDBRepo) GetUserByID(ctx context.Context, id int) (models.User, error) {
+	ctx, cancel := m.withTimeout(ctx)
 	defer cancel()
 	query := `select id, first_name,email,password,acess_level,created_at,updated_at
 from users where id = $1`
@@ -188,8 +411,8 @@ from users where id = $1`
 	return u, nil
 }
 
-func (m *postgresDBRepo) UpdateUser(u models.User) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+func (m *postgresDBRepo) UpdateUser(ctx context.Context, u models.User) error {
+	ctx, cancel := m.withTimeout(ctx)
 	defer cancel()
 	query := `
 	update users set first_name=$1,last_name=$2,email=$3,access_level=$4,updated_at=$5
@@ -202,14 +425,14 @@ func (m *postgresDBRepo) UpdateUser(u models.User) error {
 
 }
 
-func (m *postgresDBRepo) Authenticate(email, testPassword string) (int, string, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+func (m *postgresDBRepo) Authenticate(ctx context.Context, email, testPassword string) (int, string, error) {
+	ctx, cancel := m.withTimeout(ctx)
 	defer cancel()
 
 	var id int
 	var hashedPassword string
 
-	row := m.DB.QueryRowContext(ctx, "select id,password from users where email=$1", email)
+	row := m.DB.QueryRowContext(ctx, "select id,password from users where email=$1 and disabled_at is null", email)
 
 	err := row.Scan(&id, &hashedPassword)
 	if err != nil {
@@ -225,113 +448,350 @@ func (m *postgresDBRepo) Authenticate(email, testPassword string) (int, string,
 	return id, hashedPassword, nil
 }
 
-// returns a slice of all reservations
-func (m *postgresDBRepo) AllReservations() ([]models.Reservation, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+// passwordCost is the bcrypt cost of the stored passwords.
+const passwordCost = 12
+
+// GetUserByEmail returns the user with the email address, disabled or not.
+func (m *postgresDBRepo) GetUserByEmail(ctx context.Context, email string) (models.User, error) {
+	ctx, cancel := m.withTimeout(ctx)
 	defer cancel()
 
-	var reservations []models.Reservation
+	query := `select id, first_name, last_name, email, password, access_level, created_at, updated_at, disabled_at
+		from users where email = $1`
 
-	query := `
-	select r.id,r.first_name,r.last_name, r.email,r.phone,r.start_date,r.end_date,r.room_id,r.created_at,r.updated_at,r.processed,
-	rm.id,rm.room_name 
-	from reservations r
-	left join rooms rm on (r.room_id=rm.id)
-	order by r.start_date asc
-	`
-	rows, err := m.DB.QueryContext(ctx, query)
+	var u models.User
+	var disabledAt sql.NullTime
+	err := m.DB.QueryRowContext(ctx, query, email).Scan(
+		&u.ID,
+		&u.FirstName,
+		&u.LastName,
+		&u.Email,
+		&u.Password,
+		&u.AcessLevel,
+		&u.CreatedAt,
+		&u.UpdatedAt,
+		&disabledAt,
+	)
+	if err != nil {
+		return u, err
+	}
+	u.DisabledAt = disabledAt.Time
+	return u, nil
+}
+
+// InsertUser adds a user signing in with password, stored hashed as Authenticate expects, and returns the new ID.
+func (m *postgresDBRepo) InsertUser(ctx context.Context, u models.User, password string) (int, error) {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
 
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), passwordCost)
 	if err != nil {
-		return reservations, err
+		return 0, err
+	}
+
+	var newID int
+	stmt := `insert into users (first_name, last_name, email, password, access_level, created_at, updated_at)
+			values ($1, $2, $3, $4, $5, $6, $6) returning id`
+
+	err = m.DB.QueryRowContext(ctx, stmt,
+		u.FirstName,
+		u.LastName,
+		u.Email,
+		string(hash),
+		u.AcessLevel,
+		time.Now(),
+	).Scan(&newID)
+	if err != nil {
+		return 0, err
+	}
+	return newID, nil
+}
+
+// UpdateUserPassword sets the password of a user, stored hashed as Authenticate expects.
+func (m *postgresDBRepo) UpdateUserPassword(ctx context.Context, id int, password string) error {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), passwordCost)
+	if err != nil {
+		return err
+	}
+
+	_, err = m.DB.ExecContext(ctx, `update users set password = $1, updated_at = $2 where id = $3`,
+		string(hash), time.Now(), id)
+	return err
+}
+
+// DisableUser stops a user from signing in. The user is kept for the notes written by them.
+func (m *postgresDBRepo) DisableUser(ctx context.Context, id int) error {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, `update users set disabled_at = $1, updated_at = $1 where id = $2 and disabled_at is null`,
+		time.Now(), id)
+	return err
+}
+
+// reservationSortColumns maps the sortable columns of the admin lists to their SQL expression and type.
+var reservationSortColumns = map[string]struct {
+	expr    string
+	sqlType string
+}{
+	"id":         {"r.id", "integer"},
+	"first_name": {"r.first_name", "text"},
+	"last_name":  {"r.last_name", "text"},
+	"email":      {"r.email", "text"},
+	"phone":      {"r.phone", "text"},
+	"room":       {"rm.room_name", "text"},
+	"start_date": {"r.start_date", "date"},
+	"end_date":   {"r.end_date", "date"},
+	"created_at": {"r.created_at", "timestamp"},
+	"processed":  {"r.processed", "integer"},
+}
+
+// SearchReservations returns one page of reservations matching the filter. Pages are keyset paginated
+// on the sort column and the reservation id, so f.After is the NextCursor of the previous page.
+func (m *postgresDBRepo) SearchReservations(ctx context.Context, f models.ReservationFilter) (models.ReservationPage, error) {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	var page models.ReservationPage
+
+	limit := f.Limit
+	if limit <= 0 {
+		limit = 25
+	}
+
+	// ask for one extra row to find out whether there is another page
+	query, args, err := reservationSearchQuery(f, limit+1)
+	if err != nil {
+		return page, err
+	}
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return page, err
 	}
 	defer rows.Close()
+
 	for rows.Next() {
-		var i models.Reservation
-		err := rows.Scan(
-			&i.ID,
-			&i.FirstName,
-			&i.LastName,
-			&i.Email,
-			&i.Phone,
-			&i.StartDate,
-			&i.EndDate,
-			&i.RoomID,
-			&i.CreatedAt,
-			&i.UpdatedAt,
-			&i.Processed,
-			&i.Room.ID,
-			&i.Room.RoomName,
-		)
+		i, err := scanReservationRow(rows)
 		if err != nil {
-			return reservations, err
-		}
-		reservations = append(reservations, i)
-		if err = rows.Err(); err != nil {
-			return reservations, err
+			return page, err
 		}
+		page.Reservations = append(page.Reservations, i)
+	}
+	if err = rows.Err(); err != nil {
+		return page, err
+	}
 
+	if len(page.Reservations) > limit {
+		page.Reservations = page.Reservations[:limit]
+		last := page.Reservations[limit-1]
+		page.NextCursor = encodeReservationCursor(reservationSortValue(last, f.SortBy), last.ID)
 	}
-	return reservations, nil
+
+	return page, nil
 }
 
-// returns a slice of all new reservations
-func (m *postgresDBRepo) AllNewReservations() ([]models.Reservation, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+// StreamReservations calls fn for every reservation matching the filter, one row at a time, without
+// loading them all into memory. Paging fields of the filter are ignored.
+func (m *postgresDBRepo) StreamReservations(ctx context.Context, f models.ReservationFilter, fn func(models.Reservation) error) error {
+	// an export reads every row, far longer than a single query is allowed
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Minute)
 	defer cancel()
 
-	var reservations []models.Reservation
+	f.After = ""
+	query, args, err := reservationSearchQuery(f, 0)
+	if err != nil {
+		return err
+	}
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		i, err := scanReservationRow(rows)
+		if err != nil {
+			return err
+		}
+		if err = fn(i); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// reservationSearchQuery builds the select for a reservation filter. A limit of 0 returns every row.
+func reservationSearchQuery(f models.ReservationFilter, limit int) (string, []interface{}, error) {
+	sortCol, ok := reservationSortColumns[f.SortBy]
+	if !ok {
+		sortCol = reservationSortColumns["start_date"]
+	}
+
+	var where []string
+	var args []interface{}
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	if q := strings.TrimSpace(f.Query); q != "" {
+		like := arg("%" + q + "%")
+		where = append(where, fmt.Sprintf("(r.first_name ilike %[1]s or r.last_name ilike %[1]s or r.email ilike %[1]s or r.phone ilike %[1]s)", like))
+	}
+	if f.RoomID > 0 {
+		where = append(where, "r.room_id = "+arg(f.RoomID))
+	}
+	if !f.From.IsZero() {
+		where = append(where, "r.end_date >= "+arg(f.From))
+	}
+	if !f.To.IsZero() {
+		where = append(where, "r.start_date <= "+arg(f.To))
+	}
+	switch f.Status {
+	case "new":
+		where = append(where, "r.processed = 0")
+	case "processed":
+		where = append(where, "r.processed = 1")
+	}
+
+	direction, comparison := "asc", ">"
+	if f.SortDesc {
+		direction, comparison = "desc", "<"
+	}
+
+	if f.After != "" {
+		value, id, err := decodeReservationCursor(f.After, sortCol.sqlType)
+		if err != nil {
+			return "", nil, err
+		}
+		where = append(where, fmt.Sprintf("(%s, r.id) %s (%s::%s, %s)",
+			sortCol.expr, comparison, arg(value), sortCol.sqlType, arg(id)))
+	}
 
 	query := `
-	select r.id,r.first_name,r.last_name, r.email,r.phone,r.start_date,r.end_date,r.room_id,r.created_at,r.updated_at,
+	select r.id,r.first_name,r.last_name, r.email,r.phone,r.start_date,r.end_date,r.room_id,r.created_at,r.updated_at,r.processed,
+	r.special_requests,r.amount,r.guests,r.currency,r.discount,
+	coalesce((select sum(c.amount) from reservation_charges c where c.reservation_id = r.id and c.kind = 'fee'), 0),
+	coalesce((select sum(c.amount) from reservation_charges c where c.reservation_id = r.id and c.kind = 'tax'), 0),
 	rm.id,rm.room_name
 	from reservations r
 	left join rooms rm on (r.room_id=rm.id)
-	where processed = 0 
-	order by r.start_date asc
 	`
-	rows, err := m.DB.QueryContext(ctx, query)
+	if len(where) > 0 {
+		query += "where " + strings.Join(where, " and ")
+	}
+	query += fmt.Sprintf(" order by %s %s, r.id %s", sortCol.expr, direction, direction)
+	if limit > 0 {
+		query += " limit " + arg(limit)
+	}
+
+	return query, args, nil
+}
+
+// scanReservationRow scans one row selected by reservationSearchQuery.
+func scanReservationRow(rows *sql.Rows) (models.Reservation, error) {
+	var i models.Reservation
+	err := rows.Scan(
+		&i.ID,
+		&i.FirstName,
+		&i.LastName,
+		&i.Email,
+		&i.Phone,
+		&i.StartDate,
+		&i.EndDate,
+		&i.RoomID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Processed,
+		&i.SpecialRequests,
+		&i.Amount,
+		&i.Guests,
+		&i.Currency,
+		&i.Discount,
+		&i.Fees,
+		&i.Taxes,
+		&i.Room.ID,
+		&i.Room.RoomName,
+	)
+	return i, err
+}
+
+// reservationSortValue returns the value of the sort column for a reservation, as text Postgres can cast back.
+func reservationSortValue(res models.Reservation, sortBy string) string {
+	switch sortBy {
+	case "id":
+		return strconv.Itoa(res.ID)
+	case "first_name":
+		return res.FirstName
+	case "last_name":
+		return res.LastName
+	case "email":
+		return res.Email
+	case "phone":
+		return res.Phone
+	case "room":
+		return res.Room.RoomName
+	case "end_date":
+		return res.EndDate.Format("2006-01-02")
+	case "created_at":
+		return res.CreatedAt.Format("2006-01-02 15:04:05.999999")
+	case "processed":
+		return strconv.Itoa(res.Processed)
+	default:
+		return res.StartDate.Format("2006-01-02")
+	}
+}
 
+// encodeReservationCursor packs the last sort value and id of a page into an opaque URL safe cursor.
+func encodeReservationCursor(value string, id int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf("%d:%s", id, value)))
+}
+
+// decodeReservationCursor unpacks a cursor made by encodeReservationCursor and checks that its value can be
+// cast to the SQL type of the sort column. It returns repository.ErrInvalidCursor for anything else.
+func decodeReservationCursor(cursor, sqlType string) (string, int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
 	if err != nil {
-		return reservations, err
+		return "", 0, repository.ErrInvalidCursor
+	}
+	idPart, value, found := strings.Cut(string(b), ":")
+	if !found {
+		return "", 0, repository.ErrInvalidCursor
+	}
+	id, err := strconv.Atoi(idPart)
+	if err != nil {
+		return "", 0, repository.ErrInvalidCursor
 	}
-	defer rows.Close()
-	for rows.Next() {
-		var i models.Reservation
-		err := rows.Scan(
-			&i.ID,
-			&i.FirstName,
-			&i.LastName,
-			&i.Email,
-			&i.Phone,
-			&i.StartDate,
-			&i.EndDate,
-			&i.RoomID,
-			&i.CreatedAt,
-			&i.UpdatedAt,
-			&i.Room.ID,
-			&i.Room.RoomName,
-		)
-		if err != nil {
-			return reservations, err
-		}
-		reservations = append(reservations, i)
-		if err = rows.Err(); err != nil {
-			return reservations, err
-		}
 
+	switch sqlType {
+	case "integer":
+		_, err = strconv.ParseInt(value, 10, 32)
+	case "date":
+		_, err = time.Parse("2006-01-02", value)
+	case "timestamp":
+		_, err = time.Parse("2006-01-02 15:04:05.999999", value)
 	}
-	return reservations, nil
+	if err != nil {
+		return "", 0, repository.ErrInvalidCursor
+	}
+	return value, id, nil
 }
 
-func (m *postgresDBRepo) GetReservationByID(id int) (models.Reservation, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+func (m *postgresDBRepo) GetReservationByID(ctx context.Context, id int) (models.Reservation, error) {
+	ctx, cancel := m.withTimeout(ctx)
 	defer cancel()
 
 	var res models.Reservation
 
 	query := `
 	select r.id,r.first_name,r.last_name,r.email,r.phone,r.start_date,r.end_date,r.room_id,r.created_at,r.updated_at,r.processed,
-	rm.id,rm.room_name
+	r.source,r.note,coalesce(r.guest_id, 0),r.amount,r.special_requests,r.cancellation_policy,r.guests,r.currency,
+	r.promotion_code,r.discount,rm.id,rm.room_name
 	from reservations r
 	left join rooms rm on (r.room_id=rm.id)
 	where r.id=$1
@@ -350,52 +810,188 @@ func (m *postgresDBRepo) GetReservationByID(id int) (models.Reservation, error)
 		&res.CreatedAt,
 		&res.UpdatedAt,
 		&res.Processed,
+		&res.Source,
+		&res.Note,
+		&res.GuestID,
+		&res.Amount,
+		&res.SpecialRequests,
+		&res.CancellationPolicy,
+		&res.Guests,
+		&res.Currency,
+		&res.PromotionCode,
+		&res.Discount,
 		&res.Room.ID,
 		&res.Room.RoomName,
 	)
 	if err != nil {
 		return res, err
 	}
-	return res, nil
-}
 
-func (m *postgresDBRepo) UpdateReservation(u models.Reservation) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
-	query := `
-	update reservations set first_name=$1,last_name=$2,email=$3,phone=$4,updated_at=$5
-	where id = $6
+	query = `
+	select id,reservation_id,coalesce(tax_rule_id, 0),kind,description,quantity,unit_amount,amount,currency
+	from reservation_charges
+	where reservation_id=$1
+	order by id
 	`
-	_, err := m.DB.ExecContext(ctx, query,
-		u.FirstName,
-		u.LastName,
-		u.Email,
-		u.Phone,
-		time.Now(),
-		u.ID)
+	rows, err := m.DB.QueryContext(ctx, query, id)
 	if err != nil {
-		return err
+		return res, err
+	}
+	defer rows.Close()
+
+	res.Charges = []models.Charge{}
+	for rows.Next() {
+		var c models.Charge
+		err := rows.Scan(
+			&c.ID,
+			&c.ReservationID,
+			&c.TaxRuleID,
+			&c.Kind,
+			&c.Description,
+			&c.Quantity,
+			&c.UnitAmount,
+			&c.Amount,
+			&c.Currency,
+		)
+		if err != nil {
+			return res, err
+		}
+		res.Charges = append(res.Charges, c)
+	}
+
+	if err = rows.Err(); err != nil {
+		return res, err
+	}
+	return res, nil
+}
+
+// UpdateReservation saves the guest details, room, dates, price and charges of a reservation and moves its room
+// restriction along in one transaction. The amount and discount are stored as given, so the price agreed when
+// booking stays unless the caller reprices the stay. It returns repository.ErrRoomUnavailable if the new room or
+// dates clash with another restriction.
+func (m *postgresDBRepo) UpdateReservation(ctx context.Context, u models.Reservation) error {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `select id from rooms where id = $1 for update`, u.RoomID)
+	if err != nil {
+		return err
+	}
+
+	available, err := roomAvailableTx(ctx, tx, u.RoomID, u.StartDate, u.EndDate, u.ID)
+	if err != nil {
+		return err
+	}
+	if !available {
+		return repository.ErrRoomUnavailable
+	}
+
+	query := `
+	update reservations set first_name=$1,last_name=$2,email=$3,phone=$4,start_date=$5,end_date=$6,room_id=$7,
+	amount=$8,discount=$9,updated_at=$10,guests=$11
+	where id = $12
+	`
+	_, err = tx.ExecContext(ctx, query,
+		u.FirstName,
+		u.LastName,
+		u.Email,
+		u.Phone,
+		u.StartDate,
+		u.EndDate,
+		u.RoomID,
+		u.Amount,
+		u.Discount,
+		time.Now(),
+		reservationGuests(u),
+		u.ID)
+	if err != nil {
+		return err
+	}
+
+	// the promotion reports show the discount actually given
+	_, err = tx.ExecContext(ctx, `update promotion_redemptions set discount = $1, updated_at = $2 where reservation_id = $3`,
+		u.Discount, time.Now(), u.ID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `delete from reservation_charges where reservation_id = $1`, u.ID)
+	if err != nil {
+		return err
+	}
+
+	err = insertChargesTx(ctx, tx, u.ID, u.Charges)
+	if err != nil {
+		return err
+	}
+
+	query = `
+	update room_restrictions set room_id=$1,start_date=$2,end_date=$3,updated_at=$4
+	where reservation_id = $5
+	`
+	_, err = tx.ExecContext(ctx, query,
+		u.RoomID,
+		u.StartDate,
+		u.EndDate,
+		time.Now(),
+		u.ID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (m *postgresDBRepo) CancelReservation(ctx context.Context, c models.Cancellation) error {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// keep a record of the stay for the cancellation statistics
+	record := `insert into cancellations (reservation_id, room_id, guest_id, start_date, end_date, booked_at, policy,
+			days_before, refund_percent, paid, refund, fee, cancelled_by, created_at, updated_at)
+			select id, room_id, guest_id, start_date, end_date, created_at, $2, $3, $4, $5, $6, $7, $8, $9, $9
+			from reservations where id = $1`
+
+	_, err = tx.ExecContext(ctx, record,
+		c.ReservationID,
+		c.Policy,
+		c.DaysBefore,
+		c.RefundPercent,
+		c.Paid,
+		c.Refund,
+		c.Fee,
+		c.CancelledBy,
+		time.Now(),
+	)
+	if err != nil {
+		return err
 	}
-	return nil
-
-}
 
-func (m *postgresDBRepo) DeleteReservation(id int) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
 	query := `delete from reservations where id = $1`
 
-	_, err := m.DB.Exec(query, ctx, id)
+	_, err = tx.ExecContext(ctx, query, c.ReservationID)
 	if err != nil {
 		return err
 	}
 
-	return nil
+	return tx.Commit()
 }
 
-func (m *postgresDBRepo) UpdateProcessedForReservation(id, processed int) error {
+func (m *postgresDBRepo) UpdateProcessedForReservation(ctx context.Context, id, processed int) error {
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := m.withTimeout(ctx)
 	defer cancel()
 	query := `update reservations set processed = $1 where id =$2`
 
@@ -406,13 +1002,13 @@ func (m *postgresDBRepo) UpdateProcessedForReservation(id, processed int) error
 	return nil
 }
 
-func (m *postgresDBRepo) AllRooms() ([]models.Room, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+func (m *postgresDBRepo) AllRooms(ctx context.Context) ([]models.Room, error) {
+	ctx, cancel := m.withTimeout(ctx)
 	defer cancel()
 
 	var rooms []models.Room
 
-	query := `select id,room_name,created_at,updated_at from rooms order by room_name`
+	query := `select id,room_name,nightly_rate,cancellation_policy,created_at,updated_at from rooms order by room_name`
 
 	rows, err := m.DB.QueryContext(ctx, query)
 	if err != nil {
@@ -425,6 +1021,8 @@ func (m *postgresDBRepo) AllRooms() ([]models.Room, error) {
 		err := rows.Scan(
 			&rm.ID,
 			&rm.RoomName,
+			&rm.NightlyRate,
+			&rm.CancellationPolicy,
 			&rm.CreatedAt,
 			&rm.UpdatedAt,
 		)
@@ -440,8 +1038,24 @@ func (m *postgresDBRepo) AllRooms() ([]models.Room, error) {
 	return rooms, nil
 }
 
-func (m *postgresDBRepo) GetRestrictionsForRoomByDate(roomID int, start, end time.Time) ([]models.RoomRestriction, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+// InsertRoom adds a room and returns the new ID.
+func (m *postgresDBRepo) InsertRoom(ctx context.Context, rm models.Room) (int, error) {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	var newID int
+	stmt := `insert into rooms (room_name, nightly_rate, cancellation_policy, created_at, updated_at)
+			values ($1, $2, $3, $4, $4) returning id`
+
+	err := m.DB.QueryRowContext(ctx, stmt, rm.RoomName, rm.NightlyRate, rm.CancellationPolicy, time.Now()).Scan(&newID)
+	if err != nil {
+		return 0, err
+	}
+	return newID, nil
+}
+
+func (m *postgresDBRepo) GetRestrictionsForRoomByDate(ctx context.Context, roomID int, start, end time.Time) ([]models.RoomRestriction, error) {
+	ctx, cancel := m.withTimeout(ctx)
 	defer cancel()
 
 	var restrictions []models.RoomRestriction
@@ -449,10 +1063,10 @@ func (m *postgresDBRepo) GetRestrictionsForRoomByDate(roomID int, start, end tim
 	query :=
 		`
 select id, coalesce(reservation_id,0), restriction_id, room_id, start_date, end_date from room_restrictions where $1< end_date and $2>=start_date and room_id =$3
-
+and (expires_at is null or expires_at > $4)
 `
 
-	rows, err := m.DB.QueryContext(ctx, query, start, end, roomID)
+	rows, err := m.DB.QueryContext(ctx, query, start, end, roomID, time.Now())
 	if err != nil {
 		return nil, err
 	}
@@ -479,3 +1093,1685 @@ select id, coalesce(reservation_id,0), restriction_id, room_id, start_date, end_
 	}
 	return restrictions, nil
 }
+
+// InsertHold places a temporary hold on a room for the given dates and returns the new restriction ID.
+// The room row is locked while checking availability so two guests can't hold the same nights.
+func (m *postgresDBRepo) InsertHold(ctx context.Context, r models.RoomRestriction) (int, error) {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `select id from rooms where id = $1 for update`, r.RoomID)
+	if err != nil {
+		return 0, err
+	}
+
+	available, err := roomAvailableTx(ctx, tx, r.RoomID, r.StartDate, r.EndDate, 0)
+	if err != nil {
+		return 0, err
+	}
+	if !available {
+		return 0, repository.ErrRoomUnavailable
+	}
+
+	var newID int
+	stmt := `insert into room_restrictions (start_date, end_date, room_id, restriction_id, expires_at,
+			created_at, updated_at)
+			values ($1, $2, $3, $4, $5, $6, $7) returning id`
+
+	err = tx.QueryRowContext(ctx, stmt,
+		r.StartDate,
+		r.EndDate,
+		r.RoomID,
+		models.RestrictionHold,
+		r.ExpiresAt,
+		time.Now(),
+		time.Now(),
+	).Scan(&newID)
+	if err != nil {
+		return 0, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, err
+	}
+	return newID, nil
+}
+
+// DeleteHold releases a hold that has not been converted into a reservation.
+func (m *postgresDBRepo) DeleteHold(ctx context.Context, id int) error {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	query := `delete from room_restrictions where id = $1 and restriction_id = $2`
+
+	_, err := m.DB.ExecContext(ctx, query, id, models.RestrictionHold)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// ConvertHoldToReservation inserts the reservation and turns the hold into its reservation restriction
+// in one transaction. If the hold has already expired the room is re-checked and a new restriction is
+// inserted instead, or repository.ErrRoomUnavailable is returned when somebody else took the room.
+func (m *postgresDBRepo) ConvertHoldToReservation(ctx context.Context, res models.Reservation, holdID int) (int, error) {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `select id from rooms where id = $1 for update`, res.RoomID)
+	if err != nil {
+		return 0, err
+	}
+
+	guestID, err := guestForReservation(ctx, tx, res)
+	if err != nil {
+		return 0, err
+	}
+
+	var newID int
+	stmt := `insert into reservations (first_name, last_name, email, phone, start_date,
+			end_date, room_id, guest_id, amount, created_at, updated_at, special_requests, cancellation_policy,
+			guests, currency, promotion_code, discount)
+			values ($1, $2, $3, $4, $5, $6, $7, $8, ` + reservationAmount + `, $9, $10, $11, ` + reservationPolicy + `,
+			$12, $13, $14, $15) returning id`
+
+	err = tx.QueryRowContext(ctx, stmt,
+		res.FirstName,
+		res.LastName,
+		res.Email,
+		res.Phone,
+		res.StartDate,
+		res.EndDate,
+		res.RoomID,
+		guestID,
+		time.Now(),
+		time.Now(),
+		res.SpecialRequests,
+		reservationGuests(res),
+		reservationCurrency(res),
+		res.PromotionCode,
+		res.Discount,
+	).Scan(&newID)
+	if err != nil {
+		return 0, err
+	}
+
+	err = insertChargesTx(ctx, tx, newID, res.Charges)
+	if err != nil {
+		return 0, err
+	}
+
+	err = redeemPromotionTx(ctx, tx, newID, guestID, res)
+	if err != nil {
+		return 0, err
+	}
+
+	update := `update room_restrictions set restriction_id = $1, reservation_id = $2, expires_at = null, updated_at = $3
+			where id = $4 and restriction_id = $5 and room_id = $6 and start_date = $7 and end_date = $8
+			and expires_at > $3`
+
+	result, err := tx.ExecContext(ctx, update,
+		models.RestrictionReservation,
+		newID,
+		time.Now(),
+		holdID,
+		models.RestrictionHold,
+		res.RoomID,
+		res.StartDate,
+		res.EndDate,
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	converted, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	if converted == 0 {
+		// the hold is gone, so fall back to a regular availability check
+		m.logger(ctx).Info("room hold expired before the reservation was saved", "hold_id", holdID, "room_id", res.RoomID)
+		available, err := roomAvailableTx(ctx, tx, res.RoomID, res.StartDate, res.EndDate, 0)
+		if err != nil {
+			return 0, err
+		}
+		if !available {
+			return 0, repository.ErrRoomUnavailable
+		}
+
+		insert := `insert into room_restrictions (start_date, end_date, room_id, restriction_id, reservation_id,
+				created_at, updated_at)
+				values ($1, $2, $3, $4, $5, $6, $7)`
+
+		_, err = tx.ExecContext(ctx, insert,
+			res.StartDate,
+			res.EndDate,
+			res.RoomID,
+			models.RestrictionReservation,
+			newID,
+			time.Now(),
+			time.Now(),
+		)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, err
+	}
+	return newID, nil
+}
+
+// DeleteExpiredHolds removes holds whose expiry has passed and returns how many were removed.
+func (m *postgresDBRepo) DeleteExpiredHolds(ctx context.Context) (int64, error) {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	query := `delete from room_restrictions where restriction_id = $1 and expires_at <= $2`
+
+	result, err := m.DB.ExecContext(ctx, query, models.RestrictionHold, time.Now())
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// InsertBlock blocks a room for the owner on the given dates and returns the new restriction ID, or
+// repository.ErrRoomUnavailable when the room is booked, held or blocked already.
+func (m *postgresDBRepo) InsertBlock(ctx context.Context, r models.RoomRestriction) (int, error) {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `select id from rooms where id = $1 for update`, r.RoomID)
+	if err != nil {
+		return 0, err
+	}
+
+	available, err := roomAvailableTx(ctx, tx, r.RoomID, r.StartDate, r.EndDate, 0)
+	if err != nil {
+		return 0, err
+	}
+	if !available {
+		return 0, repository.ErrRoomUnavailable
+	}
+
+	var newID int
+	stmt := `insert into room_restrictions (start_date, end_date, room_id, restriction_id, created_at, updated_at)
+			values ($1, $2, $3, $4, $5, $5) returning id`
+
+	err = tx.QueryRowContext(ctx, stmt,
+		r.StartDate,
+		r.EndDate,
+		r.RoomID,
+		models.RestrictionOwnerBlock,
+		time.Now(),
+	).Scan(&newID)
+	if err != nil {
+		return 0, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, err
+	}
+	return newID, nil
+}
+
+// DeleteBlock removes an owner block and returns it, so the nights it freed are known, or sql.ErrNoRows when
+// there is no block with the ID.
+func (m *postgresDBRepo) DeleteBlock(ctx context.Context, id int) (models.RoomRestriction, error) {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	query := `delete from room_restrictions where id = $1 and restriction_id = $2
+		returning id, room_id, restriction_id, start_date, end_date`
+
+	var b models.RoomRestriction
+	err := m.DB.QueryRowContext(ctx, query, id, models.RestrictionOwnerBlock).Scan(
+		&b.ID,
+		&b.RoomID,
+		&b.RestrictionID,
+		&b.StartDate,
+		&b.EndDate,
+	)
+	return b, err
+}
+
+// InsertWaitlistEntry puts a guest on the waitlist and returns the new entry ID.
+func (m *postgresDBRepo) InsertWaitlistEntry(ctx context.Context, w models.WaitlistEntry) (int, error) {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	var newID int
+
+	var roomID sql.NullInt64
+	if w.RoomID > 0 {
+		roomID = sql.NullInt64{Int64: int64(w.RoomID), Valid: true}
+	}
+
+	stmt := `insert into waitlist (first_name, email, room_id, start_date, end_date, created_at, updated_at)
+			values ($1, $2, $3, $4, $5, $6, $7) returning id`
+
+	err := m.DB.QueryRowContext(ctx, stmt,
+		w.FirstName,
+		w.Email,
+		roomID,
+		w.StartDate,
+		w.EndDate,
+		time.Now(),
+		time.Now(),
+	).Scan(&newID)
+	if err != nil {
+		return 0, err
+	}
+
+	return newID, nil
+}
+
+// GetWaitlistEntriesForDates returns the waitlist entries, oldest first, that want the room (or any room)
+// for nights overlapping start to end and have not been sent a booking link that is still valid.
+func (m *postgresDBRepo) GetWaitlistEntriesForDates(ctx context.Context, roomID int, start, end time.Time) ([]models.WaitlistEntry, error) {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	var entries []models.WaitlistEntry
+
+	query := `
+	select id, first_name, email, coalesce(room_id, 0), start_date, end_date, created_at, updated_at
+	from waitlist
+	where (room_id = $1 or room_id is null)
+	and $2 < end_date and $3 > start_date
+	and (notified_at is null or token_expires_at <= $4)
+	order by created_at asc
+	`
+
+	rows, err := m.DB.QueryContext(ctx, query, roomID, start, end, time.Now())
+	if err != nil {
+		return entries, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var e models.WaitlistEntry
+		err := rows.Scan(
+			&e.ID,
+			&e.FirstName,
+			&e.Email,
+			&e.RoomID,
+			&e.StartDate,
+			&e.EndDate,
+			&e.CreatedAt,
+			&e.UpdatedAt,
+		)
+		if err != nil {
+			return entries, err
+		}
+		entries = append(entries, e)
+	}
+	if err = rows.Err(); err != nil {
+		return entries, err
+	}
+	return entries, nil
+}
+
+// UpdateWaitlistToken stores the booking link token sent to a waitlisted guest, and the room freed for them.
+func (m *postgresDBRepo) UpdateWaitlistToken(ctx context.Context, id, roomID int, token string, expiresAt time.Time) error {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	query := `update waitlist set token = $1, token_expires_at = $2, notified_at = $3, updated_at = $3,
+		offered_room_id = $4 where id = $5`
+
+	_, err := m.DB.ExecContext(ctx, query, token, expiresAt, time.Now(), roomID, id)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// GetWaitlistEntryByToken returns the waitlist entry for a booking link that has not expired yet.
+func (m *postgresDBRepo) GetWaitlistEntryByToken(ctx context.Context, token string) (models.WaitlistEntry, error) {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	var e models.WaitlistEntry
+
+	query := `
+	select id, first_name, email, coalesce(room_id, 0), coalesce(offered_room_id, 0), start_date, end_date,
+	token, token_expires_at, notified_at, created_at, updated_at
+	from waitlist
+	where token = $1 and token_expires_at > $2
+	`
+
+	row := m.DB.QueryRowContext(ctx, query, token, time.Now())
+	err := row.Scan(
+		&e.ID,
+		&e.FirstName,
+		&e.Email,
+		&e.RoomID,
+		&e.OfferedRoomID,
+		&e.StartDate,
+		&e.EndDate,
+		&e.Token,
+		&e.TokenExpiresAt,
+		&e.NotifiedAt,
+		&e.CreatedAt,
+		&e.UpdatedAt,
+	)
+	if err != nil {
+		return e, err
+	}
+	return e, nil
+}
+
+// ImportReservations inserts the reservations and their room restrictions in one transaction, so an import
+// either goes in completely or not at all. Availability is checked again while the rooms are locked and
+// repository.ErrRoomUnavailable is returned if a stay was booked since the file was validated.
+func (m *postgresDBRepo) ImportReservations(ctx context.Context, res []models.Reservation) (int, error) {
+	// a whole file goes in at once, far longer than a single query is allowed
+	ctx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `select id from rooms order by id for update`)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, r := range res {
+		_, err = insertReservationTx(ctx, tx, r)
+		if errors.Is(err, repository.ErrRoomUnavailable) {
+			return 0, fmt.Errorf("%s %s, %s to %s: %w", r.FirstName, r.LastName,
+				r.StartDate.Format("2006-01-02"), r.EndDate.Format("2006-01-02"), err)
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, err
+	}
+	return len(res), nil
+}
+
+// CreateReservation inserts a reservation, with its status, source and note, together with its room restriction
+// while the room is locked. It returns repository.ErrRoomUnavailable if the room was taken in the meantime,
+// by a reservation or a hold.
+func (m *postgresDBRepo) CreateReservation(ctx context.Context, res models.Reservation) (int, error) {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `select id from rooms where id = $1 for update`, res.RoomID)
+	if err != nil {
+		return 0, err
+	}
+
+	newID, err := insertReservationTx(ctx, tx, res)
+	if err != nil {
+		return 0, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, err
+	}
+	return newID, nil
+}
+
+// insertReservationTx checks the room is free and inserts the reservation and its room restriction.
+// The caller must hold the lock on the room.
+func insertReservationTx(ctx context.Context, tx *sql.Tx, res models.Reservation) (int, error) {
+	available, err := roomAvailableTx(ctx, tx, res.RoomID, res.StartDate, res.EndDate, 0)
+	if err != nil {
+		return 0, err
+	}
+	if !available {
+		return 0, repository.ErrRoomUnavailable
+	}
+
+	source := res.Source
+	if source == "" {
+		source = models.SourceWebsite
+	}
+
+	guestID, err := guestForReservation(ctx, tx, res)
+	if err != nil {
+		return 0, err
+	}
+
+	var newID int
+	stmt := `insert into reservations (first_name, last_name, email, phone, start_date,
+			end_date, room_id, processed, source, note, guest_id, amount, created_at, updated_at, special_requests,
+			cancellation_policy, guests, currency, promotion_code, discount)
+			values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, ` + reservationAmount + `, $12, $13, $14,
+			` + reservationPolicy + `, $15, $16, $17, $18) returning id`
+
+	err = tx.QueryRowContext(ctx, stmt,
+		res.FirstName,
+		res.LastName,
+		res.Email,
+		res.Phone,
+		res.StartDate,
+		res.EndDate,
+		res.RoomID,
+		res.Processed,
+		source,
+		res.Note,
+		guestID,
+		time.Now(),
+		time.Now(),
+		res.SpecialRequests,
+		reservationGuests(res),
+		reservationCurrency(res),
+		res.PromotionCode,
+		res.Discount,
+	).Scan(&newID)
+	if err != nil {
+		return 0, err
+	}
+
+	err = insertChargesTx(ctx, tx, newID, res.Charges)
+	if err != nil {
+		return 0, err
+	}
+
+	err = redeemPromotionTx(ctx, tx, newID, guestID, res)
+	if err != nil {
+		return 0, err
+	}
+
+	insert := `insert into room_restrictions (start_date, end_date, room_id, restriction_id, reservation_id,
+			created_at, updated_at)
+			values ($1, $2, $3, $4, $5, $6, $7)`
+
+	_, err = tx.ExecContext(ctx, insert,
+		res.StartDate,
+		res.EndDate,
+		res.RoomID,
+		models.RestrictionReservation,
+		newID,
+		time.Now(),
+		time.Now(),
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	return newID, nil
+}
+
+// DashboardStats returns the arrivals and departures of today and of the week starting at the Monday on or
+// before today, together with the averages and cancellations of the range [start, end).
+func (m *postgresDBRepo) DashboardStats(ctx context.Context, today, start, end time.Time) (models.DashboardStats, error) {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	var s models.DashboardStats
+
+	weekStart := today.AddDate(0, 0, -((int(today.Weekday()) + 6) % 7))
+	weekEnd := weekStart.AddDate(0, 0, 7)
+
+	query := `
+		select
+			(select count(id) from reservations where start_date = $1),
+			(select count(id) from reservations where end_date = $1),
+			(select count(id) from reservations where start_date >= $2 and start_date < $3),
+			(select count(id) from reservations where end_date >= $2 and end_date < $3),
+			(select count(id) from reservations where processed = 0),
+			(select count(id) from cancellations where created_at >= $4 and created_at < $5),
+			(select coalesce(avg(end_date - start_date), 0)::float8
+				from reservations where start_date >= $4 and start_date < $5),
+			(select coalesce(avg(start_date - created_at::date), 0)::float8
+				from reservations where start_date >= $4 and start_date < $5)`
+
+	err := m.DB.QueryRowContext(ctx, query, today, weekStart, weekEnd, start, end).Scan(
+		&s.ArrivalsToday,
+		&s.DeparturesToday,
+		&s.ArrivalsThisWeek,
+		&s.DeparturesThisWeek,
+		&s.NewReservations,
+		&s.Cancellations,
+		&s.AverageStay,
+		&s.AverageLeadTime,
+	)
+	if err != nil {
+		return s, err
+	}
+
+	return s, nil
+}
+
+// RoomOccupancy returns the booked nights per room and month for the nights in [start, end).
+// Owner blocks and holds don't count as booked.
+func (m *postgresDBRepo) RoomOccupancy(ctx context.Context, start, end time.Time) ([]models.RoomOccupancy, error) {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	var occupancy []models.RoomOccupancy
+
+	query := `
+		select
+			r.id, r.room_name, date_trunc('month', d.day)::date as month,
+			count(distinct case when rr.id is not null then d.day end) as booked,
+			count(distinct d.day) as nights
+		from
+			rooms r
+			cross join generate_series($1::date, $2::date - 1, interval '1 day') as d(day)
+			left join room_restrictions rr on rr.room_id = r.id and rr.restriction_id = $3
+				and d.day >= rr.start_date and d.day < rr.end_date
+		group by
+			r.id, r.room_name, month
+		order by
+			month, r.id`
+
+	rows, err := m.DB.QueryContext(ctx, query, start, end, models.RestrictionReservation)
+	if err != nil {
+		return occupancy, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var o models.RoomOccupancy
+		err := rows.Scan(
+			&o.RoomID,
+			&o.RoomName,
+			&o.Month,
+			&o.BookedNights,
+			&o.Nights,
+		)
+		if err != nil {
+			return occupancy, err
+		}
+		occupancy = append(occupancy, o)
+	}
+
+	if err = rows.Err(); err != nil {
+		return occupancy, err
+	}
+
+	return occupancy, nil
+}
+
+// MonthlyBookings returns arrivals, cancellations and the average stay and lead time of every month
+// overlapping [start, end), counting only the days inside the range.
+func (m *postgresDBRepo) MonthlyBookings(ctx context.Context, start, end time.Time) ([]models.MonthlyBookings, error) {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	var months []models.MonthlyBookings
+
+	query := `
+		with months as (
+			select
+				m.month::date as month,
+				greatest(m.month, $1::date)::date as first_day,
+				least(m.month + interval '1 month', $2::date)::date as last_day
+			from
+				generate_series(date_trunc('month', $1::date), $2::date - 1, interval '1 month') as m(month)
+		)
+		select
+			ms.month,
+			(select count(id) from reservations
+				where start_date >= ms.first_day and start_date < ms.last_day),
+			(select count(id) from cancellations
+				where created_at >= ms.first_day and created_at < ms.last_day),
+			(select coalesce(avg(end_date - start_date), 0)::float8 from reservations
+				where start_date >= ms.first_day and start_date < ms.last_day),
+			(select coalesce(avg(start_date - created_at::date), 0)::float8 from reservations
+				where start_date >= ms.first_day and start_date < ms.last_day)
+		from
+			months ms
+		order by
+			ms.month`
+
+	rows, err := m.DB.QueryContext(ctx, query, start, end)
+	if err != nil {
+		return months, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var mb models.MonthlyBookings
+		err := rows.Scan(
+			&mb.Month,
+			&mb.Arrivals,
+			&mb.Cancellations,
+			&mb.AverageStay,
+			&mb.AverageLeadTime,
+		)
+		if err != nil {
+			return months, err
+		}
+		months = append(months, mb)
+	}
+
+	if err = rows.Err(); err != nil {
+		return months, err
+	}
+
+	return months, nil
+}
+
+// querier is the part of *sql.DB and *sql.Tx the guest lookup needs.
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// guestForReservation returns the guest of a reservation: the one it is already linked to, the guest with
+// the same email address, the guest with the same phone number, or else a new guest.
+func guestForReservation(ctx context.Context, q querier, res models.Reservation) (int, error) {
+	if res.GuestID != 0 {
+		return res.GuestID, nil
+	}
+
+	email := strings.ToLower(strings.TrimSpace(res.Email))
+
+	var id int
+	err := q.QueryRowContext(ctx, `select id from guests where lower(email) = $1`, email).Scan(&id)
+	if err == nil {
+		// remember the phone number if we didn't have one yet
+		_, err = q.ExecContext(ctx, `update guests set phone = $1, updated_at = $2 where id = $3 and phone = ''`,
+			res.Phone, time.Now(), id)
+		return id, err
+	}
+	if err != sql.ErrNoRows {
+		return 0, err
+	}
+
+	if phone := phoneDigits(res.Phone); phone != "" {
+		query := `select id from guests where regexp_replace(phone, '\D', '', 'g') = $1 order by id limit 1`
+		err = q.QueryRowContext(ctx, query, phone).Scan(&id)
+		if err == nil {
+			return id, nil
+		}
+		if err != sql.ErrNoRows {
+			return 0, err
+		}
+	}
+
+	// a booking made at the same time for the same email address may have added the guest since
+	stmt := `insert into guests (first_name, last_name, email, phone, created_at, updated_at)
+			values ($1, $2, $3, $4, $5, $6)
+			on conflict ((lower(email))) do update set
+				phone = case when guests.phone = '' then excluded.phone else guests.phone end,
+				updated_at = excluded.updated_at
+			returning id`
+
+	err = q.QueryRowContext(ctx, stmt,
+		res.FirstName,
+		res.LastName,
+		email,
+		res.Phone,
+		time.Now(),
+		time.Now(),
+	).Scan(&id)
+	if err != nil {
+		return 0, err
+	}
+	return id, nil
+}
+
+// phoneDigits returns the digits of a phone number, or nothing if it is too short to identify a guest.
+func phoneDigits(phone string) string {
+	var digits strings.Builder
+	for _, c := range phone {
+		if c >= '0' && c <= '9' {
+			digits.WriteRune(c)
+		}
+	}
+	if digits.Len() < 6 {
+		return ""
+	}
+	return digits.String()
+}
+
+// joinTags and splitTags convert guest tags to and from the comma separated tags column.
+func joinTags(tags []string) string {
+	return strings.Join(tags, ",")
+}
+
+func splitTags(tags string) []string {
+	if tags == "" {
+		return nil
+	}
+	return strings.Split(tags, ",")
+}
+
+// guestSummaryQuery selects guests with the totals of their stays, to be completed with a where clause.
+// The total spent is what the stays cost with their discounts, fees and taxes, plus what was kept of the
+// deposits of cancelled stays.
+const guestSummaryQuery = `
+	select
+		g.id, g.first_name, g.last_name, g.email, g.phone, g.notes, g.tags, g.created_at, g.updated_at,
+		count(r.id), coalesce(sum(r.end_date - r.start_date), 0),
+		coalesce(sum(r.amount - r.discount + coalesce(c.amount, 0)), 0)
+			+ coalesce((select sum(x.fee) from cancellations x where x.guest_id = g.id), 0),
+		coalesce(max(r.start_date), '0001-01-01')
+	from
+		guests g
+		left join reservations r on (r.guest_id = g.id)
+		left join (
+			select reservation_id, sum(amount) as amount from reservation_charges group by reservation_id
+		) c on (c.reservation_id = r.id)
+	`
+
+// scanner is a *sql.Row or *sql.Rows.
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanGuestSummary(row scanner) (models.GuestSummary, error) {
+	var g models.GuestSummary
+	var tags string
+
+	err := row.Scan(
+		&g.ID,
+		&g.FirstName,
+		&g.LastName,
+		&g.Email,
+		&g.Phone,
+		&g.Notes,
+		&tags,
+		&g.CreatedAt,
+		&g.UpdatedAt,
+		&g.Stays,
+		&g.Nights,
+		&g.TotalSpent,
+		&g.LastStay,
+	)
+	g.Tags = splitTags(tags)
+	return g, err
+}
+
+// SearchGuests returns up to 100 guests whose name, email or phone contains query, with their stay totals.
+func (m *postgresDBRepo) SearchGuests(ctx context.Context, query string) ([]models.GuestSummary, error) {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	var guests []models.GuestSummary
+
+	stmt := guestSummaryQuery + `
+	where
+		$1 = '' or g.first_name ilike '%' || $1 || '%' or g.last_name ilike '%' || $1 || '%'
+		or g.email ilike '%' || $1 || '%' or g.phone ilike '%' || $1 || '%'
+	group by
+		g.id
+	order by
+		g.last_name, g.first_name, g.id
+	limit 100`
+
+	rows, err := m.DB.QueryContext(ctx, stmt, strings.TrimSpace(query))
+	if err != nil {
+		return guests, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		g, err := scanGuestSummary(rows)
+		if err != nil {
+			return guests, err
+		}
+		guests = append(guests, g)
+	}
+
+	if err = rows.Err(); err != nil {
+		return guests, err
+	}
+	return guests, nil
+}
+
+// GetGuestByID returns a guest with the totals of their stays.
+func (m *postgresDBRepo) GetGuestByID(ctx context.Context, id int) (models.GuestSummary, error) {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	stmt := guestSummaryQuery + `
+	where
+		g.id = $1
+	group by
+		g.id`
+
+	return scanGuestSummary(m.DB.QueryRowContext(ctx, stmt, id))
+}
+
+// GetReservationsForGuest returns all stays of a guest, the latest first.
+func (m *postgresDBRepo) GetReservationsForGuest(ctx context.Context, guestID int) ([]models.Reservation, error) {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	var reservations []models.Reservation
+
+	query := `
+		select
+			r.id, r.first_name, r.last_name, r.email, r.phone, r.start_date, r.end_date, r.room_id,
+			r.created_at, r.updated_at, r.processed, r.source, r.amount, rm.id, rm.room_name
+		from
+			reservations r
+			left join rooms rm on (r.room_id = rm.id)
+		where
+			r.guest_id = $1
+		order by
+			r.start_date desc`
+
+	rows, err := m.DB.QueryContext(ctx, query, guestID)
+	if err != nil {
+		return reservations, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var res models.Reservation
+		err := rows.Scan(
+			&res.ID,
+			&res.FirstName,
+			&res.LastName,
+			&res.Email,
+			&res.Phone,
+			&res.StartDate,
+			&res.EndDate,
+			&res.RoomID,
+			&res.CreatedAt,
+			&res.UpdatedAt,
+			&res.Processed,
+			&res.Source,
+			&res.Amount,
+			&res.Room.ID,
+			&res.Room.RoomName,
+		)
+		if err != nil {
+			return reservations, err
+		}
+		res.GuestID = guestID
+		reservations = append(reservations, res)
+	}
+
+	if err = rows.Err(); err != nil {
+		return reservations, err
+	}
+	return reservations, nil
+}
+
+// UpdateGuest saves the contact details, notes and tags of a guest. It returns repository.ErrGuestEmailTaken
+// if another guest has the email address.
+func (m *postgresDBRepo) UpdateGuest(ctx context.Context, g models.Guest) error {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	query := `
+	update guests set first_name=$1,last_name=$2,email=$3,phone=$4,notes=$5,tags=$6,updated_at=$7
+	where id = $8 and not exists (select 1 from guests where lower(email) = $3 and id <> $8)
+	`
+	result, err := m.DB.ExecContext(ctx, query,
+		g.FirstName,
+		g.LastName,
+		strings.ToLower(strings.TrimSpace(g.Email)),
+		g.Phone,
+		g.Notes,
+		joinTags(g.Tags),
+		time.Now(),
+		g.ID)
+	if err != nil {
+		return err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return repository.ErrGuestEmailTaken
+	}
+	return nil
+}
+
+// GetPossibleDuplicateGuests returns other guests with the same name, email address or phone number.
+func (m *postgresDBRepo) GetPossibleDuplicateGuests(ctx context.Context, g models.Guest) ([]models.Guest, error) {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	var guests []models.Guest
+
+	query := `
+		select
+			id, first_name, last_name, email, phone, notes, tags, created_at, updated_at
+		from
+			guests
+		where
+			id <> $1
+			and (
+				(lower(first_name) = lower($2) and lower(last_name) = lower($3))
+				or email = lower($4)
+				or ($5 <> '' and regexp_replace(phone, '\D', '', 'g') = $5)
+			)
+		order by
+			id`
+
+	rows, err := m.DB.QueryContext(ctx, query, g.ID, g.FirstName, g.LastName, g.Email, phoneDigits(g.Phone))
+	if err != nil {
+		return guests, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var d models.Guest
+		var tags string
+		err := rows.Scan(
+			&d.ID,
+			&d.FirstName,
+			&d.LastName,
+			&d.Email,
+			&d.Phone,
+			&d.Notes,
+			&tags,
+			&d.CreatedAt,
+			&d.UpdatedAt,
+		)
+		if err != nil {
+			return guests, err
+		}
+		d.Tags = splitTags(tags)
+		guests = append(guests, d)
+	}
+
+	if err = rows.Err(); err != nil {
+		return guests, err
+	}
+	return guests, nil
+}
+
+// MergeGuests moves the stays of guest mergeID to guest keepID, adds its notes and tags and fills in any
+// contact details keepID is missing, then deletes mergeID. Everything happens in one transaction.
+func (m *postgresDBRepo) MergeGuests(ctx context.Context, keepID, mergeID int) error {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	if keepID == mergeID {
+		return errors.New("can't merge a guest into itself")
+	}
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var keep, merge models.Guest
+	var keepTags, mergeTags string
+
+	query := `select id, first_name, last_name, email, phone, notes, tags from guests where id = $1 for update`
+	for _, g := range []struct {
+		id    int
+		guest *models.Guest
+		tags  *string
+	}{{keepID, &keep, &keepTags}, {mergeID, &merge, &mergeTags}} {
+		err = tx.QueryRowContext(ctx, query, g.id).Scan(
+			&g.guest.ID,
+			&g.guest.FirstName,
+			&g.guest.LastName,
+			&g.guest.Email,
+			&g.guest.Phone,
+			&g.guest.Notes,
+			g.tags,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	if keep.Phone == "" {
+		keep.Phone = merge.Phone
+	}
+	if keep.FirstName == "" {
+		keep.FirstName = merge.FirstName
+	}
+	if keep.LastName == "" {
+		keep.LastName = merge.LastName
+	}
+	if merge.Notes != "" {
+		keep.Notes = strings.TrimSpace(keep.Notes + "\n" + merge.Notes)
+	}
+
+	keep.Tags = splitTags(keepTags)
+	for _, t := range splitTags(mergeTags) {
+		if !keep.HasTag(t) {
+			keep.Tags = append(keep.Tags, t)
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, `update reservations set guest_id = $1, updated_at = $2 where guest_id = $3`,
+		keepID, time.Now(), mergeID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `update cancellations set guest_id = $1, updated_at = $2 where guest_id = $3`,
+		keepID, time.Now(), mergeID)
+	if err != nil {
+		return err
+	}
+
+	// the promo codes used count against the merged guest's limits
+	_, err = tx.ExecContext(ctx, `update promotion_redemptions set guest_id = $1, updated_at = $2 where guest_id = $3`,
+		keepID, time.Now(), mergeID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `update guests set first_name=$1,last_name=$2,phone=$3,notes=$4,tags=$5,updated_at=$6 where id = $7`,
+		keep.FirstName,
+		keep.LastName,
+		keep.Phone,
+		keep.Notes,
+		joinTags(keep.Tags),
+		time.Now(),
+		keepID,
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `delete from guests where id = $1`, mergeID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// roomAvailableTx checks availability inside a transaction, ignoring expired holds and the restriction
+// of reservation excludeID, so a reservation doesn't clash with itself when it is moved. Pass 0 to exclude nothing.
+func roomAvailableTx(ctx context.Context, tx *sql.Tx, roomID int, start, end time.Time, excludeID int) (bool, error) {
+	var numRows int
+
+	query := `
+		select
+			count(id)
+		from
+			room_restrictions
+		where
+			room_id = $1
+			and $2 < end_date and $3 > start_date
+			and (expires_at is null or expires_at > $4)
+			and (reservation_id is null or reservation_id <> $5);`
+
+	err := tx.QueryRowContext(ctx, query, roomID, start, end, time.Now(), excludeID).Scan(&numRows)
+	if err != nil {
+		return false, err
+	}
+	return numRows == 0, nil
+}
+
+// GetReservationNotes returns the notes on a reservation, pinned notes first and otherwise oldest first.
+// Replies are returned in the Replies of the note they answer.
+func (m *postgresDBRepo) GetReservationNotes(ctx context.Context, reservationID int) ([]models.ReservationNote, error) {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	var notes []models.ReservationNote
+
+	query := `
+	select n.id, n.reservation_id, coalesce(n.parent_id, 0), coalesce(n.user_id, 0),
+	coalesce(trim(u.first_name || ' ' || u.last_name), ''), n.body, n.pinned, n.created_at, n.updated_at
+	from reservation_notes n
+	left join users u on (u.id = n.user_id)
+	where n.reservation_id = $1
+	order by n.pinned desc, n.created_at, n.id
+	`
+
+	rows, err := m.DB.QueryContext(ctx, query, reservationID)
+	if err != nil {
+		return notes, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var n models.ReservationNote
+		err := rows.Scan(
+			&n.ID,
+			&n.ReservationID,
+			&n.ParentID,
+			&n.UserID,
+			&n.Author,
+			&n.Body,
+			&n.Pinned,
+			&n.CreatedAt,
+			&n.UpdatedAt,
+		)
+		if err != nil {
+			return notes, err
+		}
+		notes = append(notes, n)
+	}
+	if err = rows.Err(); err != nil {
+		return notes, err
+	}
+
+	return threadNotes(notes), nil
+}
+
+// threadNotes moves every reply into the Replies of its parent, keeping the order of notes.
+func threadNotes(notes []models.ReservationNote) []models.ReservationNote {
+	var threads []models.ReservationNote
+	index := make(map[int]int)
+
+	for _, n := range notes {
+		if n.ParentID == 0 {
+			index[n.ID] = len(threads)
+			threads = append(threads, n)
+		}
+	}
+	for _, n := range notes {
+		if i, ok := index[n.ParentID]; ok {
+			threads[i].Replies = append(threads[i].Replies, n)
+		}
+	}
+
+	return threads
+}
+
+// InsertReservationNote adds a note to a reservation and returns its id. A reply must answer a note on the
+// same reservation, replies to replies are attached to the note that started the thread.
+func (m *postgresDBRepo) InsertReservationNote(ctx context.Context, n models.ReservationNote) (int, error) {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	if n.ParentID != 0 {
+		var parentID int
+		query := `select coalesce(parent_id, id) from reservation_notes where id = $1 and reservation_id = $2`
+		err := m.DB.QueryRowContext(ctx, query, n.ParentID, n.ReservationID).Scan(&parentID)
+		if err != nil {
+			return 0, err
+		}
+		n.ParentID = parentID
+	}
+
+	var newID int
+	stmt := `insert into reservation_notes (reservation_id, parent_id, user_id, body, pinned, created_at, updated_at)
+			values ($1, nullif($2, 0), nullif($3, 0), $4, $5, $6, $7) returning id`
+
+	err := m.DB.QueryRowContext(ctx, stmt,
+		n.ReservationID,
+		n.ParentID,
+		n.UserID,
+		n.Body,
+		n.Pinned && n.ParentID == 0,
+		time.Now(),
+		time.Now(),
+	).Scan(&newID)
+	if err != nil {
+		return 0, err
+	}
+
+	return newID, nil
+}
+
+// SetReservationNotePinned pins or unpins a note. Only notes that start a thread can be pinned.
+func (m *postgresDBRepo) SetReservationNotePinned(ctx context.Context, id int, pinned bool) error {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	query := `update reservation_notes set pinned = $1, updated_at = $2 where id = $3 and parent_id is null`
+	_, err := m.DB.ExecContext(ctx, query, pinned, time.Now(), id)
+	return err
+}
+
+// InsertPayment records a payment or refund and returns its id.
+func (m *postgresDBRepo) InsertPayment(ctx context.Context, p models.Payment) (int, error) {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	var newID int
+	stmt := `insert into payments (reservation_id, provider, provider_ref, kind, amount, currency, status,
+			created_at, updated_at)
+			values ($1, $2, $3, $4, $5, $6, $7, $8, $9) returning id`
+
+	err := m.DB.QueryRowContext(ctx, stmt,
+		p.ReservationID,
+		p.Provider,
+		p.ProviderRef,
+		p.Kind,
+		p.Amount,
+		p.Currency,
+		p.Status,
+		time.Now(),
+		time.Now(),
+	).Scan(&newID)
+	if err != nil {
+		return 0, err
+	}
+
+	return newID, nil
+}
+
+// GetPaymentsForReservation returns the payments and refunds of a reservation, oldest first.
+func (m *postgresDBRepo) GetPaymentsForReservation(ctx context.Context, reservationID int) ([]models.Payment, error) {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	var payments []models.Payment
+
+	query := `
+	select id, reservation_id, provider, provider_ref, kind, amount, currency, status, created_at, updated_at
+	from payments
+	where reservation_id = $1
+	order by created_at, id
+	`
+
+	rows, err := m.DB.QueryContext(ctx, query, reservationID)
+	if err != nil {
+		return payments, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var p models.Payment
+		err := rows.Scan(
+			&p.ID,
+			&p.ReservationID,
+			&p.Provider,
+			&p.ProviderRef,
+			&p.Kind,
+			&p.Amount,
+			&p.Currency,
+			&p.Status,
+			&p.CreatedAt,
+			&p.UpdatedAt,
+		)
+		if err != nil {
+			return payments, err
+		}
+		payments = append(payments, p)
+	}
+	if err = rows.Err(); err != nil {
+		return payments, err
+	}
+
+	return payments, nil
+}
+
+// UpdatePaymentStatus sets the status of the payments with the provider reference, as reported by a webhook
+// of the provider. It returns the number of payments changed.
+func (m *postgresDBRepo) UpdatePaymentStatus(ctx context.Context, provider, providerRef, status string) (int64, error) {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	query := `update payments set status = $1, updated_at = $2 where provider = $3 and provider_ref = $4`
+	result, err := m.DB.ExecContext(ctx, query, status, time.Now(), provider, providerRef)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
+
+// InvoiceForReservation returns the invoice of a reservation, issuing it with the next invoice number the
+// first time. The table is locked while the number is taken so the numbers have no gaps.
+func (m *postgresDBRepo) InvoiceForReservation(ctx context.Context, reservationID int) (models.Invoice, error) {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	var inv models.Invoice
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return inv, err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `lock table invoices in share row exclusive mode`)
+	if err != nil {
+		return inv, err
+	}
+
+	query := `select id, number, reservation_id, created_at, updated_at from invoices where reservation_id = $1`
+	err = tx.QueryRowContext(ctx, query, reservationID).Scan(
+		&inv.ID,
+		&inv.Number,
+		&inv.ReservationID,
+		&inv.CreatedAt,
+		&inv.UpdatedAt,
+	)
+	if err == nil {
+		return inv, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return inv, err
+	}
+
+	query = `insert into invoices (number, reservation_id, created_at, updated_at)
+			select coalesce(max(number), 0) + 1, $1, $2, $2 from invoices
+			returning id, number, reservation_id, created_at, updated_at`
+	err = tx.QueryRowContext(ctx, query, reservationID, time.Now()).Scan(
+		&inv.ID,
+		&inv.Number,
+		&inv.ReservationID,
+		&inv.CreatedAt,
+		&inv.UpdatedAt,
+	)
+	if err != nil {
+		return inv, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return inv, err
+	}
+	m.logger(ctx).Info("invoice issued", "invoice", inv.Number, "reservation_id", reservationID)
+	return inv, nil
+}
+
+// AllTaxRules returns the tax rules, fees first.
+func (m *postgresDBRepo) AllTaxRules(ctx context.Context) ([]models.TaxRule, error) {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	var rules []models.TaxRule
+
+	query := `
+		select
+			id, name, kind, method, basis, amount, currency, valid_from, valid_until, created_at, updated_at
+		from
+			tax_rules
+		order by
+			kind, name, valid_from nulls first`
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return rules, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var r models.TaxRule
+		var validFrom, validUntil sql.NullTime
+		err := rows.Scan(
+			&r.ID,
+			&r.Name,
+			&r.Kind,
+			&r.Method,
+			&r.Basis,
+			&r.Amount,
+			&r.Currency,
+			&validFrom,
+			&validUntil,
+			&r.CreatedAt,
+			&r.UpdatedAt,
+		)
+		if err != nil {
+			return rules, err
+		}
+		r.ValidFrom = validFrom.Time
+		r.ValidUntil = validUntil.Time
+		rules = append(rules, r)
+	}
+
+	if err = rows.Err(); err != nil {
+		return rules, err
+	}
+	return rules, nil
+}
+
+// InsertTaxRule saves a new tax rule and returns its ID.
+func (m *postgresDBRepo) InsertTaxRule(ctx context.Context, r models.TaxRule) (int, error) {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	var newID int
+
+	stmt := `insert into tax_rules (name, kind, method, basis, amount, currency, valid_from, valid_until,
+			created_at, updated_at)
+			values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $9) returning id`
+
+	err := m.DB.QueryRowContext(ctx, stmt,
+		r.Name,
+		r.Kind,
+		r.Method,
+		r.Basis,
+		r.Amount,
+		strings.ToLower(r.Currency),
+		sql.NullTime{Time: r.ValidFrom, Valid: !r.ValidFrom.IsZero()},
+		sql.NullTime{Time: r.ValidUntil, Valid: !r.ValidUntil.IsZero()},
+		time.Now(),
+	).Scan(&newID)
+	if err != nil {
+		return 0, err
+	}
+
+	return newID, nil
+}
+
+// DeleteTaxRule deletes a tax rule. Charges already made from it are kept.
+func (m *postgresDBRepo) DeleteTaxRule(ctx context.Context, id int) error {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, `delete from tax_rules where id = $1`, id)
+	return err
+}
+
+// promotionQuery selects the promotions scanned by scanPromotion, with their rooms and number of uses.
+const promotionQuery = `
+	select
+		p.id, p.code, p.description, p.method, p.amount, p.currency, p.valid_from, p.valid_until, p.min_nights,
+		p.max_uses, p.max_uses_per_guest, p.created_at, p.updated_at,
+		coalesce((select string_agg(pr.room_id::text, ',' order by pr.room_id) from promotion_rooms pr
+			where pr.promotion_id = p.id), ''),
+		(select count(*) from promotion_redemptions r where r.promotion_id = p.id)
+	from
+		promotions p`
+
+// scanPromotion scans one row selected by promotionQuery.
+func scanPromotion(row scanner) (models.Promotion, error) {
+	var p models.Promotion
+	var validFrom, validUntil sql.NullTime
+	var rooms string
+
+	err := row.Scan(
+		&p.ID,
+		&p.Code,
+		&p.Description,
+		&p.Method,
+		&p.Amount,
+		&p.Currency,
+		&validFrom,
+		&validUntil,
+		&p.MinNights,
+		&p.MaxUses,
+		&p.MaxUsesPerGuest,
+		&p.CreatedAt,
+		&p.UpdatedAt,
+		&rooms,
+		&p.Uses,
+	)
+	if err != nil {
+		return p, err
+	}
+
+	p.ValidFrom = validFrom.Time
+	p.ValidUntil = validUntil.Time
+	if rooms != "" {
+		for _, id := range strings.Split(rooms, ",") {
+			roomID, err := strconv.Atoi(id)
+			if err != nil {
+				return p, err
+			}
+			p.RoomIDs = append(p.RoomIDs, roomID)
+		}
+	}
+	return p, nil
+}
+
+// GetPromotionByCode returns the promotion with a promo code.
+func (m *postgresDBRepo) GetPromotionByCode(ctx context.Context, code string) (models.Promotion, error) {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	return scanPromotion(m.DB.QueryRowContext(ctx, promotionQuery+` where p.code = $1`, code))
+}
+
+// AllPromotions returns the promotions, the latest first.
+func (m *postgresDBRepo) AllPromotions(ctx context.Context) ([]models.Promotion, error) {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	var list []models.Promotion
+
+	rows, err := m.DB.QueryContext(ctx, promotionQuery+` order by p.created_at desc, p.id desc`)
+	if err != nil {
+		return list, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		p, err := scanPromotion(rows)
+		if err != nil {
+			return list, err
+		}
+		list = append(list, p)
+	}
+
+	if err = rows.Err(); err != nil {
+		return list, err
+	}
+	return list, nil
+}
+
+// InsertPromotion saves a new promotion with its rooms and returns its ID.
+func (m *postgresDBRepo) InsertPromotion(ctx context.Context, p models.Promotion) (int, error) {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var newID int
+
+	stmt := `insert into promotions (code, description, method, amount, currency, valid_from, valid_until,
+			min_nights, max_uses, max_uses_per_guest, created_at, updated_at)
+			values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $11) returning id`
+
+	err = tx.QueryRowContext(ctx, stmt,
+		p.Code,
+		p.Description,
+		p.Method,
+		p.Amount,
+		strings.ToLower(p.Currency),
+		sql.NullTime{Time: p.ValidFrom, Valid: !p.ValidFrom.IsZero()},
+		sql.NullTime{Time: p.ValidUntil, Valid: !p.ValidUntil.IsZero()},
+		p.MinNights,
+		p.MaxUses,
+		p.MaxUsesPerGuest,
+		time.Now(),
+	).Scan(&newID)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, roomID := range p.RoomIDs {
+		_, err = tx.ExecContext(ctx, `insert into promotion_rooms (promotion_id, room_id, created_at, updated_at)
+				values ($1, $2, $3, $3)`, newID, roomID, time.Now())
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, err
+	}
+	return newID, nil
+}
+
+// DeletePromotion deletes a promotion. Its redemptions are kept for the report.
+func (m *postgresDBRepo) DeletePromotion(ctx context.Context, id int) error {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, `delete from promotions where id = $1`, id)
+	return err
+}
+
+// GetPromotionRedemptions returns the uses of a promo code, or of every code when code is empty, the latest
+// first.
+func (m *postgresDBRepo) GetPromotionRedemptions(ctx context.Context, code string) ([]models.PromotionRedemption, error) {
+	ctx, cancel := m.withTimeout(ctx)
+	defer cancel()
+
+	var redemptions []models.PromotionRedemption
+
+	query := `
+		select
+			id, coalesce(promotion_id, 0), code, coalesce(reservation_id, 0), coalesce(guest_id, 0), first_name,
+			last_name, email, discount, currency, created_at
+		from
+			promotion_redemptions
+		where
+			$1 = '' or code = $1
+		order by
+			created_at desc, id desc`
+
+	rows, err := m.DB.QueryContext(ctx, query, code)
+	if err != nil {
+		return redemptions, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var r models.PromotionRedemption
+		err := rows.Scan(
+			&r.ID,
+			&r.PromotionID,
+			&r.Code,
+			&r.ReservationID,
+			&r.GuestID,
+			&r.FirstName,
+			&r.LastName,
+			&r.Email,
+			&r.Discount,
+			&r.Currency,
+			&r.CreatedAt,
+		)
+		if err != nil {
+			return redemptions, err
+		}
+		redemptions = append(redemptions, r)
+	}
+
+	if err = rows.Err(); err != nil {
+		return redemptions, err
+	}
+	return redemptions, nil
+}
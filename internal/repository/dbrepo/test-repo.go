@@ -1,28 +1,49 @@
 package dbrepo
 
 import (
+	"context"
+	"database/sql"
 	"errors"
+	"fmt"
 	"time"
 
 	"github.com/GitEagleY/BookingsWebApp/internal/models"
+	"github.com/GitEagleY/BookingsWebApp/internal/promotions"
+	"github.com/GitEagleY/BookingsWebApp/internal/repository"
 )
 
-// AllUsers returns a boolean value (always true in this case).
-func (m *testDBRepo) AllUsers() bool {
-	return true
+func (m *testDBRepo) SetupDone(ctx context.Context) (bool, error) {
+	return true, nil
+}
+
+func (m *testDBRepo) CompleteSetup(ctx context.Context, p models.Property, owner models.User, password string) (int, error) {
+	if owner.Email == "taken@here.com" {
+		return 0, repository.ErrSetupDone
+	}
+	if p.Name == "Broken" {
+		return 0, errors.New("some error")
+	}
+	return 1, nil
+}
+
+func (m *testDBRepo) GetProperty(ctx context.Context) (models.Property, error) {
+	return models.Property{Name: "Relax B&B", Timezone: "UTC", ContactEmail: "me@here.com"}, nil
 }
 
 // InsertReservations inserts a new reservation into the database and returns the new ID.
-func (m *testDBRepo) InsertReservation(res models.Reservation) (int, error) {
+func (m *testDBRepo) InsertReservation(ctx context.Context, res models.Reservation) (int, error) {
 	if res.RoomID == 2 {
 		return 0, errors.New("some error")
 	}
+	if res.PromotionCode == "USEDUP" {
+		return 0, fmt.Errorf("%w: it has been used up", promotions.ErrNotApplicable)
+	}
 
 	return 1, nil
 }
 
 // InsertRoomRestrictions inserts room restrictions into the database.
-func (m *testDBRepo) InsertRoomRestriction(r models.RoomRestriction) error {
+func (m *testDBRepo) InsertRoomRestriction(ctx context.Context, r models.RoomRestriction) error {
 	if r.RoomID == 1000 {
 		return errors.New("some error")
 	}
@@ -30,22 +51,27 @@ func (m *testDBRepo) InsertRoomRestriction(r models.RoomRestriction) error {
 }
 
 // SearchAvailabilityDatesByRoomsID checks if a room is available within a specified time range.
-func (m *testDBRepo) SearchAvailabilityByDatesByRoomID(start, end time.Time, roomID int) (bool, error) {
+func (m *testDBRepo) SearchAvailabilityByDatesByRoomID(ctx context.Context, start, end time.Time, roomID int) (bool, error) {
 
 	return false, nil
 }
 
 // SearchAvailabilityForAllRooms searches for available rooms within a specified time range.
-func (m *testDBRepo) SearchAvailabilityForAllRooms(start, end time.Time) ([]models.Room, error) {
+func (m *testDBRepo) SearchAvailabilityForAllRooms(ctx context.Context, start, end time.Time) ([]models.Room, error) {
 
 	var rooms []models.Room
 
+	// like a query, it fails once the request is gone
+	if err := ctx.Err(); err != nil {
+		return rooms, err
+	}
+
 	return rooms, nil
 }
 
 // GetRoomByID gets a room by id
-func (m *testDBRepo) GetRoomByID(id int) (models.Room, error) {
-	var room models.Room
+func (m *testDBRepo) GetRoomByID(ctx context.Context, id int) (models.Room, error) {
+	room := models.Room{ID: id, NightlyRate: 10000}
 
 	if id > 2 {
 		return room, errors.New("some erorr")
@@ -53,64 +79,484 @@ func (m *testDBRepo) GetRoomByID(id int) (models.Room, error) {
 
 	return room, nil
 }
-func (m *testDBRepo) GetUserByID(id int) (models.User, error) {
+func (m *testDBRepo) GetUserByID(ctx context.Context, id int) (models.User, error) {
 	var u models.User
 	return u, nil
 }
 
-func (m *testDBRepo) UpdateUser(u models.User) error {
+func (m *testDBRepo) UpdateUser(ctx context.Context, u models.User) error {
 	return nil
 }
 
-func (m *testDBRepo) Authenticate(email, testPassword string) (int, string, error) {
+func (m *testDBRepo) Authenticate(ctx context.Context, email, testPassword string) (int, string, error) {
 	return 1, "", nil
 }
 
-func (m *testDBRepo) AllReservations() ([]models.Reservation, error) {
+func (m *testDBRepo) GetUserByEmail(ctx context.Context, email string) (models.User, error) {
+	if email == "nobody@here.com" {
+		return models.User{}, sql.ErrNoRows
+	}
+	return models.User{ID: 1, Email: email, AcessLevel: 3}, nil
+}
 
-	var reservations []models.Reservation
+func (m *testDBRepo) InsertUser(ctx context.Context, u models.User, password string) (int, error) {
+	if u.Email == "taken@here.com" {
+		return 0, errors.New("duplicate key value violates unique constraint")
+	}
+	return 1, nil
+}
 
-	return reservations, nil
+func (m *testDBRepo) UpdateUserPassword(ctx context.Context, id int, password string) error {
+	return nil
+}
 
+func (m *testDBRepo) DisableUser(ctx context.Context, id int) error {
+	return nil
 }
 
-// returns a slice of all new reservations
-func (m *testDBRepo) AllNewReservations() ([]models.Reservation, error) {
+func (m *testDBRepo) SearchReservations(ctx context.Context, f models.ReservationFilter) (models.ReservationPage, error) {
 
-	var reservations []models.Reservation
+	var page models.ReservationPage
 
-	return reservations, nil
+	if f.After == "invalid" {
+		return page, repository.ErrInvalidCursor
+	}
+
+	return page, nil
 }
 
-func (m *testDBRepo) GetReservationByID(id int) (models.Reservation, error) {
+func (m *testDBRepo) StreamReservations(ctx context.Context, f models.ReservationFilter, fn func(models.Reservation) error) error {
+	res := models.Reservation{
+		ID:        1,
+		FirstName: "John",
+		LastName:  "Smith",
+		Email:     "john@smith.com",
+		RoomID:    1,
+		StartDate: time.Date(2050, 1, 1, 0, 0, 0, 0, time.UTC),
+		EndDate:   time.Date(2050, 1, 3, 0, 0, 0, 0, time.UTC),
+		Room: models.Room{
+			ID:       1,
+			RoomName: "Generals Quarters",
+		},
+	}
+	return fn(res)
+}
+
+func (m *testDBRepo) GetReservationByID(ctx context.Context, id int) (models.Reservation, error) {
 
-	var res models.Reservation
+	if err := ctx.Err(); err != nil {
+		return models.Reservation{}, err
+	}
+	if id == 1000 {
+		return models.Reservation{}, errors.New("some error")
+	}
+
+	arrival := time.Now().AddDate(0, 0, 30)
+	res := models.Reservation{
+		ID:                 id,
+		GuestID:            1,
+		Email:              "john@smith.com",
+		StartDate:          arrival,
+		EndDate:            arrival.AddDate(0, 0, 2),
+		CancellationPolicy: "moderate:5=100,1=50",
+	}
 
 	return res, nil
 }
 
-func (m *testDBRepo) UpdateReservation(u models.Reservation) error {
-
+func (m *testDBRepo) UpdateReservation(ctx context.Context, u models.Reservation) error {
+	if u.RoomID == 2 {
+		return repository.ErrRoomUnavailable
+	}
+	if u.RoomID == 1000 {
+		return errors.New("some error")
+	}
 	return nil
-
 }
-func (m *testDBRepo) DeleteReservation(id int) error {
-
+func (m *testDBRepo) CancelReservation(ctx context.Context, c models.Cancellation) error {
+	if c.ReservationID == 1000 {
+		return errors.New("some error")
+	}
 	return nil
 }
-func (m *testDBRepo) UpdateProcessedForReservation(id, processed int) error {
+func (m *testDBRepo) UpdateProcessedForReservation(ctx context.Context, id, processed int) error {
 
 	return nil
 }
 
-func (m *testDBRepo) AllRooms() ([]models.Room, error) {
+func (m *testDBRepo) AllRooms(ctx context.Context) ([]models.Room, error) {
 
 	var rooms []models.Room
 	return rooms, nil
 }
-func (m *testDBRepo) GetRestrictionsForRoomByDate(roomID int, start, end time.Time) ([]models.RoomRestriction, error) {
+
+func (m *testDBRepo) InsertRoom(ctx context.Context, rm models.Room) (int, error) {
+	return 1, nil
+}
+
+func (m *testDBRepo) GetRestrictionsForRoomByDate(ctx context.Context, roomID int, start, end time.Time) ([]models.RoomRestriction, error) {
 
 	var restrictions []models.RoomRestriction
 
 	return restrictions, nil
 }
+
+func (m *testDBRepo) InsertHold(ctx context.Context, r models.RoomRestriction) (int, error) {
+	if r.RoomID == 2 {
+		return 0, repository.ErrRoomUnavailable
+	}
+	return 1, nil
+}
+
+func (m *testDBRepo) DeleteHold(ctx context.Context, id int) error {
+
+	return nil
+}
+
+func (m *testDBRepo) ConvertHoldToReservation(ctx context.Context, res models.Reservation, holdID int) (int, error) {
+	if res.RoomID == 2 {
+		return 0, repository.ErrRoomUnavailable
+	}
+	if res.PromotionCode == "USEDUP" {
+		return 0, fmt.Errorf("%w: it has been used up", promotions.ErrNotApplicable)
+	}
+	return 1, nil
+}
+
+func (m *testDBRepo) DeleteExpiredHolds(ctx context.Context) (int64, error) {
+
+	return 0, nil
+}
+
+func (m *testDBRepo) InsertBlock(ctx context.Context, r models.RoomRestriction) (int, error) {
+	if r.RoomID == 2 {
+		return 0, repository.ErrRoomUnavailable
+	}
+	return 1, nil
+}
+
+func (m *testDBRepo) DeleteBlock(ctx context.Context, id int) (models.RoomRestriction, error) {
+	if id == 1000 {
+		return models.RoomRestriction{}, sql.ErrNoRows
+	}
+	return models.RoomRestriction{ID: id, RoomID: 1, RestrictionID: models.RestrictionOwnerBlock}, nil
+}
+
+func (m *testDBRepo) InsertWaitlistEntry(ctx context.Context, w models.WaitlistEntry) (int, error) {
+	if w.RoomID == 2 {
+		return 0, errors.New("some error")
+	}
+	return 1, nil
+}
+
+func (m *testDBRepo) GetWaitlistEntriesForDates(ctx context.Context, roomID int, start, end time.Time) ([]models.WaitlistEntry, error) {
+
+	var entries []models.WaitlistEntry
+
+	return entries, nil
+}
+
+func (m *testDBRepo) UpdateWaitlistToken(ctx context.Context, id, roomID int, token string, expiresAt time.Time) error {
+
+	return nil
+}
+
+func (m *testDBRepo) GetWaitlistEntryByToken(ctx context.Context, token string) (models.WaitlistEntry, error) {
+	var e models.WaitlistEntry
+
+	if token == "expired" {
+		return e, errors.New("some error")
+	}
+
+	e.RoomID = 1
+	if token == "any-room" {
+		e.RoomID = 0
+		e.OfferedRoomID = 2
+	}
+	e.Email = "john@smith.com"
+	e.StartDate = time.Date(2050, 1, 1, 0, 0, 0, 0, time.UTC)
+	e.EndDate = time.Date(2050, 1, 2, 0, 0, 0, 0, time.UTC)
+	return e, nil
+}
+
+func (m *testDBRepo) ImportReservations(ctx context.Context, res []models.Reservation) (int, error) {
+	for _, r := range res {
+		if r.RoomID == 2 {
+			return 0, repository.ErrRoomUnavailable
+		}
+	}
+	return len(res), nil
+}
+
+func (m *testDBRepo) DashboardStats(ctx context.Context, today, start, end time.Time) (models.DashboardStats, error) {
+	s := models.DashboardStats{
+		ArrivalsToday:   1,
+		NewReservations: 2,
+		AverageStay:     2.5,
+	}
+	return s, nil
+}
+
+func (m *testDBRepo) RoomOccupancy(ctx context.Context, start, end time.Time) ([]models.RoomOccupancy, error) {
+	var occupancy []models.RoomOccupancy
+
+	for month := start; month.Before(end); month = month.AddDate(0, 1, 0) {
+		occupancy = append(occupancy,
+			models.RoomOccupancy{RoomID: 1, RoomName: "Generals Quarters", Month: month, BookedNights: 15, Nights: 30},
+			models.RoomOccupancy{RoomID: 2, RoomName: "Majors Suite", Month: month, BookedNights: 3, Nights: 30},
+		)
+	}
+	return occupancy, nil
+}
+
+func (m *testDBRepo) MonthlyBookings(ctx context.Context, start, end time.Time) ([]models.MonthlyBookings, error) {
+	var months []models.MonthlyBookings
+
+	for month := start; month.Before(end); month = month.AddDate(0, 1, 0) {
+		months = append(months, models.MonthlyBookings{Month: month, Arrivals: 4, Cancellations: 1, AverageStay: 2, AverageLeadTime: 14})
+	}
+	return months, nil
+}
+
+func (m *testDBRepo) CreateReservation(ctx context.Context, res models.Reservation) (int, error) {
+	if res.RoomID == 2 {
+		return 0, repository.ErrRoomUnavailable
+	}
+	if res.RoomID == 1000 {
+		return 0, errors.New("some error")
+	}
+	if res.PromotionCode == "USEDUP" {
+		return 0, fmt.Errorf("%w: it has been used up", promotions.ErrNotApplicable)
+	}
+	return 1, nil
+}
+
+func (m *testDBRepo) SearchGuests(ctx context.Context, query string) ([]models.GuestSummary, error) {
+	var guests []models.GuestSummary
+
+	if err := ctx.Err(); err != nil {
+		return guests, err
+	}
+	if query == "error" {
+		return guests, errors.New("some error")
+	}
+
+	g := models.GuestSummary{Stays: 2, Nights: 5, TotalSpent: 44500}
+	g.ID = 1
+	g.FirstName = "John"
+	g.LastName = "Smith"
+	g.Email = "john@smith.com"
+	g.Tags = []string{"VIP"}
+	guests = append(guests, g)
+	return guests, nil
+}
+
+func (m *testDBRepo) GetGuestByID(ctx context.Context, id int) (models.GuestSummary, error) {
+	var g models.GuestSummary
+
+	if id > 2 {
+		return g, errors.New("some error")
+	}
+
+	g.ID = id
+	g.FirstName = "John"
+	g.LastName = "Smith"
+	g.Email = "john@smith.com"
+	return g, nil
+}
+
+func (m *testDBRepo) GetReservationsForGuest(ctx context.Context, guestID int) ([]models.Reservation, error) {
+	var reservations []models.Reservation
+
+	reservations = append(reservations, models.Reservation{
+		ID:        1,
+		GuestID:   guestID,
+		StartDate: time.Date(2050, 1, 1, 0, 0, 0, 0, time.UTC),
+		EndDate:   time.Date(2050, 1, 3, 0, 0, 0, 0, time.UTC),
+		Amount:    17800,
+		Room:      models.Room{ID: 1, RoomName: "Generals Quarters"},
+	})
+	return reservations, nil
+}
+
+func (m *testDBRepo) UpdateGuest(ctx context.Context, g models.Guest) error {
+	if g.Email == "jane@smith.com" {
+		return repository.ErrGuestEmailTaken
+	}
+	return nil
+}
+
+func (m *testDBRepo) GetPossibleDuplicateGuests(ctx context.Context, g models.Guest) ([]models.Guest, error) {
+	var guests []models.Guest
+
+	return guests, nil
+}
+
+func (m *testDBRepo) MergeGuests(ctx context.Context, keepID, mergeID int) error {
+	if mergeID > 2 {
+		return errors.New("some error")
+	}
+	return nil
+}
+
+func (m *testDBRepo) GetReservationNotes(ctx context.Context, reservationID int) ([]models.ReservationNote, error) {
+	var notes []models.ReservationNote
+
+	notes = append(notes, models.ReservationNote{
+		ID:            1,
+		ReservationID: reservationID,
+		Author:        "Admin User",
+		Body:          "Arrives after midnight",
+		Pinned:        true,
+		CreatedAt:     time.Date(2050, 1, 1, 12, 0, 0, 0, time.UTC),
+		Replies: []models.ReservationNote{
+			{ID: 2, ReservationID: reservationID, ParentID: 1, Author: "Admin User", Body: "Key left at the bar"},
+		},
+	})
+	return notes, nil
+}
+
+func (m *testDBRepo) InsertReservationNote(ctx context.Context, n models.ReservationNote) (int, error) {
+	if n.ParentID > 2 {
+		return 0, errors.New("some error")
+	}
+	return 1, nil
+}
+
+func (m *testDBRepo) SetReservationNotePinned(ctx context.Context, id int, pinned bool) error {
+	if id > 2 {
+		return errors.New("some error")
+	}
+	return nil
+}
+
+func (m *testDBRepo) InsertPayment(ctx context.Context, p models.Payment) (int, error) {
+	if p.ReservationID == 1000 {
+		return 0, errors.New("some error")
+	}
+	return 1, nil
+}
+
+func (m *testDBRepo) GetPaymentsForReservation(ctx context.Context, reservationID int) ([]models.Payment, error) {
+	var payments []models.Payment
+
+	if reservationID == 1 {
+		payments = append(payments, models.Payment{
+			ID:            1,
+			ReservationID: reservationID,
+			Provider:      "fake",
+			ProviderRef:   "pi_fake_1",
+			Kind:          models.PaymentDeposit,
+			Amount:        5000,
+			Currency:      "usd",
+			Status:        "succeeded",
+		})
+	}
+	return payments, nil
+}
+
+func (m *testDBRepo) UpdatePaymentStatus(ctx context.Context, provider, providerRef, status string) (int64, error) {
+	if providerRef == "pi_unknown" {
+		return 0, nil
+	}
+	return 1, nil
+}
+
+func (m *testDBRepo) InvoiceForReservation(ctx context.Context, reservationID int) (models.Invoice, error) {
+	if reservationID == 1000 {
+		return models.Invoice{}, errors.New("some error")
+	}
+	return models.Invoice{ID: reservationID, Number: reservationID, ReservationID: reservationID}, nil
+}
+
+func (m *testDBRepo) AllTaxRules(ctx context.Context) ([]models.TaxRule, error) {
+	var rules []models.TaxRule
+
+	rules = append(rules,
+		models.TaxRule{ID: 1, Name: "Cleaning fee", Kind: models.TaxRuleFee, Method: models.TaxRuleFixed, Basis: models.TaxRulePerStay, Amount: 3000, Currency: "usd"},
+		models.TaxRule{ID: 2, Name: "Tourist tax", Kind: models.TaxRuleTax, Method: models.TaxRuleFixed, Basis: models.TaxRulePerGuestNight, Amount: 250, Currency: "usd"},
+	)
+	return rules, nil
+}
+
+func (m *testDBRepo) InsertTaxRule(ctx context.Context, r models.TaxRule) (int, error) {
+	if r.Name == "fail" {
+		return 0, errors.New("some error")
+	}
+	return 1, nil
+}
+
+func (m *testDBRepo) DeleteTaxRule(ctx context.Context, id int) error {
+	if id > 2 {
+		return errors.New("some error")
+	}
+	return nil
+}
+
+func (m *testDBRepo) GetPromotionByCode(ctx context.Context, code string) (models.Promotion, error) {
+	switch code {
+	case "SUMMER":
+		return models.Promotion{ID: 1, Code: code, Method: models.PromotionPercent, Amount: 1000}, nil
+	case "SUITE":
+		return models.Promotion{ID: 2, Code: code, Method: models.PromotionFixed, Amount: 2500, Currency: "usd", RoomIDs: []int{2}}, nil
+	case "USEDUP":
+		// someone else takes the last use before the reservation is saved
+		return models.Promotion{ID: 3, Code: code, Method: models.PromotionPercent, Amount: 1000, MaxUses: 1}, nil
+	case "EXPIRED":
+		return models.Promotion{ID: 4, Code: code, Method: models.PromotionPercent, Amount: 1000, ValidUntil: time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)}, nil
+	}
+	return models.Promotion{}, sql.ErrNoRows
+}
+
+func (m *testDBRepo) AllPromotions(ctx context.Context) ([]models.Promotion, error) {
+	var list []models.Promotion
+
+	list = append(list, models.Promotion{
+		ID:         1,
+		Code:       "SUMMER",
+		Method:     models.PromotionPercent,
+		Amount:     1000,
+		ValidUntil: time.Date(2050, 8, 31, 0, 0, 0, 0, time.UTC),
+		RoomIDs:    []int{1},
+		MaxUses:    100,
+		Uses:       1,
+	})
+	return list, nil
+}
+
+func (m *testDBRepo) InsertPromotion(ctx context.Context, p models.Promotion) (int, error) {
+	if p.Code == "FAIL" {
+		return 0, errors.New("some error")
+	}
+	return 1, nil
+}
+
+func (m *testDBRepo) DeletePromotion(ctx context.Context, id int) error {
+	if id > 2 {
+		return errors.New("some error")
+	}
+	return nil
+}
+
+func (m *testDBRepo) GetPromotionRedemptions(ctx context.Context, code string) ([]models.PromotionRedemption, error) {
+	var redemptions []models.PromotionRedemption
+
+	if code == "FAIL" {
+		return redemptions, errors.New("some error")
+	}
+
+	redemptions = append(redemptions, models.PromotionRedemption{
+		ID:            1,
+		PromotionID:   1,
+		Code:          "SUMMER",
+		ReservationID: 1,
+		GuestID:       1,
+		FirstName:     "John",
+		LastName:      "Smith",
+		Email:         "john@smith.com",
+		Discount:      2000,
+		Currency:      "usd",
+		CreatedAt:     time.Date(2050, 1, 1, 12, 0, 0, 0, time.UTC),
+	})
+	return redemptions, nil
+}
@@ -1,28 +1,98 @@
 package repository
 
 import (
+	"context"
+	"errors"
 	"time"
 
 	"github.com/GitEagleY/BookingsWebApp/internal/models"
 )
 
+// ErrRoomUnavailable is returned when a room is already taken for the requested dates.
+var ErrRoomUnavailable = errors.New("room is not available for the requested dates")
+
+// ErrSetupDone is returned when the setup is completed a second time.
+var ErrSetupDone = errors.New("setup has been completed already")
+
+// ErrGuestEmailTaken is returned when a guest is given the email address of another guest.
+var ErrGuestEmailTaken = errors.New("another guest has that email address")
+
+// ErrInvalidCursor is returned when a page cursor wasn't made by a previous page of the same list.
+var ErrInvalidCursor = errors.New("invalid page cursor")
+
+// DatabaseRepo is the storage of the application. Every method takes the context of the request it serves, so
+// its queries are cancelled when the client goes away.
 type DatabaseRepo interface {
-	AllUsers() bool
-	InsertReservation(res models.Reservation) (int, error)
-	InsertRoomRestriction(r models.RoomRestriction) error
-	SearchAvailabilityByDatesByRoomID(start, end time.Time, roomID int) (bool, error)
-	SearchAvailabilityForAllRooms(start, end time.Time) ([]models.Room, error)
-	GetRoomByID(id int) (models.Room, error)
-
-	GetUserByID(id int) (models.User, error)
-	UpdateUser(u models.User) error
-	Authenticate(email, testPassword string) (int, string, error)
-	AllReservations() ([]models.Reservation, error)
-	AllNewReservations() ([]models.Reservation, error)
-	GetReservationByID(id int) (models.Reservation, error)
-	UpdateReservation(u models.Reservation) error
-	DeleteReservation(id int) error
-	UpdateProcessedForReservation(id, processed int) error
-	AllRooms() ([]models.Room, error)
-	GetRestrictionsForRoomByDate(roomID int, start, end time.Time) ([]models.RoomRestriction, error)
+	SetupDone(ctx context.Context) (bool, error)
+	CompleteSetup(ctx context.Context, p models.Property, owner models.User, password string) (int, error)
+	GetProperty(ctx context.Context) (models.Property, error)
+
+	InsertReservation(ctx context.Context, res models.Reservation) (int, error)
+	InsertRoomRestriction(ctx context.Context, r models.RoomRestriction) error
+	SearchAvailabilityByDatesByRoomID(ctx context.Context, start, end time.Time, roomID int) (bool, error)
+	SearchAvailabilityForAllRooms(ctx context.Context, start, end time.Time) ([]models.Room, error)
+	GetRoomByID(ctx context.Context, id int) (models.Room, error)
+
+	GetUserByID(ctx context.Context, id int) (models.User, error)
+	UpdateUser(ctx context.Context, u models.User) error
+	Authenticate(ctx context.Context, email, testPassword string) (int, string, error)
+	GetUserByEmail(ctx context.Context, email string) (models.User, error)
+	InsertUser(ctx context.Context, u models.User, password string) (int, error)
+	UpdateUserPassword(ctx context.Context, id int, password string) error
+	DisableUser(ctx context.Context, id int) error
+	SearchReservations(ctx context.Context, f models.ReservationFilter) (models.ReservationPage, error)
+	StreamReservations(ctx context.Context, f models.ReservationFilter, fn func(models.Reservation) error) error
+	GetReservationByID(ctx context.Context, id int) (models.Reservation, error)
+	UpdateReservation(ctx context.Context, u models.Reservation) error
+	CancelReservation(ctx context.Context, c models.Cancellation) error
+	UpdateProcessedForReservation(ctx context.Context, id, processed int) error
+	AllRooms(ctx context.Context) ([]models.Room, error)
+	InsertRoom(ctx context.Context, rm models.Room) (int, error)
+	GetRestrictionsForRoomByDate(ctx context.Context, roomID int, start, end time.Time) ([]models.RoomRestriction, error)
+
+	InsertHold(ctx context.Context, r models.RoomRestriction) (int, error)
+	DeleteHold(ctx context.Context, id int) error
+	ConvertHoldToReservation(ctx context.Context, res models.Reservation, holdID int) (int, error)
+	DeleteExpiredHolds(ctx context.Context) (int64, error)
+
+	InsertBlock(ctx context.Context, r models.RoomRestriction) (int, error)
+	DeleteBlock(ctx context.Context, id int) (models.RoomRestriction, error)
+
+	InsertWaitlistEntry(ctx context.Context, w models.WaitlistEntry) (int, error)
+	GetWaitlistEntriesForDates(ctx context.Context, roomID int, start, end time.Time) ([]models.WaitlistEntry, error)
+	UpdateWaitlistToken(ctx context.Context, id, roomID int, token string, expiresAt time.Time) error
+	GetWaitlistEntryByToken(ctx context.Context, token string) (models.WaitlistEntry, error)
+
+	ImportReservations(ctx context.Context, res []models.Reservation) (int, error)
+	CreateReservation(ctx context.Context, res models.Reservation) (int, error)
+
+	SearchGuests(ctx context.Context, query string) ([]models.GuestSummary, error)
+	GetGuestByID(ctx context.Context, id int) (models.GuestSummary, error)
+	GetReservationsForGuest(ctx context.Context, guestID int) ([]models.Reservation, error)
+	UpdateGuest(ctx context.Context, g models.Guest) error
+	GetPossibleDuplicateGuests(ctx context.Context, g models.Guest) ([]models.Guest, error)
+	MergeGuests(ctx context.Context, keepID, mergeID int) error
+
+	GetReservationNotes(ctx context.Context, reservationID int) ([]models.ReservationNote, error)
+	InsertReservationNote(ctx context.Context, n models.ReservationNote) (int, error)
+	SetReservationNotePinned(ctx context.Context, id int, pinned bool) error
+
+	InsertPayment(ctx context.Context, p models.Payment) (int, error)
+	GetPaymentsForReservation(ctx context.Context, reservationID int) ([]models.Payment, error)
+	UpdatePaymentStatus(ctx context.Context, provider, providerRef, status string) (int64, error)
+	InvoiceForReservation(ctx context.Context, reservationID int) (models.Invoice, error)
+
+	AllTaxRules(ctx context.Context) ([]models.TaxRule, error)
+	InsertTaxRule(ctx context.Context, r models.TaxRule) (int, error)
+	DeleteTaxRule(ctx context.Context, id int) error
+
+	GetPromotionByCode(ctx context.Context, code string) (models.Promotion, error)
+	AllPromotions(ctx context.Context) ([]models.Promotion, error)
+	InsertPromotion(ctx context.Context, p models.Promotion) (int, error)
+	DeletePromotion(ctx context.Context, id int) error
+	GetPromotionRedemptions(ctx context.Context, code string) ([]models.PromotionRedemption, error)
+
+	DashboardStats(ctx context.Context, today, start, end time.Time) (models.DashboardStats, error)
+	RoomOccupancy(ctx context.Context, start, end time.Time) ([]models.RoomOccupancy, error)
+	MonthlyBookings(ctx context.Context, start, end time.Time) ([]models.MonthlyBookings, error)
 }
@@ -0,0 +1,144 @@
+package sessionstore
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// headerSize is the size of the expiry, in Unix nanoseconds, written before the data of a session.
+const headerSize = 8
+
+// File keeps the sessions in a directory, a file each, named by the hash of the token so the directory
+// listing doesn't give the tokens away.
+type File struct {
+	dir string
+}
+
+// NewFile returns the store of dir, creating it readable by the application only.
+func NewFile(dir string) (*File, error) {
+	err := os.MkdirAll(dir, 0700)
+	if err != nil {
+		return nil, err
+	}
+	return &File{dir: dir}, nil
+}
+
+// path returns the file of the session token.
+func (f *File) path(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return filepath.Join(f.dir, hex.EncodeToString(sum[:]))
+}
+
+// Find returns the data of the session token, unless it is missing or expired.
+func (f *File) Find(token string) ([]byte, bool, error) {
+	b, err := os.ReadFile(f.path(token))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	if len(b) < headerSize || expired(b) {
+		return nil, false, nil
+	}
+	return b[headerSize:], true, nil
+}
+
+// Commit saves the data of the session token, replacing what was saved before. The file is replaced whole, so
+// a request reading it at the same time finds the old data or the new.
+func (f *File) Commit(token string, b []byte, expiry time.Time) error {
+	tmp, err := os.CreateTemp(f.dir, ".commit-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	header := make([]byte, headerSize)
+	binary.BigEndian.PutUint64(header, uint64(expiry.UnixNano()))
+	_, err = tmp.Write(append(header, b...))
+	if err != nil {
+		tmp.Close()
+		return err
+	}
+	err = tmp.Close()
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), f.path(token))
+}
+
+// Delete removes the session token.
+func (f *File) Delete(token string) error {
+	err := os.Remove(f.path(token))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// DeleteExpired removes the expired sessions and returns how many there were.
+func (f *File) DeleteExpired(ctx context.Context) (int64, error) {
+	entries, err := os.ReadDir(f.dir)
+	if err != nil {
+		return 0, err
+	}
+
+	var n int64
+	for _, e := range entries {
+		if err := ctx.Err(); err != nil {
+			return n, err
+		}
+		// the temporary files of commits in progress
+		if e.IsDir() || strings.HasPrefix(e.Name(), ".") {
+			continue
+		}
+
+		path := filepath.Join(f.dir, e.Name())
+		header, err := readHeader(path)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+			return n, err
+		}
+		// a file too short to hold an expiry is no session either
+		if err == nil && !expired(header) {
+			continue
+		}
+
+		err = os.Remove(path)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
+
+// readHeader returns the expiry header of the session file path.
+func readHeader(path string) ([]byte, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	header := make([]byte, headerSize)
+	_, err = io.ReadFull(file, header)
+	return header, err
+}
+
+// expired reports whether the session starting with the expiry header b has expired.
+func expired(b []byte) bool {
+	expiry := time.Unix(0, int64(binary.BigEndian.Uint64(b[:headerSize])))
+	return !time.Now().Before(expiry)
+}
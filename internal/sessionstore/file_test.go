@@ -0,0 +1,78 @@
+package sessionstore
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFile(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "sessions")
+	store, err := NewFile(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = store.Commit("token", []byte("data"), time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, found, err := store.Find("token")
+	if err != nil || !found || string(b) != "data" {
+		t.Errorf("expected the data, got %q, %v, %v", b, found, err)
+	}
+
+	err = store.Commit("token", []byte("changed"), time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _, _ = store.Find("token")
+	if string(b) != "changed" {
+		t.Errorf("expected the data replaced, got %q", b)
+	}
+
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 || entries[0].Name() == "token" {
+		t.Errorf("expected a file named by the hash of the token, got %v", entries)
+	}
+
+	err = store.Delete("token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, found, _ := store.Find("token"); found {
+		t.Error("expected the session deleted")
+	}
+	if err := store.Delete("token"); err != nil {
+		t.Errorf("expected deleting a missing session to do nothing, got %v", err)
+	}
+}
+
+func TestFileDeleteExpired(t *testing.T) {
+	store, err := NewFile(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store.Commit("expired", []byte("old"), time.Now().Add(-time.Minute))
+	store.Commit("current", []byte("new"), time.Now().Add(time.Hour))
+	os.WriteFile(filepath.Join(store.dir, "garbage"), []byte("x"), 0600)
+	os.WriteFile(filepath.Join(store.dir, ".commit-1"), nil, 0600)
+
+	if _, found, _ := store.Find("expired"); found {
+		t.Error("expected an expired session not to be found")
+	}
+
+	n, err := store.DeleteExpired(context.Background())
+	if err != nil || n != 2 {
+		t.Errorf("expected the expired session and the garbage removed, got %d, %v", n, err)
+	}
+	if _, found, _ := store.Find("current"); !found {
+		t.Error("expected the current session kept")
+	}
+	if _, err := os.Stat(filepath.Join(store.dir, ".commit-1")); err != nil {
+		t.Errorf("expected a commit in progress left alone, got %v", err)
+	}
+}
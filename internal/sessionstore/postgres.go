@@ -0,0 +1,81 @@
+// Package sessionstore keeps the sessions of the application where they outlive a restart: in the database,
+// shared by every instance behind a load balancer, or in files for a single instance.
+package sessionstore
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/alexedwards/scs/v2"
+)
+
+var _ scs.CtxStore = (*Postgres)(nil)
+
+// Sweeper is a store whose expired sessions are removed by calling DeleteExpired now and then. The memory
+// store removes its own.
+type Sweeper interface {
+	DeleteExpired(ctx context.Context) (int64, error)
+}
+
+// Postgres keeps the sessions in the sessions table.
+type Postgres struct {
+	db *sql.DB
+}
+
+// NewPostgres returns the store of the sessions table of db.
+func NewPostgres(db *sql.DB) *Postgres {
+	return &Postgres{db: db}
+}
+
+// Find returns the data of the session token, unless it is missing or expired.
+func (p *Postgres) Find(token string) ([]byte, bool, error) {
+	return p.FindCtx(context.Background(), token)
+}
+
+// FindCtx is Find for the request of ctx.
+func (p *Postgres) FindCtx(ctx context.Context, token string) ([]byte, bool, error) {
+	var b []byte
+	err := p.db.QueryRowContext(ctx, `select data from sessions where token = $1 and current_timestamp < expiry`, token).Scan(&b)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return b, true, nil
+}
+
+// Commit saves the data of the session token, replacing what was saved before.
+func (p *Postgres) Commit(token string, b []byte, expiry time.Time) error {
+	return p.CommitCtx(context.Background(), token, b, expiry)
+}
+
+// CommitCtx is Commit for the request of ctx.
+func (p *Postgres) CommitCtx(ctx context.Context, token string, b []byte, expiry time.Time) error {
+	_, err := p.db.ExecContext(ctx, `insert into sessions (token, data, expiry) values ($1, $2, $3)
+			on conflict (token) do update set data = excluded.data, expiry = excluded.expiry`,
+		token, b, expiry.UTC())
+	return err
+}
+
+// Delete removes the session token.
+func (p *Postgres) Delete(token string) error {
+	return p.DeleteCtx(context.Background(), token)
+}
+
+// DeleteCtx is Delete for the request of ctx.
+func (p *Postgres) DeleteCtx(ctx context.Context, token string) error {
+	_, err := p.db.ExecContext(ctx, `delete from sessions where token = $1`, token)
+	return err
+}
+
+// DeleteExpired removes the expired sessions and returns how many there were.
+func (p *Postgres) DeleteExpired(ctx context.Context) (int64, error) {
+	result, err := p.db.ExecContext(ctx, `delete from sessions where expiry < current_timestamp`)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1 @@
+-- reservation_id stays nullable; owner blocks and holds have no reservation.
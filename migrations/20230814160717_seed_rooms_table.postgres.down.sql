@@ -1 +0,0 @@
-delete from rooms
\ No newline at end of file
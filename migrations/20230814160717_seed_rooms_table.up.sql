@@ -1,3 +1,3 @@
 INSERT INTO public.rooms (room_name,created_at,updated_at) VALUES
 	 ('Generals Quarters','2023-08-13 00:00:00.000','2023-08-13 00:00:00.000'),
-	 ('Majors Suite','2023-08-14 00:00:00.000','2023-08-14 00:00:00.000');
\ No newline at end of file
+	 ('Majors Suite','2023-08-14 00:00:00.000','2023-08-14 00:00:00.000');
@@ -0,0 +1 @@
+-- Nothing was seeded.
@@ -1 +0,0 @@
-delete from users where email = 'admin@email.com';
\ No newline at end of file
@@ -1,2 +0,0 @@
-INSERT INTO public.users (first_name,last_name,email,"password",access_level,created_at,updated_at) VALUES
-	 ('Admin','Admin-lastname','admin@email.com','$2a$12$oBu9azGQOynN7Hwg9tqThetE7A4vY8X27x4V9OBu1jTH7prS8c70W',3,'2023-08-19 00:00:00.000','2023-08-19 00:00:00.000');
\ No newline at end of file
@@ -0,0 +1 @@
+-- The default admin account is no longer seeded; the owner account is created on the setup page.
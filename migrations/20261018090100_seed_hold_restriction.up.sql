@@ -0,0 +1,2 @@
+INSERT INTO public.restrictions (restriction_name,created_at,updated_at) VALUES
+	 ('Hold','2026-10-18 00:00:00.000','2026-10-18 00:00:00.000');
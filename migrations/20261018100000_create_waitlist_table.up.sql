@@ -0,0 +1,20 @@
+CREATE TABLE waitlist (
+    id SERIAL PRIMARY KEY,
+    first_name varchar(255) NOT NULL DEFAULT '',
+    email varchar(255) NOT NULL,
+    room_id integer,
+    start_date date NOT NULL,
+    end_date date NOT NULL,
+    token varchar(255),
+    token_expires_at timestamp,
+    notified_at timestamp,
+    created_at timestamp NOT NULL,
+    updated_at timestamp NOT NULL
+);
+
+ALTER TABLE waitlist ADD CONSTRAINT waitlist_rooms_id_fk FOREIGN KEY (room_id) REFERENCES rooms (id)
+    ON UPDATE CASCADE ON DELETE CASCADE;
+
+CREATE INDEX waitlist_start_date_end_date_idx ON waitlist (start_date, end_date);
+
+CREATE UNIQUE INDEX waitlist_token_idx ON waitlist (token);
@@ -0,0 +1,15 @@
+CREATE TABLE cancellations (
+    id SERIAL PRIMARY KEY,
+    reservation_id integer NOT NULL,
+    room_id integer NOT NULL,
+    start_date date NOT NULL,
+    end_date date NOT NULL,
+    booked_at timestamp NOT NULL,
+    created_at timestamp NOT NULL,
+    updated_at timestamp NOT NULL
+);
+
+ALTER TABLE cancellations ADD CONSTRAINT cancellations_rooms_id_fk FOREIGN KEY (room_id) REFERENCES rooms (id)
+    ON UPDATE CASCADE ON DELETE CASCADE;
+
+CREATE INDEX cancellations_created_at_idx ON cancellations (created_at);
@@ -0,0 +1,3 @@
+ALTER TABLE reservations DROP COLUMN note;
+
+ALTER TABLE reservations DROP COLUMN source;
@@ -0,0 +1,3 @@
+ALTER TABLE reservations ADD COLUMN source varchar(255) NOT NULL DEFAULT 'website';
+
+ALTER TABLE reservations ADD COLUMN note text NOT NULL DEFAULT '';
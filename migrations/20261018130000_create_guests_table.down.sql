@@ -0,0 +1,3 @@
+ALTER TABLE reservations DROP COLUMN guest_id;
+
+DROP TABLE guests;
@@ -0,0 +1,22 @@
+CREATE TABLE guests (
+    id SERIAL PRIMARY KEY,
+    first_name varchar(255) NOT NULL DEFAULT '',
+    last_name varchar(255) NOT NULL DEFAULT '',
+    email varchar(255) NOT NULL,
+    phone varchar(255) NOT NULL DEFAULT '',
+    notes text NOT NULL DEFAULT '',
+    tags varchar(255) NOT NULL DEFAULT '',
+    created_at timestamp NOT NULL,
+    updated_at timestamp NOT NULL
+);
+
+CREATE INDEX guests_email_idx ON guests (email);
+
+CREATE INDEX guests_last_name_first_name_idx ON guests (last_name, first_name);
+
+ALTER TABLE reservations ADD COLUMN guest_id integer;
+
+ALTER TABLE reservations ADD CONSTRAINT reservations_guests_id_fk FOREIGN KEY (guest_id) REFERENCES guests (id)
+    ON UPDATE CASCADE ON DELETE SET NULL;
+
+CREATE INDEX reservations_guest_id_idx ON reservations (guest_id);
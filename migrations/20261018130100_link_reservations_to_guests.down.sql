@@ -0,0 +1,2 @@
+UPDATE public.reservations SET guest_id = NULL;
+DELETE FROM public.guests;
@@ -0,0 +1,8 @@
+INSERT INTO public.guests (first_name,last_name,email,phone,created_at,updated_at)
+	SELECT DISTINCT ON (lower(email)) first_name, last_name, lower(email), phone, now(), now()
+	FROM public.reservations
+	ORDER BY lower(email), created_at DESC;
+
+UPDATE public.reservations r SET guest_id = g.id
+	FROM public.guests g
+	WHERE g.email = lower(r.email);
@@ -0,0 +1,3 @@
+ALTER TABLE reservations DROP COLUMN amount;
+
+ALTER TABLE rooms DROP COLUMN nightly_rate;
@@ -0,0 +1,3 @@
+ALTER TABLE rooms ADD COLUMN nightly_rate integer NOT NULL DEFAULT 0;
+
+ALTER TABLE reservations ADD COLUMN amount integer NOT NULL DEFAULT 0;
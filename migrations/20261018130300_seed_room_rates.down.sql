@@ -0,0 +1,2 @@
+UPDATE public.reservations SET amount = 0;
+UPDATE public.rooms SET nightly_rate = 0;
@@ -0,0 +1,6 @@
+UPDATE public.rooms SET nightly_rate = 8900 WHERE room_name = 'Generals Quarters';
+UPDATE public.rooms SET nightly_rate = 12900 WHERE room_name = 'Majors Suite';
+
+UPDATE public.reservations r SET amount = rm.nightly_rate * (r.end_date - r.start_date)
+	FROM public.rooms rm
+	WHERE rm.id = r.room_id;
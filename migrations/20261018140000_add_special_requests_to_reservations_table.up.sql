@@ -0,0 +1 @@
+ALTER TABLE reservations ADD COLUMN special_requests text NOT NULL DEFAULT '';
@@ -0,0 +1,21 @@
+CREATE TABLE reservation_notes (
+    id SERIAL PRIMARY KEY,
+    reservation_id integer NOT NULL,
+    parent_id integer,
+    user_id integer,
+    body text NOT NULL,
+    pinned boolean NOT NULL DEFAULT false,
+    created_at timestamp NOT NULL,
+    updated_at timestamp NOT NULL
+);
+
+ALTER TABLE reservation_notes ADD CONSTRAINT reservation_notes_reservations_id_fk FOREIGN KEY (reservation_id) REFERENCES reservations (id)
+    ON UPDATE CASCADE ON DELETE CASCADE;
+
+ALTER TABLE reservation_notes ADD CONSTRAINT reservation_notes_reservation_notes_id_fk FOREIGN KEY (parent_id) REFERENCES reservation_notes (id)
+    ON UPDATE CASCADE ON DELETE CASCADE;
+
+ALTER TABLE reservation_notes ADD CONSTRAINT reservation_notes_users_id_fk FOREIGN KEY (user_id) REFERENCES users (id)
+    ON UPDATE CASCADE ON DELETE SET NULL;
+
+CREATE INDEX reservation_notes_reservation_id_idx ON reservation_notes (reservation_id);
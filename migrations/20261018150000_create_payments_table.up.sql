@@ -0,0 +1,16 @@
+CREATE TABLE payments (
+    id SERIAL PRIMARY KEY,
+    reservation_id integer NOT NULL,
+    provider varchar(255) NOT NULL,
+    provider_ref varchar(255) NOT NULL,
+    kind varchar(255) NOT NULL,
+    amount integer NOT NULL,
+    currency varchar(3) NOT NULL,
+    status varchar(255) NOT NULL,
+    created_at timestamp NOT NULL,
+    updated_at timestamp NOT NULL
+);
+
+CREATE INDEX payments_reservation_id_idx ON payments (reservation_id);
+
+CREATE INDEX payments_provider_ref_idx ON payments (provider_ref);
@@ -0,0 +1,17 @@
+ALTER TABLE cancellations DROP COLUMN cancelled_by;
+
+ALTER TABLE cancellations DROP COLUMN fee;
+
+ALTER TABLE cancellations DROP COLUMN refund;
+
+ALTER TABLE cancellations DROP COLUMN paid;
+
+ALTER TABLE cancellations DROP COLUMN refund_percent;
+
+ALTER TABLE cancellations DROP COLUMN days_before;
+
+ALTER TABLE cancellations DROP COLUMN policy;
+
+ALTER TABLE reservations DROP COLUMN cancellation_policy;
+
+ALTER TABLE rooms DROP COLUMN cancellation_policy;
@@ -0,0 +1,17 @@
+ALTER TABLE rooms ADD COLUMN cancellation_policy varchar(255) NOT NULL DEFAULT 'flexible:1=100';
+
+ALTER TABLE reservations ADD COLUMN cancellation_policy varchar(255) NOT NULL DEFAULT 'flexible:1=100';
+
+ALTER TABLE cancellations ADD COLUMN policy varchar(255) NOT NULL DEFAULT '';
+
+ALTER TABLE cancellations ADD COLUMN days_before integer NOT NULL DEFAULT 0;
+
+ALTER TABLE cancellations ADD COLUMN refund_percent integer NOT NULL DEFAULT 0;
+
+ALTER TABLE cancellations ADD COLUMN paid integer NOT NULL DEFAULT 0;
+
+ALTER TABLE cancellations ADD COLUMN refund integer NOT NULL DEFAULT 0;
+
+ALTER TABLE cancellations ADD COLUMN fee integer NOT NULL DEFAULT 0;
+
+ALTER TABLE cancellations ADD COLUMN cancelled_by varchar(255) NOT NULL DEFAULT 'staff';
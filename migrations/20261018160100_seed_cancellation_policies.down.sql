@@ -0,0 +1,2 @@
+UPDATE public.reservations SET cancellation_policy = 'flexible:1=100';
+UPDATE public.rooms SET cancellation_policy = 'flexible:1=100';
@@ -0,0 +1,5 @@
+UPDATE public.rooms SET cancellation_policy = 'moderate:5=100,1=50' WHERE room_name = 'Majors Suite';
+
+UPDATE public.reservations r SET cancellation_policy = rm.cancellation_policy
+	FROM public.rooms rm
+	WHERE rm.id = r.room_id;
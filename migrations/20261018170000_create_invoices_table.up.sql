@@ -0,0 +1,11 @@
+CREATE TABLE invoices (
+    id SERIAL PRIMARY KEY,
+    number integer NOT NULL,
+    reservation_id integer NOT NULL,
+    created_at timestamp NOT NULL,
+    updated_at timestamp NOT NULL
+);
+
+CREATE UNIQUE INDEX invoices_number_idx ON invoices (number);
+
+CREATE UNIQUE INDEX invoices_reservation_id_idx ON invoices (reservation_id);
@@ -0,0 +1,13 @@
+CREATE TABLE tax_rules (
+    id SERIAL PRIMARY KEY,
+    name varchar(255) NOT NULL,
+    kind varchar(255) NOT NULL,
+    method varchar(255) NOT NULL,
+    basis varchar(255) NOT NULL,
+    amount integer NOT NULL,
+    currency varchar(3) NOT NULL DEFAULT '',
+    valid_from date,
+    valid_until date,
+    created_at timestamp NOT NULL,
+    updated_at timestamp NOT NULL
+);
@@ -0,0 +1,3 @@
+ALTER TABLE reservations DROP COLUMN currency;
+
+ALTER TABLE reservations DROP COLUMN guests;
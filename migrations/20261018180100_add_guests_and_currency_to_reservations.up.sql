@@ -0,0 +1,3 @@
+ALTER TABLE reservations ADD COLUMN guests integer NOT NULL DEFAULT 1;
+
+ALTER TABLE reservations ADD COLUMN currency varchar(3) NOT NULL DEFAULT 'usd';
@@ -0,0 +1,21 @@
+CREATE TABLE reservation_charges (
+    id SERIAL PRIMARY KEY,
+    reservation_id integer NOT NULL,
+    tax_rule_id integer,
+    kind varchar(255) NOT NULL,
+    description varchar(255) NOT NULL,
+    quantity integer NOT NULL,
+    unit_amount integer NOT NULL,
+    amount integer NOT NULL,
+    currency varchar(3) NOT NULL,
+    created_at timestamp NOT NULL,
+    updated_at timestamp NOT NULL
+);
+
+ALTER TABLE reservation_charges ADD CONSTRAINT reservation_charges_reservations_id_fk FOREIGN KEY (reservation_id) REFERENCES reservations (id)
+    ON UPDATE CASCADE ON DELETE CASCADE;
+
+ALTER TABLE reservation_charges ADD CONSTRAINT reservation_charges_tax_rules_id_fk FOREIGN KEY (tax_rule_id) REFERENCES tax_rules (id)
+    ON UPDATE CASCADE ON DELETE SET NULL;
+
+CREATE INDEX reservation_charges_reservation_id_idx ON reservation_charges (reservation_id);
@@ -0,0 +1,17 @@
+CREATE TABLE promotions (
+    id SERIAL PRIMARY KEY,
+    code varchar(255) NOT NULL,
+    description varchar(255) NOT NULL DEFAULT '',
+    method varchar(255) NOT NULL,
+    amount integer NOT NULL,
+    currency varchar(3) NOT NULL DEFAULT '',
+    valid_from date,
+    valid_until date,
+    min_nights integer NOT NULL DEFAULT 0,
+    max_uses integer NOT NULL DEFAULT 0,
+    max_uses_per_guest integer NOT NULL DEFAULT 0,
+    created_at timestamp NOT NULL,
+    updated_at timestamp NOT NULL
+);
+
+CREATE UNIQUE INDEX promotions_code_idx ON promotions (code);
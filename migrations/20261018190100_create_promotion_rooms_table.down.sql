@@ -0,0 +1 @@
+DROP TABLE promotion_rooms;
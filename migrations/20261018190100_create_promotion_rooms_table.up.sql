@@ -0,0 +1,15 @@
+CREATE TABLE promotion_rooms (
+    id SERIAL PRIMARY KEY,
+    promotion_id integer NOT NULL,
+    room_id integer NOT NULL,
+    created_at timestamp NOT NULL,
+    updated_at timestamp NOT NULL
+);
+
+ALTER TABLE promotion_rooms ADD CONSTRAINT promotion_rooms_promotions_id_fk FOREIGN KEY (promotion_id) REFERENCES promotions (id)
+    ON UPDATE CASCADE ON DELETE CASCADE;
+
+ALTER TABLE promotion_rooms ADD CONSTRAINT promotion_rooms_rooms_id_fk FOREIGN KEY (room_id) REFERENCES rooms (id)
+    ON UPDATE CASCADE ON DELETE CASCADE;
+
+CREATE UNIQUE INDEX promotion_rooms_promotion_id_room_id_idx ON promotion_rooms (promotion_id, room_id);
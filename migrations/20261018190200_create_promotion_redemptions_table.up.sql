@@ -0,0 +1,27 @@
+CREATE TABLE promotion_redemptions (
+    id SERIAL PRIMARY KEY,
+    promotion_id integer,
+    code varchar(255) NOT NULL,
+    reservation_id integer,
+    guest_id integer,
+    first_name varchar(255) NOT NULL,
+    last_name varchar(255) NOT NULL,
+    email varchar(255) NOT NULL,
+    discount integer NOT NULL,
+    currency varchar(3) NOT NULL,
+    created_at timestamp NOT NULL,
+    updated_at timestamp NOT NULL
+);
+
+ALTER TABLE promotion_redemptions ADD CONSTRAINT promotion_redemptions_promotions_id_fk FOREIGN KEY (promotion_id) REFERENCES promotions (id)
+    ON UPDATE CASCADE ON DELETE SET NULL;
+
+ALTER TABLE promotion_redemptions ADD CONSTRAINT promotion_redemptions_reservations_id_fk FOREIGN KEY (reservation_id) REFERENCES reservations (id)
+    ON UPDATE CASCADE ON DELETE SET NULL;
+
+ALTER TABLE promotion_redemptions ADD CONSTRAINT promotion_redemptions_guests_id_fk FOREIGN KEY (guest_id) REFERENCES guests (id)
+    ON UPDATE CASCADE ON DELETE SET NULL;
+
+CREATE INDEX promotion_redemptions_promotion_id_idx ON promotion_redemptions (promotion_id);
+
+CREATE INDEX promotion_redemptions_guest_id_idx ON promotion_redemptions (guest_id);
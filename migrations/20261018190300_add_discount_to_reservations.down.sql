@@ -0,0 +1,3 @@
+ALTER TABLE reservations DROP COLUMN discount;
+
+ALTER TABLE reservations DROP COLUMN promotion_code;
@@ -0,0 +1,3 @@
+ALTER TABLE reservations ADD COLUMN promotion_code varchar(255) NOT NULL DEFAULT '';
+
+ALTER TABLE reservations ADD COLUMN discount integer NOT NULL DEFAULT 0;
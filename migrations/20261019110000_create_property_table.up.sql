@@ -0,0 +1,8 @@
+CREATE TABLE property (
+    id integer PRIMARY KEY DEFAULT 1 CHECK (id = 1),
+    name varchar(255) NOT NULL,
+    timezone varchar(255) NOT NULL,
+    contact_email varchar(255) NOT NULL,
+    created_at timestamp NOT NULL,
+    updated_at timestamp NOT NULL
+);
@@ -0,0 +1 @@
+-- The default admin account is not restored.
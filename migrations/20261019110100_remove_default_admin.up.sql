@@ -0,0 +1,4 @@
+-- The default admin account seeded by earlier versions signs in with a published password. It is removed while
+-- that password is unchanged; with no users left the setup page creates the owner account.
+DELETE FROM users WHERE email = 'admin@email.com'
+    AND password = '$2a$12$oBu9azGQOynN7Hwg9tqThetE7A4vY8X27x4V9OBu1jTH7prS8c70W';
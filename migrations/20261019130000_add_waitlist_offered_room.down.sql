@@ -0,0 +1 @@
+ALTER TABLE waitlist DROP COLUMN offered_room_id;
@@ -0,0 +1,4 @@
+ALTER TABLE waitlist ADD COLUMN offered_room_id integer;
+
+ALTER TABLE waitlist ADD CONSTRAINT waitlist_offered_room_id_fk FOREIGN KEY (offered_room_id) REFERENCES rooms (id)
+    ON UPDATE CASCADE ON DELETE SET NULL;
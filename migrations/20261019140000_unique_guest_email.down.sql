@@ -0,0 +1,3 @@
+DROP INDEX guests_lower_email_idx;
+
+CREATE INDEX guests_email_idx ON guests (email);
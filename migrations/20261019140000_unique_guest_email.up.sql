@@ -0,0 +1,18 @@
+-- fold guests created twice for the same email address into the oldest one
+UPDATE reservations r SET guest_id = k.keep_id
+	FROM (SELECT id, min(id) OVER (PARTITION BY lower(email)) AS keep_id FROM guests) k
+	WHERE r.guest_id = k.id AND k.id <> k.keep_id;
+
+UPDATE promotion_redemptions p SET guest_id = k.keep_id
+	FROM (SELECT id, min(id) OVER (PARTITION BY lower(email)) AS keep_id FROM guests) k
+	WHERE p.guest_id = k.id AND k.id <> k.keep_id;
+
+DELETE FROM guests g
+	USING guests k
+	WHERE lower(k.email) = lower(g.email) AND k.id < g.id;
+
+UPDATE guests SET email = lower(email) WHERE email <> lower(email);
+
+DROP INDEX guests_email_idx;
+
+CREATE UNIQUE INDEX guests_lower_email_idx ON guests (lower(email));
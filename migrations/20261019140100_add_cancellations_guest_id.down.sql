@@ -0,0 +1 @@
+ALTER TABLE cancellations DROP COLUMN guest_id;
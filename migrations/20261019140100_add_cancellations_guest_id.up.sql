@@ -0,0 +1,6 @@
+ALTER TABLE cancellations ADD COLUMN guest_id integer;
+
+ALTER TABLE cancellations ADD CONSTRAINT cancellations_guests_id_fk FOREIGN KEY (guest_id) REFERENCES guests (id)
+    ON UPDATE CASCADE ON DELETE SET NULL;
+
+CREATE INDEX cancellations_guest_id_idx ON cancellations (guest_id);
@@ -0,0 +1,10 @@
+// Package migrations holds the SQL migrations of the database, built into the binary and applied with
+// ./bookings migrate up or the -migrate flag.
+package migrations
+
+import "embed"
+
+// FS holds the migration files, named <version>_<name>.up.sql and <version>_<name>.down.sql.
+//
+//go:embed *.up.sql *.down.sql
+var FS embed.FS
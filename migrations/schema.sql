@@ -21,31 +21,37 @@ SET default_tablespace = '';
 SET default_table_access_method = heap;
 
 --
--- Name: reservations; Type: TABLE; Schema: public; Owner: postgres
+-- Name: cancellations; Type: TABLE; Schema: public; Owner: postgres
 --
 
-CREATE TABLE public.reservations (
+CREATE TABLE public.cancellations (
     id integer NOT NULL,
-    first_name character varying(255) DEFAULT ''::character varying NOT NULL,
-    last_name character varying(255) DEFAULT ''::character varying NOT NULL,
-    email character varying(255) NOT NULL,
-    phone character varying(255) DEFAULT ''::character varying NOT NULL,
+    reservation_id integer NOT NULL,
+    room_id integer NOT NULL,
     start_date date NOT NULL,
     end_date date NOT NULL,
-    room_id integer NOT NULL,
+    booked_at timestamp without time zone NOT NULL,
     created_at timestamp without time zone NOT NULL,
     updated_at timestamp without time zone NOT NULL,
-    processed integer DEFAULT 0 NOT NULL
+    policy character varying(255) DEFAULT ''::character varying NOT NULL,
+    days_before integer DEFAULT 0 NOT NULL,
+    refund_percent integer DEFAULT 0 NOT NULL,
+    paid integer DEFAULT 0 NOT NULL,
+    refund integer DEFAULT 0 NOT NULL,
+    fee integer DEFAULT 0 NOT NULL,
+    cancelled_by character varying(255) DEFAULT 'staff'::character varying NOT NULL,
+    guest_id integer
 );
 
 
-ALTER TABLE public.reservations OWNER TO postgres;
+ALTER TABLE public.cancellations OWNER TO postgres;
+
 
 --
--- Name: reservations_id_seq; Type: SEQUENCE; Schema: public; Owner: postgres
+-- Name: cancellations_id_seq; Type: SEQUENCE; Schema: public; Owner: postgres
 --
 
-CREATE SEQUENCE public.reservations_id_seq
+CREATE SEQUENCE public.cancellations_id_seq
     AS integer
     START WITH 1
     INCREMENT BY 1
@@ -54,34 +60,41 @@ CREATE SEQUENCE public.reservations_id_seq
     CACHE 1;
 
 
-ALTER TABLE public.reservations_id_seq OWNER TO postgres;
+ALTER TABLE public.cancellations_id_seq OWNER TO postgres;
+
 
 --
--- Name: reservations_id_seq; Type: SEQUENCE OWNED BY; Schema: public; Owner: postgres
+-- Name: cancellations_id_seq; Type: SEQUENCE OWNED BY; Schema: public; Owner: postgres
 --
 
-ALTER SEQUENCE public.reservations_id_seq OWNED BY public.reservations.id;
+ALTER SEQUENCE public.cancellations_id_seq OWNED BY public.cancellations.id;
 
 
 --
--- Name: restrictions; Type: TABLE; Schema: public; Owner: postgres
+-- Name: guests; Type: TABLE; Schema: public; Owner: postgres
 --
 
-CREATE TABLE public.restrictions (
+CREATE TABLE public.guests (
     id integer NOT NULL,
-    restriction_name character varying(255) DEFAULT ''::character varying NOT NULL,
+    first_name character varying(255) DEFAULT ''::character varying NOT NULL,
+    last_name character varying(255) DEFAULT ''::character varying NOT NULL,
+    email character varying(255) NOT NULL,
+    phone character varying(255) DEFAULT ''::character varying NOT NULL,
+    notes text DEFAULT ''::text NOT NULL,
+    tags character varying(255) DEFAULT ''::character varying NOT NULL,
     created_at timestamp without time zone NOT NULL,
     updated_at timestamp without time zone NOT NULL
 );
 
 
-ALTER TABLE public.restrictions OWNER TO postgres;
+ALTER TABLE public.guests OWNER TO postgres;
+
 
 --
--- Name: restrictions_id_seq; Type: SEQUENCE; Schema: public; Owner: postgres
+-- Name: guests_id_seq; Type: SEQUENCE; Schema: public; Owner: postgres
 --
 
-CREATE SEQUENCE public.restrictions_id_seq
+CREATE SEQUENCE public.guests_id_seq
     AS integer
     START WITH 1
     INCREMENT BY 1
@@ -90,38 +103,37 @@ CREATE SEQUENCE public.restrictions_id_seq
     CACHE 1;
 
 
-ALTER TABLE public.restrictions_id_seq OWNER TO postgres;
+ALTER TABLE public.guests_id_seq OWNER TO postgres;
+
 
 --
--- Name: restrictions_id_seq; Type: SEQUENCE OWNED BY; Schema: public; Owner: postgres
+-- Name: guests_id_seq; Type: SEQUENCE OWNED BY; Schema: public; Owner: postgres
 --
 
-ALTER SEQUENCE public.restrictions_id_seq OWNED BY public.restrictions.id;
+ALTER SEQUENCE public.guests_id_seq OWNED BY public.guests.id;
 
 
 --
--- Name: room_restrictions; Type: TABLE; Schema: public; Owner: postgres
+-- Name: invoices; Type: TABLE; Schema: public; Owner: postgres
 --
 
-CREATE TABLE public.room_restrictions (
+CREATE TABLE public.invoices (
     id integer NOT NULL,
-    start_date date NOT NULL,
-    end_date date NOT NULL,
-    room_id integer NOT NULL,
-    reservation_id integer,
-    restriction_id integer NOT NULL,
+    number integer NOT NULL,
+    reservation_id integer NOT NULL,
     created_at timestamp without time zone NOT NULL,
     updated_at timestamp without time zone NOT NULL
 );
 
 
-ALTER TABLE public.room_restrictions OWNER TO postgres;
+ALTER TABLE public.invoices OWNER TO postgres;
+
 
 --
--- Name: room_restrictions_id_seq; Type: SEQUENCE; Schema: public; Owner: postgres
+-- Name: invoices_id_seq; Type: SEQUENCE; Schema: public; Owner: postgres
 --
 
-CREATE SEQUENCE public.room_restrictions_id_seq
+CREATE SEQUENCE public.invoices_id_seq
     AS integer
     START WITH 1
     INCREMENT BY 1
@@ -130,34 +142,42 @@ CREATE SEQUENCE public.room_restrictions_id_seq
     CACHE 1;
 
 
-ALTER TABLE public.room_restrictions_id_seq OWNER TO postgres;
+ALTER TABLE public.invoices_id_seq OWNER TO postgres;
+
 
 --
--- Name: room_restrictions_id_seq; Type: SEQUENCE OWNED BY; Schema: public; Owner: postgres
+-- Name: invoices_id_seq; Type: SEQUENCE OWNED BY; Schema: public; Owner: postgres
 --
 
-ALTER SEQUENCE public.room_restrictions_id_seq OWNED BY public.room_restrictions.id;
+ALTER SEQUENCE public.invoices_id_seq OWNED BY public.invoices.id;
 
 
 --
--- Name: rooms; Type: TABLE; Schema: public; Owner: postgres
+-- Name: payments; Type: TABLE; Schema: public; Owner: postgres
 --
 
-CREATE TABLE public.rooms (
+CREATE TABLE public.payments (
     id integer NOT NULL,
-    room_name character varying(255) DEFAULT ''::character varying NOT NULL,
+    reservation_id integer NOT NULL,
+    provider character varying(255) NOT NULL,
+    provider_ref character varying(255) NOT NULL,
+    kind character varying(255) NOT NULL,
+    amount integer NOT NULL,
+    currency character varying(3) NOT NULL,
+    status character varying(255) NOT NULL,
     created_at timestamp without time zone NOT NULL,
     updated_at timestamp without time zone NOT NULL
 );
 
 
-ALTER TABLE public.rooms OWNER TO postgres;
+ALTER TABLE public.payments OWNER TO postgres;
+
 
 --
--- Name: rooms_id_seq; Type: SEQUENCE; Schema: public; Owner: postgres
+-- Name: payments_id_seq; Type: SEQUENCE; Schema: public; Owner: postgres
 --
 
-CREATE SEQUENCE public.rooms_id_seq
+CREATE SEQUENCE public.payments_id_seq
     AS integer
     START WITH 1
     INCREMENT BY 1
@@ -166,49 +186,44 @@ CREATE SEQUENCE public.rooms_id_seq
     CACHE 1;
 
 
-ALTER TABLE public.rooms_id_seq OWNER TO postgres;
-
---
--- Name: rooms_id_seq; Type: SEQUENCE OWNED BY; Schema: public; Owner: postgres
---
-
-ALTER SEQUENCE public.rooms_id_seq OWNED BY public.rooms.id;
+ALTER TABLE public.payments_id_seq OWNER TO postgres;
 
 
 --
--- Name: schema_migration; Type: TABLE; Schema: public; Owner: postgres
+-- Name: payments_id_seq; Type: SEQUENCE OWNED BY; Schema: public; Owner: postgres
 --
 
-CREATE TABLE public.schema_migration (
-    version character varying(14) NOT NULL
-);
-
+ALTER SEQUENCE public.payments_id_seq OWNED BY public.payments.id;
 
-ALTER TABLE public.schema_migration OWNER TO postgres;
 
 --
--- Name: users; Type: TABLE; Schema: public; Owner: postgres
+-- Name: promotion_redemptions; Type: TABLE; Schema: public; Owner: postgres
 --
 
-CREATE TABLE public.users (
+CREATE TABLE public.promotion_redemptions (
     id integer NOT NULL,
-    first_name character varying(255) DEFAULT ''::character varying NOT NULL,
-    last_name character varying(255) DEFAULT ''::character varying NOT NULL,
+    promotion_id integer,
+    code character varying(255) NOT NULL,
+    reservation_id integer,
+    guest_id integer,
+    first_name character varying(255) NOT NULL,
+    last_name character varying(255) NOT NULL,
     email character varying(255) NOT NULL,
-    password character varying(60) NOT NULL,
-    access_level integer DEFAULT 1 NOT NULL,
+    discount integer NOT NULL,
+    currency character varying(3) NOT NULL,
     created_at timestamp without time zone NOT NULL,
     updated_at timestamp without time zone NOT NULL
 );
 
 
-ALTER TABLE public.users OWNER TO postgres;
+ALTER TABLE public.promotion_redemptions OWNER TO postgres;
+
 
 --
--- Name: users_id_seq; Type: SEQUENCE; Schema: public; Owner: postgres
+-- Name: promotion_redemptions_id_seq; Type: SEQUENCE; Schema: public; Owner: postgres
 --
 
-CREATE SEQUENCE public.users_id_seq
+CREATE SEQUENCE public.promotion_redemptions_id_seq
     AS integer
     START WITH 1
     INCREMENT BY 1
@@ -217,169 +232,1091 @@ CREATE SEQUENCE public.users_id_seq
     CACHE 1;
 
 
-ALTER TABLE public.users_id_seq OWNER TO postgres;
+ALTER TABLE public.promotion_redemptions_id_seq OWNER TO postgres;
+
 
 --
--- Name: users_id_seq; Type: SEQUENCE OWNED BY; Schema: public; Owner: postgres
+-- Name: promotion_redemptions_id_seq; Type: SEQUENCE OWNED BY; Schema: public; Owner: postgres
 --
 
-ALTER SEQUENCE public.users_id_seq OWNED BY public.users.id;
+ALTER SEQUENCE public.promotion_redemptions_id_seq OWNED BY public.promotion_redemptions.id;
 
 
 --
--- Name: reservations id; Type: DEFAULT; Schema: public; Owner: postgres
+-- Name: promotion_rooms; Type: TABLE; Schema: public; Owner: postgres
 --
 
-ALTER TABLE ONLY public.reservations ALTER COLUMN id SET DEFAULT nextval('public.reservations_id_seq'::regclass);
+CREATE TABLE public.promotion_rooms (
+    id integer NOT NULL,
+    promotion_id integer NOT NULL,
+    room_id integer NOT NULL,
+    created_at timestamp without time zone NOT NULL,
+    updated_at timestamp without time zone NOT NULL
+);
+
+
+ALTER TABLE public.promotion_rooms OWNER TO postgres;
 
 
 --
--- Name: restrictions id; Type: DEFAULT; Schema: public; Owner: postgres
+-- Name: promotion_rooms_id_seq; Type: SEQUENCE; Schema: public; Owner: postgres
 --
 
-ALTER TABLE ONLY public.restrictions ALTER COLUMN id SET DEFAULT nextval('public.restrictions_id_seq'::regclass);
+CREATE SEQUENCE public.promotion_rooms_id_seq
+    AS integer
+    START WITH 1
+    INCREMENT BY 1
+    NO MINVALUE
+    NO MAXVALUE
+    CACHE 1;
+
+
+ALTER TABLE public.promotion_rooms_id_seq OWNER TO postgres;
 
 
 --
--- Name: room_restrictions id; Type: DEFAULT; Schema: public; Owner: postgres
+-- Name: promotion_rooms_id_seq; Type: SEQUENCE OWNED BY; Schema: public; Owner: postgres
 --
 
-ALTER TABLE ONLY public.room_restrictions ALTER COLUMN id SET DEFAULT nextval('public.room_restrictions_id_seq'::regclass);
+ALTER SEQUENCE public.promotion_rooms_id_seq OWNED BY public.promotion_rooms.id;
 
 
 --
--- Name: rooms id; Type: DEFAULT; Schema: public; Owner: postgres
+-- Name: promotions; Type: TABLE; Schema: public; Owner: postgres
 --
 
-ALTER TABLE ONLY public.rooms ALTER COLUMN id SET DEFAULT nextval('public.rooms_id_seq'::regclass);
+CREATE TABLE public.promotions (
+    id integer NOT NULL,
+    code character varying(255) NOT NULL,
+    description character varying(255) DEFAULT ''::character varying NOT NULL,
+    method character varying(255) NOT NULL,
+    amount integer NOT NULL,
+    currency character varying(3) DEFAULT ''::character varying NOT NULL,
+    valid_from date,
+    valid_until date,
+    min_nights integer DEFAULT 0 NOT NULL,
+    max_uses integer DEFAULT 0 NOT NULL,
+    max_uses_per_guest integer DEFAULT 0 NOT NULL,
+    created_at timestamp without time zone NOT NULL,
+    updated_at timestamp without time zone NOT NULL
+);
+
+
+ALTER TABLE public.promotions OWNER TO postgres;
 
 
 --
--- Name: users id; Type: DEFAULT; Schema: public; Owner: postgres
+-- Name: promotions_id_seq; Type: SEQUENCE; Schema: public; Owner: postgres
 --
 
-ALTER TABLE ONLY public.users ALTER COLUMN id SET DEFAULT nextval('public.users_id_seq'::regclass);
+CREATE SEQUENCE public.promotions_id_seq
+    AS integer
+    START WITH 1
+    INCREMENT BY 1
+    NO MINVALUE
+    NO MAXVALUE
+    CACHE 1;
+
+
+ALTER TABLE public.promotions_id_seq OWNER TO postgres;
 
 
 --
--- Name: reservations reservations_pkey; Type: CONSTRAINT; Schema: public; Owner: postgres
+-- Name: promotions_id_seq; Type: SEQUENCE OWNED BY; Schema: public; Owner: postgres
 --
 
-ALTER TABLE ONLY public.reservations
-    ADD CONSTRAINT reservations_pkey PRIMARY KEY (id);
+ALTER SEQUENCE public.promotions_id_seq OWNED BY public.promotions.id;
 
 
 --
--- Name: restrictions restrictions_pkey; Type: CONSTRAINT; Schema: public; Owner: postgres
+-- Name: property; Type: TABLE; Schema: public; Owner: postgres
 --
 
-ALTER TABLE ONLY public.restrictions
-    ADD CONSTRAINT restrictions_pkey PRIMARY KEY (id);
+CREATE TABLE public.property (
+    id integer DEFAULT 1 NOT NULL,
+    name character varying(255) NOT NULL,
+    timezone character varying(255) NOT NULL,
+    contact_email character varying(255) NOT NULL,
+    created_at timestamp without time zone NOT NULL,
+    updated_at timestamp without time zone NOT NULL,
+    CONSTRAINT property_id_check CHECK ((id = 1))
+);
+
+
+ALTER TABLE public.property OWNER TO postgres;
 
 
 --
--- Name: room_restrictions room_restrictions_pkey; Type: CONSTRAINT; Schema: public; Owner: postgres
+-- Name: reservation_charges; Type: TABLE; Schema: public; Owner: postgres
 --
 
-ALTER TABLE ONLY public.room_restrictions
-    ADD CONSTRAINT room_restrictions_pkey PRIMARY KEY (id);
+CREATE TABLE public.reservation_charges (
+    id integer NOT NULL,
+    reservation_id integer NOT NULL,
+    tax_rule_id integer,
+    kind character varying(255) NOT NULL,
+    description character varying(255) NOT NULL,
+    quantity integer NOT NULL,
+    unit_amount integer NOT NULL,
+    amount integer NOT NULL,
+    currency character varying(3) NOT NULL,
+    created_at timestamp without time zone NOT NULL,
+    updated_at timestamp without time zone NOT NULL
+);
+
+
+ALTER TABLE public.reservation_charges OWNER TO postgres;
 
 
 --
--- Name: rooms rooms_pkey; Type: CONSTRAINT; Schema: public; Owner: postgres
+-- Name: reservation_charges_id_seq; Type: SEQUENCE; Schema: public; Owner: postgres
 --
 
-ALTER TABLE ONLY public.rooms
-    ADD CONSTRAINT rooms_pkey PRIMARY KEY (id);
+CREATE SEQUENCE public.reservation_charges_id_seq
+    AS integer
+    START WITH 1
+    INCREMENT BY 1
+    NO MINVALUE
+    NO MAXVALUE
+    CACHE 1;
+
+
+ALTER TABLE public.reservation_charges_id_seq OWNER TO postgres;
 
 
 --
--- Name: schema_migration schema_migration_pkey; Type: CONSTRAINT; Schema: public; Owner: postgres
+-- Name: reservation_charges_id_seq; Type: SEQUENCE OWNED BY; Schema: public; Owner: postgres
 --
 
-ALTER TABLE ONLY public.schema_migration
-    ADD CONSTRAINT schema_migration_pkey PRIMARY KEY (version);
+ALTER SEQUENCE public.reservation_charges_id_seq OWNED BY public.reservation_charges.id;
 
 
 --
--- Name: users users_pkey; Type: CONSTRAINT; Schema: public; Owner: postgres
+-- Name: reservation_notes; Type: TABLE; Schema: public; Owner: postgres
 --
 
-ALTER TABLE ONLY public.users
-    ADD CONSTRAINT users_pkey PRIMARY KEY (id);
+CREATE TABLE public.reservation_notes (
+    id integer NOT NULL,
+    reservation_id integer NOT NULL,
+    parent_id integer,
+    user_id integer,
+    body text NOT NULL,
+    pinned boolean DEFAULT false NOT NULL,
+    created_at timestamp without time zone NOT NULL,
+    updated_at timestamp without time zone NOT NULL
+);
+
+
+ALTER TABLE public.reservation_notes OWNER TO postgres;
 
 
 --
--- Name: reservations_email_idx; Type: INDEX; Schema: public; Owner: postgres
+-- Name: reservation_notes_id_seq; Type: SEQUENCE; Schema: public; Owner: postgres
 --
 
-CREATE INDEX reservations_email_idx ON public.reservations USING btree (email);
+CREATE SEQUENCE public.reservation_notes_id_seq
+    AS integer
+    START WITH 1
+    INCREMENT BY 1
+    NO MINVALUE
+    NO MAXVALUE
+    CACHE 1;
+
+
+ALTER TABLE public.reservation_notes_id_seq OWNER TO postgres;
 
 
 --
--- Name: reservations_last_name_idx; Type: INDEX; Schema: public; Owner: postgres
+-- Name: reservation_notes_id_seq; Type: SEQUENCE OWNED BY; Schema: public; Owner: postgres
 --
 
-CREATE INDEX reservations_last_name_idx ON public.reservations USING btree (last_name);
+ALTER SEQUENCE public.reservation_notes_id_seq OWNED BY public.reservation_notes.id;
 
 
 --
--- Name: room_restrictions_reservation_id_idx; Type: INDEX; Schema: public; Owner: postgres
+-- Name: reservations; Type: TABLE; Schema: public; Owner: postgres
 --
 
-CREATE INDEX room_restrictions_reservation_id_idx ON public.room_restrictions USING btree (reservation_id);
+CREATE TABLE public.reservations (
+    id integer NOT NULL,
+    first_name character varying(255) DEFAULT ''::character varying NOT NULL,
+    last_name character varying(255) DEFAULT ''::character varying NOT NULL,
+    email character varying(255) NOT NULL,
+    phone character varying(255) DEFAULT ''::character varying NOT NULL,
+    start_date date NOT NULL,
+    end_date date NOT NULL,
+    room_id integer NOT NULL,
+    created_at timestamp without time zone NOT NULL,
+    updated_at timestamp without time zone NOT NULL,
+    processed integer DEFAULT 0 NOT NULL,
+    source character varying(255) DEFAULT 'website'::character varying NOT NULL,
+    note text DEFAULT ''::text NOT NULL,
+    guest_id integer,
+    amount integer DEFAULT 0 NOT NULL,
+    special_requests text DEFAULT ''::text NOT NULL,
+    cancellation_policy character varying(255) DEFAULT 'flexible:1=100'::character varying NOT NULL,
+    guests integer DEFAULT 1 NOT NULL,
+    currency character varying(3) DEFAULT 'usd'::character varying NOT NULL,
+    promotion_code character varying(255) DEFAULT ''::character varying NOT NULL,
+    discount integer DEFAULT 0 NOT NULL
+);
+
 
+ALTER TABLE public.reservations OWNER TO postgres;
 
 --
--- Name: room_restrictions_room_id_idx; Type: INDEX; Schema: public; Owner: postgres
+-- Name: reservations_id_seq; Type: SEQUENCE; Schema: public; Owner: postgres
 --
 
-CREATE INDEX room_restrictions_room_id_idx ON public.room_restrictions USING btree (room_id);
+CREATE SEQUENCE public.reservations_id_seq
+    AS integer
+    START WITH 1
+    INCREMENT BY 1
+    NO MINVALUE
+    NO MAXVALUE
+    CACHE 1;
+
 
+ALTER TABLE public.reservations_id_seq OWNER TO postgres;
 
 --
--- Name: room_restrictions_start_date_end_date_idx; Type: INDEX; Schema: public; Owner: postgres
+-- Name: reservations_id_seq; Type: SEQUENCE OWNED BY; Schema: public; Owner: postgres
 --
 
-CREATE INDEX room_restrictions_start_date_end_date_idx ON public.room_restrictions USING btree (start_date, end_date);
+ALTER SEQUENCE public.reservations_id_seq OWNED BY public.reservations.id;
 
 
 --
--- Name: schema_migration_version_idx; Type: INDEX; Schema: public; Owner: postgres
+-- Name: restrictions; Type: TABLE; Schema: public; Owner: postgres
 --
 
-CREATE UNIQUE INDEX schema_migration_version_idx ON public.schema_migration USING btree (version);
+CREATE TABLE public.restrictions (
+    id integer NOT NULL,
+    restriction_name character varying(255) DEFAULT ''::character varying NOT NULL,
+    created_at timestamp without time zone NOT NULL,
+    updated_at timestamp without time zone NOT NULL
+);
+
 
+ALTER TABLE public.restrictions OWNER TO postgres;
 
 --
--- Name: users_email_idx; Type: INDEX; Schema: public; Owner: postgres
+-- Name: restrictions_id_seq; Type: SEQUENCE; Schema: public; Owner: postgres
 --
 
-CREATE UNIQUE INDEX users_email_idx ON public.users USING btree (email);
+CREATE SEQUENCE public.restrictions_id_seq
+    AS integer
+    START WITH 1
+    INCREMENT BY 1
+    NO MINVALUE
+    NO MAXVALUE
+    CACHE 1;
 
 
+ALTER TABLE public.restrictions_id_seq OWNER TO postgres;
+
 --
--- Name: reservations reservations_rooms_id_fk; Type: FK CONSTRAINT; Schema: public; Owner: postgres
+-- Name: restrictions_id_seq; Type: SEQUENCE OWNED BY; Schema: public; Owner: postgres
 --
 
-ALTER TABLE ONLY public.reservations
-    ADD CONSTRAINT reservations_rooms_id_fk FOREIGN KEY (room_id) REFERENCES public.rooms(id) ON UPDATE CASCADE ON DELETE CASCADE;
+ALTER SEQUENCE public.restrictions_id_seq OWNED BY public.restrictions.id;
 
 
 --
--- Name: room_restrictions room_restrictions_reservations_id_fk; Type: FK CONSTRAINT; Schema: public; Owner: postgres
+-- Name: room_restrictions; Type: TABLE; Schema: public; Owner: postgres
 --
 
-ALTER TABLE ONLY public.room_restrictions
-    ADD CONSTRAINT room_restrictions_reservations_id_fk FOREIGN KEY (reservation_id) REFERENCES public.reservations(id) ON UPDATE CASCADE ON DELETE CASCADE;
+CREATE TABLE public.room_restrictions (
+    id integer NOT NULL,
+    start_date date NOT NULL,
+    end_date date NOT NULL,
+    room_id integer NOT NULL,
+    reservation_id integer,
+    restriction_id integer NOT NULL,
+    created_at timestamp without time zone NOT NULL,
+    updated_at timestamp without time zone NOT NULL,
+    expires_at timestamp without time zone
+);
+
 
+ALTER TABLE public.room_restrictions OWNER TO postgres;
 
 --
--- Name: room_restrictions room_restrictions_restrictions_id_fk; Type: FK CONSTRAINT; Schema: public; Owner: postgres
+-- Name: room_restrictions_id_seq; Type: SEQUENCE; Schema: public; Owner: postgres
 --
 
-ALTER TABLE ONLY public.room_restrictions
-    ADD CONSTRAINT room_restrictions_restrictions_id_fk FOREIGN KEY (restriction_id) REFERENCES public.restrictions(id) ON UPDATE CASCADE ON DELETE CASCADE;
+CREATE SEQUENCE public.room_restrictions_id_seq
+    AS integer
+    START WITH 1
+    INCREMENT BY 1
+    NO MINVALUE
+    NO MAXVALUE
+    CACHE 1;
+
+
+ALTER TABLE public.room_restrictions_id_seq OWNER TO postgres;
+
+--
+-- Name: room_restrictions_id_seq; Type: SEQUENCE OWNED BY; Schema: public; Owner: postgres
+--
+
+ALTER SEQUENCE public.room_restrictions_id_seq OWNED BY public.room_restrictions.id;
+
+
+--
+-- Name: rooms; Type: TABLE; Schema: public; Owner: postgres
+--
+
+CREATE TABLE public.rooms (
+    id integer NOT NULL,
+    room_name character varying(255) DEFAULT ''::character varying NOT NULL,
+    created_at timestamp without time zone NOT NULL,
+    updated_at timestamp without time zone NOT NULL,
+    nightly_rate integer DEFAULT 0 NOT NULL,
+    cancellation_policy character varying(255) DEFAULT 'flexible:1=100'::character varying NOT NULL
+);
+
+
+ALTER TABLE public.rooms OWNER TO postgres;
+
+--
+-- Name: rooms_id_seq; Type: SEQUENCE; Schema: public; Owner: postgres
+--
+
+CREATE SEQUENCE public.rooms_id_seq
+    AS integer
+    START WITH 1
+    INCREMENT BY 1
+    NO MINVALUE
+    NO MAXVALUE
+    CACHE 1;
+
+
+ALTER TABLE public.rooms_id_seq OWNER TO postgres;
+
+--
+-- Name: rooms_id_seq; Type: SEQUENCE OWNED BY; Schema: public; Owner: postgres
+--
+
+ALTER SEQUENCE public.rooms_id_seq OWNED BY public.rooms.id;
+
+
+--
+-- Name: schema_migrations; Type: TABLE; Schema: public; Owner: postgres
+--
+
+CREATE TABLE public.schema_migrations (
+    version character varying(14) NOT NULL,
+    applied_at timestamp without time zone DEFAULT now() NOT NULL
+);
+
+
+ALTER TABLE public.schema_migrations OWNER TO postgres;
+
+--
+-- Name: sessions; Type: TABLE; Schema: public; Owner: postgres
+--
+
+CREATE TABLE public.sessions (
+    token text NOT NULL,
+    data bytea NOT NULL,
+    expiry timestamp with time zone NOT NULL
+);
+
+
+ALTER TABLE public.sessions OWNER TO postgres;
+
+
+--
+-- Name: tax_rules; Type: TABLE; Schema: public; Owner: postgres
+--
+
+CREATE TABLE public.tax_rules (
+    id integer NOT NULL,
+    name character varying(255) NOT NULL,
+    kind character varying(255) NOT NULL,
+    method character varying(255) NOT NULL,
+    basis character varying(255) NOT NULL,
+    amount integer NOT NULL,
+    currency character varying(3) DEFAULT ''::character varying NOT NULL,
+    valid_from date,
+    valid_until date,
+    created_at timestamp without time zone NOT NULL,
+    updated_at timestamp without time zone NOT NULL
+);
+
+
+ALTER TABLE public.tax_rules OWNER TO postgres;
+
+
+--
+-- Name: tax_rules_id_seq; Type: SEQUENCE; Schema: public; Owner: postgres
+--
+
+CREATE SEQUENCE public.tax_rules_id_seq
+    AS integer
+    START WITH 1
+    INCREMENT BY 1
+    NO MINVALUE
+    NO MAXVALUE
+    CACHE 1;
+
+
+ALTER TABLE public.tax_rules_id_seq OWNER TO postgres;
+
+
+--
+-- Name: tax_rules_id_seq; Type: SEQUENCE OWNED BY; Schema: public; Owner: postgres
+--
+
+ALTER SEQUENCE public.tax_rules_id_seq OWNED BY public.tax_rules.id;
+
+
+--
+-- Name: users; Type: TABLE; Schema: public; Owner: postgres
+--
+
+CREATE TABLE public.users (
+    id integer NOT NULL,
+    first_name character varying(255) DEFAULT ''::character varying NOT NULL,
+    last_name character varying(255) DEFAULT ''::character varying NOT NULL,
+    email character varying(255) NOT NULL,
+    password character varying(60) NOT NULL,
+    access_level integer DEFAULT 1 NOT NULL,
+    created_at timestamp without time zone NOT NULL,
+    updated_at timestamp without time zone NOT NULL,
+    disabled_at timestamp without time zone
+);
+
+
+ALTER TABLE public.users OWNER TO postgres;
+
+--
+-- Name: users_id_seq; Type: SEQUENCE; Schema: public; Owner: postgres
+--
+
+CREATE SEQUENCE public.users_id_seq
+    AS integer
+    START WITH 1
+    INCREMENT BY 1
+    NO MINVALUE
+    NO MAXVALUE
+    CACHE 1;
+
+
+ALTER TABLE public.users_id_seq OWNER TO postgres;
+
+--
+-- Name: users_id_seq; Type: SEQUENCE OWNED BY; Schema: public; Owner: postgres
+--
+
+ALTER SEQUENCE public.users_id_seq OWNED BY public.users.id;
+
+
+--
+-- Name: waitlist; Type: TABLE; Schema: public; Owner: postgres
+--
+
+CREATE TABLE public.waitlist (
+    id integer NOT NULL,
+    first_name character varying(255) DEFAULT ''::character varying NOT NULL,
+    email character varying(255) NOT NULL,
+    room_id integer,
+    start_date date NOT NULL,
+    end_date date NOT NULL,
+    token character varying(255),
+    token_expires_at timestamp without time zone,
+    notified_at timestamp without time zone,
+    created_at timestamp without time zone NOT NULL,
+    updated_at timestamp without time zone NOT NULL,
+    offered_room_id integer
+);
+
+
+ALTER TABLE public.waitlist OWNER TO postgres;
+
+
+--
+-- Name: waitlist_id_seq; Type: SEQUENCE; Schema: public; Owner: postgres
+--
+
+CREATE SEQUENCE public.waitlist_id_seq
+    AS integer
+    START WITH 1
+    INCREMENT BY 1
+    NO MINVALUE
+    NO MAXVALUE
+    CACHE 1;
+
+
+ALTER TABLE public.waitlist_id_seq OWNER TO postgres;
+
+
+--
+-- Name: waitlist_id_seq; Type: SEQUENCE OWNED BY; Schema: public; Owner: postgres
+--
+
+ALTER SEQUENCE public.waitlist_id_seq OWNED BY public.waitlist.id;
+
+
+--
+-- Name: cancellations id; Type: DEFAULT; Schema: public; Owner: postgres
+--
+
+ALTER TABLE ONLY public.cancellations ALTER COLUMN id SET DEFAULT nextval('public.cancellations_id_seq'::regclass);
+
+
+--
+-- Name: guests id; Type: DEFAULT; Schema: public; Owner: postgres
+--
+
+ALTER TABLE ONLY public.guests ALTER COLUMN id SET DEFAULT nextval('public.guests_id_seq'::regclass);
+
+
+--
+-- Name: invoices id; Type: DEFAULT; Schema: public; Owner: postgres
+--
+
+ALTER TABLE ONLY public.invoices ALTER COLUMN id SET DEFAULT nextval('public.invoices_id_seq'::regclass);
+
+
+--
+-- Name: payments id; Type: DEFAULT; Schema: public; Owner: postgres
+--
+
+ALTER TABLE ONLY public.payments ALTER COLUMN id SET DEFAULT nextval('public.payments_id_seq'::regclass);
+
+
+--
+-- Name: promotion_redemptions id; Type: DEFAULT; Schema: public; Owner: postgres
+--
+
+ALTER TABLE ONLY public.promotion_redemptions ALTER COLUMN id SET DEFAULT nextval('public.promotion_redemptions_id_seq'::regclass);
+
+
+--
+-- Name: promotion_rooms id; Type: DEFAULT; Schema: public; Owner: postgres
+--
+
+ALTER TABLE ONLY public.promotion_rooms ALTER COLUMN id SET DEFAULT nextval('public.promotion_rooms_id_seq'::regclass);
+
+
+--
+-- Name: promotions id; Type: DEFAULT; Schema: public; Owner: postgres
+--
+
+ALTER TABLE ONLY public.promotions ALTER COLUMN id SET DEFAULT nextval('public.promotions_id_seq'::regclass);
+
+
+--
+-- Name: reservation_charges id; Type: DEFAULT; Schema: public; Owner: postgres
+--
+
+ALTER TABLE ONLY public.reservation_charges ALTER COLUMN id SET DEFAULT nextval('public.reservation_charges_id_seq'::regclass);
+
+
+--
+-- Name: reservation_notes id; Type: DEFAULT; Schema: public; Owner: postgres
+--
+
+ALTER TABLE ONLY public.reservation_notes ALTER COLUMN id SET DEFAULT nextval('public.reservation_notes_id_seq'::regclass);
+
+
+--
+-- Name: reservations id; Type: DEFAULT; Schema: public; Owner: postgres
+--
+
+ALTER TABLE ONLY public.reservations ALTER COLUMN id SET DEFAULT nextval('public.reservations_id_seq'::regclass);
+
+
+--
+-- Name: restrictions id; Type: DEFAULT; Schema: public; Owner: postgres
+--
+
+ALTER TABLE ONLY public.restrictions ALTER COLUMN id SET DEFAULT nextval('public.restrictions_id_seq'::regclass);
+
+
+--
+-- Name: room_restrictions id; Type: DEFAULT; Schema: public; Owner: postgres
+--
+
+ALTER TABLE ONLY public.room_restrictions ALTER COLUMN id SET DEFAULT nextval('public.room_restrictions_id_seq'::regclass);
+
+
+--
+-- Name: rooms id; Type: DEFAULT; Schema: public; Owner: postgres
+--
+
+ALTER TABLE ONLY public.rooms ALTER COLUMN id SET DEFAULT nextval('public.rooms_id_seq'::regclass);
+
+
+--
+-- Name: tax_rules id; Type: DEFAULT; Schema: public; Owner: postgres
+--
+
+ALTER TABLE ONLY public.tax_rules ALTER COLUMN id SET DEFAULT nextval('public.tax_rules_id_seq'::regclass);
+
+
+--
+-- Name: users id; Type: DEFAULT; Schema: public; Owner: postgres
+--
+
+ALTER TABLE ONLY public.users ALTER COLUMN id SET DEFAULT nextval('public.users_id_seq'::regclass);
+
+
+--
+-- Name: waitlist id; Type: DEFAULT; Schema: public; Owner: postgres
+--
+
+ALTER TABLE ONLY public.waitlist ALTER COLUMN id SET DEFAULT nextval('public.waitlist_id_seq'::regclass);
+
+
+--
+-- Name: cancellations cancellations_pkey; Type: CONSTRAINT; Schema: public; Owner: postgres
+--
+
+ALTER TABLE ONLY public.cancellations
+    ADD CONSTRAINT cancellations_pkey PRIMARY KEY (id);
+
+
+--
+-- Name: guests guests_pkey; Type: CONSTRAINT; Schema: public; Owner: postgres
+--
+
+ALTER TABLE ONLY public.guests
+    ADD CONSTRAINT guests_pkey PRIMARY KEY (id);
+
+
+--
+-- Name: invoices invoices_pkey; Type: CONSTRAINT; Schema: public; Owner: postgres
+--
+
+ALTER TABLE ONLY public.invoices
+    ADD CONSTRAINT invoices_pkey PRIMARY KEY (id);
+
+
+--
+-- Name: payments payments_pkey; Type: CONSTRAINT; Schema: public; Owner: postgres
+--
+
+ALTER TABLE ONLY public.payments
+    ADD CONSTRAINT payments_pkey PRIMARY KEY (id);
+
+
+--
+-- Name: promotion_redemptions promotion_redemptions_pkey; Type: CONSTRAINT; Schema: public; Owner: postgres
+--
+
+ALTER TABLE ONLY public.promotion_redemptions
+    ADD CONSTRAINT promotion_redemptions_pkey PRIMARY KEY (id);
+
+
+--
+-- Name: promotion_rooms promotion_rooms_pkey; Type: CONSTRAINT; Schema: public; Owner: postgres
+--
+
+ALTER TABLE ONLY public.promotion_rooms
+    ADD CONSTRAINT promotion_rooms_pkey PRIMARY KEY (id);
+
+
+--
+-- Name: promotions promotions_pkey; Type: CONSTRAINT; Schema: public; Owner: postgres
+--
+
+ALTER TABLE ONLY public.promotions
+    ADD CONSTRAINT promotions_pkey PRIMARY KEY (id);
+
+
+--
+-- Name: property property_pkey; Type: CONSTRAINT; Schema: public; Owner: postgres
+--
+
+ALTER TABLE ONLY public.property
+    ADD CONSTRAINT property_pkey PRIMARY KEY (id);
+
+
+--
+-- Name: reservation_charges reservation_charges_pkey; Type: CONSTRAINT; Schema: public; Owner: postgres
+--
+
+ALTER TABLE ONLY public.reservation_charges
+    ADD CONSTRAINT reservation_charges_pkey PRIMARY KEY (id);
+
+
+--
+-- Name: reservation_notes reservation_notes_pkey; Type: CONSTRAINT; Schema: public; Owner: postgres
+--
+
+ALTER TABLE ONLY public.reservation_notes
+    ADD CONSTRAINT reservation_notes_pkey PRIMARY KEY (id);
+
+
+--
+-- Name: reservations reservations_pkey; Type: CONSTRAINT; Schema: public; Owner: postgres
+--
+
+ALTER TABLE ONLY public.reservations
+    ADD CONSTRAINT reservations_pkey PRIMARY KEY (id);
+
+
+--
+-- Name: restrictions restrictions_pkey; Type: CONSTRAINT; Schema: public; Owner: postgres
+--
+
+ALTER TABLE ONLY public.restrictions
+    ADD CONSTRAINT restrictions_pkey PRIMARY KEY (id);
+
+
+--
+-- Name: room_restrictions room_restrictions_pkey; Type: CONSTRAINT; Schema: public; Owner: postgres
+--
+
+ALTER TABLE ONLY public.room_restrictions
+    ADD CONSTRAINT room_restrictions_pkey PRIMARY KEY (id);
+
+
+--
+-- Name: rooms rooms_pkey; Type: CONSTRAINT; Schema: public; Owner: postgres
+--
+
+ALTER TABLE ONLY public.rooms
+    ADD CONSTRAINT rooms_pkey PRIMARY KEY (id);
+
+
+--
+-- Name: schema_migrations schema_migrations_pkey; Type: CONSTRAINT; Schema: public; Owner: postgres
+--
+
+ALTER TABLE ONLY public.schema_migrations
+    ADD CONSTRAINT schema_migrations_pkey PRIMARY KEY (version);
+
+
+--
+-- Name: sessions sessions_pkey; Type: CONSTRAINT; Schema: public; Owner: postgres
+--
+
+ALTER TABLE ONLY public.sessions
+    ADD CONSTRAINT sessions_pkey PRIMARY KEY (token);
+
+
+--
+-- Name: tax_rules tax_rules_pkey; Type: CONSTRAINT; Schema: public; Owner: postgres
+--
+
+ALTER TABLE ONLY public.tax_rules
+    ADD CONSTRAINT tax_rules_pkey PRIMARY KEY (id);
+
+
+--
+-- Name: users users_pkey; Type: CONSTRAINT; Schema: public; Owner: postgres
+--
+
+ALTER TABLE ONLY public.users
+    ADD CONSTRAINT users_pkey PRIMARY KEY (id);
+
+
+--
+-- Name: waitlist waitlist_pkey; Type: CONSTRAINT; Schema: public; Owner: postgres
+--
+
+ALTER TABLE ONLY public.waitlist
+    ADD CONSTRAINT waitlist_pkey PRIMARY KEY (id);
+
+
+--
+-- Name: cancellations_created_at_idx; Type: INDEX; Schema: public; Owner: postgres
+--
+
+CREATE INDEX cancellations_created_at_idx ON public.cancellations USING btree (created_at);
+
+
+--
+-- Name: cancellations_guest_id_idx; Type: INDEX; Schema: public; Owner: postgres
+--
+
+CREATE INDEX cancellations_guest_id_idx ON public.cancellations USING btree (guest_id);
+
+
+--
+-- Name: guests_last_name_first_name_idx; Type: INDEX; Schema: public; Owner: postgres
+--
+
+CREATE INDEX guests_last_name_first_name_idx ON public.guests USING btree (last_name, first_name);
+
+
+--
+-- Name: guests_lower_email_idx; Type: INDEX; Schema: public; Owner: postgres
+--
+
+CREATE UNIQUE INDEX guests_lower_email_idx ON public.guests USING btree (lower((email)::text));
+
+
+--
+-- Name: invoices_number_idx; Type: INDEX; Schema: public; Owner: postgres
+--
+
+CREATE UNIQUE INDEX invoices_number_idx ON public.invoices USING btree (number);
+
+
+--
+-- Name: invoices_reservation_id_idx; Type: INDEX; Schema: public; Owner: postgres
+--
+
+CREATE UNIQUE INDEX invoices_reservation_id_idx ON public.invoices USING btree (reservation_id);
+
+
+--
+-- Name: payments_provider_ref_idx; Type: INDEX; Schema: public; Owner: postgres
+--
+
+CREATE INDEX payments_provider_ref_idx ON public.payments USING btree (provider_ref);
+
+
+--
+-- Name: payments_reservation_id_idx; Type: INDEX; Schema: public; Owner: postgres
+--
+
+CREATE INDEX payments_reservation_id_idx ON public.payments USING btree (reservation_id);
+
+
+--
+-- Name: promotion_redemptions_guest_id_idx; Type: INDEX; Schema: public; Owner: postgres
+--
+
+CREATE INDEX promotion_redemptions_guest_id_idx ON public.promotion_redemptions USING btree (guest_id);
+
+
+--
+-- Name: promotion_redemptions_promotion_id_idx; Type: INDEX; Schema: public; Owner: postgres
+--
+
+CREATE INDEX promotion_redemptions_promotion_id_idx ON public.promotion_redemptions USING btree (promotion_id);
+
+
+--
+-- Name: promotion_rooms_promotion_id_room_id_idx; Type: INDEX; Schema: public; Owner: postgres
+--
+
+CREATE UNIQUE INDEX promotion_rooms_promotion_id_room_id_idx ON public.promotion_rooms USING btree (promotion_id, room_id);
+
+
+--
+-- Name: promotions_code_idx; Type: INDEX; Schema: public; Owner: postgres
+--
+
+CREATE UNIQUE INDEX promotions_code_idx ON public.promotions USING btree (code);
+
+
+--
+-- Name: reservation_charges_reservation_id_idx; Type: INDEX; Schema: public; Owner: postgres
+--
+
+CREATE INDEX reservation_charges_reservation_id_idx ON public.reservation_charges USING btree (reservation_id);
+
+
+--
+-- Name: reservation_notes_reservation_id_idx; Type: INDEX; Schema: public; Owner: postgres
+--
+
+CREATE INDEX reservation_notes_reservation_id_idx ON public.reservation_notes USING btree (reservation_id);
+
+
+--
+-- Name: reservations_email_idx; Type: INDEX; Schema: public; Owner: postgres
+--
+
+CREATE INDEX reservations_email_idx ON public.reservations USING btree (email);
+
+
+--
+-- Name: reservations_guest_id_idx; Type: INDEX; Schema: public; Owner: postgres
+--
+
+CREATE INDEX reservations_guest_id_idx ON public.reservations USING btree (guest_id);
+
+
+--
+-- Name: reservations_last_name_idx; Type: INDEX; Schema: public; Owner: postgres
+--
+
+CREATE INDEX reservations_last_name_idx ON public.reservations USING btree (last_name);
+
+
+--
+-- Name: room_restrictions_reservation_id_idx; Type: INDEX; Schema: public; Owner: postgres
+--
+
+CREATE INDEX room_restrictions_reservation_id_idx ON public.room_restrictions USING btree (reservation_id);
+
+
+--
+-- Name: room_restrictions_room_id_idx; Type: INDEX; Schema: public; Owner: postgres
+--
+
+CREATE INDEX room_restrictions_room_id_idx ON public.room_restrictions USING btree (room_id);
+
+
+--
+-- Name: room_restrictions_start_date_end_date_idx; Type: INDEX; Schema: public; Owner: postgres
+--
+
+CREATE INDEX room_restrictions_start_date_end_date_idx ON public.room_restrictions USING btree (start_date, end_date);
+
+
+--
+-- Name: sessions_expiry_idx; Type: INDEX; Schema: public; Owner: postgres
+--
+
+CREATE INDEX sessions_expiry_idx ON public.sessions USING btree (expiry);
+
+
+--
+-- Name: users_email_idx; Type: INDEX; Schema: public; Owner: postgres
+--
+
+CREATE UNIQUE INDEX users_email_idx ON public.users USING btree (email);
+
+
+--
+-- Name: waitlist_start_date_end_date_idx; Type: INDEX; Schema: public; Owner: postgres
+--
+
+CREATE INDEX waitlist_start_date_end_date_idx ON public.waitlist USING btree (start_date, end_date);
+
+
+--
+-- Name: waitlist_token_idx; Type: INDEX; Schema: public; Owner: postgres
+--
+
+CREATE UNIQUE INDEX waitlist_token_idx ON public.waitlist USING btree (token);
+
+
+--
+-- Name: cancellations cancellations_guests_id_fk; Type: FK CONSTRAINT; Schema: public; Owner: postgres
+--
+
+ALTER TABLE ONLY public.cancellations
+    ADD CONSTRAINT cancellations_guests_id_fk FOREIGN KEY (guest_id) REFERENCES public.guests(id) ON UPDATE CASCADE ON DELETE SET NULL;
+
+
+--
+-- Name: cancellations cancellations_rooms_id_fk; Type: FK CONSTRAINT; Schema: public; Owner: postgres
+--
+
+ALTER TABLE ONLY public.cancellations
+    ADD CONSTRAINT cancellations_rooms_id_fk FOREIGN KEY (room_id) REFERENCES public.rooms(id) ON UPDATE CASCADE ON DELETE CASCADE;
+
+
+--
+-- Name: promotion_redemptions promotion_redemptions_guests_id_fk; Type: FK CONSTRAINT; Schema: public; Owner: postgres
+--
+
+ALTER TABLE ONLY public.promotion_redemptions
+    ADD CONSTRAINT promotion_redemptions_guests_id_fk FOREIGN KEY (guest_id) REFERENCES public.guests(id) ON UPDATE CASCADE ON DELETE SET NULL;
+
+
+--
+-- Name: promotion_redemptions promotion_redemptions_promotions_id_fk; Type: FK CONSTRAINT; Schema: public; Owner: postgres
+--
+
+ALTER TABLE ONLY public.promotion_redemptions
+    ADD CONSTRAINT promotion_redemptions_promotions_id_fk FOREIGN KEY (promotion_id) REFERENCES public.promotions(id) ON UPDATE CASCADE ON DELETE SET NULL;
+
+
+--
+-- Name: promotion_redemptions promotion_redemptions_reservations_id_fk; Type: FK CONSTRAINT; Schema: public; Owner: postgres
+--
+
+ALTER TABLE ONLY public.promotion_redemptions
+    ADD CONSTRAINT promotion_redemptions_reservations_id_fk FOREIGN KEY (reservation_id) REFERENCES public.reservations(id) ON UPDATE CASCADE ON DELETE SET NULL;
+
+
+--
+-- Name: promotion_rooms promotion_rooms_promotions_id_fk; Type: FK CONSTRAINT; Schema: public; Owner: postgres
+--
+
+ALTER TABLE ONLY public.promotion_rooms
+    ADD CONSTRAINT promotion_rooms_promotions_id_fk FOREIGN KEY (promotion_id) REFERENCES public.promotions(id) ON UPDATE CASCADE ON DELETE CASCADE;
+
+
+--
+-- Name: promotion_rooms promotion_rooms_rooms_id_fk; Type: FK CONSTRAINT; Schema: public; Owner: postgres
+--
+
+ALTER TABLE ONLY public.promotion_rooms
+    ADD CONSTRAINT promotion_rooms_rooms_id_fk FOREIGN KEY (room_id) REFERENCES public.rooms(id) ON UPDATE CASCADE ON DELETE CASCADE;
+
+
+--
+-- Name: reservation_charges reservation_charges_reservations_id_fk; Type: FK CONSTRAINT; Schema: public; Owner: postgres
+--
+
+ALTER TABLE ONLY public.reservation_charges
+    ADD CONSTRAINT reservation_charges_reservations_id_fk FOREIGN KEY (reservation_id) REFERENCES public.reservations(id) ON UPDATE CASCADE ON DELETE CASCADE;
+
+
+--
+-- Name: reservation_charges reservation_charges_tax_rules_id_fk; Type: FK CONSTRAINT; Schema: public; Owner: postgres
+--
+
+ALTER TABLE ONLY public.reservation_charges
+    ADD CONSTRAINT reservation_charges_tax_rules_id_fk FOREIGN KEY (tax_rule_id) REFERENCES public.tax_rules(id) ON UPDATE CASCADE ON DELETE SET NULL;
+
+
+--
+-- Name: reservation_notes reservation_notes_reservation_notes_id_fk; Type: FK CONSTRAINT; Schema: public; Owner: postgres
+--
+
+ALTER TABLE ONLY public.reservation_notes
+    ADD CONSTRAINT reservation_notes_reservation_notes_id_fk FOREIGN KEY (parent_id) REFERENCES public.reservation_notes(id) ON UPDATE CASCADE ON DELETE CASCADE;
+
+
+--
+-- Name: reservation_notes reservation_notes_reservations_id_fk; Type: FK CONSTRAINT; Schema: public; Owner: postgres
+--
+
+ALTER TABLE ONLY public.reservation_notes
+    ADD CONSTRAINT reservation_notes_reservations_id_fk FOREIGN KEY (reservation_id) REFERENCES public.reservations(id) ON UPDATE CASCADE ON DELETE CASCADE;
+
+
+--
+-- Name: reservation_notes reservation_notes_users_id_fk; Type: FK CONSTRAINT; Schema: public; Owner: postgres
+--
+
+ALTER TABLE ONLY public.reservation_notes
+    ADD CONSTRAINT reservation_notes_users_id_fk FOREIGN KEY (user_id) REFERENCES public.users(id) ON UPDATE CASCADE ON DELETE SET NULL;
+
+
+--
+-- Name: reservations reservations_guests_id_fk; Type: FK CONSTRAINT; Schema: public; Owner: postgres
+--
+
+ALTER TABLE ONLY public.reservations
+    ADD CONSTRAINT reservations_guests_id_fk FOREIGN KEY (guest_id) REFERENCES public.guests(id) ON UPDATE CASCADE ON DELETE SET NULL;
+
+
+--
+-- Name: reservations reservations_rooms_id_fk; Type: FK CONSTRAINT; Schema: public; Owner: postgres
+--
+
+ALTER TABLE ONLY public.reservations
+    ADD CONSTRAINT reservations_rooms_id_fk FOREIGN KEY (room_id) REFERENCES public.rooms(id) ON UPDATE CASCADE ON DELETE CASCADE;
+
+
+--
+-- Name: room_restrictions room_restrictions_reservations_id_fk; Type: FK CONSTRAINT; Schema: public; Owner: postgres
+--
+
+ALTER TABLE ONLY public.room_restrictions
+    ADD CONSTRAINT room_restrictions_reservations_id_fk FOREIGN KEY (reservation_id) REFERENCES public.reservations(id) ON UPDATE CASCADE ON DELETE CASCADE;
+
+
+--
+-- Name: room_restrictions room_restrictions_restrictions_id_fk; Type: FK CONSTRAINT; Schema: public; Owner: postgres
+--
+
+ALTER TABLE ONLY public.room_restrictions
+    ADD CONSTRAINT room_restrictions_restrictions_id_fk FOREIGN KEY (restriction_id) REFERENCES public.restrictions(id) ON UPDATE CASCADE ON DELETE CASCADE;
 
 
 --
@@ -390,6 +1327,22 @@ ALTER TABLE ONLY public.room_restrictions
     ADD CONSTRAINT room_restrictions_rooms_id_fk FOREIGN KEY (room_id) REFERENCES public.rooms(id) ON UPDATE CASCADE ON DELETE CASCADE;
 
 
+--
+-- Name: waitlist waitlist_offered_room_id_fk; Type: FK CONSTRAINT; Schema: public; Owner: postgres
+--
+
+ALTER TABLE ONLY public.waitlist
+    ADD CONSTRAINT waitlist_offered_room_id_fk FOREIGN KEY (offered_room_id) REFERENCES public.rooms(id) ON UPDATE CASCADE ON DELETE SET NULL;
+
+
+--
+-- Name: waitlist waitlist_rooms_id_fk; Type: FK CONSTRAINT; Schema: public; Owner: postgres
+--
+
+ALTER TABLE ONLY public.waitlist
+    ADD CONSTRAINT waitlist_rooms_id_fk FOREIGN KEY (room_id) REFERENCES public.rooms(id) ON UPDATE CASCADE ON DELETE CASCADE;
+
+
 --
 -- PostgreSQL database dump complete
 --